@@ -0,0 +1,202 @@
+// Package archive verifies and reads the zip archives produced by the Account-Export API.
+package archive
+
+import (
+	"archive/zip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// ManifestSuffix is appended to the archive path to name its sidecar manifest
+const ManifestSuffix string = ".manifest.json"
+
+// Entry describes a file contained in an export archive
+type Entry struct {
+	Name   string `json:"name"`
+	Size   uint64 `json:"size"`
+	CRC32  string `json:"crc32"`
+	SHA256 string `json:"sha256"`
+}
+
+// Manifest describes a verified export archive and its contents. The manifest of an encrypted archive
+// describes the encrypted file and lists no entries.
+type Manifest struct {
+	Archive   string    `json:"archive"`
+	Size      int64     `json:"size"`
+	SHA256    string    `json:"sha256"`
+	CAID      int64     `json:"caid,omitempty"`
+	Handler   string    `json:"handler,omitempty"`
+	Resource  string    `json:"resource,omitempty"`
+	Encrypted bool      `json:"encrypted,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	Entries   []Entry   `json:"entries"`
+}
+
+// Verify checks that the file at path is a valid zip archive by reading every entry, which
+// verifies its CRC-32 checksum, and returns a manifest with the SHA-256 of the archive and its files.
+func Verify(path string) (*Manifest, error) {
+	file, err := os.Open(path) // #nosec G304 -- Callers pass paths they created or validated
+	if err != nil {
+		return nil, fmt.Errorf("failed to open archive: %w", err)
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("failed to stat archive: %w", err)
+	}
+
+	manifest, err := VerifyReader(file, info.Size())
+	if err != nil {
+		return nil, err
+	}
+	manifest.Archive = filepath.Base(path)
+	return manifest, nil
+}
+
+// VerifyReader is Verify for an archive of size bytes read from r, e.g. an archive decrypted into memory.
+// The Archive of the manifest is left empty.
+func VerifyReader(r io.ReaderAt, size int64) (*Manifest, error) {
+	archiveHash := sha256.New()
+	if _, err := io.Copy(archiveHash, io.NewSectionReader(r, 0, size)); err != nil {
+		return nil, fmt.Errorf("failed to hash archive: %w", err)
+	}
+
+	reader, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, fmt.Errorf("not a valid zip archive: %w", err)
+	}
+
+	manifest := &Manifest{
+		Size:      size,
+		SHA256:    hex.EncodeToString(archiveHash.Sum(nil)),
+		CreatedAt: time.Now().UTC(),
+		Entries:   make([]Entry, 0, len(reader.File)),
+	}
+	for _, f := range reader.File {
+		if f.FileInfo().IsDir() {
+			continue
+		}
+		entry, err := verifyEntry(f)
+		if err != nil {
+			return nil, err
+		}
+		manifest.Entries = append(manifest.Entries, entry)
+	}
+
+	return manifest, nil
+}
+
+// verifyEntry reads an archive entry completely so the zip reader checks its CRC-32
+func verifyEntry(f *zip.File) (Entry, error) {
+	rc, err := f.Open()
+	if err != nil {
+		return Entry{}, fmt.Errorf("failed to open archive entry %s: %w", f.Name, err)
+	}
+	defer rc.Close()
+
+	hash := sha256.New()
+	n, err := io.Copy(hash, rc)
+	if err != nil {
+		if errors.Is(err, zip.ErrChecksum) {
+			return Entry{}, fmt.Errorf("checksum mismatch in archive entry %s", f.Name)
+		}
+		return Entry{}, fmt.Errorf("failed to read archive entry %s: %w", f.Name, err)
+	}
+	if uint64(n) != f.UncompressedSize64 {
+		return Entry{}, fmt.Errorf("size mismatch in archive entry %s: read %d of %d bytes", f.Name, n, f.UncompressedSize64)
+	}
+
+	return Entry{
+		Name:   f.Name,
+		Size:   f.UncompressedSize64,
+		CRC32:  fmt.Sprintf("%08x", f.CRC32),
+		SHA256: hex.EncodeToString(hash.Sum(nil)),
+	}, nil
+}
+
+// EncodeManifest returns the manifest as the JSON of a sidecar file
+func EncodeManifest(manifest *Manifest) ([]byte, error) {
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode manifest: %w", err)
+	}
+	return append(data, '\n'), nil
+}
+
+// WriteManifest writes the manifest as JSON to the sidecar file of the archive at archivePath
+func WriteManifest(archivePath string, manifest *Manifest) error {
+	data, err := EncodeManifest(manifest)
+	if err != nil {
+		return err
+	}
+	manifestPath := archivePath + ManifestSuffix
+	tempPath := manifestPath + ".tmp"
+	if err := os.WriteFile(tempPath, data, 0600); err != nil {
+		return fmt.Errorf("failed to write manifest: %w", err)
+	}
+	if err := os.Rename(tempPath, manifestPath); err != nil {
+		_ = os.Remove(tempPath)
+		return fmt.Errorf("failed to rename manifest: %w", err)
+	}
+	return nil
+}
+
+// MaxFileSize is the largest archive entry ReadFiles reads into memory
+const MaxFileSize int64 = 64 << 20
+
+// ReadFiles calls fn with the name and content of every file in the archive at path for which
+// match returns true, in archive order. Entries larger than MaxFileSize are rejected.
+func ReadFiles(path string, match func(name string) bool, fn func(name string, data []byte) error) error {
+	reader, err := zip.OpenReader(path)
+	if err != nil {
+		return fmt.Errorf("failed to open archive %s: %w", path, err)
+	}
+	defer reader.Close()
+	return ReadZipFiles(&reader.Reader, match, fn)
+}
+
+// ReadZipFiles is ReadFiles for an opened archive
+func ReadZipFiles(reader *zip.Reader, match func(name string) bool, fn func(name string, data []byte) error) error {
+	for _, f := range reader.File {
+		if f.FileInfo().IsDir() || !match(f.Name) {
+			continue
+		}
+		if f.UncompressedSize64 > uint64(MaxFileSize) {
+			return fmt.Errorf("archive entry %s is too large (%d bytes)", f.Name, f.UncompressedSize64)
+		}
+		data, err := ReadEntry(f)
+		if err != nil {
+			return err
+		}
+		if err := fn(f.Name, data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ReadEntry reads an archive entry, never reading more than MaxFileSize bytes
+func ReadEntry(f *zip.File) ([]byte, error) {
+	rc, err := f.Open()
+	if err != nil {
+		return nil, fmt.Errorf("failed to open archive entry %s: %w", f.Name, err)
+	}
+	defer rc.Close()
+
+	data, err := io.ReadAll(io.LimitReader(rc, MaxFileSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read archive entry %s: %w", f.Name, err)
+	}
+	if int64(len(data)) > MaxFileSize {
+		return nil, fmt.Errorf("archive entry %s is too large", f.Name)
+	}
+	return data, nil
+}
@@ -0,0 +1,140 @@
+package archive
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// buildZip returns a zip archive with the given files, stored uncompressed so tests can corrupt them
+func buildZip(t *testing.T, files map[string]string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for name, content := range files {
+		w, err := zw.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Store})
+		if err != nil {
+			t.Fatalf("failed to create zip entry: %v", err)
+		}
+		if _, err := w.Write([]byte(content)); err != nil {
+			t.Fatalf("failed to write zip entry: %v", err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatalf("failed to close zip: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func writeFile(t *testing.T, data []byte) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "export.zip")
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+	return path
+}
+
+func TestVerify(t *testing.T) {
+	data := buildZip(t, map[string]string{"main.tf": `provider "incapsula" {}`})
+	path := writeFile(t, data)
+
+	manifest, err := Verify(path)
+	if err != nil {
+		t.Fatalf("Verify() error = %v", err)
+	}
+
+	archiveSum := sha256.Sum256(data)
+	if manifest.SHA256 != hex.EncodeToString(archiveSum[:]) || manifest.Size != int64(len(data)) {
+		t.Errorf("unexpected archive hash or size: %+v", manifest)
+	}
+	if len(manifest.Entries) != 1 || manifest.Entries[0].Name != "main.tf" {
+		t.Fatalf("unexpected entries: %+v", manifest.Entries)
+	}
+	fileSum := sha256.Sum256([]byte(`provider "incapsula" {}`))
+	if manifest.Entries[0].SHA256 != hex.EncodeToString(fileSum[:]) {
+		t.Errorf("entry sha256 = %s, want %s", manifest.Entries[0].SHA256, hex.EncodeToString(fileSum[:]))
+	}
+}
+
+func TestVerify_Invalid(t *testing.T) {
+	valid := buildZip(t, map[string]string{"main.tf": `provider "incapsula" {}`})
+
+	corrupted := bytes.Clone(valid)
+	i := bytes.Index(corrupted, []byte("incapsula"))
+	corrupted[i] = 'X'
+
+	tests := []struct {
+		name    string
+		data    []byte
+		wantErr string
+	}{
+		{"html error page", []byte("<html><body>Service unavailable</body></html>"), "not a valid zip archive"},
+		{"truncated", valid[:len(valid)/2], "not a valid zip archive"},
+		{"checksum mismatch", corrupted, "checksum mismatch"},
+		{"empty", nil, "not a valid zip archive"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Verify(writeFile(t, tt.data))
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Verify() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestWriteManifest(t *testing.T) {
+	path := writeFile(t, buildZip(t, map[string]string{"main.tf": "", "sites.tf": "# sites"}))
+	manifest, err := Verify(path)
+	if err != nil {
+		t.Fatalf("Verify() error = %v", err)
+	}
+	manifest.CAID = 123456
+
+	if err := WriteManifest(path, manifest); err != nil {
+		t.Fatalf("WriteManifest() error = %v", err)
+	}
+
+	data, err := os.ReadFile(path + ManifestSuffix)
+	if err != nil {
+		t.Fatalf("failed to read manifest: %v", err)
+	}
+	var got Manifest
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatalf("failed to parse manifest: %v", err)
+	}
+	if got.CAID != 123456 || got.SHA256 != manifest.SHA256 || len(got.Entries) != 2 {
+		t.Errorf("unexpected manifest: %+v", got)
+	}
+}
+
+func TestReadFiles(t *testing.T) {
+	path := writeFile(t, buildZip(t, map[string]string{
+		"main.tf":   `provider "incapsula" {}`,
+		"README.md": "# export",
+	}))
+
+	got := map[string]string{}
+	err := ReadFiles(path, func(name string) bool { return strings.HasSuffix(name, ".tf") }, func(name string, data []byte) error {
+		got[name] = string(data)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("ReadFiles() error = %v", err)
+	}
+	if len(got) != 1 || got["main.tf"] != `provider "incapsula" {}` {
+		t.Errorf("ReadFiles() read %v", got)
+	}
+
+	if err := ReadFiles(writeFile(t, []byte("not a zip")), func(string) bool { return true }, nil); err == nil {
+		t.Error("ReadFiles() on invalid archive should fail")
+	}
+}
@@ -0,0 +1,255 @@
+package archive
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Permissions of extracted directories and files. The modes stored in the archive are ignored.
+const (
+	ExtractDirMode  os.FileMode = 0750
+	ExtractFileMode os.FileMode = 0640
+)
+
+// ExtractedManifestName is the name of the manifest ExtractZipWithManifest writes into the extracted directory
+const ExtractedManifestName string = ".export-manifest.json"
+
+// ExtractLimits bound what Extract unpacks, so a malicious archive cannot fill the disk
+type ExtractLimits struct {
+	// MaxFiles is the maximum number of files in the archive
+	MaxFiles int
+	// MaxFileSize is the maximum uncompressed size of a single file
+	MaxFileSize int64
+	// MaxTotalSize is the maximum uncompressed size of all files together
+	MaxTotalSize int64
+}
+
+// DefaultExtractLimits returns the limits used when none are configured
+func DefaultExtractLimits() ExtractLimits {
+	return ExtractLimits{
+		MaxFiles:     10000,
+		MaxFileSize:  MaxFileSize,
+		MaxTotalSize: 1 << 30,
+	}
+}
+
+// ExtractResult describes an extracted archive
+type ExtractResult struct {
+	Dir   string
+	Files int
+	Bytes int64
+}
+
+// Extract unpacks the archive at path into dir, which must not exist yet. The files are unpacked into a
+// staging directory next to dir that is renamed into place once every file was written, so dir is either
+// complete or missing. Entries that would be written outside dir, links and other special files are
+// rejected, and the limits are enforced on the bytes actually decompressed, not the sizes the archive claims.
+func Extract(path, dir string, limits ExtractLimits) (ExtractResult, error) {
+	reader, err := zip.OpenReader(path)
+	if err != nil {
+		return ExtractResult{}, fmt.Errorf("failed to open archive %s: %w", path, err)
+	}
+	defer reader.Close()
+	return ExtractZip(&reader.Reader, dir, limits)
+}
+
+// ExtractZip is Extract for an opened archive, e.g. an archive decrypted into memory
+func ExtractZip(reader *zip.Reader, dir string, limits ExtractLimits) (ExtractResult, error) {
+	return extractZip(reader, dir, limits, nil)
+}
+
+// ExtractZipWithManifest is ExtractZip that also writes the manifest of the archive into dir as
+// ExtractedManifestName. The manifest is written before dir is moved into place, so a directory with a
+// manifest is complete and records the archive it was extracted from.
+func ExtractZipWithManifest(reader *zip.Reader, dir string, limits ExtractLimits, manifest *Manifest) (ExtractResult, error) {
+	return extractZip(reader, dir, limits, manifest)
+}
+
+// ReadExtractedManifest returns the manifest of a directory extracted by ExtractZipWithManifest
+func ReadExtractedManifest(dir string) (*Manifest, error) {
+	data, err := os.ReadFile(filepath.Join(dir, ExtractedManifestName)) // #nosec G304 -- Callers pass directories they extracted
+	if err != nil {
+		return nil, fmt.Errorf("failed to read manifest of %s: %w", dir, err)
+	}
+	var manifest Manifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return nil, fmt.Errorf("invalid manifest of %s: %w", dir, err)
+	}
+	return &manifest, nil
+}
+
+func extractZip(reader *zip.Reader, dir string, limits ExtractLimits, manifest *Manifest) (ExtractResult, error) {
+	if limits.MaxFiles > 0 && len(reader.File) > limits.MaxFiles {
+		return ExtractResult{}, fmt.Errorf("archive has %d entries, more than the limit of %d", len(reader.File), limits.MaxFiles)
+	}
+	if _, err := os.Lstat(dir); err == nil {
+		return ExtractResult{}, fmt.Errorf("extract directory already exists: %s", dir)
+	}
+
+	parent := filepath.Dir(dir)
+	if err := os.MkdirAll(parent, ExtractDirMode); err != nil {
+		return ExtractResult{}, fmt.Errorf("failed to create directory %s: %w", parent, err)
+	}
+	staging, err := os.MkdirTemp(parent, "."+filepath.Base(dir)+"-")
+	if err != nil {
+		return ExtractResult{}, fmt.Errorf("failed to create staging directory: %w", err)
+	}
+	committed := false
+	defer func() {
+		if !committed {
+			_ = os.RemoveAll(staging)
+		}
+	}()
+	if err := os.Chmod(staging, ExtractDirMode); err != nil {
+		return ExtractResult{}, fmt.Errorf("failed to set permissions of staging directory: %w", err)
+	}
+
+	result := ExtractResult{Dir: dir}
+	for _, f := range reader.File {
+		target, err := entryPath(staging, f.Name)
+		if err != nil {
+			return ExtractResult{}, err
+		}
+
+		mode := f.Mode()
+		switch {
+		case mode.IsDir():
+			if err := os.MkdirAll(target, ExtractDirMode); err != nil {
+				return ExtractResult{}, fmt.Errorf("failed to create directory for entry %s: %w", f.Name, err)
+			}
+			continue
+		case !mode.IsRegular():
+			return ExtractResult{}, fmt.Errorf("archive entry %s is not a regular file (%s)", f.Name, mode.Type())
+		}
+
+		remaining := int64(-1)
+		if limits.MaxTotalSize > 0 {
+			remaining = limits.MaxTotalSize - result.Bytes
+		}
+		n, err := extractEntry(f, target, limits.MaxFileSize, remaining)
+		if err != nil {
+			return ExtractResult{}, err
+		}
+		result.Files++
+		result.Bytes += n
+	}
+	if manifest != nil {
+		if err := writeExtractedManifest(staging, manifest); err != nil {
+			return ExtractResult{}, err
+		}
+	}
+
+	if err := os.Rename(staging, dir); err != nil {
+		return ExtractResult{}, fmt.Errorf("failed to move extracted files to %s: %w", dir, err)
+	}
+	committed = true
+	return result, nil
+}
+
+// writeExtractedManifest writes the manifest into the staging directory. An archive entry of the same name
+// is rejected rather than overwritten.
+func writeExtractedManifest(staging string, manifest *Manifest) error {
+	data, err := EncodeManifest(manifest)
+	if err != nil {
+		return err
+	}
+	path := filepath.Join(staging, ExtractedManifestName)
+	out, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, ExtractFileMode) // #nosec G304 -- Path in the staging directory
+	if errors.Is(err, os.ErrExist) {
+		return fmt.Errorf("archive entry %s is reserved for the manifest", ExtractedManifestName)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write manifest: %w", err)
+	}
+	if _, err := out.Write(data); err != nil {
+		out.Close()
+		return fmt.Errorf("failed to write manifest: %w", err)
+	}
+	if err := out.Close(); err != nil {
+		return fmt.Errorf("failed to write manifest: %w", err)
+	}
+	return nil
+}
+
+// entryPath returns the path an archive entry is extracted to, rejecting names that are absolute or
+// leave the root directory
+func entryPath(root, name string) (string, error) {
+	cleaned := filepath.FromSlash(strings.TrimSuffix(name, "/"))
+	if name == "" || strings.Contains(name, `\`) || !filepath.IsLocal(cleaned) {
+		return "", fmt.Errorf("illegal path in archive entry: %q", name)
+	}
+	target := filepath.Join(root, cleaned)
+	if rel, err := filepath.Rel(root, target); err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("illegal path in archive entry: %q", name)
+	}
+	return target, nil
+}
+
+// extractEntry writes a file entry to target and returns the number of bytes written. At most maxFileSize
+// bytes, and at most remaining bytes unless remaining is negative, are decompressed.
+func extractEntry(f *zip.File, target string, maxFileSize, remaining int64) (int64, error) {
+	if err := os.MkdirAll(filepath.Dir(target), ExtractDirMode); err != nil {
+		return 0, fmt.Errorf("failed to create directory for entry %s: %w", f.Name, err)
+	}
+
+	rc, err := f.Open()
+	if err != nil {
+		return 0, fmt.Errorf("failed to open archive entry %s: %w", f.Name, err)
+	}
+	defer rc.Close()
+
+	// O_EXCL rejects duplicate entries instead of silently overwriting the first one
+	out, err := os.OpenFile(target, os.O_WRONLY|os.O_CREATE|os.O_EXCL, ExtractFileMode) // #nosec G304 -- Path checked by entryPath
+	if err != nil {
+		return 0, fmt.Errorf("failed to create file for entry %s: %w", f.Name, err)
+	}
+
+	limit := maxFileSize
+	if limit <= 0 {
+		limit = MaxFileSize
+	}
+	totalLimited := remaining >= 0 && remaining < limit
+	if totalLimited {
+		limit = remaining
+	}
+	n, err := io.Copy(out, io.LimitReader(rc, limit+1))
+	closeErr := out.Close()
+	switch {
+	case errors.Is(err, zip.ErrChecksum):
+		return n, fmt.Errorf("checksum mismatch in archive entry %s", f.Name)
+	case err != nil:
+		return n, fmt.Errorf("failed to extract archive entry %s: %w", f.Name, err)
+	case closeErr != nil:
+		return n, fmt.Errorf("failed to write file for entry %s: %w", f.Name, closeErr)
+	case n > limit && totalLimited:
+		return n, fmt.Errorf("archive is larger than the limit of the total extracted size")
+	case n > limit:
+		return n, fmt.Errorf("archive entry %s is larger than the limit of %d bytes", f.Name, limit)
+	}
+	return n, nil
+}
+
+// ReplaceLink atomically points the symbolic link at link to target, replacing an existing link.
+// An existing file or directory at link is never replaced.
+func ReplaceLink(target, link string) error {
+	if info, err := os.Lstat(link); err == nil && info.Mode()&os.ModeSymlink == 0 {
+		return fmt.Errorf("cannot replace %s: not a symbolic link", link)
+	}
+
+	temp := fmt.Sprintf("%s.%d.tmp", link, os.Getpid())
+	_ = os.Remove(temp)
+	if err := os.Symlink(target, temp); err != nil {
+		return fmt.Errorf("failed to create link %s: %w", temp, err)
+	}
+	if err := os.Rename(temp, link); err != nil {
+		_ = os.Remove(temp)
+		return fmt.Errorf("failed to replace link %s: %w", link, err)
+	}
+	return nil
+}
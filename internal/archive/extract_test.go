@@ -0,0 +1,168 @@
+package archive
+
+import (
+	"archive/zip"
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// buildZipHeaders returns a zip archive with an entry for every header, each holding content
+func buildZipHeaders(t *testing.T, headers []*zip.FileHeader, content string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, header := range headers {
+		w, err := zw.CreateHeader(header)
+		if err != nil {
+			t.Fatalf("failed to create zip entry: %v", err)
+		}
+		if _, err := w.Write([]byte(content)); err != nil {
+			t.Fatalf("failed to write zip entry: %v", err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatalf("failed to close zip: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func TestExtract(t *testing.T) {
+	path := writeFile(t, buildZip(t, map[string]string{
+		"main.tf":          `provider "incapsula" {}`,
+		"sites/example.tf": `resource "incapsula_site" "example" {}`,
+	}))
+	dir := filepath.Join(t.TempDir(), "123456", "20240926T120000Z")
+
+	result, err := Extract(path, dir, DefaultExtractLimits())
+	if err != nil {
+		t.Fatalf("Extract() error = %v", err)
+	}
+	if result.Dir != dir || result.Files != 2 || result.Bytes != int64(len(`provider "incapsula" {}`)+len(`resource "incapsula_site" "example" {}`)) {
+		t.Errorf("Extract() = %+v", result)
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, "sites", "example.tf"))
+	if err != nil || string(data) != `resource "incapsula_site" "example" {}` {
+		t.Errorf("extracted file = %q, %v", data, err)
+	}
+	info, err := os.Stat(filepath.Join(dir, "main.tf"))
+	if err != nil || info.Mode().Perm() != ExtractFileMode {
+		t.Errorf("extracted file mode = %v, %v, want %v", info.Mode().Perm(), err, ExtractFileMode)
+	}
+
+	if _, err := Extract(path, dir, DefaultExtractLimits()); err == nil || !strings.Contains(err.Error(), "already exists") {
+		t.Errorf("Extract() into an existing directory error = %v", err)
+	}
+}
+
+func TestExtractZipWithManifest(t *testing.T) {
+	data := buildZip(t, map[string]string{"main.tf": `provider "incapsula" {}`})
+	reader, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := filepath.Join(t.TempDir(), "123456", "20240926T120000Z")
+	manifest := &Manifest{Archive: "export_123456_abc.zip", SHA256: "0123", Handler: "abc", Entries: []Entry{}}
+	if _, err := ExtractZipWithManifest(reader, dir, DefaultExtractLimits(), manifest); err != nil {
+		t.Fatalf("ExtractZipWithManifest() error = %v", err)
+	}
+	got, err := ReadExtractedManifest(dir)
+	if err != nil || got.SHA256 != "0123" || got.Handler != "abc" {
+		t.Errorf("ReadExtractedManifest() = %+v, %v", got, err)
+	}
+
+	// An archive entry named like the manifest is not overwritten
+	data = buildZip(t, map[string]string{ExtractedManifestName: `{"sha256":"forged"}`})
+	reader, err = zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ExtractZipWithManifest(reader, dir+"-2", DefaultExtractLimits(), manifest); err == nil || !strings.Contains(err.Error(), "reserved") {
+		t.Errorf("ExtractZipWithManifest() of an archive with a manifest entry error = %v", err)
+	}
+	if _, err := ReadExtractedManifest(t.TempDir()); err == nil {
+		t.Error("ReadExtractedManifest() of a directory without manifest expected an error")
+	}
+}
+
+func TestExtract_Rejects(t *testing.T) {
+	executable := &zip.FileHeader{Name: "run.sh"}
+	executable.SetMode(0777)
+	symlink := &zip.FileHeader{Name: "link"}
+	symlink.SetMode(os.ModeSymlink | 0777)
+
+	tests := []struct {
+		name    string
+		headers []*zip.FileHeader
+		limits  ExtractLimits
+		wantErr string
+	}{
+		{"parent directory", []*zip.FileHeader{{Name: "../evil.tf"}}, DefaultExtractLimits(), "illegal path"},
+		{"nested parent directory", []*zip.FileHeader{{Name: "sites/../../evil.tf"}}, DefaultExtractLimits(), "illegal path"},
+		{"absolute path", []*zip.FileHeader{{Name: "/etc/evil.tf"}}, DefaultExtractLimits(), "illegal path"},
+		{"backslash", []*zip.FileHeader{{Name: `..\evil.tf`}}, DefaultExtractLimits(), "illegal path"},
+		{"symlink", []*zip.FileHeader{symlink}, DefaultExtractLimits(), "not a regular file"},
+		{"duplicate", []*zip.FileHeader{{Name: "main.tf"}, {Name: "main.tf"}}, DefaultExtractLimits(), "failed to create file"},
+		{"too many files", []*zip.FileHeader{{Name: "a.tf"}, {Name: "b.tf"}}, ExtractLimits{MaxFiles: 1}, "more than the limit"},
+		{"file too large", []*zip.FileHeader{{Name: "a.tf", Method: zip.Deflate}}, ExtractLimits{MaxFileSize: 100}, "larger than the limit of 100 bytes"},
+		{"total too large", []*zip.FileHeader{{Name: "a.tf", Method: zip.Deflate}, {Name: "b.tf", Method: zip.Deflate}}, ExtractLimits{MaxTotalSize: 1500}, "total extracted size"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := writeFile(t, buildZipHeaders(t, tt.headers, strings.Repeat("x", 1000)))
+			root := t.TempDir()
+			dir := filepath.Join(root, "extract")
+
+			_, err := Extract(path, dir, tt.limits)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("Extract() error = %v, want %q", err, tt.wantErr)
+			}
+			entries, _ := os.ReadDir(root)
+			if len(entries) != 0 {
+				t.Errorf("Extract() left %d entries behind after failing", len(entries))
+			}
+			if _, err := os.Stat(filepath.Join(filepath.Dir(root), "evil.tf")); err == nil {
+				t.Error("Extract() wrote a file outside the directory")
+			}
+		})
+	}
+
+	t.Run("permissions", func(t *testing.T) {
+		path := writeFile(t, buildZipHeaders(t, []*zip.FileHeader{executable}, "#!/bin/sh"))
+		dir := filepath.Join(t.TempDir(), "extract")
+		if _, err := Extract(path, dir, DefaultExtractLimits()); err != nil {
+			t.Fatalf("Extract() error = %v", err)
+		}
+		info, err := os.Stat(filepath.Join(dir, "run.sh"))
+		if err != nil || info.Mode().Perm() != ExtractFileMode {
+			t.Errorf("mode of executable entry = %v, %v, want %v", info.Mode().Perm(), err, ExtractFileMode)
+		}
+	})
+}
+
+func TestReplaceLink(t *testing.T) {
+	root := t.TempDir()
+	link := filepath.Join(root, "current")
+	for _, target := range []string{"first", "second"} {
+		if err := os.Mkdir(filepath.Join(root, target), 0750); err != nil {
+			t.Fatal(err)
+		}
+		if err := ReplaceLink(target, link); err != nil {
+			t.Fatalf("ReplaceLink(%s) error = %v", target, err)
+		}
+		if got, err := os.Readlink(link); err != nil || got != target {
+			t.Errorf("link points to %q, %v, want %q", got, err, target)
+		}
+	}
+
+	dir := filepath.Join(root, "directory")
+	if err := os.Mkdir(dir, 0750); err != nil {
+		t.Fatal(err)
+	}
+	if err := ReplaceLink("first", dir); err == nil {
+		t.Error("ReplaceLink() replaced a directory")
+	}
+}
@@ -0,0 +1,278 @@
+// Package audit writes and verifies a tamper-evident, append-only log of JSON records, one per line.
+// Every record holds the hash of the previous one, so editing, removing or reordering records breaks the
+// chain. The sequence number and hash of the last record are also kept in a head file next to the log,
+// which reveals records cut off the end of the log.
+package audit
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/ren3gadem4rm0t/imperva-export-cli/internal/filelock"
+)
+
+// HeadSuffix is appended to the path of a log to get the path of its head file
+const HeadSuffix string = ".head"
+
+// Record is an entry of the audit log
+type Record struct {
+	Seq      uint64    `json:"seq"`
+	Time     time.Time `json:"time"`
+	Operator string    `json:"operator"`
+	Host     string    `json:"host"`
+	Profile  string    `json:"profile,omitempty"`
+	APIID    string    `json:"api_id,omitempty"`
+	Command  string    `json:"command"`
+	CAID     int64     `json:"caid,omitempty"`
+	Resource string    `json:"resource,omitempty"`
+	Handler  string    `json:"handler,omitempty"`
+	Outcome  string    `json:"outcome"`
+	File     string    `json:"file,omitempty"`
+	SHA256   string    `json:"sha256,omitempty"`
+	Uploaded string    `json:"uploaded,omitempty"`
+	Error    string    `json:"error,omitempty"`
+	// Prev is the hash of the previous record, empty for the first one
+	Prev string `json:"prev"`
+	// Hash is the SHA-256 of the record without its hash
+	Hash string `json:"hash"`
+}
+
+// Head is the sequence number and hash of the last record of a log
+type Head struct {
+	Seq  uint64 `json:"seq"`
+	Hash string `json:"hash"`
+}
+
+// TamperError is returned by Verify when the log was edited, truncated or is otherwise corrupt
+type TamperError struct {
+	// Line is the line of the log the chain is broken at, 0 if the log as a whole is affected
+	Line   int
+	Reason string
+}
+
+func (e *TamperError) Error() string {
+	if e.Line > 0 {
+		return fmt.Sprintf("line %d: %s", e.Line, e.Reason)
+	}
+	return e.Reason
+}
+
+// mu serializes appends within the process, filelock serializes them across processes
+var mu sync.Mutex
+
+// Append adds a record to the log at path, creating the log if needed, and updates the head file. The
+// sequence number, previous hash and hash of the record are set by Append, the time if it is zero.
+func Append(path string, rec Record) (Record, error) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if err := os.MkdirAll(filepath.Dir(path), 0750); err != nil {
+		return rec, fmt.Errorf("failed to create audit log directory: %w", err)
+	}
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0600) // #nosec G304 -- Path comes from the user's own configuration
+	if err != nil {
+		return rec, fmt.Errorf("failed to open audit log: %w", err)
+	}
+	defer f.Close()
+	if err := filelock.Lock(f); err != nil {
+		return rec, fmt.Errorf("failed to lock audit log: %w", err)
+	}
+	defer func() { _ = filelock.Unlock(f) }()
+
+	last, err := lastRecord(f)
+	if err != nil {
+		return rec, err
+	}
+	rec.Seq = last.Seq + 1
+	rec.Prev = last.Hash
+	if rec.Time.IsZero() {
+		rec.Time = time.Now()
+	}
+	rec.Time = rec.Time.UTC()
+	if rec.Hash, err = rec.hash(); err != nil {
+		return rec, err
+	}
+	line, err := json.Marshal(rec)
+	if err != nil {
+		return rec, fmt.Errorf("failed to encode audit record: %w", err)
+	}
+
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		return rec, fmt.Errorf("failed to write audit log: %w", err)
+	}
+	if err := f.Sync(); err != nil {
+		return rec, fmt.Errorf("failed to write audit log: %w", err)
+	}
+	if err := writeHead(path, Head{Seq: rec.Seq, Hash: rec.Hash}); err != nil {
+		return rec, err
+	}
+	return rec, nil
+}
+
+// Verify checks the chain of the log at path against its head file and returns the head of the log. A
+// broken chain is reported as a *TamperError. anchor, if not empty, is the hash of a record that must be
+// part of the log, e.g. a head noted earlier outside of the host, which reveals a log and head file that
+// were rewritten together.
+func Verify(path, anchor string) (Head, error) {
+	head, err := readHead(path)
+	if err != nil {
+		return Head{}, err
+	}
+	f, err := os.Open(path) // #nosec G304 -- Path comes from the user's own configuration
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) && head.Seq > 0 {
+			return Head{}, &TamperError{Reason: fmt.Sprintf("the log is missing but its head file records %d records", head.Seq)}
+		}
+		return Head{}, fmt.Errorf("failed to open audit log: %w", err)
+	}
+	defer f.Close()
+
+	var last Record
+	anchored := anchor == ""
+	reader := bufio.NewReader(f)
+	for lineNo := 1; ; lineNo++ {
+		line, err := reader.ReadBytes('\n')
+		if errors.Is(err, io.EOF) {
+			if len(line) > 0 {
+				return Head{}, &TamperError{Line: lineNo, Reason: "incomplete record at the end of the log"}
+			}
+			break
+		}
+		if err != nil {
+			return Head{}, fmt.Errorf("failed to read audit log: %w", err)
+		}
+		rec, err := verifyRecord(line, last)
+		if err != nil {
+			return Head{}, &TamperError{Line: lineNo, Reason: err.Error()}
+		}
+		if rec.Seq == head.Seq && rec.Hash != head.Hash {
+			return Head{}, &TamperError{Line: lineNo, Reason: "record does not match the head file"}
+		}
+		if rec.Hash == anchor {
+			anchored = true
+		}
+		last = rec
+	}
+
+	switch {
+	case head.Seq > last.Seq:
+		return Head{}, &TamperError{Reason: fmt.Sprintf("the log ends at record %d but its head file records %d: records were removed", last.Seq, head.Seq)}
+	case head.Seq == 0 && last.Seq > 0:
+		return Head{}, &TamperError{Reason: "the head file of the log is missing"}
+	case !anchored:
+		return Head{}, &TamperError{Reason: fmt.Sprintf("anchor %s is not part of the log", anchor)}
+	}
+	// A head file behind the log is left by an append that was interrupted before updating it
+	return Head{Seq: last.Seq, Hash: last.Hash}, nil
+}
+
+// verifyRecord decodes a line of the log and checks that it follows the previous record
+func verifyRecord(line []byte, prev Record) (Record, error) {
+	var rec Record
+	dec := json.NewDecoder(bytes.NewReader(line))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&rec); err != nil {
+		return rec, fmt.Errorf("invalid record: %w", err)
+	}
+	if rec.Seq != prev.Seq+1 {
+		return rec, fmt.Errorf("record %d follows record %d: records were removed or reordered", rec.Seq, prev.Seq)
+	}
+	if rec.Prev != prev.Hash {
+		return rec, errors.New("previous hash does not match the previous record")
+	}
+	hash, err := rec.hash()
+	if err != nil {
+		return rec, err
+	}
+	if rec.Hash != hash {
+		return rec, errors.New("hash does not match the record: the record was edited")
+	}
+	return rec, nil
+}
+
+// hash returns the hex SHA-256 of the JSON encoding of the record without its hash
+func (r Record) hash() (string, error) {
+	r.Hash = ""
+	data, err := json.Marshal(r)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode audit record: %w", err)
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// lastRecord returns the last record of the log, or the zero record if the log is empty. Records are
+// short, so the file is read backwards from its end until the start of the last line.
+func lastRecord(f *os.File) (Record, error) {
+	info, err := f.Stat()
+	if err != nil {
+		return Record{}, fmt.Errorf("failed to read audit log: %w", err)
+	}
+	size := info.Size()
+	if size == 0 {
+		return Record{}, nil
+	}
+
+	for n := int64(4096); ; n *= 2 {
+		n = min(n, size)
+		tail := make([]byte, n)
+		if _, err := f.ReadAt(tail, size-n); err != nil {
+			return Record{}, fmt.Errorf("failed to read audit log: %w", err)
+		}
+		if tail[len(tail)-1] != '\n' {
+			return Record{}, errors.New("audit log ends with an incomplete record, run audit verify")
+		}
+		start := bytes.LastIndexByte(tail[:len(tail)-1], '\n')
+		if start < 0 && n < size {
+			continue
+		}
+		var rec Record
+		if err := json.Unmarshal(tail[start+1:], &rec); err != nil {
+			return Record{}, fmt.Errorf("failed to parse the last record of the audit log: %w", err)
+		}
+		return rec, nil
+	}
+}
+
+// readHead reads the head file of the log. A missing head file is the zero head.
+func readHead(path string) (Head, error) {
+	var head Head
+	data, err := os.ReadFile(path + HeadSuffix) // #nosec G304 -- Path comes from the user's own configuration
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return head, nil
+		}
+		return head, fmt.Errorf("failed to read audit log head: %w", err)
+	}
+	if err := json.Unmarshal(data, &head); err != nil {
+		return head, &TamperError{Reason: fmt.Sprintf("invalid head file: %v", err)}
+	}
+	return head, nil
+}
+
+// writeHead atomically replaces the head file of the log
+func writeHead(path string, head Head) error {
+	data, err := json.Marshal(head)
+	if err != nil {
+		return fmt.Errorf("failed to encode audit log head: %w", err)
+	}
+	tempPath := path + HeadSuffix + ".tmp"
+	if err := os.WriteFile(tempPath, append(data, '\n'), 0600); err != nil {
+		return fmt.Errorf("failed to write audit log head: %w", err)
+	}
+	if err := os.Rename(tempPath, path+HeadSuffix); err != nil {
+		_ = os.Remove(tempPath)
+		return fmt.Errorf("failed to replace audit log head: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,227 @@
+package audit
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// writeLog appends n records to a new log and returns its path and the appended records
+func writeLog(t *testing.T, n int) (string, []Record) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "audit", "audit.jsonl")
+	records := make([]Record, 0, n)
+	for i := 0; i < n; i++ {
+		rec, err := Append(path, Record{Operator: "alice", Host: "backup-1", APIID: "12345", Command: "imperva-export-cli auto", CAID: int64(1000 + i), Outcome: "success"})
+		if err != nil {
+			t.Fatalf("Append() error = %v", err)
+		}
+		records = append(records, rec)
+	}
+	return path, records
+}
+
+// rewrite replaces the log with the result of fn applied to its lines
+func rewrite(t *testing.T, path string, fn func(lines [][]byte) [][]byte) {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := bytes.SplitAfter(data, []byte("\n"))
+	if err := os.WriteFile(path, bytes.Join(fn(lines[:len(lines)-1]), nil), 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestAppend(t *testing.T) {
+	path, records := writeLog(t, 3)
+	for i, rec := range records {
+		if rec.Seq != uint64(i+1) || len(rec.Hash) != 64 || rec.Time.IsZero() {
+			t.Errorf("record %d = %+v", i, rec)
+		}
+		if i > 0 && rec.Prev != records[i-1].Hash {
+			t.Errorf("record %d does not chain to the previous record", i)
+		}
+	}
+	if records[0].Prev != "" {
+		t.Errorf("first record prev = %q, want none", records[0].Prev)
+	}
+
+	head, err := Verify(path, "")
+	if err != nil {
+		t.Fatalf("Verify() error = %v", err)
+	}
+	if head.Seq != 3 || head.Hash != records[2].Hash {
+		t.Errorf("Verify() head = %+v, want the last record", head)
+	}
+	if head, err := Verify(path, records[1].Hash); err != nil || head.Seq != 3 {
+		t.Errorf("Verify() with a known anchor = %+v, %v", head, err)
+	}
+}
+
+func TestAppend_Concurrent(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := Append(path, Record{Command: "imperva-export-cli auto", Outcome: "success"}); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+	if head, err := Verify(path, ""); err != nil || head.Seq != 20 {
+		t.Errorf("Verify() = %+v, %v, want 20 chained records", head, err)
+	}
+}
+
+func TestAppend_IncompleteRecord(t *testing.T) {
+	path, _ := writeLog(t, 1)
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _ = f.WriteString(`{"seq":2,`)
+	f.Close()
+
+	if _, err := Append(path, Record{Command: "imperva-export-cli auto"}); err == nil {
+		t.Error("Append() after an incomplete record expected an error")
+	}
+}
+
+func TestVerify_Tampering(t *testing.T) {
+	tests := []struct {
+		name   string
+		tamper func(t *testing.T, path string)
+		want   string
+	}{
+		{
+			name: "edited record",
+			tamper: func(t *testing.T, path string) {
+				rewrite(t, path, func(lines [][]byte) [][]byte {
+					lines[1] = bytes.Replace(lines[1], []byte(`"caid":1001`), []byte(`"caid":9999`), 1)
+					return lines
+				})
+			},
+			want: "line 2: hash does not match",
+		},
+		{
+			name: "added field",
+			tamper: func(t *testing.T, path string) {
+				rewrite(t, path, func(lines [][]byte) [][]byte {
+					lines[0] = bytes.Replace(lines[0], []byte(`{"seq"`), []byte(`{"note":"x","seq"`), 1)
+					return lines
+				})
+			},
+			want: "line 1: invalid record",
+		},
+		{
+			name: "removed record",
+			tamper: func(t *testing.T, path string) {
+				rewrite(t, path, func(lines [][]byte) [][]byte { return append(lines[:1], lines[2:]...) })
+			},
+			want: "line 2: record 3 follows record 1",
+		},
+		{
+			name: "reordered records",
+			tamper: func(t *testing.T, path string) {
+				rewrite(t, path, func(lines [][]byte) [][]byte {
+					lines[1], lines[2] = lines[2], lines[1]
+					return lines
+				})
+			},
+			want: "line 2: record 3 follows record 1",
+		},
+		{
+			name: "truncated log",
+			tamper: func(t *testing.T, path string) {
+				rewrite(t, path, func(lines [][]byte) [][]byte { return lines[:2] })
+			},
+			want: "the log ends at record 2 but its head file records 3",
+		},
+		{
+			name: "removed head file",
+			tamper: func(t *testing.T, path string) {
+				if err := os.Remove(path + HeadSuffix); err != nil {
+					t.Fatal(err)
+				}
+			},
+			want: "head file of the log is missing",
+		},
+		{
+			name: "removed log",
+			tamper: func(t *testing.T, path string) {
+				if err := os.Remove(path); err != nil {
+					t.Fatal(err)
+				}
+			},
+			want: "the log is missing",
+		},
+		{
+			name: "torn write",
+			tamper: func(t *testing.T, path string) {
+				rewrite(t, path, func(lines [][]byte) [][]byte { return append(lines, []byte(`{"seq":4`)) })
+			},
+			want: "line 4: incomplete record",
+		},
+		{
+			name: "rewritten log and head",
+			tamper: func(t *testing.T, path string) {
+				// A rewritten log with a valid chain still differs from the head noted before
+				for _, name := range []string{path, path + HeadSuffix} {
+					if err := os.Remove(name); err != nil {
+						t.Fatal(err)
+					}
+				}
+				if _, err := Append(path, Record{Command: "imperva-export-cli auto", Outcome: "success"}); err != nil {
+					t.Fatal(err)
+				}
+			},
+			want: "is not part of the log",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path, records := writeLog(t, 3)
+			tt.tamper(t, path)
+
+			_, err := Verify(path, records[2].Hash)
+			var tamperErr *TamperError
+			if !errors.As(err, &tamperErr) || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Verify() error = %v, want a tamper error containing %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestVerify_InterruptedHeadUpdate(t *testing.T) {
+	path, records := writeLog(t, 2)
+	if err := writeHead(path, Head{Seq: 1, Hash: records[0].Hash}); err != nil {
+		t.Fatal(err)
+	}
+	if head, err := Verify(path, ""); err != nil || head.Seq != 2 {
+		t.Errorf("Verify() with a head file behind the log = %+v, %v", head, err)
+	}
+
+	if err := writeHead(path, Head{Seq: 1, Hash: records[1].Hash}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Verify(path, ""); err == nil || !strings.Contains(err.Error(), "does not match the head file") {
+		t.Errorf("Verify() with a wrong head = %v", err)
+	}
+}
+
+func TestVerify_MissingLog(t *testing.T) {
+	_, err := Verify(filepath.Join(t.TempDir(), "audit.jsonl"), "")
+	var tamperErr *TamperError
+	if !errors.Is(err, os.ErrNotExist) || errors.As(err, &tamperErr) {
+		t.Errorf("Verify() of a missing log error = %v, want a not exist error", err)
+	}
+}
@@ -0,0 +1,215 @@
+package cmd
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/ren3gadem4rm0t/imperva-export-cli/internal/audit"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var auditCmd = &cobra.Command{
+	Use:   "audit",
+	Short: "Verify the audit log of export operations",
+	Long: `With --audit-log every command invocation is recorded in an append-only JSONL audit log: the operator,
+host, profile and API ID (never the API key), and the CAID, resource, handler, outcome and file hash of
+every export. Every record holds the hash of the previous one, so edits and removed records are detected
+by audit verify.`,
+}
+
+var auditVerifyCmd = &cobra.Command{
+	Use:   "verify [audit-log]",
+	Short: "Verify that the audit log was not edited or truncated, by default the log of --audit-log",
+	Args:  cobra.MaximumNArgs(1),
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		return loadConfig()
+	},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cmd.SilenceUsage = true
+		path := viper.GetString("audit-log")
+		if len(args) > 0 {
+			path = args[0]
+		}
+		if path == "" {
+			return newValidationError(fmt.Errorf("no audit log: pass the path of the log or use --audit-log"))
+		}
+		anchor, _ := cmd.Flags().GetString("anchor")
+		return verifyAuditLog(os.Stdout, outputFormat(), path, anchor)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(auditCmd)
+	auditCmd.AddCommand(auditVerifyCmd)
+	auditVerifyCmd.Flags().String("anchor", "", "Hash of a record that must be part of the log, e.g. a head noted earlier outside of the host")
+}
+
+// verifyAuditLog verifies the chain of the audit log and reports its head as text or as JSON or YAML.
+// A tampered log fails with ExitError, a log that cannot be read with ExitIO.
+func verifyAuditLog(w io.Writer, format, path, anchor string) error {
+	if anchor != "" && !isRecordHash(anchor) {
+		return newValidationError(fmt.Errorf("invalid anchor %q: must be the SHA-256 hash of a record", anchor))
+	}
+
+	head, err := audit.Verify(filepath.Clean(path), anchor)
+	var tamperErr *audit.TamperError
+	if errors.As(err, &tamperErr) {
+		return fmt.Errorf("audit log %s was tampered with: %w", path, err)
+	}
+	if err != nil {
+		return newIOError(err)
+	}
+	if format == outputJSON || format == outputYAML {
+		return writeOutput(w, format, auditVerifyOutput{Log: path, Intact: true, Records: head.Seq, Head: head.Hash})
+	}
+	_, err = fmt.Fprintf(w, "Audit log %s is intact (records: %d, head: %s)\n", path, head.Seq, orDash(head.Hash))
+	return err
+}
+
+// auditVerifyOutput is the structured result of a verified audit log
+type auditVerifyOutput struct {
+	Log     string `json:"log" yaml:"log"`
+	Intact  bool   `json:"intact" yaml:"intact"`
+	Records uint64 `json:"records" yaml:"records"`
+	Head    string `json:"head,omitempty" yaml:"head,omitempty"`
+}
+
+// auditTrail records the operations of the invocation in the audit log
+var auditTrail = &auditSession{}
+
+// auditSession collects the state of the invocation that is recorded in the audit log
+type auditSession struct {
+	mu sync.Mutex
+	// command is the path of the invoked command
+	command string
+	// started is set once the configuration was loaded, so the audit log is known
+	started bool
+	// recorded is set once an export of the invocation was recorded
+	recorded bool
+	// err is the first failure to write the audit log
+	err error
+}
+
+// begin starts the session of an invocation of the command
+func (s *auditSession) begin(command string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.command = command
+	s.started, s.recorded, s.err = false, false, nil
+}
+
+// start marks the configuration as loaded
+func (s *auditSession) start() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.started = true
+}
+
+// recordExport records the result of an export
+func (s *auditSession) recordExport(result exportResult, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.recorded = true
+	rec := s.newRecord(err)
+	rec.CAID = result.CAID
+	rec.Resource = result.Resource
+	rec.Handler = result.Handler
+	rec.File = result.File
+	rec.SHA256 = result.SHA256
+	rec.Uploaded = result.Uploaded
+	s.append(rec)
+}
+
+// recordBatch records the results of a batch of exports, one record per account
+func (s *auditSession) recordBatch(results []batchResult) {
+	for _, r := range results {
+		s.recordExport(r.exportResult(), r.Err)
+	}
+}
+
+// end records the invocation if no export was recorded and returns the first failure to write the audit
+// log, if any. The audit commands themselves are not recorded.
+func (s *auditSession) end(err error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.started && !s.recorded && !strings.HasPrefix(s.command, auditCmd.CommandPath()) {
+		s.append(s.newRecord(err))
+	}
+	return s.err
+}
+
+// newRecord returns a record of the invocation with the outcome of err
+func (s *auditSession) newRecord(err error) audit.Record {
+	rec := audit.Record{
+		Operator: auditOperator(),
+		Host:     auditHost(),
+		Profile:  viper.GetString("profile"),
+		APIID:    viper.GetString("api-id"),
+		Command:  s.command,
+		Outcome:  jobOutcome(err),
+	}
+	if err != nil {
+		rec.Error = err.Error()
+	}
+	return rec
+}
+
+// append adds a record to the audit log, if one is configured. Failures are logged and kept for end.
+func (s *auditSession) append(rec audit.Record) {
+	path := viper.GetString("audit-log")
+	if path == "" {
+		return
+	}
+	if _, err := audit.Append(filepath.Clean(path), rec); err != nil {
+		log.Error().Err(err).Msg("Failed to write audit log")
+		if s.err == nil {
+			s.err = newIOError(fmt.Errorf("failed to write audit log: %w", err))
+		}
+	}
+}
+
+// auditOperator returns the name of the user running the CLI
+func auditOperator() string {
+	if u, err := user.Current(); err == nil && u.Username != "" {
+		return u.Username
+	}
+	for _, env := range []string{"USER", "USERNAME"} {
+		if name := os.Getenv(env); name != "" {
+			return name
+		}
+	}
+	return "unknown"
+}
+
+// auditHost returns the name of the host running the CLI
+func auditHost() string {
+	if host, err := os.Hostname(); err == nil && host != "" {
+		return host
+	}
+	return "unknown"
+}
+
+// isRecordHash reports whether s is a hex SHA-256 hash like the hashes of audit records
+func isRecordHash(s string) bool {
+	_, err := hex.DecodeString(s)
+	return err == nil && len(s) == hex.EncodedLen(sha256.Size)
+}
+
+// invokedCommand returns the path of the command the arguments invoke
+func invokedCommand(args []string) string {
+	cmd, _, err := rootCmd.Find(args)
+	if err != nil {
+		return rootCmd.CommandPath()
+	}
+	return cmd.CommandPath()
+}
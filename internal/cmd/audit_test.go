@@ -0,0 +1,180 @@
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ren3gadem4rm0t/imperva-export-cli/internal/audit"
+	"github.com/ren3gadem4rm0t/imperva-export-cli/pkg/mockserver"
+	"github.com/spf13/viper"
+)
+
+// useAuditLog starts an audit session of the command with a new audit log and returns its path
+func useAuditLog(t *testing.T, command string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	viper.Set("audit-log", path)
+	t.Cleanup(func() { viper.Set("audit-log", nil) })
+	auditTrail.begin(command)
+	auditTrail.start()
+	return path
+}
+
+// auditRecords returns the records of the audit log after verifying its chain
+func auditRecords(t *testing.T, path string) []audit.Record {
+	t.Helper()
+	if _, err := audit.Verify(path, ""); err != nil {
+		t.Fatalf("Verify() error = %v", err)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var records []audit.Record
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var rec audit.Record
+		if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+			t.Fatal(err)
+		}
+		records = append(records, rec)
+	}
+	return records
+}
+
+func TestAutoExport_AuditLog(t *testing.T) {
+	useMockServer(t, mockserver.WithPolls(0), mockserver.WithFixture(newTestExportZip()))
+	path := useAuditLog(t, "imperva-export-cli auto")
+	viper.Set("profile", "prod")
+	t.Cleanup(func() { viper.Set("profile", nil) })
+
+	results := captureResults(t, outputJSON)
+	if err := autoExport(context.Background(), 1234, nil, saveOptions{}); err != nil {
+		t.Fatalf("autoExport() error = %v", err)
+	}
+	var result exportResult
+	if err := json.Unmarshal(results.Bytes(), &result); err != nil {
+		t.Fatal(err)
+	}
+
+	// A rejected export is recorded with its failure class
+	useMockServer(t, mockserver.WithFault(mockserver.Fault{Status: 401}))
+	if err := autoExport(context.Background(), 1234, nil, saveOptions{}); err == nil {
+		t.Fatal("autoExport() expected an authentication error")
+	}
+	if err := auditTrail.end(nil); err != nil {
+		t.Fatalf("end() error = %v", err)
+	}
+
+	records := auditRecords(t, path)
+	if len(records) != 2 {
+		t.Fatalf("got %d audit records, want one per export: %+v", len(records), records)
+	}
+	rec := records[0]
+	if rec.Operator == "" || rec.Host == "" || rec.Profile != "prod" || rec.APIID != "test-api-id" ||
+		rec.Command != "imperva-export-cli auto" || rec.CAID != 1234 || rec.Handler != result.Handler ||
+		rec.Outcome != "success" || rec.File != result.File || rec.SHA256 != result.SHA256 || rec.SHA256 == "" {
+		t.Errorf("audit record = %+v, want the export %+v", rec, result)
+	}
+	if records[1].Outcome != "auth" || records[1].Error == "" {
+		t.Errorf("audit record of the failed export = %+v", records[1])
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), viper.GetString("api-key")) {
+		t.Error("the audit log contains the API key")
+	}
+}
+
+func TestAuditSession_Invocation(t *testing.T) {
+	path := useAuditLog(t, "imperva-export-cli inspect")
+	if err := auditTrail.end(newValidationError(errors.New("bad flag"))); err != nil {
+		t.Fatalf("end() error = %v", err)
+	}
+
+	// Help and the audit commands are not recorded
+	auditTrail.begin("imperva-export-cli auto")
+	if err := auditTrail.end(nil); err != nil {
+		t.Fatalf("end() error = %v", err)
+	}
+	auditTrail.begin("imperva-export-cli audit verify")
+	auditTrail.start()
+	if err := auditTrail.end(nil); err != nil {
+		t.Fatalf("end() error = %v", err)
+	}
+
+	records := auditRecords(t, path)
+	if len(records) != 1 || records[0].Command != "imperva-export-cli inspect" || records[0].Outcome != "validation" || records[0].CAID != 0 {
+		t.Errorf("audit records = %+v, want one record of the failed inspect", records)
+	}
+}
+
+func TestAuditSession_WriteFailure(t *testing.T) {
+	useAuditLog(t, "imperva-export-cli diff")
+	blocker := filepath.Join(t.TempDir(), "file")
+	if err := os.WriteFile(blocker, nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+	viper.Set("audit-log", filepath.Join(blocker, "audit.jsonl"))
+
+	if err := auditTrail.end(nil); ExitCode(err) != ExitIO {
+		t.Errorf("end() with an unwritable audit log error = %v, want an I/O error", err)
+	}
+}
+
+func TestVerifyAuditLog(t *testing.T) {
+	path := useAuditLog(t, "imperva-export-cli export")
+	auditTrail.recordExport(exportResult{CAID: 1234, Handler: "handler"}, nil)
+	auditTrail.recordExport(exportResult{CAID: 5678, Handler: "handler"}, nil)
+	records := auditRecords(t, path)
+
+	var buf bytes.Buffer
+	if err := verifyAuditLog(&buf, outputText, path, records[0].Hash); err != nil {
+		t.Fatalf("verifyAuditLog() error = %v", err)
+	}
+	if want := "is intact (records: 2, head: " + records[1].Hash + ")"; !strings.Contains(buf.String(), want) {
+		t.Errorf("verifyAuditLog() output = %q, want %q", buf.String(), want)
+	}
+
+	buf.Reset()
+	if err := verifyAuditLog(&buf, outputJSON, path, ""); err != nil {
+		t.Fatalf("verifyAuditLog() JSON error = %v", err)
+	}
+	var output auditVerifyOutput
+	if err := json.Unmarshal(buf.Bytes(), &output); err != nil {
+		t.Fatalf("verifyAuditLog() wrote invalid JSON: %v\n%s", err, buf.String())
+	}
+	if !output.Intact || output.Records != 2 || output.Head != records[1].Hash {
+		t.Errorf("unexpected verifyAuditLog() output: %+v", output)
+	}
+
+	if err := verifyAuditLog(&buf, outputText, path, "not-a-hash"); ExitCode(err) != ExitValidation {
+		t.Errorf("verifyAuditLog() with an invalid anchor error = %v, want a validation error", err)
+	}
+	if err := verifyAuditLog(&buf, outputText, filepath.Join(t.TempDir(), "missing.jsonl"), ""); ExitCode(err) != ExitIO {
+		t.Errorf("verifyAuditLog() of a missing log error = %v, want an I/O error", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, bytes.Replace(data, []byte(`"caid":5678`), []byte(`"caid":9999`), 1), 0600); err != nil {
+		t.Fatal(err)
+	}
+	err = verifyAuditLog(&buf, outputText, path, "")
+	if ExitCode(err) != ExitError || !strings.Contains(err.Error(), "line 2: hash does not match") {
+		t.Errorf("verifyAuditLog() of an edited log error = %v, want a tamper error", err)
+	}
+}
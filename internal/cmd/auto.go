@@ -3,9 +3,11 @@ package cmd
 import (
 	"context"
 	"fmt"
+	"os"
+	"strings"
 	"time"
 
-	"github.com/rs/zerolog"
+	"github.com/ren3gadem4rm0t/imperva-export-cli/pkg/client"
 	"github.com/rs/zerolog/log"
 	"github.com/spf13/cobra"
 )
@@ -13,56 +15,176 @@ import (
 var autoCmd = &cobra.Command{
 	Use:   "auto",
 	Short: "Initiate the export process and download the exported zip file after successful export",
+	Long: `Initiate the export process and download the exported zip file after successful export.
+
+Use the site or policy subcommand to export a single website or policy instead of the whole account.
+
+Pass several account IDs (--caid 1,2,3) or a file of account IDs (--caids-file) to export many
+accounts concurrently. A failed account does not stop the others, and a summary table is printed at the end.`,
 	RunE: func(cmd *cobra.Command, args []string) error {
 		cmd.SilenceUsage = true
-		caid, _ := cmd.Flags().GetInt64("caid")
-		if err := ValidateCAID(caid); err != nil {
+		caids, _ := cmd.Flags().GetInt64Slice("caid")
+		caidsFile, _ := cmd.Flags().GetString("caids-file")
+		if caidsFile != "" {
+			fileCAIDs, err := parseCAIDsFile(caidsFile)
+			if err != nil {
+				return err
+			}
+			caids = append(caids, fileCAIDs...)
+		}
+		caids, err := uniqueCAIDs(caidsOrDefault(caids))
+		if err != nil {
 			return err
 		}
-
-		handler, err := initiateAuto(caid)
+		if len(caids) == 0 {
+			return newValidationError(fmt.Errorf("at least one caid must be provided via --caid, --caids-file or the caid of the profile"))
+		}
+		opts, err := saveOptionsFromFlags(cmd)
 		if err != nil {
-			return fmt.Errorf("error during auto export: %w", err)
+			return err
 		}
-		log.Info().Msgf("Export completed successfully. Handler ID: %s", handler)
-		if zerolog.GlobalLevel() == zerolog.Disabled {
-			fmt.Printf("Export completed successfully. Handler ID: %s\n", handler)
+
+		if len(caids) > 1 || caidsFile != "" {
+			concurrency, _ := cmd.Flags().GetInt("concurrency")
+			results, err := runBatch(cmd.Context(), caids, concurrency, 10*time.Minute)
+			if err != nil {
+				return err
+			}
+			if interrupted(cmd.Context()) {
+				for _, r := range results {
+					if r.Err != nil && r.Handler != "" {
+						reportInterrupted(r.CAID, r.Handler)
+					}
+				}
+			}
+			processBatch(results, opts)
+			exportMetrics.observeBatch(results)
+			auditTrail.recordBatch(results)
+			if format := outputFormat(); format != outputText {
+				err = writeBatchOutput(resultOutput, format, results)
+			} else {
+				err = printBatchSummary(os.Stdout, results)
+			}
+			if err != nil {
+				return err
+			}
+			return batchError(results)
 		}
-		return nil
+
+		return autoExport(cmd.Context(), caids[0], nil, opts)
 	},
 }
 
+// newAutoResourceCmd creates the auto subcommand for a single resource of the given type
+func newAutoResourceCmd(resourceType client.ResourceType) *cobra.Command {
+	name := strings.ToLower(string(resourceType))
+	cmd := &cobra.Command{
+		Use:   name,
+		Short: fmt.Sprintf("Export a single %s and download the exported zip file after successful export", name),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cmd.SilenceUsage = true
+			caids, _ := cmd.Flags().GetInt64Slice("caid")
+			caids = caidsOrDefault(caids)
+			if len(caids) != 1 {
+				return newValidationError(fmt.Errorf("exactly one caid must be provided for a single %s export", name))
+			}
+			caid := caids[0]
+			if err := ValidateCAID(caid); err != nil {
+				return err
+			}
+			id, _ := cmd.Flags().GetInt64("id")
+			if err := ValidateResourceID(id); err != nil {
+				return err
+			}
+
+			opts, err := saveOptionsFromFlags(cmd)
+			if err != nil {
+				return err
+			}
+
+			return autoExport(cmd.Context(), caid, &client.Resource{Type: resourceType, ID: id}, opts)
+		},
+	}
+	cmd.Flags().Int64("id", 0, fmt.Sprintf("The Imperva ID of the %s to export", name))
+	addSaveFlags(cmd)
+	if err := cmd.MarkFlagRequired("id"); err != nil {
+		log.Error().Err(err).Msg("Failed to mark flag as required")
+	}
+	return cmd
+}
+
 func init() {
 	rootCmd.AddCommand(autoCmd)
-	autoCmd.Flags().Int64("caid", 0, "The account ID to work on")
-	if err := autoCmd.MarkFlagRequired("caid"); err != nil {
-		log.Error().Err(err).Msg("Failed to mark flag as required")
+	autoCmd.PersistentFlags().Int64Slice("caid", nil, "The account ID to work on, comma-separated for a batch of accounts (default is the caid of the profile)")
+	autoCmd.Flags().String("caids-file", "", "File with account IDs to export as a batch, one per line")
+	autoCmd.Flags().Int("concurrency", 4, "Maximum number of concurrent exports in batch mode")
+	addSaveFlags(autoCmd)
+	autoCmd.AddCommand(newAutoResourceCmd(client.ResourceSite))
+	autoCmd.AddCommand(newAutoResourceCmd(client.ResourcePolicy))
+}
+
+// autoExport runs the full export flow for the auto command, extracts and commits the export if enabled
+// and reports its result
+func autoExport(ctx context.Context, caid int64, resource *client.Resource, opts saveOptions) error {
+	ctx, span := startJobSpan(ctx, "auto export", caid, resource)
+	start := time.Now()
+	handler, saved, err := runAuto(ctx, caid, resource)
+	if err == nil {
+		err = processSaved(&saved, caid, handler, resource, opts)
 	}
+	endJobSpan(span, handler, err)
+	if err != nil {
+		if resource == nil {
+			err = fmt.Errorf("error during auto export: %w", err)
+		} else {
+			err = fmt.Errorf("error during auto %s export: %w", strings.ToLower(string(resource.Type)), err)
+		}
+		return emitResult(newExportResult(caid, resource, handler, saved, time.Since(start), err), err)
+	}
+
+	log.Info().Msgf("Export completed successfully. Handler ID: %s", handler)
+	if printsText() {
+		fmt.Printf("Export completed successfully. Handler ID: %s\n", handler)
+	}
+	return emitResult(newExportResult(caid, resource, handler, saved, time.Since(start), nil), nil)
 }
 
-func initiateAuto(caid int64) (string, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+// runAuto starts an export, waits for it and saves the file. It returns the handler, if the export
+// was initiated, and the saved file.
+func runAuto(ctx context.Context, caid int64, resource *client.Resource) (string, savedExport, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Minute)
 	defer cancel()
 
-	log.Info().Msgf("Initiating export for CAID: %d", caid)
+	c, err := newClient()
+	if err != nil {
+		return "", savedExport{}, err
+	}
 
-	handler, err := initiateExport(ctx, caid)
+	var handler string
+	if resource == nil {
+		log.Info().Msgf("Initiating export for CAID: %d", caid)
+		handler, err = c.Export(ctx, caid)
+	} else {
+		log.Info().Msgf("Initiating %s export for CAID: %d, ID: %d", resource.Type, caid, resource.ID)
+		handler, err = c.ExportResource(ctx, caid, *resource)
+	}
 	if err != nil {
 		log.Error().Err(err).Msg("Failed to initiate export")
-		return "", err
+		return "", savedExport{}, err
 	}
+	trackJobStarted(caid, handler, resource)
 
 	log.Info().Msgf("Export initiated. Handler ID: %s", handler)
-	if zerolog.GlobalLevel() == zerolog.Disabled {
+	if printsText() {
 		fmt.Printf("Export initiated. Handler ID: %s\n", handler)
 	}
 
-	err = checkExportStatusWithContext(ctx, caid, handler)
+	saved, err := waitForExport(ctx, c, caid, handler, resource)
 	if err != nil {
 		log.Error().Err(err).Msg("Error during status check")
-		return "", err
+		return handler, savedExport{}, err
 	}
 
 	log.Debug().Msg("Export completed successfully")
-	return handler, nil
+	return handler, saved, nil
 }
@@ -1,6 +1,7 @@
 package cmd
 
 import (
+	"context"
 	"net/http"
 	"net/http/httptest"
 	"os"
@@ -8,6 +9,7 @@ import (
 	"strings"
 	"testing"
 
+	"github.com/ren3gadem4rm0t/imperva-export-cli/pkg/client"
 	"github.com/spf13/viper"
 )
 
@@ -21,7 +23,7 @@ func TestInitiateAuto(t *testing.T) {
 			_, _ = w.Write([]byte(`{"handler": "28c5f5af-bd9e-423f-99a7-d2a8c440db7e", "status": "Export in progress"}`))
 		} else {
 			w.WriteHeader(http.StatusOK)
-			_, _ = w.Write([]byte("export file content"))
+			_, _ = w.Write(testExportContent)
 		}
 	}))
 	defer server.Close()
@@ -32,9 +34,9 @@ func TestInitiateAuto(t *testing.T) {
 	tempDir := t.TempDir()
 	viper.Set("output-dir", tempDir)
 
-	handler, err := initiateAuto(123456)
+	handler, _, err := runAuto(context.Background(), 123456, nil)
 	if err != nil {
-		t.Errorf("initiateAuto() error = %v, wantErr false", err)
+		t.Errorf("runAuto() error = %v, wantErr false", err)
 	}
 
 	if handler == "" {
@@ -53,14 +55,16 @@ func TestInitiateAuto_ErrorScenarios(t *testing.T) {
 	testCases := []struct {
 		name          string
 		handlerStatus int
+		body          string
 		wantErr       bool
 		errorMessage  string
 	}{
 		{
 			name:          "authentication failure",
 			handlerStatus: http.StatusUnauthorized,
+			body:          `{"errors":[{"status":401,"title":"Authentication Error","detail":"Authentication missing or invalid"}]}`,
 			wantErr:       true,
-			errorMessage:  "request failed after 3 retries with status code: 401",
+			errorMessage:  "API error: Authentication Error - Authentication missing or invalid (Status Code: 401)",
 		},
 		{
 			name:          "server error",
@@ -74,13 +78,14 @@ func TestInitiateAuto_ErrorScenarios(t *testing.T) {
 		t.Run(tc.name, func(t *testing.T) {
 			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 				w.WriteHeader(tc.handlerStatus)
+				_, _ = w.Write([]byte(tc.body))
 			}))
 			defer server.Close()
 
 			apiBaseURL = server.URL
 			defer func() { apiBaseURL = "" }()
 
-			_, err := initiateAuto(123456)
+			_, _, err := runAuto(context.Background(), 123456, nil)
 			if (err != nil) != tc.wantErr {
 				t.Errorf("Expected error = %v, got %v", tc.wantErr, err)
 			}
@@ -91,3 +96,39 @@ func TestInitiateAuto_ErrorScenarios(t *testing.T) {
 		})
 	}
 }
+
+func TestInitiateAutoResource(t *testing.T) {
+	viper.Set("api-id", "test-api-id")
+	viper.Set("api-key", "test-api-key")
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost {
+			if r.URL.Path != "/v3/export/SITE/1234" {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			w.WriteHeader(http.StatusAccepted)
+			_, _ = w.Write([]byte(`{"handler": "28c5f5af-bd9e-423f-99a7-d2a8c440db7e", "status": "Export in progress"}`))
+		} else {
+			w.WriteHeader(http.StatusOK)
+			_, _ = w.Write(testExportContent)
+		}
+	}))
+	defer server.Close()
+
+	apiBaseURL = server.URL
+	defer func() { apiBaseURL = "" }()
+
+	tempDir := t.TempDir()
+	viper.Set("output-dir", tempDir)
+
+	handler, _, err := runAuto(context.Background(), 123456, &client.Resource{Type: client.ResourceSite, ID: 1234})
+	if err != nil {
+		t.Fatalf("runAuto() error = %v, wantErr false", err)
+	}
+
+	expectedFile := filepath.Join(tempDir, "export_123456_site_1234_"+handler+".zip")
+	if _, err := os.Stat(expectedFile); os.IsNotExist(err) {
+		t.Errorf("Expected file %s to exist, but it does not", expectedFile)
+	}
+}
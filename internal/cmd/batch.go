@@ -0,0 +1,246 @@
+package cmd
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/ren3gadem4rm0t/imperva-export-cli/pkg/client"
+	"github.com/rs/zerolog/log"
+)
+
+// batchResult is the outcome of the export of a single account in a batch
+type batchResult struct {
+	CAID     int64
+	Handler  string
+	FilePath string
+	Size     int64
+	SHA256   string
+	// Extracted is the directory the export was extracted to, if it was
+	Extracted string
+	// Commit is the commit of the export in the git repository, if it changed anything
+	Commit string
+	// Uploaded is the URL of the export in object storage, if it was uploaded
+	Uploaded string
+	// RedactionReport is the report of the redaction of the export, if it was redacted
+	RedactionReport string
+	Duration        time.Duration
+	Err             error
+}
+
+// parseCAIDsFile reads account IDs from a file. IDs are separated by newlines or commas;
+// blank lines and lines starting with # are ignored.
+func parseCAIDsFile(path string) ([]int64, error) {
+	if err := ValidateFilePath(path); err != nil {
+		return nil, err
+	}
+	file, err := os.Open(path) // #nosec G304 -- Path validated above
+	if err != nil {
+		return nil, fmt.Errorf("failed to open caids file: %w", err)
+	}
+	defer file.Close()
+
+	var caids []int64
+	scanner := bufio.NewScanner(file)
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		for _, field := range strings.Split(line, ",") {
+			field = strings.TrimSpace(field)
+			if field == "" {
+				continue
+			}
+			caid, err := strconv.ParseInt(field, 10, 64)
+			if err != nil {
+				return nil, newValidationError(fmt.Errorf("invalid caid %q on line %d of %s", field, lineNumber, path))
+			}
+			caids = append(caids, caid)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read caids file: %w", err)
+	}
+	return caids, nil
+}
+
+// uniqueCAIDs validates the account IDs and removes duplicates, keeping the first occurrence
+func uniqueCAIDs(caids []int64) ([]int64, error) {
+	seen := make(map[int64]bool, len(caids))
+	unique := make([]int64, 0, len(caids))
+	for _, caid := range caids {
+		if err := ValidateCAID(caid); err != nil {
+			return nil, err
+		}
+		if seen[caid] {
+			continue
+		}
+		seen[caid] = true
+		unique = append(unique, caid)
+	}
+	return unique, nil
+}
+
+// runBatch exports every account with at most concurrency exports in flight.
+// A failure only affects the result of its own account. Results are returned in input order.
+func runBatch(ctx context.Context, caids []int64, concurrency int, timeout time.Duration) ([]batchResult, error) {
+	if concurrency < 1 {
+		return nil, newValidationError(fmt.Errorf("invalid concurrency: %d", concurrency))
+	}
+
+	// Polling progress of concurrent exports would interleave on stdout, so only the summary is printed
+	c, err := newClient(client.WithStatusHook(observedStatusHook(nil)))
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]batchResult, len(caids))
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+
+	for w := 0; w < concurrency && w < len(caids); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				results[i] = exportAccount(ctx, c, caids[i], timeout)
+			}
+		}()
+	}
+
+	for i := range caids {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	return results, nil
+}
+
+// exportAccount runs the full export flow for one account of a batch
+func exportAccount(ctx context.Context, c *client.Client, caid int64, timeout time.Duration) (result batchResult) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	ctx, span := startJobSpan(ctx, "auto export", caid, nil)
+	defer func() { endJobSpan(span, result.Handler, result.Err) }()
+
+	start := time.Now()
+	result = batchResult{CAID: caid}
+	logger := log.With().Int64("caid", caid).Logger()
+
+	logger.Info().Msg("Initiating export")
+	handler, err := c.Export(ctx, caid)
+	if err != nil {
+		logger.Error().Err(err).Msg("Failed to initiate export")
+		result.Err = err
+		result.Duration = time.Since(start)
+		return result
+	}
+	result.Handler = handler
+	trackJobStarted(caid, handler, nil)
+	logger.Info().Msgf("Export initiated. Handler ID: %s", handler)
+
+	saved, err := waitAndSave(ctx, c, caid, handler, nil)
+	result.FilePath, result.Size, result.SHA256, result.Err = saved.Path, saved.Size, saved.SHA256, err
+	result.Uploaded = saved.Uploaded
+	result.Duration = time.Since(start)
+	if result.Err != nil {
+		logger.Error().Err(result.Err).Msg("Export failed")
+	} else {
+		logger.Info().Msgf("Export file downloaded successfully to %s (%d bytes)", result.FilePath, result.Size)
+	}
+	return result
+}
+
+// processBatch redacts, extracts and commits the successful exports of a batch, as far as enabled. The
+// exports are processed one after another, so commits to the git repository never race. A failed
+// redaction, extraction or commit fails the result of its account.
+func processBatch(results []batchResult, opts saveOptions) {
+	for i := range results {
+		r := &results[i]
+		if r.Err != nil {
+			continue
+		}
+		saved := savedExport{Path: r.FilePath, Size: r.Size, SHA256: r.SHA256, Uploaded: r.Uploaded}
+		r.Err = processSaved(&saved, r.CAID, r.Handler, nil, opts)
+		r.Size, r.SHA256 = saved.Size, saved.SHA256
+		r.Extracted = saved.Extracted
+		r.Commit = saved.Commit
+		r.RedactionReport = saved.RedactionReport
+		if r.Err != nil {
+			log.Error().Err(r.Err).Int64("caid", r.CAID).Msg("Failed to process export")
+		}
+	}
+}
+
+// printBatchSummary writes a per-account summary table of the batch
+func printBatchSummary(w io.Writer, results []batchResult) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "CAID\tHANDLER\tFILE\tSIZE\tDURATION\tERROR")
+	for _, r := range results {
+		errMsg := "-"
+		if r.Err != nil {
+			errMsg = r.Err.Error()
+		}
+		fmt.Fprintf(tw, "%d\t%s\t%s\t%d\t%s\t%s\n",
+			r.CAID, orDash(r.Handler), orDash(r.FilePath), r.Size, r.Duration.Round(time.Millisecond), errMsg)
+	}
+	return tw.Flush()
+}
+
+// writeBatchOutput writes the results of the batch in a structured output format
+func writeBatchOutput(w io.Writer, format string, results []batchResult) error {
+	output := batchOutput{Results: make([]exportResult, len(results))}
+	for i, r := range results {
+		output.Results[i] = r.exportResult()
+		if r.Err != nil {
+			output.Failed++
+		}
+	}
+	return writeOutput(w, format, output)
+}
+
+// exportResult returns the structured result of the export of the account
+func (r batchResult) exportResult() exportResult {
+	saved := savedExport{
+		Path:            r.FilePath,
+		Size:            r.Size,
+		SHA256:          r.SHA256,
+		Extracted:       r.Extracted,
+		Commit:          r.Commit,
+		RedactionReport: r.RedactionReport,
+		Uploaded:        r.Uploaded,
+	}
+	return newExportResult(r.CAID, nil, r.Handler, saved, r.Duration, r.Err)
+}
+
+// batchError summarizes the failed exports of a batch, or returns nil if all succeeded
+func batchError(results []batchResult) error {
+	failed := 0
+	for _, r := range results {
+		if r.Err != nil {
+			failed++
+		}
+	}
+	if failed == 0 {
+		return nil
+	}
+	return fmt.Errorf("%d of %d exports failed", failed, len(results))
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
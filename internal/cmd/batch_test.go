@@ -0,0 +1,156 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+func TestParseCAIDsFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "caids.txt")
+	content := "# sub-accounts\n123\n456, 789\n\n  1011  \n"
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatalf("failed to write caids file: %v", err)
+	}
+
+	caids, err := parseCAIDsFile(path)
+	if err != nil {
+		t.Fatalf("parseCAIDsFile() error = %v", err)
+	}
+	want := []int64{123, 456, 789, 1011}
+	if fmt.Sprint(caids) != fmt.Sprint(want) {
+		t.Errorf("parseCAIDsFile() = %v, want %v", caids, want)
+	}
+
+	badPath := filepath.Join(dir, "bad.txt")
+	if err := os.WriteFile(badPath, []byte("123\nabc\n"), 0600); err != nil {
+		t.Fatalf("failed to write caids file: %v", err)
+	}
+	if _, err := parseCAIDsFile(badPath); err == nil || !strings.Contains(err.Error(), "line 2") {
+		t.Errorf("parseCAIDsFile() error = %v, want error for line 2", err)
+	}
+}
+
+func TestUniqueCAIDs(t *testing.T) {
+	caids, err := uniqueCAIDs([]int64{3, 1, 3, 2, 1})
+	if err != nil {
+		t.Fatalf("uniqueCAIDs() error = %v", err)
+	}
+	if fmt.Sprint(caids) != "[3 1 2]" {
+		t.Errorf("uniqueCAIDs() = %v, want [3 1 2]", caids)
+	}
+
+	if _, err := uniqueCAIDs([]int64{1, 0}); err == nil {
+		t.Errorf("uniqueCAIDs() expected error for invalid caid")
+	}
+}
+
+func TestRunBatch(t *testing.T) {
+	viper.Set("api-id", "test-api-id")
+	viper.Set("api-key", "test-api-key")
+
+	var mu sync.Mutex
+	inFlight, maxInFlight := 0, 0
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		inFlight++
+		if inFlight > maxInFlight {
+			maxInFlight = inFlight
+		}
+		mu.Unlock()
+		defer func() {
+			mu.Lock()
+			inFlight--
+			mu.Unlock()
+		}()
+		time.Sleep(20 * time.Millisecond)
+
+		caid := r.URL.Query().Get("caid")
+		if r.Method == http.MethodPost {
+			if caid == "2" {
+				w.WriteHeader(http.StatusNotFound)
+				_, _ = w.Write([]byte(`{"errors":[{"status":404,"title":"Not Found","detail":"Unknown account"}]}`))
+				return
+			}
+			w.WriteHeader(http.StatusAccepted)
+			_, _ = fmt.Fprintf(w, `{"handler": "00000000-0000-0000-0000-%012s", "status": "Export in progress"}`, caid)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write(testExportContent)
+	}))
+	defer server.Close()
+
+	originalURL := apiBaseURL
+	apiBaseURL = server.URL
+	defer func() { apiBaseURL = originalURL }()
+
+	tempDir := t.TempDir()
+	viper.Set("output-dir", tempDir)
+
+	caids := []int64{1, 2, 3, 4, 5}
+	results, err := runBatch(context.Background(), caids, 2, 30*time.Second)
+	if err != nil {
+		t.Fatalf("runBatch() error = %v", err)
+	}
+
+	if maxInFlight > 2 {
+		t.Errorf("max concurrent requests = %d, want at most 2", maxInFlight)
+	}
+
+	for i, r := range results {
+		if r.CAID != caids[i] {
+			t.Errorf("result %d caid = %d, want %d", i, r.CAID, caids[i])
+		}
+		if r.CAID == 2 {
+			if r.Err == nil {
+				t.Errorf("expected error for caid 2")
+			}
+			continue
+		}
+		if r.Err != nil {
+			t.Errorf("caid %d error = %v", r.CAID, r.Err)
+			continue
+		}
+		if _, err := os.Stat(r.FilePath); err != nil {
+			t.Errorf("caid %d file %s: %v", r.CAID, r.FilePath, err)
+		}
+		if r.Size != int64(len(testExportContent)) {
+			t.Errorf("caid %d size = %d", r.CAID, r.Size)
+		}
+	}
+
+	if err := batchError(results); err == nil || err.Error() != "1 of 5 exports failed" {
+		t.Errorf("batchError() = %v, want 1 of 5 exports failed", err)
+	}
+
+	var buf bytes.Buffer
+	if err := printBatchSummary(&buf, results); err != nil {
+		t.Fatalf("printBatchSummary() error = %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != len(caids)+1 {
+		t.Errorf("summary has %d lines, want %d:\n%s", len(lines), len(caids)+1, buf.String())
+	}
+	if !strings.HasPrefix(lines[0], "CAID") || !strings.Contains(lines[2], "Unknown account") {
+		t.Errorf("unexpected summary:\n%s", buf.String())
+	}
+}
+
+func TestRunBatch_InvalidConcurrency(t *testing.T) {
+	if _, err := runBatch(context.Background(), []int64{1}, 0, time.Minute); err == nil {
+		t.Errorf("runBatch() expected error for zero concurrency")
+	}
+}
@@ -0,0 +1,237 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var configCmd = &cobra.Command{
+	Use:   "config",
+	Short: "Show the CLI configuration",
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		return loadConfig()
+	},
+}
+
+var profilesCmd = &cobra.Command{
+	Use:   "profiles",
+	Short: "List and show the named profiles of the config file",
+	Long: `Named profiles hold the credentials and defaults of an account in the "profiles" section of the config file.
+Select a profile with --profile or the IMPERVA_PROFILE environment variable, or set "profile" in the config file.`,
+}
+
+var profilesListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List the named profiles with masked credentials",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cmd.SilenceUsage = true
+		return printProfiles(os.Stdout, outputFormat())
+	},
+}
+
+var profilesShowCmd = &cobra.Command{
+	Use:   "show [name]",
+	Short: "Show the settings of a profile with masked secrets, by default the selected profile",
+	Args:  cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cmd.SilenceUsage = true
+		name := viper.GetString("profile")
+		if len(args) == 1 {
+			name = args[0]
+		}
+		if name == "" {
+			return newValidationError(fmt.Errorf("no profile selected: pass a profile name or use --profile"))
+		}
+		return printProfile(os.Stdout, outputFormat(), name)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(configCmd)
+	configCmd.AddCommand(profilesCmd)
+	profilesCmd.AddCommand(profilesListCmd)
+	profilesCmd.AddCommand(profilesShowCmd)
+}
+
+// profileSettings returns the settings of the named profile. Profile names are case-insensitive.
+func profileSettings(name string) (map[string]interface{}, error) {
+	profile, ok := viper.GetStringMap("profiles")[strings.ToLower(name)]
+	if !ok {
+		return nil, newValidationError(fmt.Errorf("profile %q not found in config file", name))
+	}
+	settings, ok := profile.(map[string]interface{})
+	if !ok {
+		return nil, newValidationError(fmt.Errorf("profile %q in config file is not a map of settings", name))
+	}
+	return settings, nil
+}
+
+// applyProfile merges the settings of the selected profile over the top-level settings of the config file.
+// Flags and environment variables still take precedence over the profile.
+func applyProfile() error {
+	name := viper.GetString("profile")
+	if name == "" {
+		return nil
+	}
+	settings, err := profileSettings(name)
+	if err != nil {
+		return err
+	}
+	return viper.MergeConfigMap(settings)
+}
+
+// profileNames returns the sorted names of the profiles in the config file
+func profileNames() []string {
+	profiles := viper.GetStringMap("profiles")
+	names := make([]string, 0, len(profiles))
+	for name := range profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// printProfiles writes a table of the profiles, marking the selected one, or the profiles as JSON or YAML
+func printProfiles(w io.Writer, format string) error {
+	names := profileNames()
+	active := strings.ToLower(viper.GetString("profile"))
+	if format == outputJSON || format == outputYAML {
+		output := profilesOutput{Profiles: make([]profileOutput, 0, len(names))}
+		for _, name := range names {
+			profile, err := newProfileOutput(name)
+			if err != nil {
+				return err
+			}
+			profile.Selected = name == active
+			output.Profiles = append(output.Profiles, profile)
+		}
+		return writeOutput(w, format, output)
+	}
+
+	if len(names) == 0 {
+		_, err := fmt.Fprintln(w, "No profiles configured.")
+		return err
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "\tNAME\tAPI ID\tAPI KEY\tCAID\tOUTPUT DIR\tBASE URL")
+	for _, name := range names {
+		settings, err := profileSettings(name)
+		if err != nil {
+			return err
+		}
+		marker := ""
+		if name == active {
+			marker = "*"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n", marker, name,
+			settingString(settings, "api-id"),
+			maskSecret(settingString(settings, "api-key")),
+			settingString(settings, "caid"),
+			settingString(settings, "output-dir"),
+			settingString(settings, "base-url"))
+	}
+	return tw.Flush()
+}
+
+// printProfile writes every setting of the profile, masking secrets, as a table or as JSON or YAML
+func printProfile(w io.Writer, format, name string) error {
+	if format == outputJSON || format == outputYAML {
+		profile, err := newProfileOutput(name)
+		if err != nil {
+			return err
+		}
+		profile.Selected = strings.ToLower(name) == strings.ToLower(viper.GetString("profile"))
+		return writeOutput(w, format, profile)
+	}
+
+	settings, err := profileSettings(name)
+	if err != nil {
+		return err
+	}
+	keys := make([]string, 0, len(settings))
+	for key := range settings {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(tw, "profile:\t%s\n", strings.ToLower(name))
+	for _, key := range keys {
+		fmt.Fprintf(tw, "%s:\t%s\n", key, profileSetting(settings, key))
+	}
+	return tw.Flush()
+}
+
+// profilesOutput is the structured list of the profiles of the config file
+type profilesOutput struct {
+	Profiles []profileOutput `json:"profiles" yaml:"profiles"`
+}
+
+// profileOutput is the structured form of a profile with masked secrets
+type profileOutput struct {
+	Name     string            `json:"name" yaml:"name"`
+	Selected bool              `json:"selected" yaml:"selected"`
+	Settings map[string]string `json:"settings" yaml:"settings"`
+}
+
+// newProfileOutput builds the structured form of the named profile, masking secrets
+func newProfileOutput(name string) (profileOutput, error) {
+	settings, err := profileSettings(name)
+	if err != nil {
+		return profileOutput{}, err
+	}
+	profile := profileOutput{Name: strings.ToLower(name), Settings: make(map[string]string, len(settings))}
+	for key := range settings {
+		profile.Settings[key] = profileSetting(settings, key)
+	}
+	return profile, nil
+}
+
+// profileSetting returns a setting of a profile as a string, masked if it is a secret
+func profileSetting(settings map[string]interface{}, key string) string {
+	value := fmt.Sprint(settings[key])
+	if isSecretSetting(key) {
+		value = maskSecret(value)
+	}
+	return value
+}
+
+// settingString returns a setting of a profile as a string, or - if it is not set
+func settingString(settings map[string]interface{}, key string) string {
+	value, ok := settings[key]
+	if !ok || value == nil {
+		return "-"
+	}
+	return orDash(fmt.Sprint(value))
+}
+
+// isSecretSetting reports whether the value of a setting must not be printed in full
+func isSecretSetting(key string) bool {
+	key = strings.ToLower(key)
+	for _, marker := range []string{"key", "secret", "password", "token"} {
+		if strings.Contains(key, marker) {
+			return true
+		}
+	}
+	return false
+}
+
+// maskSecret hides all but the last four characters of a secret
+func maskSecret(secret string) string {
+	if secret == "" || secret == "-" {
+		return "-"
+	}
+	if len(secret) <= 8 {
+		return "****"
+	}
+	return "****" + secret[len(secret)-4:]
+}
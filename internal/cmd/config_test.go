@@ -0,0 +1,169 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+const testProfilesConfig = `
+api-id: default-id
+api-key: default-key-0000000000
+log-level: none
+profiles:
+  prod:
+    api-id: prod-id
+    api-key: prod-secret-key-1234
+    caid: 111
+    output-dir: /exports/prod
+  Staging:
+    api-id: staging-id
+    api-key: short
+`
+
+// useTestConfig loads the config file content for the duration of the test
+func useTestConfig(t *testing.T, content string) {
+	t.Helper()
+	viper.SetConfigType("yaml")
+	if err := viper.ReadConfig(strings.NewReader(content)); err != nil {
+		t.Fatalf("failed to read config: %v", err)
+	}
+	t.Cleanup(func() {
+		_ = viper.ReadConfig(strings.NewReader(""))
+		viper.Set("profile", nil)
+		viper.Set("api-id", nil)
+		viper.Set("api-key", nil)
+	})
+}
+
+func TestApplyProfile(t *testing.T) {
+	useTestConfig(t, testProfilesConfig)
+	viper.Set("api-id", nil)
+	viper.Set("api-key", nil)
+
+	viper.Set("profile", "prod")
+	if err := applyProfile(); err != nil {
+		t.Fatalf("applyProfile() error = %v", err)
+	}
+	if viper.GetString("api-id") != "prod-id" || viper.GetString("api-key") != "prod-secret-key-1234" || viper.GetInt64("caid") != 111 {
+		t.Errorf("profile settings not applied: api-id=%s caid=%d", viper.GetString("api-id"), viper.GetInt64("caid"))
+	}
+	if viper.GetString("log-level") != "none" {
+		t.Errorf("top-level setting lost, log-level = %q", viper.GetString("log-level"))
+	}
+
+	// Flags and environment variables take precedence over the profile
+	viper.Set("api-id", "flag-id")
+	if viper.GetString("api-id") != "flag-id" {
+		t.Errorf("flag did not override profile, api-id = %q", viper.GetString("api-id"))
+	}
+
+	viper.Set("profile", "missing")
+	if err := applyProfile(); err == nil || !strings.Contains(err.Error(), `profile "missing" not found`) {
+		t.Errorf("applyProfile() error = %v, want profile not found", err)
+	}
+}
+
+func TestCAIDFromFlags(t *testing.T) {
+	useTestConfig(t, testProfilesConfig)
+	newCmd := func() *cobra.Command {
+		cmd := &cobra.Command{}
+		cmd.Flags().Int64("caid", 0, "")
+		return cmd
+	}
+
+	if _, err := caidFromFlags(newCmd()); err == nil {
+		t.Error("caidFromFlags() without flag or profile should fail")
+	}
+
+	viper.Set("profile", "prod")
+	if err := applyProfile(); err != nil {
+		t.Fatalf("applyProfile() error = %v", err)
+	}
+	if caid, err := caidFromFlags(newCmd()); err != nil || caid != 111 {
+		t.Errorf("caidFromFlags() = %d, %v, want the profile caid 111", caid, err)
+	}
+	if caids := caidsOrDefault(nil); len(caids) != 1 || caids[0] != 111 {
+		t.Errorf("caidsOrDefault() = %v, want [111]", caids)
+	}
+
+	cmd := newCmd()
+	if err := cmd.Flags().Set("caid", "222"); err != nil {
+		t.Fatalf("failed to set flag: %v", err)
+	}
+	if caid, err := caidFromFlags(cmd); err != nil || caid != 222 {
+		t.Errorf("caidFromFlags() = %d, %v, want the flag caid 222", caid, err)
+	}
+}
+
+func TestPrintProfiles(t *testing.T) {
+	useTestConfig(t, testProfilesConfig)
+	viper.Set("profile", "prod")
+
+	var list bytes.Buffer
+	if err := printProfiles(&list, outputText); err != nil {
+		t.Fatalf("printProfiles() error = %v", err)
+	}
+	out := list.String()
+	if strings.Contains(out, "prod-secret-key-1234") {
+		t.Errorf("printProfiles() leaked the API key:\n%s", out)
+	}
+	for _, want := range []string{"*  prod", "****1234", "/exports/prod", "staging", "****"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("printProfiles() output missing %q:\n%s", want, out)
+		}
+	}
+
+	var show bytes.Buffer
+	if err := printProfile(&show, outputText, "Staging"); err != nil {
+		t.Fatalf("printProfile() error = %v", err)
+	}
+	if strings.Contains(show.String(), "short") || !strings.Contains(show.String(), "api-id:   staging-id") {
+		t.Errorf("unexpected printProfile() output:\n%s", show.String())
+	}
+
+	if err := printProfile(&show, outputJSON, "missing"); err == nil {
+		t.Error("printProfile() of a missing profile should fail")
+	}
+
+	list.Reset()
+	if err := printProfiles(&list, outputJSON); err != nil {
+		t.Fatalf("printProfiles() JSON error = %v", err)
+	}
+	var profiles profilesOutput
+	if err := json.Unmarshal(list.Bytes(), &profiles); err != nil {
+		t.Fatalf("printProfiles() wrote invalid JSON: %v\n%s", err, list.String())
+	}
+	if strings.Contains(list.String(), "prod-secret-key-1234") {
+		t.Errorf("printProfiles() leaked the API key:\n%s", list.String())
+	}
+	if len(profiles.Profiles) != 2 || profiles.Profiles[0].Name != "prod" || !profiles.Profiles[0].Selected ||
+		profiles.Profiles[0].Settings["api-key"] != "****1234" {
+		t.Errorf("unexpected profiles output: %+v", profiles)
+	}
+
+	show.Reset()
+	if err := printProfile(&show, outputYAML, "Staging"); err != nil {
+		t.Fatalf("printProfile() YAML error = %v", err)
+	}
+	if !strings.Contains(show.String(), "name: staging") || !strings.Contains(show.String(), "api-id: staging-id") {
+		t.Errorf("unexpected printProfile() YAML output:\n%s", show.String())
+	}
+}
+
+func TestMaskSecret(t *testing.T) {
+	tests := map[string]string{
+		"":                  "-",
+		"short":             "****",
+		"a-long-secret-key": "****-key",
+	}
+	for secret, want := range tests {
+		if got := maskSecret(secret); got != want {
+			t.Errorf("maskSecret(%q) = %q, want %q", secret, got, want)
+		}
+	}
+}
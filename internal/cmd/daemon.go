@@ -0,0 +1,294 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/ren3gadem4rm0t/imperva-export-cli/internal/archive"
+	"github.com/ren3gadem4rm0t/imperva-export-cli/internal/encryption"
+	"github.com/ren3gadem4rm0t/imperva-export-cli/internal/retention"
+	"github.com/robfig/cron/v3"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// exportSchedule exports a set of accounts on a cron schedule
+type exportSchedule struct {
+	Cron  string  `mapstructure:"cron"`
+	CAIDs []int64 `mapstructure:"caids"`
+}
+
+var daemonCmd = &cobra.Command{
+	Use:     "daemon",
+	Aliases: []string{"schedule"},
+	Short:   "Run scheduled account exports and apply a retention policy to the exported files",
+	Long: `Run account exports on cron-style schedules in a long-lived process.
+
+Schedules are read from the "schedules" list of the config file, each with a cron expression and the
+account IDs to export, or given with --schedule and --caid. After every run the retention policy is applied
+to the account exports in the output directory. Without any keep rule all files are kept.
+
+With --metrics-addr the metrics of the exports are served in the Prometheus text format on /metrics.
+
+On SIGINT or SIGTERM the daemon stops scheduling, cancels running exports and removes their partial downloads.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cmd.SilenceUsage = true
+		schedules, err := loadSchedules(cmd)
+		if err != nil {
+			return err
+		}
+
+		policy := retention.Policy{
+			KeepLast:    viper.GetInt("retention.keep-last"),
+			KeepDaily:   viper.GetInt("retention.keep-daily"),
+			KeepWeekly:  viper.GetInt("retention.keep-weekly"),
+			KeepMonthly: viper.GetInt("retention.keep-monthly"),
+		}
+		if err := policy.Validate(); err != nil {
+			return newValidationError(err)
+		}
+		if !policy.IsZero() && remoteDestination() {
+			return newValidationError(fmt.Errorf("retention policies only apply to exports saved to a local directory"))
+		}
+
+		concurrency, _ := cmd.Flags().GetInt("concurrency")
+		timeout, _ := cmd.Flags().GetDuration("timeout")
+
+		if addr := viper.GetString("metrics-addr"); addr != "" {
+			server, err := startMetricsServer(addr)
+			if err != nil {
+				return err
+			}
+			defer func() {
+				if err := server.Close(); err != nil {
+					log.Error().Err(err).Msg("Failed to stop metrics server")
+				}
+			}()
+		}
+
+		return runDaemon(cmd.Context(), schedules, policy, concurrency, timeout)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(daemonCmd)
+	daemonCmd.Flags().String("schedule", "", "Cron expression for the accounts given with --caid, e.g. \"0 2 * * *\" or @daily")
+	daemonCmd.Flags().Int64Slice("caid", nil, "Account IDs to export on --schedule (comma-separated)")
+	daemonCmd.Flags().Int("concurrency", 4, "Maximum number of concurrent exports per run")
+	daemonCmd.Flags().Duration("timeout", 10*time.Minute, "Maximum duration of the export of a single account")
+	daemonCmd.Flags().Int("keep-last", 0, "Keep the newest N exports of each account")
+	daemonCmd.Flags().Int("keep-daily", 0, "Keep the newest export of each of the last N days")
+	daemonCmd.Flags().Int("keep-weekly", 0, "Keep the newest export of each of the last N weeks")
+	daemonCmd.Flags().Int("keep-monthly", 0, "Keep the newest export of each of the last N months")
+	daemonCmd.Flags().String("metrics-addr", "", "Address to serve Prometheus metrics on at /metrics, e.g. :9090 (default is no metrics server)")
+	daemonCmd.MarkFlagsRequiredTogether("schedule", "caid")
+
+	if err := viper.BindPFlag("metrics-addr", daemonCmd.Flags().Lookup("metrics-addr")); err != nil {
+		log.Error().Err(err).Msg("Failed to bind flag metrics-addr")
+	}
+
+	for _, name := range []string{"keep-last", "keep-daily", "keep-weekly", "keep-monthly"} {
+		if err := viper.BindPFlag("retention."+name, daemonCmd.Flags().Lookup(name)); err != nil {
+			log.Error().Err(err).Msgf("Failed to bind flag %s", name)
+		}
+	}
+}
+
+// loadSchedules returns the schedules of the config file and the one given by flags
+func loadSchedules(cmd *cobra.Command) ([]exportSchedule, error) {
+	var schedules []exportSchedule
+	if err := viper.UnmarshalKey("schedules", &schedules); err != nil {
+		return nil, newValidationError(fmt.Errorf("invalid schedules in config file: %w", err))
+	}
+
+	spec, _ := cmd.Flags().GetString("schedule")
+	caids, _ := cmd.Flags().GetInt64Slice("caid")
+	if spec != "" {
+		schedules = append(schedules, exportSchedule{Cron: spec, CAIDs: caids})
+	}
+
+	if len(schedules) == 0 {
+		return nil, newValidationError(fmt.Errorf("no schedules configured: use --schedule and --caid or the schedules list of the config file"))
+	}
+	for i := range schedules {
+		if err := validateSchedule(&schedules[i]); err != nil {
+			return nil, err
+		}
+	}
+	return schedules, nil
+}
+
+// validateSchedule checks the cron expression and removes duplicate account IDs
+func validateSchedule(s *exportSchedule) error {
+	if _, err := cron.ParseStandard(s.Cron); err != nil {
+		return newValidationError(fmt.Errorf("invalid schedule %q: %w", s.Cron, err))
+	}
+	caids, err := uniqueCAIDs(s.CAIDs)
+	if err != nil {
+		return err
+	}
+	if len(caids) == 0 {
+		return newValidationError(fmt.Errorf("schedule %q has no caids", s.Cron))
+	}
+	s.CAIDs = caids
+	return nil
+}
+
+// runDaemon runs the schedules until the context is cancelled and waits for running exports to stop.
+// A run that is still in progress when its schedule fires again is skipped.
+func runDaemon(ctx context.Context, schedules []exportSchedule, policy retention.Policy, concurrency int, timeout time.Duration) error {
+	if concurrency < 1 {
+		return newValidationError(fmt.Errorf("invalid concurrency: %d", concurrency))
+	}
+
+	scheduler := cron.New(
+		cron.WithLogger(cronLogger{}),
+		cron.WithChain(cron.SkipIfStillRunning(cronLogger{})),
+	)
+	for _, s := range schedules {
+		s := s
+		if _, err := scheduler.AddFunc(s.Cron, func() {
+			runScheduledExports(ctx, s.CAIDs, policy, concurrency, timeout)
+		}); err != nil {
+			return fmt.Errorf("invalid schedule %q: %w", s.Cron, err)
+		}
+	}
+
+	scheduler.Start()
+	for _, entry := range scheduler.Entries() {
+		log.Info().Msgf("Next scheduled export at %s", entry.Next.Format(time.RFC3339))
+	}
+	if printsText() {
+		fmt.Printf("Daemon started with %d schedules\n", len(schedules))
+	}
+
+	<-ctx.Done()
+	log.Info().Msg("Shutting down, waiting for running exports to stop")
+	<-scheduler.Stop().Done()
+	log.Info().Msg("Daemon stopped")
+	return nil
+}
+
+// runScheduledExports exports the accounts of one scheduled run and applies the retention policy
+func runScheduledExports(ctx context.Context, caids []int64, policy retention.Policy, concurrency int, timeout time.Duration) {
+	if ctx.Err() != nil {
+		return
+	}
+
+	results, err := runBatch(ctx, caids, concurrency, timeout)
+	if err != nil {
+		log.Error().Err(err).Msg("Scheduled export failed")
+		return
+	}
+	exportMetrics.observeBatch(results)
+	auditTrail.recordBatch(results)
+
+	if ctx.Err() != nil {
+		// The next run starts a new export, so a partial download cancelled by shutdown is never resumed
+		for _, r := range results {
+			if r.Err != nil && r.Handler != "" {
+				removePartialDownload(r.Handler)
+			}
+		}
+		return
+	}
+
+	if printsText() {
+		if err := printBatchSummary(os.Stdout, results); err != nil {
+			log.Error().Err(err).Msg("Failed to print export summary")
+		}
+	}
+	if err := batchError(results); err != nil {
+		log.Error().Err(err).Msg("Scheduled export finished with errors")
+	}
+
+	for _, r := range results {
+		if r.Err != nil {
+			// A partial download stays on disk for jobs resume, but the daemon itself never resumes it
+			keptPartials.forget(r.Handler)
+			continue
+		}
+		if err := applyRetention(r.CAID, policy); err != nil {
+			log.Error().Err(err).Int64("caid", r.CAID).Msg("Failed to apply retention policy")
+		}
+	}
+}
+
+// removePartialDownload removes the partial download that the sink of an interrupted export kept for resume.
+// The sinks of encrypted exports and remote destinations discard theirs when the download is aborted.
+func removePartialDownload(handler string) {
+	partial, ok := keptPartials.forget(handler)
+	if !ok {
+		return
+	}
+	if err := os.Remove(partial.path); err != nil && !os.IsNotExist(err) {
+		log.Error().Err(err).Msgf("Failed to remove temp file: %s", partial.path)
+		return
+	}
+	log.Debug().Msgf("Removed partial download: %s", partial.path)
+}
+
+// applyRetention removes the account exports of caid in the output directory that the policy does not keep,
+// together with their manifests. Single-resource exports are never removed.
+func applyRetention(caid int64, policy retention.Policy) error {
+	if policy.IsZero() {
+		return nil
+	}
+
+	// Encrypted and plain exports are retained together, so enabling encryption does not keep old exports forever
+	prefix := fmt.Sprintf("export_%d_", caid)
+	var matches []string
+	for _, suffix := range []string{".zip", ".zip" + encryption.Suffix} {
+		found, err := filepath.Glob(filepath.Join(outputDirectory(), prefix+"*"+suffix))
+		if err != nil {
+			return fmt.Errorf("failed to list exports: %w", err)
+		}
+		matches = append(matches, found...)
+	}
+
+	items := make([]retention.Item, 0, len(matches))
+	for _, path := range matches {
+		name := strings.TrimSuffix(filepath.Base(path), encryption.Suffix)
+		handler := strings.TrimSuffix(strings.TrimPrefix(name, prefix), ".zip")
+		if ValidateHandler(handler) != nil {
+			continue
+		}
+		info, err := os.Stat(path)
+		if err != nil {
+			return fmt.Errorf("failed to stat export: %w", err)
+		}
+		items = append(items, retention.Item{Path: path, Time: info.ModTime()})
+	}
+
+	_, remove := retention.Apply(items, policy)
+	for _, item := range remove {
+		if err := os.Remove(item.Path); err != nil {
+			return fmt.Errorf("failed to remove export: %w", err)
+		}
+		if err := os.Remove(item.Path + archive.ManifestSuffix); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to remove manifest: %w", err)
+		}
+		log.Info().Msgf("Removed export %s by retention policy", item.Path)
+	}
+	return nil
+}
+
+// cronLogger writes the messages of the scheduler to the global logger
+type cronLogger struct{}
+
+func (cronLogger) Info(msg string, keysAndValues ...interface{}) {
+	if msg == "skip" {
+		log.Warn().Fields(keysAndValues).Msg("Skipping scheduled export, the previous run is still in progress")
+		return
+	}
+	log.Debug().Fields(keysAndValues).Msg(msg)
+}
+
+func (cronLogger) Error(err error, msg string, keysAndValues ...interface{}) {
+	log.Error().Err(err).Fields(keysAndValues).Msg(msg)
+}
@@ -0,0 +1,268 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ren3gadem4rm0t/imperva-export-cli/internal/archive"
+	"github.com/ren3gadem4rm0t/imperva-export-cli/internal/encryption"
+	"github.com/ren3gadem4rm0t/imperva-export-cli/internal/retention"
+	"github.com/ren3gadem4rm0t/imperva-export-cli/internal/sink"
+	"github.com/ren3gadem4rm0t/imperva-export-cli/internal/sink/sinktest"
+	"github.com/spf13/viper"
+)
+
+func TestValidateSchedule(t *testing.T) {
+	s := exportSchedule{Cron: "0 2 * * *", CAIDs: []int64{2, 1, 2}}
+	if err := validateSchedule(&s); err != nil {
+		t.Fatalf("validateSchedule() error = %v", err)
+	}
+	if fmt.Sprint(s.CAIDs) != "[2 1]" {
+		t.Errorf("validateSchedule() caids = %v, want [2 1]", s.CAIDs)
+	}
+
+	for _, invalid := range []exportSchedule{
+		{Cron: "every night", CAIDs: []int64{1}},
+		{Cron: "@daily"},
+		{Cron: "@daily", CAIDs: []int64{0}},
+	} {
+		if err := validateSchedule(&invalid); err == nil {
+			t.Errorf("validateSchedule(%+v) should fail", invalid)
+		}
+	}
+}
+
+func TestApplyRetention(t *testing.T) {
+	dir := t.TempDir()
+	viper.Set("output-dir", dir)
+	defer viper.Set("output-dir", "")
+
+	now := time.Now()
+	var paths []string
+	for i := 0; i < 4; i++ {
+		path := filepath.Join(dir, exportFileName(1, fmt.Sprintf("00000000-0000-0000-0000-00000000000%d", i), nil))
+		if i%2 == 1 {
+			// Encrypted exports are retained together with plain ones
+			path += encryption.Suffix
+		}
+		for _, p := range []string{path, path + archive.ManifestSuffix} {
+			if err := os.WriteFile(p, []byte("export"), 0600); err != nil {
+				t.Fatalf("failed to write export: %v", err)
+			}
+			mtime := now.Add(-time.Duration(i) * time.Hour)
+			if err := os.Chtimes(p, mtime, mtime); err != nil {
+				t.Fatalf("failed to set mtime: %v", err)
+			}
+		}
+		paths = append(paths, path)
+	}
+	others := []string{
+		filepath.Join(dir, "export_1_site_7_00000000-0000-0000-0000-000000000009.zip"),
+		filepath.Join(dir, "export_2_00000000-0000-0000-0000-000000000009.zip"),
+	}
+	for _, p := range others {
+		if err := os.WriteFile(p, []byte("export"), 0600); err != nil {
+			t.Fatalf("failed to write export: %v", err)
+		}
+	}
+
+	if err := applyRetention(1, retention.Policy{KeepLast: 2}); err != nil {
+		t.Fatalf("applyRetention() error = %v", err)
+	}
+
+	for i, path := range paths {
+		for _, p := range []string{path, path + archive.ManifestSuffix} {
+			_, err := os.Stat(p)
+			if kept := err == nil; kept != (i < 2) {
+				t.Errorf("%s kept = %v, want %v", filepath.Base(p), kept, i < 2)
+			}
+		}
+	}
+	for _, p := range others {
+		if _, err := os.Stat(p); err != nil {
+			t.Errorf("unrelated export %s was removed", filepath.Base(p))
+		}
+	}
+}
+
+func TestRunDaemon(t *testing.T) {
+	viper.Set("api-id", "test-api-id")
+	viper.Set("api-key", "test-api-key")
+
+	var exports atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost {
+			w.WriteHeader(http.StatusAccepted)
+			_, _ = fmt.Fprintf(w, `{"handler": "00000000-0000-0000-0000-%012d", "status": "Export in progress"}`, exports.Add(1))
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write(testExportContent)
+	}))
+	defer server.Close()
+
+	originalURL := apiBaseURL
+	apiBaseURL = server.URL
+	defer func() { apiBaseURL = originalURL }()
+
+	dir := t.TempDir()
+	viper.Set("output-dir", dir)
+	defer viper.Set("output-dir", "")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done := make(chan error, 1)
+	go func() {
+		done <- runDaemon(ctx, []exportSchedule{{Cron: "@every 1s", CAIDs: []int64{1}}}, retention.Policy{KeepLast: 1}, 1, 30*time.Second)
+	}()
+
+	// Runs never overlap, so once the third export starts the second run has applied the retention policy
+	deadline := time.After(10 * time.Second)
+	for exports.Load() < 3 {
+		select {
+		case <-deadline:
+			t.Fatal("daemon did not run the schedule three times")
+		case <-time.After(100 * time.Millisecond):
+		}
+	}
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatalf("runDaemon() error = %v", err)
+	}
+
+	zips, _ := filepath.Glob(filepath.Join(dir, "export_1_*.zip"))
+	if len(zips) != 1 {
+		t.Errorf("exports after retention = %v, want 1", zips)
+	}
+}
+
+func TestRunDaemon_ShutdownRemovesPartialDownload(t *testing.T) {
+	viper.Set("api-id", "test-api-id")
+	viper.Set("api-key", "test-api-key")
+
+	handler := "00000000-0000-0000-0000-000000000042"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost {
+			w.WriteHeader(http.StatusAccepted)
+			_, _ = fmt.Fprintf(w, `{"handler": "%s", "status": "Export in progress"}`, handler)
+			return
+		}
+		// Send half of the archive and stall until the client gives up
+		w.Header().Set("Content-Length", fmt.Sprint(len(testExportContent)))
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write(testExportContent[:len(testExportContent)/2])
+		w.(http.Flusher).Flush()
+		<-r.Context().Done()
+	}))
+	defer server.Close()
+
+	originalURL := apiBaseURL
+	apiBaseURL = server.URL
+	defer func() { apiBaseURL = originalURL }()
+
+	tests := []struct {
+		name string
+		// setup configures the destination and returns the directory the partial download is written to
+		setup func(t *testing.T, outputDir string) string
+	}{
+		{
+			name:  "output directory",
+			setup: func(t *testing.T, outputDir string) string { return outputDir },
+		},
+		{
+			name: "local destination",
+			setup: func(t *testing.T, outputDir string) string {
+				dir := t.TempDir()
+				useDest(t, dir)
+				return dir
+			},
+		},
+		{
+			name: "encrypted",
+			setup: func(t *testing.T, outputDir string) string {
+				useEncryption(t)
+				return outputDir
+			},
+		},
+		{
+			name: "webdav",
+			setup: func(t *testing.T, outputDir string) string {
+				root := t.TempDir()
+				httpServer := httptest.NewServer(sinktest.NewWebDAVServer(root, "backup", "secret"))
+				t.Cleanup(httpServer.Close)
+				useDest(t, "webdav://backup@"+strings.TrimPrefix(httpServer.URL, "http://")+"/backups")
+				viper.Set("webdav.password", "secret")
+				// The bytes written to a remote sink are spooled to TMPDIR, so the spool file shows the download started
+				spoolDir := t.TempDir()
+				t.Setenv("TMPDIR", spoolDir)
+				return spoolDir
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			outputDir := t.TempDir()
+			viper.Set("output-dir", outputDir)
+			defer viper.Set("output-dir", "")
+			dir := tt.setup(t, outputDir)
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			done := make(chan error, 1)
+			go func() {
+				done <- runDaemon(ctx, []exportSchedule{{Cron: "@every 1s", CAIDs: []int64{1}}}, retention.Policy{}, 1, 30*time.Second)
+			}()
+
+			deadline := time.After(10 * time.Second)
+			for len(partialFiles(t, dir)) == 0 {
+				select {
+				case <-deadline:
+					t.Fatal("download did not start")
+				case <-time.After(50 * time.Millisecond):
+				}
+			}
+			cancel()
+			if err := <-done; err != nil {
+				t.Fatalf("runDaemon() error = %v", err)
+			}
+
+			if partials := partialFiles(t, dir); len(partials) > 0 {
+				t.Errorf("partial downloads left behind: %v", partials)
+			}
+			if _, kept := keptPartials.lookup(handler); kept {
+				t.Error("the partial download is still recorded after the shutdown")
+			}
+		})
+	}
+}
+
+// partialFiles returns the names of the non-empty temp files in the directory
+func partialFiles(t *testing.T, dir string) []string {
+	t.Helper()
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("failed to read directory: %v", err)
+	}
+	var names []string
+	for _, entry := range entries {
+		if info, err := entry.Info(); err == nil && strings.HasSuffix(entry.Name(), sink.TempSuffix) && info.Size() > 0 {
+			names = append(names, entry.Name())
+		}
+	}
+	return names
+}
+
+func TestRunDaemon_InvalidConcurrency(t *testing.T) {
+	if err := runDaemon(context.Background(), nil, retention.Policy{}, 0, time.Minute); err == nil {
+		t.Error("runDaemon() expected error for zero concurrency")
+	}
+}
@@ -0,0 +1,164 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+
+	"github.com/ren3gadem4rm0t/imperva-export-cli/internal/sink"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/viper"
+)
+
+// exportDestination returns the destination of saved exports given with --dest, or nil if exports are
+// saved to the output directory
+func exportDestination() (*url.URL, error) {
+	dest := viper.GetString("dest")
+	if dest == "" {
+		return nil, nil
+	}
+	u, err := sink.ParseDest(dest)
+	if err != nil {
+		return nil, newValidationError(err)
+	}
+	return u, nil
+}
+
+// remoteDestination reports whether exports are saved to a remote host rather than a local directory
+func remoteDestination() bool {
+	dest, err := exportDestination()
+	return err == nil && dest != nil && !sink.IsLocal(dest)
+}
+
+// newExportSink returns the sink exports are saved to. The partial file of an interrupted download to a
+// local directory is resumed if resume is set.
+func newExportSink(resume bool) (sink.ExportSink, error) {
+	dest, err := exportDestination()
+	if err != nil {
+		return nil, err
+	}
+	if dest == nil || sink.IsLocal(dest) {
+		outputDir := outputDirectory()
+		if err := ValidateOutputDir(outputDir); err != nil {
+			return nil, fmt.Errorf("invalid output dir: %w", err)
+		}
+		dest = &url.URL{Scheme: sink.SchemeFile, Path: filepath.ToSlash(outputDir)}
+	}
+	httpClient, err := sharedHTTPClient()
+	if err != nil {
+		return nil, err
+	}
+
+	s, err := sink.New(dest, sink.Options{
+		Resume: resume,
+		SFTP: sink.SFTPAuth{
+			IdentityFile:   viper.GetString("sftp.identity"),
+			Password:       viper.GetString("sftp.password"),
+			KnownHostsFile: viper.GetString("sftp.known-hosts"),
+		},
+		WebDAVPassword: viper.GetString("webdav.password"),
+		HTTPClient:     httpClient,
+	})
+	if err != nil {
+		return nil, newValidationError(fmt.Errorf("invalid destination %s: %w", dest.Redacted(), err))
+	}
+	return s, nil
+}
+
+// localDestination returns the directory of a --dest that is a local directory
+func localDestination() (string, bool) {
+	dest, err := exportDestination()
+	if err != nil || dest == nil || !sink.IsLocal(dest) {
+		return "", false
+	}
+	return filepath.FromSlash(dest.Path), true
+}
+
+// exportFile is the file an export is downloaded to. It implements client.ResumableWriter and writes every
+// byte to the sink, to the upload to object storage, if any, and to a local spool file the export is
+// verified from if the sink is remote and cannot be read back.
+type exportFile struct {
+	sink     sink.ExportSink
+	tempPath string
+	upload   *exportUpload
+	spool    *os.File
+}
+
+// newExportFile returns the file of an opened sink. The temp file of a local directory is read back for
+// verification; the bytes written to a remote sink are spooled to a temp file instead, which close removes.
+func newExportFile(s sink.ExportSink, upload *exportUpload) (*exportFile, error) {
+	f := &exportFile{sink: s, upload: upload}
+	if local, ok := s.(*sink.Local); ok {
+		f.tempPath = local.TempPath()
+		return f, nil
+	}
+	spool, err := os.CreateTemp("", "imperva-export-*.zip"+sink.TempSuffix)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create spool file: %w", err)
+	}
+	f.spool = spool
+	return f, nil
+}
+
+// Write writes p to the sink, the upload and the spool file
+func (f *exportFile) Write(p []byte) (int, error) {
+	n, err := f.sink.Write(p)
+	if n > 0 {
+		if f.spool != nil {
+			if _, spoolErr := f.spool.Write(p[:n]); spoolErr != nil {
+				return n, fmt.Errorf("failed to write spool file: %w", spoolErr)
+			}
+		}
+		if f.upload != nil {
+			if _, uploadErr := f.upload.Write(p[:n]); uploadErr != nil {
+				return n, fmt.Errorf("failed to upload export: %w", uploadErr)
+			}
+		}
+	}
+	return n, err
+}
+
+// Size returns the number of bytes in the file, including those of a resumed partial download
+func (f *exportFile) Size() (int64, error) {
+	return f.sink.Size()
+}
+
+// Reset discards the contents of the file, so the download starts over
+func (f *exportFile) Reset() error {
+	if err := f.sink.Reset(); err != nil {
+		return err
+	}
+	if f.spool != nil {
+		if err := f.spool.Truncate(0); err != nil {
+			return fmt.Errorf("failed to reset spool file: %w", err)
+		}
+		if _, err := f.spool.Seek(0, io.SeekStart); err != nil {
+			return fmt.Errorf("failed to reset spool file: %w", err)
+		}
+	}
+	if f.upload != nil {
+		return f.upload.restart()
+	}
+	return nil
+}
+
+// verifyPath returns the path of the local file the export is verified from
+func (f *exportFile) verifyPath() string {
+	if f.spool != nil {
+		return f.spool.Name()
+	}
+	return f.tempPath
+}
+
+// close removes the spool file, if any
+func (f *exportFile) close() {
+	if f.spool == nil {
+		return
+	}
+	_ = f.spool.Close()
+	if err := os.Remove(f.spool.Name()); err != nil {
+		log.Warn().Err(err).Msgf("Failed to remove spool file %s", f.spool.Name())
+	}
+}
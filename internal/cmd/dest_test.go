@@ -0,0 +1,160 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ren3gadem4rm0t/imperva-export-cli/internal/archive"
+	"github.com/ren3gadem4rm0t/imperva-export-cli/internal/encryption"
+	"github.com/ren3gadem4rm0t/imperva-export-cli/internal/sink/sinktest"
+	"github.com/ren3gadem4rm0t/imperva-export-cli/pkg/mockserver"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// useDest saves exports to the destination
+func useDest(t *testing.T, dest string) {
+	t.Helper()
+	viper.Set("dest", dest)
+	t.Cleanup(func() {
+		viper.Set("dest", nil)
+		viper.Set("sftp.password", nil)
+		viper.Set("sftp.known-hosts", nil)
+		viper.Set("webdav.password", nil)
+	})
+}
+
+// autoExportResult runs an account export and returns its structured result
+func autoExportResult(t *testing.T) exportResult {
+	t.Helper()
+	out := captureResults(t, outputJSON)
+	if err := autoExport(context.Background(), 1234, nil, saveOptions{}); err != nil {
+		t.Fatalf("autoExport() error = %v", err)
+	}
+	var result exportResult
+	if err := json.Unmarshal(out.Bytes(), &result); err != nil {
+		t.Fatalf("output is not JSON: %v", err)
+	}
+	return result
+}
+
+// assertSavedExport checks that the directory holds the export of the result and its manifest
+func assertSavedExport(t *testing.T, dir string, result exportResult) {
+	t.Helper()
+	name := exportFileName(1234, result.Handler, nil)
+	data, err := os.ReadFile(filepath.Join(dir, name))
+	if err != nil || !bytes.Equal(data, newTestExportZip()) {
+		t.Fatalf("saved export differs from the download: %v", err)
+	}
+	var manifest archive.Manifest
+	data, err = os.ReadFile(filepath.Join(dir, name+archive.ManifestSuffix))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		t.Fatal(err)
+	}
+	if manifest.Archive != name || manifest.SHA256 != result.SHA256 || manifest.CAID != 1234 || len(manifest.Entries) == 0 {
+		t.Errorf("manifest = %+v", manifest)
+	}
+	if temps, _ := filepath.Glob(filepath.Join(dir, "*.tmp")); len(temps) != 0 {
+		t.Errorf("temp files left behind: %v", temps)
+	}
+}
+
+func TestAutoExport_SFTP(t *testing.T) {
+	useMockServer(t, mockserver.WithPolls(0), mockserver.WithFixture(newTestExportZip()))
+	server, err := sinktest.NewSFTPServer("backup", "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = server.Close() })
+	knownHosts := filepath.Join(t.TempDir(), "known_hosts")
+	if err := os.WriteFile(knownHosts, []byte(server.KnownHosts()), 0600); err != nil {
+		t.Fatal(err)
+	}
+	dir := filepath.Join(t.TempDir(), "imperva")
+	useDest(t, "sftp://backup@"+server.Addr()+filepath.ToSlash(dir))
+	viper.Set("sftp.password", "secret")
+	viper.Set("sftp.known-hosts", knownHosts)
+
+	result := autoExportResult(t)
+	if !strings.HasPrefix(result.File, "sftp://backup@"+server.Addr()+"/") {
+		t.Errorf("file = %q, want an sftp:// URL", result.File)
+	}
+	assertSavedExport(t, dir, result)
+	if entries, _ := os.ReadDir(outputDirectory()); len(entries) != 0 {
+		t.Errorf("export written to the output directory: %v", entries)
+	}
+
+	// An encrypted export is verified before encryption and saved encrypted
+	useEncryption(t)
+	result = autoExportResult(t)
+	saved := filepath.Join(dir, exportFileName(1234, result.Handler, nil))
+	if encrypted, err := encryption.IsEncrypted(saved); err != nil || !encrypted {
+		t.Errorf("saved export is not encrypted: %v", err)
+	}
+}
+
+func TestAutoExport_WebDAV(t *testing.T) {
+	useMockServer(t, mockserver.WithPolls(0), mockserver.WithFixture(newTestExportZip()))
+	root := t.TempDir()
+	httpServer := httptest.NewServer(sinktest.NewWebDAVServer(root, "backup", "secret"))
+	t.Cleanup(httpServer.Close)
+	useDest(t, "webdav://backup@"+strings.TrimPrefix(httpServer.URL, "http://")+"/backups/imperva")
+	viper.Set("webdav.password", "secret")
+	spoolDir := t.TempDir()
+	t.Setenv("TMPDIR", spoolDir)
+
+	result := autoExportResult(t)
+	assertSavedExport(t, filepath.Join(root, "backups", "imperva"), result)
+
+	// A failed upload leaves nothing behind
+	viper.Set("webdav.password", "wrong")
+	captureResults(t, outputJSON)
+	if err := autoExport(context.Background(), 1234, nil, saveOptions{}); ExitCode(err) != ExitIO {
+		t.Errorf("autoExport() with a wrong password error = %v, want an I/O error", err)
+	}
+	if entries, _ := os.ReadDir(filepath.Join(root, "backups", "imperva")); len(entries) != 2 {
+		t.Errorf("failed export changed the collection: %v", entries)
+	}
+	// The export is verified from a spool file, which is removed afterwards
+	if entries, _ := os.ReadDir(spoolDir); len(entries) != 0 {
+		t.Errorf("spool files were left behind: %v", entries)
+	}
+}
+
+func TestAutoExport_LocalDest(t *testing.T) {
+	useMockServer(t, mockserver.WithPolls(0), mockserver.WithFixture(newTestExportZip()))
+	dir := filepath.Join(t.TempDir(), "backups")
+	useDest(t, "file://"+filepath.ToSlash(dir))
+
+	result := autoExportResult(t)
+	if filepath.Dir(result.File) != dir || outputDirectory() != dir {
+		t.Errorf("file = %q, output directory = %q, want them in %s", result.File, outputDirectory(), dir)
+	}
+	assertSavedExport(t, dir, result)
+}
+
+func TestSaveOptionsFromFlags_RemoteDest(t *testing.T) {
+	useDest(t, "sftp://backup@backup.example.com/srv/imperva")
+	cmd := &cobra.Command{}
+	addSaveFlags(cmd)
+	if err := cmd.ParseFlags([]string{"--extract"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := saveOptionsFromFlags(cmd); ExitCode(err) != ExitValidation {
+		t.Errorf("saveOptionsFromFlags() accepted --extract with a remote destination: %v", err)
+	}
+
+	viper.Set("dest", "ftp://backup.example.com/srv")
+	if _, err := newExportSink(true); ExitCode(err) != ExitValidation {
+		t.Errorf("newExportSink() accepted an unsupported destination: %v", err)
+	}
+}
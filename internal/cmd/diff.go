@@ -0,0 +1,99 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/ren3gadem4rm0t/imperva-export-cli/internal/terraform"
+	"github.com/spf13/cobra"
+)
+
+// ErrChanges is returned by the diff command with --exit-code when the exports differ
+var ErrChanges = errors.New("exports differ")
+
+var diffCmd = &cobra.Command{
+	Use:   "diff <old.zip> <new.zip>",
+	Short: "Show the resources that changed between two export archives",
+	Long: `Parses the Terraform files of two export archives, matches resources and data sources by type and name
+and reports the resources that were added, removed or changed with their attribute-level changes.
+The order of blocks and attributes and the formatting of the files are ignored.`,
+	Args: cobra.ExactArgs(2),
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		return loadConfig()
+	},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cmd.SilenceUsage = true
+		format, err := commandFormat(cmd, reportFormats...)
+		if err != nil {
+			return err
+		}
+		exitCode, _ := cmd.Flags().GetBool("exit-code")
+
+		changed, err := diffExports(os.Stdout, args[0], args[1], format)
+		if err != nil {
+			return err
+		}
+		if changed && exitCode {
+			cmd.SilenceErrors = true
+			return ErrChanges
+		}
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(diffCmd)
+	diffCmd.Flags().String("format", "text", "Output format (text, json)")
+	diffCmd.Flags().Bool("exit-code", false, "Exit with status 1 if the exports differ")
+}
+
+// diffExports compares two export archives, writes the differences and reports whether they differ
+func diffExports(w io.Writer, oldPath, newPath, format string) (bool, error) {
+	oldConfig, err := loadExportConfig(oldPath)
+	if err != nil {
+		return false, fmt.Errorf("error reading old export: %w", err)
+	}
+	newConfig, err := loadExportConfig(newPath)
+	if err != nil {
+		return false, fmt.Errorf("error reading new export: %w", err)
+	}
+
+	diff := terraform.Compare(oldConfig, newConfig)
+	if format == outputJSON || format == outputYAML {
+		return diff.HasChanges(), writeOutput(w, format, diff)
+	}
+	return diff.HasChanges(), printDiff(w, diff)
+}
+
+// diffSymbols prefixes resources and attributes by change kind like terraform plan
+var diffSymbols = map[string]string{
+	terraform.ChangeAdded:   "+",
+	terraform.ChangeRemoved: "-",
+	terraform.ChangeChanged: "~",
+}
+
+// printDiff writes every changed resource followed by its attribute changes and a summary line
+func printDiff(w io.Writer, diff *terraform.Diff) error {
+	if !diff.HasChanges() {
+		_, err := fmt.Fprintln(w, "No changes.")
+		return err
+	}
+
+	for _, resource := range diff.Resources {
+		fmt.Fprintf(w, "%s %s\n", diffSymbols[resource.Change], resource.Address)
+		for _, attr := range resource.Attributes {
+			switch attr.Change {
+			case terraform.ChangeAdded:
+				fmt.Fprintf(w, "    + %s = %s\n", attr.Path, attr.New)
+			case terraform.ChangeRemoved:
+				fmt.Fprintf(w, "    - %s = %s\n", attr.Path, attr.Old)
+			default:
+				fmt.Fprintf(w, "    ~ %s = %s -> %s\n", attr.Path, attr.Old, attr.New)
+			}
+		}
+	}
+	_, err := fmt.Fprintf(w, "\nAdded: %d, removed: %d, changed: %d\n", diff.Added, diff.Removed, diff.Changed)
+	return err
+}
@@ -0,0 +1,89 @@
+package cmd
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ren3gadem4rm0t/imperva-export-cli/internal/terraform"
+)
+
+func writeTestZip(t *testing.T, name, content string) string {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	w, err := zw.Create("main.tf")
+	if err != nil {
+		t.Fatalf("failed to create zip entry: %v", err)
+	}
+	if _, err := w.Write([]byte(content)); err != nil {
+		t.Fatalf("failed to write zip entry: %v", err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatalf("failed to close zip: %v", err)
+	}
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, buf.Bytes(), 0600); err != nil {
+		t.Fatalf("failed to write export: %v", err)
+	}
+	return path
+}
+
+func TestDiffExports(t *testing.T) {
+	oldPath := writeTestZip(t, "old.zip", `resource "incapsula_site" "a" { domain = "a.example.com" }
+resource "incapsula_site" "b" { domain = "b.example.com" }
+`)
+	newPath := writeTestZip(t, "new.zip", `resource "incapsula_site" "b" {
+  domain = "www.b.example.com"
+}
+
+resource "incapsula_site" "c" {
+  domain = "c.example.com"
+}
+`)
+
+	var text bytes.Buffer
+	changed, err := diffExports(&text, oldPath, newPath, "text")
+	if err != nil {
+		t.Fatalf("diffExports() error = %v", err)
+	}
+	if !changed {
+		t.Error("diffExports() reported no changes")
+	}
+	for _, want := range []string{
+		"- incapsula_site.a\n",
+		"~ incapsula_site.b\n    ~ domain = \"b.example.com\" -> \"www.b.example.com\"\n",
+		"+ incapsula_site.c\n    + domain = \"c.example.com\"\n",
+		"Added: 1, removed: 1, changed: 1",
+	} {
+		if !strings.Contains(text.String(), want) {
+			t.Errorf("text output missing %q:\n%s", want, text.String())
+		}
+	}
+
+	var out bytes.Buffer
+	if _, err := diffExports(&out, oldPath, newPath, "json"); err != nil {
+		t.Fatalf("diffExports() error = %v", err)
+	}
+	var diff terraform.Diff
+	if err := json.Unmarshal(out.Bytes(), &diff); err != nil {
+		t.Fatalf("invalid JSON output: %v", err)
+	}
+	if diff.Added != 1 || diff.Removed != 1 || diff.Changed != 1 || len(diff.Resources) != 3 {
+		t.Errorf("unexpected diff: %+v", diff)
+	}
+
+	var same bytes.Buffer
+	changed, err = diffExports(&same, oldPath, oldPath, "text")
+	if err != nil || changed || same.String() != "No changes.\n" {
+		t.Errorf("diffExports() of identical exports = %v, %v, %q", changed, err, same.String())
+	}
+
+	if _, err := diffExports(&out, oldPath, filepath.Join(t.TempDir(), "missing.zip"), "text"); err == nil {
+		t.Error("diffExports() on missing file should fail")
+	}
+}
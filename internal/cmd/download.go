@@ -4,15 +4,20 @@ import (
 	"context"
 	"fmt"
 	"io"
-	"net/http"
 	"os"
 	"path/filepath"
+	"sync"
 	"time"
 
-	"github.com/rs/zerolog"
+	"github.com/ren3gadem4rm0t/imperva-export-cli/internal/archive"
+	"github.com/ren3gadem4rm0t/imperva-export-cli/internal/encryption"
+	"github.com/ren3gadem4rm0t/imperva-export-cli/internal/sink"
+	"github.com/ren3gadem4rm0t/imperva-export-cli/pkg/client"
 	"github.com/rs/zerolog/log"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/trace"
 )
 
 var downloadCmd = &cobra.Command{
@@ -27,131 +32,388 @@ The download command retrieves the export file using the provided handler and CA
 			return err
 		}
 
-		caid, _ := cmd.Flags().GetInt64("caid")
-		if err := ValidateCAID(caid); err != nil {
+		caid, err := caidFromFlags(cmd)
+		if err != nil {
 			return err
 		}
 
-		ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+		resource, err := resourceFromFlags(cmd)
+		if err != nil {
+			return err
+		}
+
+		opts, err := saveOptionsFromFlags(cmd)
+		if err != nil {
+			return err
+		}
+
+		ctx, cancel := context.WithTimeout(cmd.Context(), 60*time.Second)
 		defer cancel()
 
-		if err := downloadExportFile(ctx, caid, handler); err != nil {
-			return fmt.Errorf("error downloading export file: %w", err)
+		start := time.Now()
+		saved, err := downloadResourceExportFile(ctx, caid, handler, resource)
+		if err != nil {
+			err = fmt.Errorf("error downloading export file: %w", err)
+		} else {
+			err = processSaved(&saved, caid, handler, resource, opts)
 		}
-		return nil
+		return emitResult(newExportResult(caid, resource, handler, saved, time.Since(start), err), err)
 	},
 }
 
 func init() {
 	rootCmd.AddCommand(downloadCmd)
 	downloadCmd.Flags().String("handler", "", "The handler received in the export response")
-	downloadCmd.Flags().Int64("caid", 0, "The account ID to work on")
+	downloadCmd.Flags().Int64("caid", 0, "The account ID to work on (default is the caid of the profile)")
+	addResourceFlags(downloadCmd)
+	addSaveFlags(downloadCmd)
 	err := downloadCmd.MarkFlagRequired("handler")
 	if err != nil {
 		log.Error().Err(err).Msg("Failed to mark flag as required")
 	}
-	err = downloadCmd.MarkFlagRequired("caid")
-	if err != nil {
-		log.Error().Err(err).Msg("Failed to mark flag as required")
-	}
 }
 
-func downloadExportFile(ctx context.Context, caid int64, handler string) error {
+// downloadResourceExportFile downloads a finished export. A non-nil resource marks a
+// single-resource export and is reflected in the saved file name.
+func downloadResourceExportFile(ctx context.Context, caid int64, handler string, resource *client.Resource) (savedExport, error) {
 	if err := ValidateHandler(handler); err != nil {
-		return err
+		return savedExport{}, err
 	}
 
-	outputDir := viper.GetString("output-dir")
-	if outputDir == "" {
-		outputDir = "."
+	ctx, span := startJobSpan(ctx, "download export", caid, resource)
+	c, err := newClient()
+	if err != nil {
+		endJobSpan(span, handler, err)
+		return savedExport{}, err
 	}
-	if err := ValidateOutputDir(outputDir); err != nil {
-		return err
+
+	saved, err := saveExportFile(ctx, caid, handler, resource, false, func(w io.Writer) (int64, error) {
+		return c.Download(ctx, caid, handler, w)
+	})
+	endJobSpan(span, handler, err)
+	trackJobFinished(ctx, caid, handler, resource, saved.Path, err)
+	if err != nil {
+		if interrupted(ctx) {
+			reportInterrupted(caid, handler)
+		}
+		return savedExport{}, err
 	}
+	reportSavedFile(saved)
+	return saved, nil
+}
 
-	url := fmt.Sprintf("%s/v3/export/download/%s?caid=%d", apiBaseURL, handler, caid)
+// savedExport describes an export file saved to the output directory
+type savedExport struct {
+	Path   string
+	Size   int64
+	SHA256 string
+	// Extracted is the directory the export was extracted to, if it was
+	Extracted string
+	// Commit is the commit of the export in the git repository, if it changed anything
+	Commit string
+	// RedactionReport is the report of the redaction of the export, if it was redacted
+	RedactionReport string
+	// Uploaded is the URL of the export in object storage, if it was uploaded
+	Uploaded string
+}
 
-	resp, err := makeAPIRequest(ctx, http.MethodGet, url, nil)
+// saveOptions controls what happens to an export after it was saved
+type saveOptions struct {
+	Redact  redactOptions
+	Extract extractOptions
+	Git     gitOptions
+}
+
+// addSaveFlags adds the flags controlling what happens to an export after it was saved
+func addSaveFlags(cmd *cobra.Command) {
+	addRedactFlags(cmd, true)
+	addExtractFlags(cmd, true)
+	addGitFlags(cmd)
+}
+
+// saveOptionsFromFlags returns the options of the flags added by addSaveFlags
+func saveOptionsFromFlags(cmd *cobra.Command) (saveOptions, error) {
+	redact, err := redactOptionsFromFlags(cmd)
 	if err != nil {
-		return err
+		return saveOptions{}, err
 	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		return HandleHTTPError(resp)
+	extract, err := extractOptionsFromFlags(cmd)
+	if err != nil {
+		return saveOptions{}, err
 	}
-
-	if err := SaveExportFile(caid, handler, resp); err != nil {
-		return fmt.Errorf("failed to save export file: %w", err)
+	git, err := gitOptionsFromFlags(cmd)
+	if err != nil {
+		return saveOptions{}, err
 	}
-	return nil
+	// Redacting, extracting and committing an export would write its plaintext to disk
+	if encryptionEnabled() && (redact.Enabled || extract.Enabled || git.Repo != "") {
+		return saveOptions{}, newValidationError(fmt.Errorf("--encrypt cannot be combined with --redact, --extract or --git-repo"))
+	}
+	// Exports saved to a remote host never exist as a local file
+	if remoteDestination() && (redact.Enabled || extract.Enabled || git.Repo != "") {
+		return saveOptions{}, newValidationError(fmt.Errorf("a remote --dest cannot be combined with --redact, --extract or --git-repo"))
+	}
+	// Exports are uploaded while they are downloaded, before they could be redacted
+	if s3Enabled() && redact.Enabled {
+		return saveOptions{}, newValidationError(fmt.Errorf("--s3-bucket cannot be combined with --redact"))
+	}
+	return saveOptions{Redact: redact, Extract: extract, Git: git}, nil
 }
 
-func SaveExportFile(caid int64, handler string, resp *http.Response) error {
-	filename := fmt.Sprintf("export_%d_%s.zip", caid, handler)
-	outputDir := viper.GetString("output-dir")
-	if outputDir == "" {
-		outputDir = "."
+// processSaved redacts a saved export, extracts it and commits it to the git repository, as far as enabled.
+// The export is redacted first, so only the redacted export is extracted and committed.
+func processSaved(saved *savedExport, caid int64, handler string, resource *client.Resource, opts saveOptions) error {
+	if err := redactSaved(saved, caid, handler, resource, opts.Redact); err != nil {
+		return err
 	}
-	filePath := filepath.Join(outputDir, filename)
-	if err := ValidateOutputDir(outputDir); err != nil {
-		return fmt.Errorf("invalid output dir: %w", err)
+	if err := extractSaved(saved, caid, opts.Extract); err != nil {
+		return err
 	}
-	tempFilePath := filePath + ".tmp"
+	return commitSaved(saved, caid, handler, resource, opts)
+}
 
-	if err := ValidateFilePath(tempFilePath); err != nil {
-		return fmt.Errorf("invalid file path: %w", err)
-	}
+// saveExportFile saves an export to its destination and describes the saved file. wait reports whether
+// download polls the export status before the archive arrives. Verifying and saving the downloaded export is
+// traced in its own span.
+func saveExportFile(ctx context.Context, caid int64, handler string, resource *client.Resource, wait bool, download func(io.Writer) (int64, error)) (saved savedExport, err error) {
+	filename := exportFileName(caid, handler, resource)
 
-	if err := os.MkdirAll(outputDir, 0750); err != nil {
-		log.Error().Err(err).Msgf("Failed to create output directory: %s", outputDir)
-		return fmt.Errorf("failed to create output directory: %w", err)
+	// A partial temp file left by an interrupted download to a local directory is kept and resumed. An
+	// encrypted export is encrypted while it is downloaded, so the plaintext never touches disk, and cannot
+	// be resumed.
+	recipients, err := encryptionRecipients()
+	if err != nil {
+		return savedExport{}, err
+	}
+	dest, err := newExportSink(recipients == nil)
+	if err != nil {
+		return savedExport{}, err
+	}
+	if _, local := dest.(*sink.Local); local {
+		if err := ValidateFilePath(filepath.Join(outputDirectory(), filename) + sink.TempSuffix); err != nil {
+			return savedExport{}, fmt.Errorf("invalid file path: %w", err)
+		}
+	}
+	if err := dest.Open(ctx, filename); err != nil {
+		log.Error().Err(err).Msgf("Failed to open %s", filename)
+		return savedExport{}, newIOError(err)
 	}
 
-	outFile, err := os.OpenFile(tempFilePath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600) // #nosec G304 -- Path validated above
+	// An upload to object storage receives every byte written to the sink and is only committed once the
+	// export was verified and saved
+	upload, err := newExportUpload(ctx, caid, handler, resource)
 	if err != nil {
-		log.Error().Err(err).Msgf("Failed to create temp file: %s", tempFilePath)
-		return fmt.Errorf("failed to create temp file: %w", err)
+		_ = dest.Abort()
+		return savedExport{}, err
 	}
-	defer func() {
-		if err := outFile.Close(); err != nil {
-			log.Error().Err(err).Msgf("Failed to close temp file: %s", tempFilePath)
+	file, err := newExportFile(dest, upload)
+	if err != nil {
+		_ = dest.Abort()
+		if upload != nil {
+			_ = upload.Abort()
 		}
-		if err := os.Remove(tempFilePath); err != nil {
-			if !os.IsNotExist(err) {
-				log.Error().Err(err).Msgf("Failed to remove temp file: %s", tempFilePath)
+		return savedExport{}, newIOError(err)
+	}
+	committed, uploaded := false, false
+	defer func() {
+		file.close()
+		if upload != nil && !uploaded {
+			if err := upload.Abort(); err != nil {
+				log.Error().Err(err).Msgf("Failed to abort upload of %s", upload.Key())
 			}
 		}
+		if committed {
+			keptPartials.forget(handler)
+			return
+		}
+		if err := dest.Abort(); err != nil {
+			log.Error().Err(err).Msgf("Failed to discard partial file of %s", filename)
+		}
+		// A local directory keeps a non-empty partial download so the next attempt can resume it
+		if info, err := os.Stat(file.tempPath); err == nil && file.tempPath != "" && info.Size() > 0 {
+			log.Warn().Msgf("Keeping partial download for resume: %s (%d bytes)", file.tempPath, info.Size())
+			keptPartials.keep(handler, partialDownload{path: file.tempPath, size: info.Size()})
+		} else {
+			keptPartials.forget(handler)
+		}
 	}()
 
-	buffer := make([]byte, 32*1024)
-	var totalBytes int64 = 0
-	for {
-		n, readErr := resp.Body.Read(buffer)
-		if n > 0 {
-			if _, writeErr := outFile.Write(buffer[:n]); writeErr != nil {
-				log.Error().Err(writeErr).Msgf("Failed to write to temp file: %s", tempFilePath)
-				return fmt.Errorf("failed to write to temp file: %w", writeErr)
-			}
-			totalBytes += int64(n)
+	var writer client.ResumableWriter = file
+	var encrypted *encryption.Writer
+	if recipients != nil {
+		if encrypted, err = encryption.NewWriter(file, recipients); err != nil {
+			return savedExport{}, newIOError(err)
 		}
-		if readErr != nil {
-			if readErr != io.EOF {
-				log.Error().Err(readErr).Msg("Error reading response body")
-				return fmt.Errorf("error reading response body: %w", readErr)
+		writer = encrypted
+	} else if size, err := writer.Size(); err == nil && size > 0 && file.tempPath != "" {
+		log.Info().Msgf("Found partial download of %d bytes: %s", size, file.tempPath)
+		if upload != nil {
+			if err := upload.resume(file.tempPath); err != nil {
+				return savedExport{}, err
 			}
-			break
 		}
 	}
 
-	if err := os.Rename(tempFilePath, filePath); err != nil {
-		log.Error().Err(err).Msgf("Failed to rename temp file to final file: %s", filePath)
-		return fmt.Errorf("failed to rename temp file to final file: %w", err)
+	metered := &meteredWriter{ResumableWriter: writer}
+	downloadStart := time.Now()
+	totalBytes, err := download(metered)
+	exportMetrics.observeDownload(metered, downloadStart, wait, err)
+	if err != nil {
+		return savedExport{}, err
 	}
+	if encrypted != nil {
+		if err := encrypted.Close(); err != nil {
+			return savedExport{}, newIOError(err)
+		}
+	}
+
+	ctx, span := otel.Tracer(tracerName).Start(ctx, "export.save", trace.WithAttributes(
+		attrFile.String(filename), attrEncrypted.Bool(encrypted != nil)))
+	defer func() {
+		span.SetAttributes(attrBytes.Int64(saved.Size))
+		endSpan(span, err)
+	}()
+
+	manifest, err := verifySavedExport(file, encrypted, totalBytes)
+	if err != nil {
+		// A complete but invalid download cannot be resumed
+		if resetErr := dest.Reset(); resetErr != nil {
+			log.Error().Err(resetErr).Msgf("Failed to discard invalid download of %s", filename)
+		}
+		return savedExport{}, fmt.Errorf("downloaded export failed verification: %w", err)
+	}
+
+	location, err := dest.Commit()
+	committed = true
+	if err != nil {
+		log.Error().Err(err).Msgf("Failed to save %s", filename)
+		return savedExport{}, newIOError(err)
+	}
+
+	recordExport(manifest, filename, caid, handler, resource)
+	manifestData, err := archive.EncodeManifest(manifest)
+	if err == nil {
+		_, err = sink.WriteFile(ctx, dest, filename+archive.ManifestSuffix, manifestData)
+	}
+	if err != nil {
+		log.Error().Err(err).Msgf("Failed to write manifest for %s", location)
+		return savedExport{}, newIOError(err)
+	}
+
+	saved = savedExport{Path: location, Size: manifest.Size, SHA256: manifest.SHA256}
+	if upload != nil {
+		uploaded = true
+		if saved.Uploaded, err = upload.commit(manifestData); err != nil {
+			return saved, err
+		}
+	}
+	return saved, nil
+}
+
+// partialDownload is a partial download that a sink kept for resume
+type partialDownload struct {
+	path string
+	size int64
+}
+
+// keptPartials records the partial downloads kept by the sinks of failed exports by handler, so an
+// interrupted command reports the file that was actually kept and the daemon can remove it
+var keptPartials = &partialDownloads{files: make(map[string]partialDownload)}
+
+// partialDownloads is a set of partial downloads by handler that is safe for concurrent use
+type partialDownloads struct {
+	mu    sync.Mutex
+	files map[string]partialDownload
+}
+
+// keep records the partial download of the export
+func (p *partialDownloads) keep(handler string, partial partialDownload) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.files[handler] = partial
+}
+
+// lookup returns the partial download of the export, if one was kept
+func (p *partialDownloads) lookup(handler string) (partialDownload, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	partial, ok := p.files[handler]
+	return partial, ok
+}
+
+// forget removes the partial download of the export from the set and returns it, if one was kept
+func (p *partialDownloads) forget(handler string) (partialDownload, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	partial, ok := p.files[handler]
+	delete(p.files, handler)
+	return partial, ok
+}
+
+// recordExport records the export in the manifest of a verified archive
+func recordExport(manifest *archive.Manifest, filename string, caid int64, handler string, resource *client.Resource) {
+	manifest.Archive = filename
+	manifest.CAID = caid
+	manifest.Handler = handler
+	if resource != nil {
+		manifest.Resource = fmt.Sprintf("%s/%d", resource.Type, resource.ID)
+	}
+}
+
+// writeExportManifest records the export in the manifest of a verified archive and writes it next to the archive
+func writeExportManifest(filePath string, manifest *archive.Manifest, caid int64, handler string, resource *client.Resource) error {
+	recordExport(manifest, filepath.Base(filePath), caid, handler, resource)
+	return archive.WriteManifest(filePath, manifest)
+}
+
+// outputDirectory returns the configured directory exports are saved to, which is the --dest directory
+// if it is local
+func outputDirectory() string {
+	if dir, ok := localDestination(); ok {
+		return dir
+	}
+	if outputDir := viper.GetString("output-dir"); outputDir != "" {
+		return outputDir
+	}
+	return "."
+}
+
+// verifySavedExport verifies a downloaded export before it is committed to its destination. The temp file
+// of a local directory is read back; an export written to a remote host is verified from its spool file.
+func verifySavedExport(file *exportFile, encrypted *encryption.Writer, expectedBytes int64) (*archive.Manifest, error) {
+	if encrypted == nil {
+		return verifyExportFile(file.verifyPath(), expectedBytes)
+	}
+	encryptedFile, err := os.Open(file.verifyPath()) // #nosec G304 -- Temp file created by the local sink or the spool
+	if err != nil {
+		return nil, fmt.Errorf("failed to open encrypted file: %w", err)
+	}
+	defer encryptedFile.Close()
+	return verifyEncryptedExport(encryptedFile, encrypted, expectedBytes)
+}
+
+// verifyExportFile checks that the downloaded file has the expected size and is a valid zip archive
+func verifyExportFile(path string, expectedBytes int64) (*archive.Manifest, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to stat downloaded file: %w", err)
+	}
+	if info.Size() != expectedBytes {
+		return nil, fmt.Errorf("downloaded file has %d bytes, expected %d", info.Size(), expectedBytes)
+	}
+
+	manifest, err := archive.Verify(path)
+	if err != nil {
+		return nil, err
+	}
+	log.Debug().Msgf("Verified export archive with %d files (sha256 %s)", len(manifest.Entries), manifest.SHA256)
+	return manifest, nil
+}
 
-	log.Info().Msgf("Export file downloaded successfully to %s (%d bytes)", filePath, totalBytes)
-	if zerolog.GlobalLevel() == zerolog.Disabled {
-		fmt.Printf("Export file downloaded successfully to %s (%d bytes)\n", filePath, totalBytes)
+// reportSavedFile reports a successfully saved export file
+func reportSavedFile(saved savedExport) {
+	log.Info().Msgf("Export file downloaded successfully to %s (%d bytes)", saved.Path, saved.Size)
+	if printsText() {
+		fmt.Printf("Export file downloaded successfully to %s (%d bytes)\n", saved.Path, saved.Size)
 	}
-	return nil
 }
@@ -1,14 +1,18 @@
 package cmd
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
 	"net/http"
 	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"strconv"
 	"testing"
 	"time"
 
+	"github.com/ren3gadem4rm0t/imperva-export-cli/internal/archive"
 	"github.com/spf13/viper"
 )
 
@@ -37,12 +41,12 @@ func TestDownloadExportFile(t *testing.T) {
 					return
 				}
 				w.WriteHeader(http.StatusOK)
-				_, _ = w.Write([]byte("export file content"))
+				_, _ = w.Write(testExportContent)
 			},
 			outputDir:     t.TempDir(),
 			wantErr:       false,
 			expectedFile:  "export_123456_28c5f5af-bd9e-423f-99a7-d2a8c440db7e.zip",
-			expectedBytes: int64(len("export file content")),
+			expectedBytes: int64(len(testExportContent)),
 		},
 		{
 			name:    "unauthorized download",
@@ -80,7 +84,7 @@ func TestDownloadExportFile(t *testing.T) {
 			apiKey:  "test-api-key",
 			serverHandler: func(w http.ResponseWriter, r *http.Request) {
 				w.WriteHeader(http.StatusOK)
-				_, _ = w.Write([]byte("export file content"))
+				_, _ = w.Write(testExportContent)
 			},
 			outputDir:    "../invalid_dir",
 			wantErr:      true,
@@ -104,9 +108,9 @@ func TestDownloadExportFile(t *testing.T) {
 			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 			defer cancel()
 
-			err := downloadExportFile(ctx, tt.caid, tt.handler)
+			_, err := downloadResourceExportFile(ctx, tt.caid, tt.handler, nil)
 			if (err != nil) != tt.wantErr {
-				t.Errorf("downloadExportFile() error = %v, wantErr %v", err, tt.wantErr)
+				t.Errorf("downloadResourceExportFile() error = %v, wantErr %v", err, tt.wantErr)
 			}
 
 			if !tt.wantErr {
@@ -142,8 +146,160 @@ func TestDownloadExportFileTimeout(t *testing.T) {
 	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
 	defer cancel()
 
-	err := downloadExportFile(ctx, 123456, "28c5f5af-bd9e-423f-99a7-d2a8c440db7e")
+	_, err := downloadResourceExportFile(ctx, 123456, "28c5f5af-bd9e-423f-99a7-d2a8c440db7e", nil)
 	if err == nil {
 		t.Fatalf("expected timeout error, got none")
 	}
 }
+
+func TestDownloadExportFile_ResumesPartialFile(t *testing.T) {
+	viper.Set("api-id", "test-api-id")
+	viper.Set("api-key", "test-api-key")
+
+	content := testExportContent
+	var gotRange string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotRange = r.Header.Get("Range")
+		http.ServeContent(w, r, "export.zip", time.Time{}, bytes.NewReader(content))
+	}))
+	defer server.Close()
+
+	originalURL := apiBaseURL
+	apiBaseURL = server.URL
+	defer func() { apiBaseURL = originalURL }()
+
+	tempDir := t.TempDir()
+	viper.Set("output-dir", tempDir)
+
+	handler := "28c5f5af-bd9e-423f-99a7-d2a8c440db7e"
+	filePath := filepath.Join(tempDir, "export_123456_"+handler+".zip")
+	if err := os.WriteFile(filePath+".tmp", content[:5000], 0600); err != nil {
+		t.Fatalf("failed to write partial file: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if _, err := downloadResourceExportFile(ctx, 123456, handler, nil); err != nil {
+		t.Fatalf("downloadResourceExportFile() error = %v", err)
+	}
+	if gotRange != "bytes=5000-" {
+		t.Errorf("Range header = %q, want bytes=5000-", gotRange)
+	}
+
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		t.Fatalf("failed to read export file: %v", err)
+	}
+	if !bytes.Equal(data, content) {
+		t.Errorf("export file has %d bytes, want %d", len(data), len(content))
+	}
+	if _, err := os.Stat(filePath + ".tmp"); !os.IsNotExist(err) {
+		t.Errorf("expected temp file to be removed after download")
+	}
+}
+
+func TestDownloadExportFile_KeepsPartialFileOnFailure(t *testing.T) {
+	viper.Set("api-id", "test-api-id")
+	viper.Set("api-key", "test-api-key")
+
+	content := testExportContent
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if requests > 1 {
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = w.Write([]byte(`{"errors":[{"status":404,"title":"Not Found","detail":"Export expired"}]}`))
+			return
+		}
+		w.Header().Set("Content-Length", strconv.Itoa(len(content)))
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write(content[:10000])
+		w.(http.Flusher).Flush()
+		conn, _, err := w.(http.Hijacker).Hijack()
+		if err == nil {
+			_ = conn.Close()
+		}
+	}))
+	defer server.Close()
+
+	originalURL := apiBaseURL
+	apiBaseURL = server.URL
+	defer func() { apiBaseURL = originalURL }()
+
+	tempDir := t.TempDir()
+	viper.Set("output-dir", tempDir)
+
+	handler := "28c5f5af-bd9e-423f-99a7-d2a8c440db7e"
+	_, err := downloadResourceExportFile(context.Background(), 123456, handler, nil)
+	if err == nil {
+		t.Fatalf("downloadResourceExportFile() expected error")
+	}
+
+	info, err := os.Stat(filepath.Join(tempDir, "export_123456_"+handler+".zip.tmp"))
+	if err != nil {
+		t.Fatalf("expected partial file to be kept: %v", err)
+	}
+	if info.Size() != 10000 {
+		t.Errorf("partial file size = %d, want 10000", info.Size())
+	}
+}
+
+func TestDownloadExportFile_Verification(t *testing.T) {
+	viper.Set("api-id", "test-api-id")
+	viper.Set("api-key", "test-api-key")
+
+	handler := "28c5f5af-bd9e-423f-99a7-d2a8c440db7e"
+	tests := []struct {
+		name    string
+		body    []byte
+		wantErr bool
+	}{
+		{"valid archive", testExportContent, false},
+		{"html page served with 200", []byte("<html><body>Maintenance</body></html>"), true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusOK)
+				_, _ = w.Write(tt.body)
+			}))
+			defer server.Close()
+
+			originalURL := apiBaseURL
+			apiBaseURL = server.URL
+			defer func() { apiBaseURL = originalURL }()
+
+			tempDir := t.TempDir()
+			viper.Set("output-dir", tempDir)
+			filePath := filepath.Join(tempDir, "export_123456_"+handler+".zip")
+
+			_, err := downloadResourceExportFile(context.Background(), 123456, handler, nil)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("downloadResourceExportFile() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if tt.wantErr {
+				for _, path := range []string{filePath, filePath + ".tmp", filePath + archive.ManifestSuffix} {
+					if _, err := os.Stat(path); !os.IsNotExist(err) {
+						t.Errorf("expected %s not to exist", path)
+					}
+				}
+				return
+			}
+
+			data, err := os.ReadFile(filePath + archive.ManifestSuffix)
+			if err != nil {
+				t.Fatalf("failed to read manifest: %v", err)
+			}
+			var manifest archive.Manifest
+			if err := json.Unmarshal(data, &manifest); err != nil {
+				t.Fatalf("failed to parse manifest: %v", err)
+			}
+			if manifest.Archive != filepath.Base(filePath) || manifest.CAID != 123456 || manifest.Handler != handler || len(manifest.Entries) != 2 {
+				t.Errorf("unexpected manifest: %+v", manifest)
+			}
+		})
+	}
+}
@@ -0,0 +1,240 @@
+package cmd
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"filippo.io/age"
+	"github.com/ren3gadem4rm0t/imperva-export-cli/internal/archive"
+	"github.com/ren3gadem4rm0t/imperva-export-cli/internal/encryption"
+	"github.com/ren3gadem4rm0t/imperva-export-cli/internal/terraform"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var decryptCmd = &cobra.Command{
+	Use:   "decrypt <export.zip.age>",
+	Short: "Decrypt an encrypted export archive",
+	Long: `Decrypts an export archive saved with --encrypt using the age identity files given with --identity or
+the passphrase of --passphrase-file or the EXPORT_PASSPHRASE environment variable. The archive is decrypted
+to a temp file next to --out and verified before it is renamed to --out, which defaults to the path without the
+.age suffix.
+
+Encrypted archives can also be decrypted with the age command line tool, and inspect, extract and diff read
+them directly without decrypting them to disk.`,
+	Args: cobra.ExactArgs(1),
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		return loadConfig()
+	},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cmd.SilenceUsage = true
+		identities, err := decryptionIdentities()
+		if err != nil {
+			return err
+		}
+		out, _ := cmd.Flags().GetString("out")
+		if out == "" {
+			out = strings.TrimSuffix(args[0], encryption.Suffix)
+		}
+		if out == args[0] {
+			return newValidationError(fmt.Errorf("--out must be given for an archive without the %s suffix", encryption.Suffix))
+		}
+		return decryptExport(args[0], out, identities)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(decryptCmd)
+	decryptCmd.Flags().String("out", "", "Path of the decrypted archive (default is the path without "+encryption.Suffix+")")
+}
+
+// encryptionEnabled reports whether saved exports are encrypted
+func encryptionEnabled() bool {
+	return viper.GetBool("encrypt") || len(viper.GetStringSlice("encrypt-recipient")) > 0
+}
+
+// exportPassphrase returns the passphrase of --passphrase-file or the EXPORT_PASSPHRASE environment variable
+func exportPassphrase() (string, error) {
+	path := viper.GetString("passphrase-file")
+	if path == "" {
+		return viper.GetString("passphrase"), nil
+	}
+	data, err := os.ReadFile(path) // #nosec G304 -- Passphrase file is chosen by the user
+	if err != nil {
+		return "", newValidationError(fmt.Errorf("failed to read passphrase file: %w", err))
+	}
+	passphrase := strings.TrimRight(string(data), "\r\n")
+	if passphrase == "" {
+		return "", newValidationError(fmt.Errorf("passphrase file %s is empty", path))
+	}
+	return passphrase, nil
+}
+
+// encryptionRecipients returns the recipients saved exports are encrypted to, or nil if encryption is not enabled.
+// Recipients take precedence over the passphrase, which is only required without them.
+func encryptionRecipients() ([]age.Recipient, error) {
+	if !encryptionEnabled() {
+		return nil, nil
+	}
+	recipients := viper.GetStringSlice("encrypt-recipient")
+	var passphrase string
+	if len(recipients) == 0 {
+		var err error
+		if passphrase, err = exportPassphrase(); err != nil {
+			return nil, err
+		}
+	}
+	parsed, err := encryption.Recipients(recipients, passphrase)
+	if err != nil {
+		return nil, newValidationError(err)
+	}
+	return parsed, nil
+}
+
+// decryptionIdentities returns the identities of the --identity files and the passphrase, if configured
+func decryptionIdentities() ([]age.Identity, error) {
+	files := viper.GetStringSlice("identity")
+	passphrase, err := exportPassphrase()
+	if err != nil {
+		return nil, err
+	}
+	identities, err := encryption.Identities(files, passphrase)
+	if err != nil {
+		return nil, newValidationError(err)
+	}
+	return identities, nil
+}
+
+// loadExportConfig parses the Terraform files of the export archive at path, which may be encrypted
+func loadExportConfig(path string) (*terraform.Config, error) {
+	reader, err := openEncryptedArchive(path)
+	if err != nil {
+		return nil, err
+	}
+	if reader == nil {
+		return terraform.LoadArchive(path)
+	}
+	return terraform.LoadZip(reader)
+}
+
+// openEncryptedArchive decrypts the archive at path into memory if it is encrypted. It returns nil for an
+// archive that is not encrypted, which is read from disk as usual.
+func openEncryptedArchive(path string) (*zip.Reader, error) {
+	encrypted, err := encryption.IsEncrypted(path)
+	if err != nil {
+		return nil, newIOError(fmt.Errorf("failed to open archive: %w", err))
+	}
+	if !encrypted {
+		return nil, nil
+	}
+	identities, err := decryptionIdentities()
+	if err != nil {
+		return nil, err
+	}
+	data, err := encryption.ReadFile(path, identities)
+	if err != nil {
+		return nil, err
+	}
+	reader, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, fmt.Errorf("decrypted %s is not a valid zip archive: %w", path, err)
+	}
+	return reader, nil
+}
+
+// decryptExport decrypts and verifies the encrypted archive at src and writes it to dst via a temp file
+func decryptExport(src, dst string, identities []age.Identity) error {
+	if err := ValidateOutputDir(dst); err != nil {
+		return err
+	}
+	encrypted, err := encryption.IsEncrypted(src)
+	if err != nil {
+		return newIOError(fmt.Errorf("failed to open archive: %w", err))
+	}
+	if !encrypted {
+		return newValidationError(fmt.Errorf("%s is not an encrypted export", src))
+	}
+	manifest, err := decryptToFile(src, dst, identities)
+	if err != nil {
+		return err
+	}
+
+	log.Info().Msgf("Decrypted %s to %s (%d bytes, sha256 %s)", src, dst, manifest.Size, manifest.SHA256)
+	if printsText() {
+		fmt.Printf("Decrypted %s to %s (%d bytes)\n", src, dst, manifest.Size)
+	}
+	return nil
+}
+
+// decryptToFile decrypts the archive at src into a temp file next to dst, verifies it and renames it to dst
+func decryptToFile(src, dst string, identities []age.Identity) (*archive.Manifest, error) {
+	r, err := encryption.Open(src, identities)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	tempPath := dst + ".tmp"
+	out, err := os.OpenFile(tempPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600) // #nosec G304 -- Output path is validated by the caller
+	if err != nil {
+		return nil, newIOError(fmt.Errorf("failed to create decrypted archive: %w", err))
+	}
+	if _, err := io.Copy(out, r); err != nil {
+		_ = out.Close()
+		_ = os.Remove(tempPath)
+		return nil, fmt.Errorf("failed to decrypt %s: %w", src, err)
+	}
+	if err := out.Close(); err != nil {
+		_ = os.Remove(tempPath)
+		return nil, newIOError(fmt.Errorf("failed to write decrypted archive: %w", err))
+	}
+
+	manifest, err := archive.Verify(tempPath)
+	if err != nil {
+		_ = os.Remove(tempPath)
+		return nil, fmt.Errorf("decrypted export failed verification: %w", err)
+	}
+	if err := os.Rename(tempPath, dst); err != nil {
+		_ = os.Remove(tempPath)
+		return nil, newIOError(fmt.Errorf("failed to rename decrypted archive: %w", err))
+	}
+	return manifest, nil
+}
+
+// verifyEncryptedExport checks that the plaintext written to the encryption writer has the expected size and
+// is a valid zip archive, and returns a manifest of the encrypted file read from r that lists no entries
+func verifyEncryptedExport(r io.Reader, encrypted *encryption.Writer, expectedBytes int64) (*archive.Manifest, error) {
+	size, err := encrypted.Size()
+	if err != nil {
+		return nil, err
+	}
+	if size != expectedBytes {
+		return nil, fmt.Errorf("downloaded export has %d bytes, expected %d", size, expectedBytes)
+	}
+	verified, err := archive.VerifyReader(encrypted.Plaintext(), size)
+	if err != nil {
+		return nil, err
+	}
+
+	hash := sha256.New()
+	encryptedSize, err := io.Copy(hash, r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to hash encrypted file: %w", err)
+	}
+	log.Debug().Msgf("Verified export archive with %d files before encryption (sha256 %s)", len(verified.Entries), encrypted.SHA256())
+
+	return &archive.Manifest{
+		Size:      encryptedSize,
+		SHA256:    hex.EncodeToString(hash.Sum(nil)),
+		Encrypted: true,
+		CreatedAt: verified.CreatedAt,
+		Entries:   []archive.Entry{},
+	}, nil
+}
@@ -0,0 +1,156 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"filippo.io/age"
+	"github.com/ren3gadem4rm0t/imperva-export-cli/internal/archive"
+	"github.com/ren3gadem4rm0t/imperva-export-cli/internal/encryption"
+	"github.com/ren3gadem4rm0t/imperva-export-cli/pkg/mockserver"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// useEncryption encrypts saved exports to a new X25519 identity and decrypts with its identity file
+func useEncryption(t *testing.T) {
+	t.Helper()
+	identity, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	identityFile := filepath.Join(t.TempDir(), "key.txt")
+	if err := os.WriteFile(identityFile, []byte(identity.String()+"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	viper.Set("encrypt-recipient", []string{identity.Recipient().String()})
+	viper.Set("identity", []string{identityFile})
+	t.Cleanup(func() {
+		viper.Set("encrypt-recipient", nil)
+		viper.Set("identity", nil)
+	})
+}
+
+func TestAutoExport_Encrypted(t *testing.T) {
+	useMockServer(t, mockserver.WithPolls(0), mockserver.WithFixture(newTestExportZip()))
+	useEncryption(t)
+	out := captureResults(t, outputJSON)
+
+	if err := autoExport(context.Background(), 1234, nil, saveOptions{}); err != nil {
+		t.Fatalf("autoExport() error = %v", err)
+	}
+	var result exportResult
+	if err := json.Unmarshal(out.Bytes(), &result); err != nil {
+		t.Fatalf("output is not JSON: %v", err)
+	}
+	if !strings.HasSuffix(result.File, ".zip"+encryption.Suffix) {
+		t.Fatalf("file = %q, want the %s suffix", result.File, encryption.Suffix)
+	}
+	if encrypted, err := encryption.IsEncrypted(result.File); err != nil || !encrypted {
+		t.Fatalf("saved export is not encrypted: %v", err)
+	}
+	if matches, _ := filepath.Glob(filepath.Join(filepath.Dir(result.File), "*.zip")); len(matches) != 0 {
+		t.Errorf("plaintext written to disk: %v", matches)
+	}
+
+	// The manifest describes the encrypted file without listing its entries
+	var manifest archive.Manifest
+	data, err := os.ReadFile(result.File + archive.ManifestSuffix)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(result.File)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !manifest.Encrypted || manifest.Size != info.Size() || manifest.SHA256 != result.SHA256 || len(manifest.Entries) != 0 {
+		t.Errorf("manifest = %+v, want the encrypted file of %d bytes", manifest, info.Size())
+	}
+
+	// inspect reads the encrypted export and decrypt restores the archive
+	var table bytes.Buffer
+	if err := inspectExport(&table, result.File, "table"); err != nil || !strings.Contains(table.String(), "incapsula_site") {
+		t.Errorf("inspectExport() = %q, %v", table.String(), err)
+	}
+	identities, err := decryptionIdentities()
+	if err != nil {
+		t.Fatal(err)
+	}
+	decrypted := strings.TrimSuffix(result.File, encryption.Suffix)
+	if err := decryptExport(result.File, decrypted, identities); err != nil {
+		t.Fatalf("decryptExport() error = %v", err)
+	}
+	plaintext, err := os.ReadFile(decrypted)
+	if err != nil || !bytes.Equal(plaintext, newTestExportZip()) {
+		t.Errorf("decrypted archive differs from the export: %v", err)
+	}
+	if err := decryptExport(decrypted, decrypted+".out", identities); ExitCode(err) != ExitValidation {
+		t.Errorf("decryptExport() of a plain archive error = %v", err)
+	}
+
+	// A truncated archive is decrypted to a temp file, which is removed once decryption fails
+	data, err = os.ReadFile(result.File)
+	if err != nil {
+		t.Fatal(err)
+	}
+	truncated := filepath.Join(t.TempDir(), "truncated.zip.age")
+	if err := os.WriteFile(truncated, data[:len(data)/2], 0600); err != nil {
+		t.Fatal(err)
+	}
+	dst := strings.TrimSuffix(truncated, encryption.Suffix)
+	if err := decryptExport(truncated, dst, identities); err == nil {
+		t.Error("decryptExport() of a truncated archive should fail")
+	}
+	for _, path := range []string{dst, dst + ".tmp"} {
+		if _, err := os.Stat(path); !os.IsNotExist(err) {
+			t.Errorf("failed decryption left %s behind: %v", path, err)
+		}
+	}
+}
+
+func TestEncryptionRecipients(t *testing.T) {
+	if recipients, err := encryptionRecipients(); err != nil || recipients != nil {
+		t.Fatalf("encryptionRecipients() without encryption = %v, %v", recipients, err)
+	}
+
+	viper.Set("encrypt", true)
+	t.Cleanup(func() {
+		viper.Set("encrypt", nil)
+		viper.Set("passphrase-file", nil)
+	})
+	if _, err := encryptionRecipients(); ExitCode(err) != ExitValidation {
+		t.Errorf("encryptionRecipients() without a recipient or passphrase error = %v", err)
+	}
+
+	passphraseFile := filepath.Join(t.TempDir(), "passphrase")
+	if err := os.WriteFile(passphraseFile, []byte("correct horse battery staple\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	viper.Set("passphrase-file", passphraseFile)
+	if passphrase, err := exportPassphrase(); err != nil || passphrase != "correct horse battery staple" {
+		t.Errorf("exportPassphrase() = %q, %v", passphrase, err)
+	}
+	if recipients, err := encryptionRecipients(); err != nil || len(recipients) != 1 {
+		t.Errorf("encryptionRecipients() = %v, %v, want the passphrase", recipients, err)
+	}
+}
+
+func TestSaveOptionsFromFlags_Encrypt(t *testing.T) {
+	useEncryption(t)
+	cmd := &cobra.Command{}
+	addSaveFlags(cmd)
+	if err := cmd.ParseFlags([]string{"--extract"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := saveOptionsFromFlags(cmd); ExitCode(err) != ExitValidation {
+		t.Errorf("saveOptionsFromFlags() accepted --extract with encryption: %v", err)
+	}
+}
@@ -0,0 +1,185 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"net"
+	"net/http"
+
+	"github.com/ren3gadem4rm0t/imperva-export-cli/pkg/client"
+)
+
+// Exit codes of the CLI. Every failure class has its own code so pipelines can react to it
+// without parsing the error message.
+const (
+	ExitOK         int = 0
+	ExitError      int = 1   // Any other failure, e.g. a server error, and diff --exit-code finding changes
+	ExitValidation int = 2   // Invalid flags, arguments or configuration
+	ExitAuth       int = 3   // Missing or rejected API credentials
+	ExitNotFound   int = 4   // The account, resource or export does not exist
+	ExitBusy       int = 5   // The account or resource is currently at work or rate limited
+	ExitTimeout    int = 6   // The export or a request did not complete in time
+	ExitIO         int = 7   // The export could not be read from or written to disk
+	ExitInterrupt  int = 130 // The command was stopped by SIGINT or SIGTERM
+)
+
+// AuthError is returned when API credentials are missing or rejected by the API
+type AuthError struct {
+	Err error
+	// API is the error returned by the API, if any
+	API *client.APIError
+}
+
+func (e *AuthError) Error() string { return e.Err.Error() }
+func (e *AuthError) Unwrap() error { return e.Err }
+
+// NotFoundError is returned when the API does not know the account, resource or export handler
+type NotFoundError struct {
+	Err error
+	// API is the error returned by the API
+	API *client.APIError
+}
+
+func (e *NotFoundError) Error() string { return e.Err.Error() }
+func (e *NotFoundError) Unwrap() error { return e.Err }
+
+// BusyError is returned when the account or resource is currently at work or the API rate limits the requests
+type BusyError struct {
+	Err error
+	// API is the error returned by the API, if any
+	API *client.APIError
+}
+
+func (e *BusyError) Error() string { return e.Err.Error() }
+func (e *BusyError) Unwrap() error { return e.Err }
+
+// TimeoutError is returned when an export or a request did not complete in time
+type TimeoutError struct {
+	Err error
+}
+
+func (e *TimeoutError) Error() string { return e.Err.Error() }
+func (e *TimeoutError) Unwrap() error { return e.Err }
+
+// ValidationError is returned for invalid flags, arguments or configuration
+type ValidationError struct {
+	Err error
+}
+
+func (e *ValidationError) Error() string { return e.Err.Error() }
+func (e *ValidationError) Unwrap() error { return e.Err }
+
+// IOError is returned when an export cannot be read from or written to disk
+type IOError struct {
+	Err error
+}
+
+func (e *IOError) Error() string { return e.Err.Error() }
+func (e *IOError) Unwrap() error { return e.Err }
+
+// InterruptedError is returned when the command was stopped by SIGINT or SIGTERM
+type InterruptedError struct {
+	Err error
+}
+
+func (e *InterruptedError) Error() string { return e.Err.Error() }
+func (e *InterruptedError) Unwrap() error { return e.Err }
+
+// newValidationError wraps a non-nil error in a ValidationError
+func newValidationError(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &ValidationError{Err: err}
+}
+
+// newIOError wraps a non-nil error in an IOError
+func newIOError(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &IOError{Err: err}
+}
+
+// classifyError wraps an error in the typed error of its failure class. Errors that already are typed
+// and errors without a known class are returned unchanged.
+func classifyError(err error) error {
+	if err == nil || classified(err) {
+		return err
+	}
+
+	var apiErr client.APIError
+	if errors.As(err, &apiErr) {
+		switch {
+		case apiErr.Busy(), apiErr.Status == http.StatusTooManyRequests:
+			return &BusyError{Err: err, API: &apiErr}
+		case apiErr.Status == http.StatusUnauthorized, apiErr.Status == http.StatusForbidden:
+			return &AuthError{Err: err, API: &apiErr}
+		case apiErr.Status == http.StatusNotFound:
+			return &NotFoundError{Err: err, API: &apiErr}
+		}
+		return err
+	}
+
+	var netErr net.Error
+	var pathErr *fs.PathError
+	switch {
+	case errors.Is(err, client.ErrResourceBusy):
+		return &BusyError{Err: err}
+	case errors.Is(err, client.ErrWaitTimeout), errors.Is(err, context.DeadlineExceeded):
+		return &TimeoutError{Err: err}
+	case errors.As(err, &netErr) && netErr.Timeout():
+		return &TimeoutError{Err: err}
+	case errors.As(err, &pathErr):
+		return &IOError{Err: err}
+	}
+	return err
+}
+
+// classified reports whether the error chain already holds a typed error
+func classified(err error) bool {
+	var authErr *AuthError
+	var notFoundErr *NotFoundError
+	var busyErr *BusyError
+	var timeoutErr *TimeoutError
+	var validationErr *ValidationError
+	var ioErr *IOError
+	var interruptedErr *InterruptedError
+	return errors.As(err, &authErr) || errors.As(err, &notFoundErr) || errors.As(err, &busyErr) ||
+		errors.As(err, &timeoutErr) || errors.As(err, &validationErr) || errors.As(err, &ioErr) ||
+		errors.As(err, &interruptedErr)
+}
+
+// ExitCode returns the exit code of the CLI for an error returned by Execute
+func ExitCode(err error) int {
+	if err == nil {
+		return ExitOK
+	}
+
+	var authErr *AuthError
+	var notFoundErr *NotFoundError
+	var busyErr *BusyError
+	var timeoutErr *TimeoutError
+	var validationErr *ValidationError
+	var ioErr *IOError
+	var interruptedErr *InterruptedError
+	switch {
+	case errors.As(err, &interruptedErr):
+		return ExitInterrupt
+	case errors.As(err, &validationErr):
+		return ExitValidation
+	case errors.As(err, &authErr):
+		return ExitAuth
+	case errors.As(err, &notFoundErr):
+		return ExitNotFound
+	case errors.As(err, &busyErr):
+		return ExitBusy
+	case errors.As(err, &timeoutErr):
+		return ExitTimeout
+	case errors.As(err, &ioErr):
+		return ExitIO
+	default:
+		return ExitError
+	}
+}
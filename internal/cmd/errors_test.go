@@ -0,0 +1,75 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"testing"
+
+	"github.com/ren3gadem4rm0t/imperva-export-cli/pkg/client"
+)
+
+// apiErrorResponse returns the error of a request that the API answered with a single error
+func apiErrorResponse(status int, detail string) error {
+	return fmt.Errorf("failed to initiate export: %w", &client.ErrorResponse{Errors: []client.APIError{{Status: status, Title: "Error", Detail: detail}}})
+}
+
+func TestClassifyError(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want int
+	}{
+		{"nil", nil, ExitOK},
+		{"unauthorized", apiErrorResponse(401, "Authentication missing or invalid"), ExitAuth},
+		{"forbidden", apiErrorResponse(403, "Access denied"), ExitAuth},
+		{"not found", apiErrorResponse(404, "Unknown export"), ExitNotFound},
+		{"busy", apiErrorResponse(403, "This resource is currently at work"), ExitBusy},
+		{"rate limited", apiErrorResponse(429, "Too many requests"), ExitBusy},
+		{"busy retries exhausted", fmt.Errorf("request failed after 3 retries: %w", client.ErrResourceBusy), ExitBusy},
+		{"server error", apiErrorResponse(500, "Internal error"), ExitError},
+		{"wait timeout", fmt.Errorf("%w: %w", client.ErrWaitTimeout, context.DeadlineExceeded), ExitTimeout},
+		{"deadline", fmt.Errorf("failed to send request: %w", context.DeadlineExceeded), ExitTimeout},
+		{"path error", fmt.Errorf("failed to write export file: %w", &fs.PathError{Op: "write", Path: "export.zip", Err: os.ErrPermission}), ExitIO},
+		{"validation", fmt.Errorf("error downloading export file: %w", ValidateHandler("invalid")), ExitValidation},
+		{"io", newIOError(errors.New("failed to create temp file")), ExitIO},
+		{"unknown", errors.New("something went wrong"), ExitError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := classifyError(tt.err)
+			if got := ExitCode(err); got != tt.want {
+				t.Errorf("ExitCode(classifyError(%v)) = %d, want %d", tt.err, got, tt.want)
+			}
+			if tt.err != nil && err.Error() != tt.err.Error() {
+				t.Errorf("classifyError() changed the message to %q", err.Error())
+			}
+		})
+	}
+}
+
+func TestClassifyError_APIError(t *testing.T) {
+	err := classifyError(apiErrorResponse(401, "Authentication missing or invalid"))
+
+	var authErr *AuthError
+	if !errors.As(err, &authErr) {
+		t.Fatalf("classifyError() = %T, want *AuthError", err)
+	}
+	if authErr.API == nil || authErr.API.Status != 401 || authErr.API.Detail != "Authentication missing or invalid" {
+		t.Errorf("AuthError.API = %+v", authErr.API)
+	}
+
+	var apiErr client.APIError
+	if !errors.As(err, &apiErr) {
+		t.Errorf("errors.As() found no APIError in %v", err)
+	}
+}
+
+func TestClassifyError_KeepsTypedErrors(t *testing.T) {
+	notFound := &NotFoundError{Err: errors.New("no job with handler")}
+	if err := classifyError(fmt.Errorf("wrapped: %w", notFound)); ExitCode(err) != ExitNotFound {
+		t.Errorf("ExitCode() = %d, want %d", ExitCode(err), ExitNotFound)
+	}
+}
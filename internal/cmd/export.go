@@ -4,12 +4,11 @@ package cmd
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
-	"net/http"
+	"strings"
 	"time"
 
-	"github.com/rs/zerolog"
+	"github.com/ren3gadem4rm0t/imperva-export-cli/pkg/client"
 	"github.com/rs/zerolog/log"
 	"github.com/spf13/cobra"
 )
@@ -18,64 +17,110 @@ var exportCmd = &cobra.Command{
 	Use:   "export",
 	Short: "Initiate the export process",
 	Long: `Initiate the export process for an account. This command starts the asynchronous
-export operation and returns a handler ID to track the export status.`,
+export operation and returns a handler ID to track the export status.
+
+Use the site or policy subcommand to export a single website or policy instead of the whole account.`,
 	RunE: func(cmd *cobra.Command, args []string) error {
 		cmd.SilenceUsage = true
-		caid, _ := cmd.Flags().GetInt64("caid")
-		if err := ValidateCAID(caid); err != nil {
+		caid, err := caidFromFlags(cmd)
+		if err != nil {
 			return err
 		}
 
-		ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+		ctx, cancel := context.WithTimeout(cmd.Context(), 60*time.Second)
 		defer cancel()
 
+		start := time.Now()
 		handler, err := initiateExport(ctx, caid)
 		if err != nil {
-			return fmt.Errorf("error initiating export: %w", err)
-		}
-		log.Info().Msgf("Export initiated. Handler: %s", handler)
-		if zerolog.GlobalLevel() == zerolog.Disabled {
-			fmt.Printf("Export initiated. Handler: %s\n", handler)
+			err = fmt.Errorf("error initiating export: %w", err)
+			return emitResult(newExportResult(caid, nil, "", savedExport{}, time.Since(start), err), err)
 		}
-		return nil
+		trackJobStarted(caid, handler, nil)
+		reportInitiated(handler)
+		return emitResult(newExportResult(caid, nil, handler, savedExport{}, time.Since(start), nil), nil)
 	},
 }
 
-func init() {
-	rootCmd.AddCommand(exportCmd)
-	exportCmd.Flags().Int64("caid", 0, "The account ID to work on")
-	if err := exportCmd.MarkFlagRequired("caid"); err != nil {
+// newExportResourceCmd creates the export subcommand for a single resource of the given type
+func newExportResourceCmd(resourceType client.ResourceType) *cobra.Command {
+	name := strings.ToLower(string(resourceType))
+	cmd := &cobra.Command{
+		Use:   name,
+		Short: fmt.Sprintf("Initiate the export process for a single %s", name),
+		Long: fmt.Sprintf(`Initiate the export process for a single %s. This command starts the asynchronous
+export operation and returns a handler ID to track the export status.`, name),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cmd.SilenceUsage = true
+			caid, err := caidFromFlags(cmd)
+			if err != nil {
+				return err
+			}
+
+			id, _ := cmd.Flags().GetInt64("id")
+			if err := ValidateResourceID(id); err != nil {
+				return err
+			}
+			resource := client.Resource{Type: resourceType, ID: id}
+
+			ctx, cancel := context.WithTimeout(cmd.Context(), 60*time.Second)
+			defer cancel()
+
+			start := time.Now()
+			handler, err := initiateResourceExport(ctx, caid, resource)
+			if err != nil {
+				err = fmt.Errorf("error initiating %s export: %w", name, err)
+				return emitResult(newExportResult(caid, &resource, "", savedExport{}, time.Since(start), err), err)
+			}
+			trackJobStarted(caid, handler, &resource)
+			reportInitiated(handler)
+			return emitResult(newExportResult(caid, &resource, handler, savedExport{}, time.Since(start), nil), nil)
+		},
+	}
+	cmd.Flags().Int64("id", 0, fmt.Sprintf("The Imperva ID of the %s to export", name))
+	if err := cmd.MarkFlagRequired("id"); err != nil {
 		log.Error().Err(err).Msg("Failed to mark flag as required")
 	}
+	return cmd
 }
 
-// initiateExport starts the export process and returns the handler ID
-func initiateExport(ctx context.Context, caid int64) (string, error) {
-	url := fmt.Sprintf("%s/v3/export?caid=%d", apiBaseURL, caid)
-
-	log.Debug().Msgf("Initiating export for CAID: %d", caid)
-	log.Debug().Msgf("Export URL: %s", url)
+func init() {
+	rootCmd.AddCommand(exportCmd)
+	exportCmd.PersistentFlags().Int64("caid", 0, "The account ID to work on (default is the caid of the profile)")
+	exportCmd.AddCommand(newExportResourceCmd(client.ResourceSite))
+	exportCmd.AddCommand(newExportResourceCmd(client.ResourcePolicy))
+}
 
-	resp, err := makeAPIRequest(ctx, http.MethodPost, url, nil)
-	if err != nil {
-		log.Error().Err(err).Msg("Failed to initiate export")
-		return "", fmt.Errorf("failed to initiate export: %w", err)
+// reportInitiated reports the handler of an initiated export
+func reportInitiated(handler string) {
+	log.Info().Msgf("Export initiated. Handler: %s", handler)
+	if printsText() {
+		fmt.Printf("Export initiated. Handler: %s\n", handler)
 	}
-	defer resp.Body.Close()
+}
 
-	if err := HandleHTTPError(resp); err != nil {
-		return "", fmt.Errorf("error response from export initiation: %w", err)
-	}
+// initiateExport starts the export process and returns the handler ID
+func initiateExport(ctx context.Context, caid int64) (string, error) {
+	return initiateTraced(ctx, caid, nil, func(ctx context.Context, c *client.Client) (string, error) {
+		return c.Export(ctx, caid)
+	})
+}
 
-	var asyncResp AsyncResponse
-	decoder := json.NewDecoder(resp.Body)
-	if err := decoder.Decode(&asyncResp); err != nil {
-		return "", fmt.Errorf("failed to decode export initiation response: %w", err)
-	}
+// initiateResourceExport starts the export process for a single site or policy and returns the handler ID
+func initiateResourceExport(ctx context.Context, caid int64, resource client.Resource) (string, error) {
+	return initiateTraced(ctx, caid, &resource, func(ctx context.Context, c *client.Client) (string, error) {
+		return c.ExportResource(ctx, caid, resource)
+	})
+}
 
-	if asyncResp.Handler == "" {
-		return "", fmt.Errorf("received empty handler in response")
+// initiateTraced starts an export with a new client in the root span of the job
+func initiateTraced(ctx context.Context, caid int64, resource *client.Resource, initiate func(context.Context, *client.Client) (string, error)) (string, error) {
+	ctx, span := startJobSpan(ctx, "initiate export", caid, resource)
+	c, err := newClient()
+	var handler string
+	if err == nil {
+		handler, err = initiate(ctx, c)
 	}
-
-	return asyncResp.Handler, nil
+	endJobSpan(span, handler, err)
+	return handler, err
 }
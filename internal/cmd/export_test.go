@@ -7,6 +7,8 @@ import (
 	"testing"
 	"time"
 
+	"github.com/ren3gadem4rm0t/imperva-export-cli/pkg/client"
+	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 )
 
@@ -143,7 +145,7 @@ func TestCheckExportStatus_Polling(t *testing.T) {
 				},
 				func(w http.ResponseWriter, r *http.Request) {
 					w.WriteHeader(http.StatusOK)
-					_, _ = w.Write([]byte("export file content"))
+					_, _ = w.Write(testExportContent)
 				},
 			},
 			wantErr: false,
@@ -156,7 +158,7 @@ func TestCheckExportStatus_Polling(t *testing.T) {
 			serverHandlers: []func(w http.ResponseWriter, r *http.Request){
 				func(w http.ResponseWriter, r *http.Request) {
 					w.WriteHeader(http.StatusOK)
-					_, _ = w.Write([]byte("export file content"))
+					_, _ = w.Write(testExportContent)
 				},
 			},
 			wantErr: true,
@@ -184,10 +186,94 @@ func TestCheckExportStatus_Polling(t *testing.T) {
 			ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 			defer cancel()
 
-			err := checkExportStatusWithContext(ctx, tt.caid, tt.handler)
+			_, err := checkResourceExportStatusWithContext(ctx, tt.caid, tt.handler, nil)
 			if (err != nil) != tt.wantErr {
-				t.Errorf("checkExportStatusWithContext() error = %v, wantErr %v", err, tt.wantErr)
+				t.Errorf("checkResourceExportStatusWithContext() error = %v, wantErr %v", err, tt.wantErr)
 			}
 		})
 	}
 }
+
+func TestInitiateResourceExport(t *testing.T) {
+	tests := []struct {
+		name        string
+		resource    client.Resource
+		wantPath    string
+		wantHandler string
+		wantErr     bool
+	}{
+		{
+			name:        "site export",
+			resource:    client.Resource{Type: client.ResourceSite, ID: 1234},
+			wantPath:    "/v3/export/SITE/1234",
+			wantHandler: "28c5f5af-bd9e-423f-99a7-d2a8c440db7e",
+		},
+		{
+			name:        "policy export with lower case type",
+			resource:    client.Resource{Type: "policy", ID: 5678},
+			wantPath:    "/v3/export/POLICY/5678",
+			wantHandler: "28c5f5af-bd9e-423f-99a7-d2a8c440db7e",
+		},
+		{
+			name:     "invalid resource type",
+			resource: client.Resource{Type: "ACCOUNT", ID: 1234},
+			wantErr:  true,
+		},
+		{
+			name:     "invalid resource id",
+			resource: client.Resource{Type: client.ResourceSite, ID: 0},
+			wantErr:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.Method != http.MethodPost || r.URL.Path != tt.wantPath || r.URL.Query().Get("caid") != "123456" {
+					w.WriteHeader(http.StatusNotFound)
+					_, _ = w.Write([]byte(`{"errors":[{"status":404,"title":"Not Found","detail":"Unexpected request"}]}`))
+					return
+				}
+				w.WriteHeader(http.StatusAccepted)
+				_, _ = w.Write([]byte(`{"handler": "28c5f5af-bd9e-423f-99a7-d2a8c440db7e", "status": "Export is in progress"}`))
+			}))
+			defer server.Close()
+
+			originalURL := apiBaseURL
+			apiBaseURL = server.URL
+			defer func() { apiBaseURL = originalURL }()
+
+			viper.Set("api-id", "test-api-id")
+			viper.Set("api-key", "test-api-key")
+
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+
+			handler, err := initiateResourceExport(ctx, 123456, tt.resource)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("initiateResourceExport() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if handler != tt.wantHandler {
+				t.Errorf("initiateResourceExport() handler = %v, want %v", handler, tt.wantHandler)
+			}
+		})
+	}
+}
+
+func TestResourceCmd_InvalidID(t *testing.T) {
+	export := newExportResourceCmd(client.ResourceSite)
+	export.Flags().Int64("caid", 0, "")
+	auto := newAutoResourceCmd(client.ResourcePolicy)
+	auto.Flags().Int64Slice("caid", nil, "")
+
+	for _, cmd := range []*cobra.Command{export, auto} {
+		for _, id := range []string{"0", "-5"} {
+			if err := cmd.ParseFlags([]string{"--caid", "123456", "--id", id}); err != nil {
+				t.Fatal(err)
+			}
+			if err := cmd.RunE(cmd, nil); ExitCode(err) != ExitValidation {
+				t.Errorf("%s --id %s error = %v, want exit code %d", cmd.Name(), id, err, ExitValidation)
+			}
+		}
+	}
+}
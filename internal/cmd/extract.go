@@ -0,0 +1,269 @@
+package cmd
+
+import (
+	"archive/zip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ren3gadem4rm0t/imperva-export-cli/internal/archive"
+	"github.com/ren3gadem4rm0t/imperva-export-cli/internal/encryption"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// extractTimeFormat is the format of the timestamp in the name of the directory an export is extracted to
+const extractTimeFormat string = "20060102T150405Z"
+
+// currentLinkName is the stable link in the account directory that --replace points at the newest export
+const currentLinkName string = "current"
+
+// exportFileCAID matches the account ID in the file name of a saved export
+var exportFileCAID = regexp.MustCompile(`^export_(\d+)_`)
+
+// exportFileHandler matches the resource type and ID, if any, and the handler in the file name of a saved export
+var exportFileHandler = regexp.MustCompile(`^export_\d+_(?:(site|policy)_(\d+)_)?(.+?)\.zip(?:\.age)?$`)
+
+var extractCmd = &cobra.Command{
+	Use:   "extract <export.zip>",
+	Short: "Extract an export archive into a directory tree",
+	Long: `Extracts an export archive into <output-dir>/<caid>/<timestamp>/, named after the time the archive
+was saved. Entries that would be written outside that directory, links and special files are rejected, the
+number of files and the extracted size are limited, and the files are written with fixed permissions. The
+directory records the archive, its SHA-256 and handler in .export-manifest.json; an export that
+was already extracted is not extracted again.
+
+With --replace, the link <output-dir>/<caid>/current is atomically pointed at the new directory.`,
+	Args: cobra.ExactArgs(1),
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		return loadConfig()
+	},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cmd.SilenceUsage = true
+		caid, err := extractCAID(cmd, args[0])
+		if err != nil {
+			return err
+		}
+		opts, err := extractOptionsFromFlags(cmd)
+		if err != nil {
+			return err
+		}
+		opts.Enabled = true
+
+		_, err = extractExport(args[0], caid, opts)
+		return err
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(extractCmd)
+	extractCmd.Flags().Int64("caid", 0, "The account ID of the export (default is taken from the file name or the profile)")
+	addExtractFlags(extractCmd, false)
+}
+
+// extractOptions controls the extraction of a saved export
+type extractOptions struct {
+	Enabled bool
+	Replace bool
+	Limits  archive.ExtractLimits
+}
+
+// addExtractFlags adds the flags controlling the extraction of an export. The --extract flag is only added
+// to commands that do not always extract.
+func addExtractFlags(cmd *cobra.Command, toggle bool) {
+	if toggle {
+		cmd.Flags().Bool("extract", false, "Extract the export into <output-dir>/<caid>/<timestamp>/ after it was saved")
+	}
+	limits := archive.DefaultExtractLimits()
+	cmd.Flags().Bool("replace", false, "Atomically point <output-dir>/<caid>/current at the extracted directory")
+	cmd.Flags().Int("max-files", limits.MaxFiles, "Maximum number of files extracted from an export")
+	cmd.Flags().Int64("max-bytes", limits.MaxTotalSize, "Maximum total size in bytes of the files extracted from an export")
+}
+
+// extractOptionsFromFlags returns the extract options of the flags added by addExtractFlags
+func extractOptionsFromFlags(cmd *cobra.Command) (extractOptions, error) {
+	opts := extractOptions{Limits: archive.DefaultExtractLimits()}
+	opts.Enabled, _ = cmd.Flags().GetBool("extract")
+	opts.Replace, _ = cmd.Flags().GetBool("replace")
+	opts.Limits.MaxFiles, _ = cmd.Flags().GetInt("max-files")
+	opts.Limits.MaxTotalSize, _ = cmd.Flags().GetInt64("max-bytes")
+	if opts.Limits.MaxFiles <= 0 || opts.Limits.MaxTotalSize <= 0 {
+		return extractOptions{}, newValidationError(fmt.Errorf("--max-files and --max-bytes must be positive"))
+	}
+	if opts.Replace && !opts.Enabled && cmd.Flags().Lookup("extract") != nil {
+		return extractOptions{}, newValidationError(fmt.Errorf("--replace requires --extract"))
+	}
+	return opts, nil
+}
+
+// extractCAID returns the account ID of the --caid flag, the file name of the export or the profile
+func extractCAID(cmd *cobra.Command, path string) (int64, error) {
+	if cmd.Flags().Changed("caid") {
+		return caidFromFlags(cmd)
+	}
+	if match := exportFileCAID.FindStringSubmatch(filepath.Base(path)); match != nil {
+		caid, err := strconv.ParseInt(match[1], 10, 64)
+		if err == nil {
+			return caid, ValidateCAID(caid)
+		}
+	}
+	if caid := viper.GetInt64("caid"); caid != 0 {
+		return caid, ValidateCAID(caid)
+	}
+	return 0, newValidationError(fmt.Errorf("the caid of %s must be provided via --caid", path))
+}
+
+// extractDirCandidates is the maximum number of directories tried for exports saved in the same second
+const extractDirCandidates int = 100
+
+// extractDirName returns the name of the directory an export saved at modTime is extracted to. The first
+// candidate is the timestamp itself; later candidates, for other exports saved in the same second or a
+// directory that does not record its archive, add a counter: <timestamp>-2, <timestamp>-3 and so on.
+func extractDirName(modTime time.Time, candidate int) string {
+	name := modTime.UTC().Format(extractTimeFormat)
+	if candidate > 1 {
+		name += "-" + strconv.Itoa(candidate)
+	}
+	return name
+}
+
+// extractExport extracts a saved export into <output-dir>/<caid>/<timestamp>/ and returns the directory.
+// The directory records the archive in its manifest; a directory holding the same archive is kept as it is,
+// any other existing directory is left alone and the next candidate name is used.
+func extractExport(path string, caid int64, opts extractOptions) (string, error) {
+	if err := ValidateCAID(caid); err != nil {
+		return "", err
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", newIOError(fmt.Errorf("failed to stat export: %w", err))
+	}
+
+	accountDir := filepath.Join(outputDirectory(), strconv.FormatInt(caid, 10))
+	if err := ValidateOutputDir(accountDir); err != nil {
+		return "", err
+	}
+	manifest, err := extractedManifest(path, caid, info.ModTime())
+	if err != nil {
+		return "", err
+	}
+
+	var name, dir string
+	for candidate := 1; ; candidate++ {
+		if candidate > extractDirCandidates {
+			return "", newIOError(fmt.Errorf("no free directory to extract %s into in %s", path, accountDir))
+		}
+		name = extractDirName(info.ModTime(), candidate)
+		dir = filepath.Join(accountDir, name)
+		if _, err := os.Lstat(dir); err != nil {
+			if err := extractArchive(path, dir, opts.Limits, manifest); err != nil {
+				return "", err
+			}
+			break
+		}
+		if existing, err := archive.ReadExtractedManifest(dir); err == nil && existing.SHA256 == manifest.SHA256 {
+			log.Info().Msgf("Export already extracted to %s", dir)
+			if printsText() {
+				fmt.Printf("Export already extracted to %s\n", dir)
+			}
+			break
+		}
+		log.Debug().Msgf("%s holds another export, trying the next directory", dir)
+	}
+
+	if opts.Replace {
+		link := filepath.Join(accountDir, currentLinkName)
+		if err := archive.ReplaceLink(name, link); err != nil {
+			return dir, newIOError(err)
+		}
+		log.Info().Msgf("Pointed %s at %s", link, dir)
+		if printsText() {
+			fmt.Printf("Pointed %s at %s\n", link, dir)
+		}
+	}
+	return dir, nil
+}
+
+// extractedManifest returns the manifest recorded in the directory an export is extracted to: the sidecar
+// manifest of the archive if it matches the archive, otherwise the size and SHA-256 of the archive with
+// the handler and resource of its file name
+func extractedManifest(path string, caid int64, modTime time.Time) (*archive.Manifest, error) {
+	f, err := os.Open(path) // #nosec G304 -- Path of an export given by the user
+	if err != nil {
+		return nil, newIOError(fmt.Errorf("failed to open export: %w", err))
+	}
+	defer f.Close()
+	hash := sha256.New()
+	size, err := io.Copy(hash, f)
+	if err != nil {
+		return nil, newIOError(fmt.Errorf("failed to hash export: %w", err))
+	}
+	sum := hex.EncodeToString(hash.Sum(nil))
+
+	var manifest archive.Manifest
+	if data, err := os.ReadFile(path + archive.ManifestSuffix); err == nil && json.Unmarshal(data, &manifest) == nil && manifest.SHA256 == sum {
+		manifest.CAID = caid
+		return &manifest, nil
+	}
+	manifest = archive.Manifest{
+		Archive:   filepath.Base(path),
+		Size:      size,
+		SHA256:    sum,
+		CAID:      caid,
+		Encrypted: strings.HasSuffix(path, encryption.Suffix),
+		CreatedAt: modTime.UTC(),
+		Entries:   []archive.Entry{},
+	}
+	if match := exportFileHandler.FindStringSubmatch(filepath.Base(path)); match != nil {
+		if match[1] != "" {
+			manifest.Resource = strings.ToUpper(match[1]) + "/" + match[2]
+		}
+		manifest.Handler = match[3]
+	}
+	return &manifest, nil
+}
+
+// extractArchive extracts the archive into the directory, which must not exist, and records the manifest
+// in it. An encrypted export is decrypted in memory, only the extracted files are written to disk.
+func extractArchive(path, dir string, limits archive.ExtractLimits, manifest *archive.Manifest) error {
+	reader, err := openEncryptedArchive(path)
+	if err != nil {
+		return err
+	}
+	if reader == nil {
+		plain, err := zip.OpenReader(path)
+		if err != nil {
+			return fmt.Errorf("error extracting export: failed to open archive %s: %w", path, err)
+		}
+		defer plain.Close()
+		reader = &plain.Reader
+	}
+	result, err := archive.ExtractZipWithManifest(reader, dir, limits, manifest)
+	if err != nil {
+		return fmt.Errorf("error extracting export: %w", err)
+	}
+	log.Info().Msgf("Extracted %d files (%d bytes) to %s", result.Files, result.Bytes, dir)
+	if printsText() {
+		fmt.Printf("Extracted %d files (%d bytes) to %s\n", result.Files, result.Bytes, dir)
+	}
+	return nil
+}
+
+// extractSaved extracts a saved export if extraction is enabled and records the directory
+func extractSaved(saved *savedExport, caid int64, opts extractOptions) error {
+	if !opts.Enabled || saved.Path == "" {
+		return nil
+	}
+	dir, err := extractExport(saved.Path, caid, opts)
+	saved.Extracted = dir
+	return err
+}
@@ -0,0 +1,197 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ren3gadem4rm0t/imperva-export-cli/internal/archive"
+	"github.com/ren3gadem4rm0t/imperva-export-cli/pkg/mockserver"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+func TestAutoExport_Extract(t *testing.T) {
+	useMockServer(t, mockserver.WithPolls(0))
+	out := captureResults(t, outputJSON)
+
+	opts := saveOptions{Extract: extractOptions{Enabled: true, Replace: true, Limits: archive.DefaultExtractLimits()}}
+	if err := autoExport(context.Background(), 1234, nil, opts); err != nil {
+		t.Fatalf("autoExport() error = %v", err)
+	}
+
+	var result exportResult
+	if err := json.Unmarshal(out.Bytes(), &result); err != nil {
+		t.Fatalf("output is not JSON: %v", err)
+	}
+	if filepath.Dir(result.Extracted) != filepath.Join(outputDirectory(), "1234") {
+		t.Fatalf("extracted to %q, want a directory of the account", result.Extracted)
+	}
+	if entries, err := os.ReadDir(result.Extracted); err != nil || len(entries) == 0 {
+		t.Errorf("extracted directory is empty: %v", err)
+	}
+
+	link := filepath.Join(outputDirectory(), "1234", currentLinkName)
+	if target, err := os.Readlink(link); err != nil || target != filepath.Base(result.Extracted) {
+		t.Errorf("current link points to %q, %v, want %q", target, err, filepath.Base(result.Extracted))
+	}
+}
+
+// writeSavedExport writes the archive as the saved export of the handler, modified at the time
+func writeSavedExport(t *testing.T, dir, handler string, data []byte, modTime time.Time) string {
+	t.Helper()
+	path := filepath.Join(dir, "export_1234_"+handler+".zip")
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(path, modTime, modTime); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestExtractExport_SameSecond(t *testing.T) {
+	dir := t.TempDir()
+	viper.Set("output-dir", dir)
+	t.Cleanup(func() { viper.Set("output-dir", nil) })
+
+	// Two exports saved in the same second are extracted to directories of their own
+	saved := time.Date(2024, 9, 26, 12, 0, 0, 0, time.UTC)
+	first := writeSavedExport(t, dir, "handler-a", newTestExportZip(), saved)
+	other, err := os.ReadFile(writeTestZip(t, "other.zip", `resource "incapsula_site" "b" {}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	second := writeSavedExport(t, dir, "handler-b", other, saved)
+	opts := extractOptions{Replace: true, Limits: archive.DefaultExtractLimits()}
+	firstDir, err := extractExport(first, 1234, opts)
+	if err != nil {
+		t.Fatalf("extractExport() error = %v", err)
+	}
+	secondDir, err := extractExport(second, 1234, opts)
+	if err != nil {
+		t.Fatalf("extractExport() of an export saved in the same second error = %v", err)
+	}
+	if filepath.Base(firstDir) != "20240926T120000Z" || filepath.Base(secondDir) != "20240926T120000Z-2" {
+		t.Errorf("extracted to %s and %s, want the timestamp and the next candidate", firstDir, secondDir)
+	}
+	manifest, err := archive.ReadExtractedManifest(firstDir)
+	if err != nil || manifest.Handler != "handler-a" || manifest.CAID != 1234 || manifest.SHA256 == "" {
+		t.Errorf("manifest of the extracted directory = %+v, %v", manifest, err)
+	}
+
+	// Extracting an export again keeps its directory and points the link at it
+	again, err := extractExport(first, 1234, opts)
+	if err != nil || again != firstDir {
+		t.Errorf("extractExport() again = %q, %v, want %q", again, err, firstDir)
+	}
+	if target, err := os.Readlink(filepath.Join(dir, "1234", currentLinkName)); err != nil || target != filepath.Base(firstDir) {
+		t.Errorf("current link points to %q, %v, want %q", target, err, filepath.Base(firstDir))
+	}
+}
+
+func TestExtractExport_ExistingDirectory(t *testing.T) {
+	dir := t.TempDir()
+	viper.Set("output-dir", dir)
+	t.Cleanup(func() { viper.Set("output-dir", nil) })
+	saved := time.Date(2024, 9, 26, 12, 0, 0, 0, time.UTC)
+	path := writeSavedExport(t, dir, "handler-a", newTestExportZip(), saved)
+
+	// A directory of the same name without a manifest, e.g. left by another tool, is never trusted
+	stale := filepath.Join(dir, "1234", "20240926T120000Z")
+	if err := os.MkdirAll(stale, 0750); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(stale, "stale.tf"), []byte("stale"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	extracted, err := extractExport(path, 1234, extractOptions{Replace: true, Limits: archive.DefaultExtractLimits()})
+	if err != nil {
+		t.Fatalf("extractExport() error = %v", err)
+	}
+	if extracted == stale {
+		t.Fatalf("extractExport() trusted the existing directory %s", stale)
+	}
+	if _, err := os.Stat(filepath.Join(extracted, "stale.tf")); !os.IsNotExist(err) {
+		t.Errorf("extracted directory holds the stale file: %v", err)
+	}
+	if data, err := os.ReadFile(filepath.Join(stale, "stale.tf")); err != nil || string(data) != "stale" {
+		t.Errorf("existing directory was changed: %q, %v", data, err)
+	}
+	if target, err := os.Readlink(filepath.Join(dir, "1234", currentLinkName)); err != nil || target != filepath.Base(extracted) {
+		t.Errorf("current link points to %q, %v, want %q", target, err, filepath.Base(extracted))
+	}
+}
+
+func TestExtractedManifest(t *testing.T) {
+	dir := t.TempDir()
+	saved := time.Date(2024, 9, 26, 12, 0, 0, 0, time.UTC)
+	path := filepath.Join(dir, "export_1234_site_7_abc.zip")
+	if err := os.WriteFile(path, []byte("archive"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	manifest, err := extractedManifest(path, 1234, saved)
+	if err != nil {
+		t.Fatalf("extractedManifest() error = %v", err)
+	}
+	if manifest.Handler != "abc" || manifest.Resource != "SITE/7" || manifest.Size != 7 || !manifest.CreatedAt.Equal(saved) {
+		t.Errorf("extractedManifest() = %+v", manifest)
+	}
+
+	// The sidecar manifest of the archive is used if it describes the same archive
+	sidecar := *manifest
+	sidecar.Handler = "from-sidecar"
+	if err := archive.WriteManifest(path, &sidecar); err != nil {
+		t.Fatal(err)
+	}
+	if manifest, err := extractedManifest(path, 1234, saved); err != nil || manifest.Handler != "from-sidecar" {
+		t.Errorf("extractedManifest() with a sidecar = %+v, %v", manifest, err)
+	}
+}
+
+func TestExtractCAID(t *testing.T) {
+	newCmd := func() *cobra.Command {
+		cmd := &cobra.Command{}
+		cmd.Flags().Int64("caid", 0, "")
+		return cmd
+	}
+
+	caid, err := extractCAID(newCmd(), "/exports/export_123456_28c5f5af-bd9e-423f-99a7-d2a8c440db7e.zip")
+	if err != nil || caid != 123456 {
+		t.Errorf("extractCAID() from the file name = %d, %v", caid, err)
+	}
+
+	cmd := newCmd()
+	if err := cmd.Flags().Set("caid", "42"); err != nil {
+		t.Fatal(err)
+	}
+	if caid, err := extractCAID(cmd, "export_123456_x.zip"); err != nil || caid != 42 {
+		t.Errorf("extractCAID() with --caid = %d, %v", caid, err)
+	}
+
+	viper.Set("caid", nil)
+	if _, err := extractCAID(newCmd(), "backup.zip"); ExitCode(err) != ExitValidation {
+		t.Errorf("extractCAID() without a caid error = %v", err)
+	}
+}
+
+func TestExtractOptionsFromFlags(t *testing.T) {
+	cmd := &cobra.Command{}
+	addExtractFlags(cmd, true)
+	if err := cmd.Flags().Set("replace", "true"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := extractOptionsFromFlags(cmd); err == nil {
+		t.Error("extractOptionsFromFlags() accepted --replace without --extract")
+	}
+	if err := cmd.Flags().Set("extract", "true"); err != nil {
+		t.Fatal(err)
+	}
+	opts, err := extractOptionsFromFlags(cmd)
+	if err != nil || !opts.Enabled || !opts.Replace || opts.Limits != archive.DefaultExtractLimits() {
+		t.Errorf("extractOptionsFromFlags() = %+v, %v", opts, err)
+	}
+}
@@ -0,0 +1,116 @@
+package cmd
+
+import (
+	"fmt"
+	"net/mail"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/ren3gadem4rm0t/imperva-export-cli/internal/gitrepo"
+	"github.com/ren3gadem4rm0t/imperva-export-cli/pkg/client"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+)
+
+// gitOptions controls committing saved exports to a git repository
+type gitOptions struct {
+	Repo        string
+	Tag         bool
+	AuthorName  string
+	AuthorEmail string
+}
+
+// addGitFlags adds the flags controlling the git repository exports are committed to
+func addGitFlags(cmd *cobra.Command) {
+	cmd.Flags().String("git-repo", "", "Commit the export into the git repository at this path, which is created if missing")
+	cmd.Flags().Bool("git-tag", false, "Tag the commit of the export in --git-repo")
+	cmd.Flags().String("git-author", fmt.Sprintf("%s <%s>", gitrepo.DefaultAuthorName, gitrepo.DefaultAuthorEmail),
+		"Author of the commits in --git-repo, as \"Name <email>\"")
+}
+
+// gitOptionsFromFlags returns the git options of the flags added by addGitFlags
+func gitOptionsFromFlags(cmd *cobra.Command) (gitOptions, error) {
+	var opts gitOptions
+	opts.Repo, _ = cmd.Flags().GetString("git-repo")
+	opts.Tag, _ = cmd.Flags().GetBool("git-tag")
+	if opts.Repo == "" {
+		if opts.Tag {
+			return gitOptions{}, newValidationError(fmt.Errorf("--git-tag requires --git-repo"))
+		}
+		return opts, nil
+	}
+	if err := ValidateOutputDir(opts.Repo); err != nil {
+		return gitOptions{}, err
+	}
+
+	author, _ := cmd.Flags().GetString("git-author")
+	address, err := mail.ParseAddress(author)
+	if err != nil {
+		return gitOptions{}, newValidationError(fmt.Errorf("invalid --git-author %q: must be \"Name <email>\"", author))
+	}
+	opts.AuthorName, opts.AuthorEmail = address.Name, address.Address
+	return opts, nil
+}
+
+// gitExportDir returns the directory of the git working tree an export is kept in: <caid>/account for an
+// account export and <caid>/<type>_<id> for a single resource. The directories are siblings, as syncing an
+// export into a directory deletes every file below it that is not part of the export.
+func gitExportDir(caid int64, resource *client.Resource) string {
+	dir := strconv.FormatInt(caid, 10)
+	if resource == nil {
+		return dir + "/account"
+	}
+	return dir + fmt.Sprintf("/%s_%d", strings.ToLower(string(resource.Type)), resource.ID)
+}
+
+// commitSaved commits a saved export to the git repository if one is configured and records the commit
+func commitSaved(saved *savedExport, caid int64, handler string, resource *client.Resource, opts saveOptions) error {
+	if opts.Git.Repo == "" || saved.Path == "" {
+		return nil
+	}
+	info, err := os.Stat(saved.Path)
+	if err != nil {
+		return newIOError(fmt.Errorf("failed to stat export: %w", err))
+	}
+
+	export := gitrepo.Export{
+		Archive: saved.Path,
+		Dir:     gitExportDir(caid, resource),
+		CAID:    caid,
+		Handler: handler,
+		Time:    info.ModTime().UTC(),
+	}
+	if resource != nil {
+		export.Resource = fmt.Sprintf("%s/%d", resource.Type, resource.ID)
+	}
+	result, err := gitrepo.Commit(opts.Git.Repo, export, gitrepo.Options{
+		AuthorName:  opts.Git.AuthorName,
+		AuthorEmail: opts.Git.AuthorEmail,
+		Tag:         opts.Git.Tag,
+		Limits:      opts.Extract.Limits,
+	})
+	saved.Commit = result.Commit
+	if err != nil {
+		return fmt.Errorf("error committing export to %s: %w", opts.Git.Repo, err)
+	}
+
+	if result.Commit == "" {
+		log.Info().Msgf("Export matches %s, nothing to commit", opts.Git.Repo)
+		if printsText() {
+			fmt.Printf("Export matches %s, nothing to commit\n", opts.Git.Repo)
+		}
+		return nil
+	}
+	diff := result.Resources
+	log.Info().Str("commit", result.Commit).Str("tag", result.Tag).
+		Msgf("Committed export to %s: %d added, %d changed, %d removed", opts.Git.Repo, diff.Added, diff.Changed, diff.Removed)
+	if printsText() {
+		fmt.Printf("Committed export to %s as %.12s: %d added, %d changed, %d removed\n",
+			opts.Git.Repo, result.Commit, diff.Added, diff.Changed, diff.Removed)
+		if result.Tag != "" {
+			fmt.Printf("Tagged commit as %s\n", result.Tag)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,162 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/ren3gadem4rm0t/imperva-export-cli/internal/archive"
+	"github.com/ren3gadem4rm0t/imperva-export-cli/pkg/client"
+	"github.com/ren3gadem4rm0t/imperva-export-cli/pkg/mockserver"
+	"github.com/spf13/cobra"
+)
+
+func TestAutoExport_GitRepo(t *testing.T) {
+	useMockServer(t, mockserver.WithPolls(0))
+	repoDir := filepath.Join(t.TempDir(), "history")
+	opts := saveOptions{
+		Extract: extractOptions{Limits: archive.DefaultExtractLimits()},
+		Git:     gitOptions{Repo: repoDir, Tag: true},
+	}
+
+	out := captureResults(t, outputJSON)
+	if err := autoExport(context.Background(), 1234, nil, opts); err != nil {
+		t.Fatalf("autoExport() error = %v", err)
+	}
+	var result exportResult
+	if err := json.Unmarshal(out.Bytes(), &result); err != nil {
+		t.Fatalf("output is not JSON: %v", err)
+	}
+	if result.Commit == "" {
+		t.Fatal("no commit in the result")
+	}
+
+	repo, err := git.PlainOpen(repoDir)
+	if err != nil {
+		t.Fatalf("repository not created: %v", err)
+	}
+	commit, err := repo.CommitObject(plumbing.NewHash(result.Commit))
+	if err != nil {
+		t.Fatalf("failed to read commit: %v", err)
+	}
+	if !strings.HasPrefix(commit.Message, "Export of CAID 1234: ") || !strings.Contains(commit.Message, "Handler: "+result.Handler) {
+		t.Errorf("unexpected commit message %q", commit.Message)
+	}
+	files, err := commit.Files()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := files.ForEach(func(f *object.File) error {
+		if !strings.HasPrefix(f.Name, "1234/account/") {
+			t.Errorf("committed file %s outside the account directory", f.Name)
+		}
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	// The mock server returns the same archive, so the second export does not commit
+	out = captureResults(t, outputJSON)
+	opts.Git.Tag = false
+	if err := autoExport(context.Background(), 1234, nil, opts); err != nil {
+		t.Fatalf("autoExport() error = %v", err)
+	}
+	result = exportResult{}
+	if err := json.Unmarshal(out.Bytes(), &result); err != nil {
+		t.Fatalf("output is not JSON: %v", err)
+	}
+	if result.Commit != "" {
+		t.Errorf("unchanged export was committed as %s", result.Commit)
+	}
+}
+
+func TestAutoExport_GitRepoResourceThenAccount(t *testing.T) {
+	useMockServer(t, mockserver.WithPolls(0))
+	repoDir := filepath.Join(t.TempDir(), "history")
+	opts := saveOptions{
+		Extract: extractOptions{Limits: archive.DefaultExtractLimits()},
+		Git:     gitOptions{Repo: repoDir},
+	}
+	captureResults(t, outputJSON)
+	if err := autoExport(context.Background(), 1234, &client.Resource{Type: client.ResourceSite, ID: 7}, opts); err != nil {
+		t.Fatalf("autoExport() of a site error = %v", err)
+	}
+	if err := autoExport(context.Background(), 1234, nil, opts); err != nil {
+		t.Fatalf("autoExport() of the account error = %v", err)
+	}
+
+	// The account export is kept next to the site export instead of replacing it
+	repo, err := git.PlainOpen(repoDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	head, err := repo.Head()
+	if err != nil {
+		t.Fatal(err)
+	}
+	commit, err := repo.CommitObject(head.Hash())
+	if err != nil {
+		t.Fatal(err)
+	}
+	stats, err := commit.Stats()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, stat := range stats {
+		if !strings.HasPrefix(stat.Name, "1234/account/") {
+			t.Errorf("account export changed %s", stat.Name)
+		}
+	}
+	dirs := map[string]bool{}
+	files, err := commit.Files()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := files.ForEach(func(f *object.File) error {
+		dirs[strings.Join(strings.SplitN(f.Name, "/", 3)[:2], "/")] = true
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if !dirs["1234/site_7"] || !dirs["1234/account"] {
+		t.Errorf("committed directories = %v, want the site and the account export", dirs)
+	}
+}
+
+func TestGitExportDir(t *testing.T) {
+	if dir := gitExportDir(1234, nil); dir != "1234/account" {
+		t.Errorf("gitExportDir() = %q", dir)
+	}
+	if dir := gitExportDir(1234, &client.Resource{Type: client.ResourceSite, ID: 7}); dir != "1234/site_7" {
+		t.Errorf("gitExportDir() of a site = %q", dir)
+	}
+}
+
+func TestGitOptionsFromFlags(t *testing.T) {
+	newCmd := func(args ...string) *cobra.Command {
+		cmd := &cobra.Command{}
+		addGitFlags(cmd)
+		if err := cmd.ParseFlags(args); err != nil {
+			t.Fatal(err)
+		}
+		return cmd
+	}
+
+	if _, err := gitOptionsFromFlags(newCmd("--git-tag")); ExitCode(err) != ExitValidation {
+		t.Errorf("gitOptionsFromFlags() accepted --git-tag without --git-repo: %v", err)
+	}
+	if _, err := gitOptionsFromFlags(newCmd("--git-repo", "history", "--git-author", "nobody")); ExitCode(err) != ExitValidation {
+		t.Errorf("gitOptionsFromFlags() accepted an invalid author: %v", err)
+	}
+
+	opts, err := gitOptionsFromFlags(newCmd("--git-repo", "history", "--git-author", "Ops Team <ops@example.com>"))
+	want := gitOptions{Repo: "history", AuthorName: "Ops Team", AuthorEmail: "ops@example.com"}
+	if err != nil || opts != want {
+		t.Errorf("gitOptionsFromFlags() = %+v, %v, want %+v", opts, err, want)
+	}
+}
@@ -2,16 +2,16 @@ package cmd
 
 import (
 	"fmt"
+
+	"github.com/ren3gadem4rm0t/imperva-export-cli/pkg/client"
 )
 
 const (
-	apiIDHeaderName  string = "x-API-Id"  // #nosec G101 -- False positive. This is the name of the header, not the value.
-	apiKeyHeaderName string = "x-API-Key" // #nosec G101 -- False positive. This is the name of the header, not the value.
-	version          string = "1.0.0"
+	version string = "1.0.0"
 )
 
 var (
-	apiBaseURL     string = "https://api.imperva.com/account-export-import"
+	apiBaseURL     string = client.DefaultBaseURL
 	userAgentValue string = fmt.Sprintf("imperva-export-cli/%s", version)
 	cfgFile        string
 )
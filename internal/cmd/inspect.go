@@ -0,0 +1,114 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/ren3gadem4rm0t/imperva-export-cli/internal/terraform"
+	"github.com/spf13/cobra"
+)
+
+var inspectCmd = &cobra.Command{
+	Use:   "inspect <export.zip>",
+	Short: "Summarize the Terraform configuration inside an export archive",
+	Long: `Reads an export archive without extracting it, parses the Terraform files it contains and
+reports the number of resources and data sources by type, variables, outputs, modules and providers.`,
+	Args: cobra.ExactArgs(1),
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		return loadConfig()
+	},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cmd.SilenceUsage = true
+		format, err := commandFormat(cmd, inspectFormats...)
+		if err != nil {
+			return err
+		}
+		return inspectExport(os.Stdout, args[0], format)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(inspectCmd)
+	inspectCmd.Flags().String("format", "table", "Output format (table, json)")
+}
+
+// Formats of the --format flag of inspect, and of diff and redact
+var (
+	inspectFormats = []string{"table", "json"}
+	reportFormats  = []string{"text", "json"}
+)
+
+// commandFormat returns the format of the --format flag of the command, validated against the supported
+// formats. A structured --output takes precedence over the default format, and an explicit --format that
+// conflicts with it is rejected, so --output json never prints text.
+func commandFormat(cmd *cobra.Command, supported ...string) (string, error) {
+	format, _ := cmd.Flags().GetString("format")
+	if err := ValidateFormat(format, supported...); err != nil {
+		return "", err
+	}
+	output := outputFormat()
+	if output == outputText {
+		return format, nil
+	}
+	if cmd.Flags().Changed("format") && format != output {
+		return "", newValidationError(fmt.Errorf("--format %s conflicts with --output %s", format, output))
+	}
+	return output, nil
+}
+
+// ValidateFormat checks that the --format of a command is one of the formats it supports
+func ValidateFormat(format string, supported ...string) error {
+	if slices.Contains(supported, format) {
+		return nil
+	}
+	return newValidationError(fmt.Errorf("invalid format: %q (must be %s)", format, strings.Join(supported, ", ")))
+}
+
+func inspectExport(w io.Writer, path, format string) error {
+	config, err := loadExportConfig(path)
+	if err != nil {
+		return fmt.Errorf("error inspecting export: %w", err)
+	}
+
+	summary := terraform.Summarize(config)
+	if format == outputJSON || format == outputYAML {
+		return writeOutput(w, format, summary)
+	}
+	return printSummary(w, summary)
+}
+
+// printSummary writes the summary as a table of block kinds and types followed by the providers
+func printSummary(w io.Writer, summary terraform.Summary) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "KIND\tTYPE\tCOUNT")
+	for _, t := range sortedKeys(summary.ByType) {
+		fmt.Fprintf(tw, "%s\t%s\t%d\n", terraform.KindResource, t, summary.ByType[t])
+	}
+	for _, t := range sortedKeys(summary.DataByType) {
+		fmt.Fprintf(tw, "%s\t%s\t%d\n", terraform.KindData, t, summary.DataByType[t])
+	}
+	fmt.Fprintf(tw, "%s\t%s\t%d\n", terraform.KindVariable, "-", summary.Variables)
+	fmt.Fprintf(tw, "%s\t%s\t%d\n", terraform.KindOutput, "-", summary.Outputs)
+	fmt.Fprintf(tw, "%s\t%s\t%d\n", terraform.KindModule, "-", summary.Modules)
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(w, "\nFiles: %d, resources: %d, data sources: %d\n", summary.Files, summary.Resources, summary.DataSources)
+	_, err := fmt.Fprintf(w, "Providers: %s\n", orDash(strings.Join(summary.Providers, ", ")))
+	return err
+}
+
+func sortedKeys(m map[string]int) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
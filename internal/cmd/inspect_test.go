@@ -0,0 +1,117 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ren3gadem4rm0t/imperva-export-cli/internal/terraform"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+func TestInspectExport(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "export.zip")
+	if err := os.WriteFile(path, testExportContent, 0600); err != nil {
+		t.Fatalf("failed to write export: %v", err)
+	}
+
+	var table bytes.Buffer
+	if err := inspectExport(&table, path, "table"); err != nil {
+		t.Fatalf("inspectExport() error = %v", err)
+	}
+	for _, want := range []string{"resource  incapsula_site  1000", "Files: 2, resources: 1000", "Providers: incapsula"} {
+		if !strings.Contains(table.String(), want) {
+			t.Errorf("table output missing %q:\n%s", want, table.String())
+		}
+	}
+
+	var out bytes.Buffer
+	if err := inspectExport(&out, path, "json"); err != nil {
+		t.Fatalf("inspectExport() error = %v", err)
+	}
+	var summary terraform.Summary
+	if err := json.Unmarshal(out.Bytes(), &summary); err != nil {
+		t.Fatalf("invalid JSON output: %v", err)
+	}
+	if summary.ByType["incapsula_site"] != 1000 || len(summary.Providers) != 1 {
+		t.Errorf("unexpected summary: %+v", summary)
+	}
+
+	var yamlOut bytes.Buffer
+	if err := inspectExport(&yamlOut, path, outputYAML); err != nil {
+		t.Fatalf("inspectExport() error = %v", err)
+	}
+	if !strings.Contains(yamlOut.String(), "resources_by_type:\n  incapsula_site: 1000") {
+		t.Errorf("unexpected YAML output:\n%s", yamlOut.String())
+	}
+
+	if err := inspectExport(&out, filepath.Join(t.TempDir(), "missing.zip"), "table"); err == nil {
+		t.Error("inspectExport() on missing file should fail")
+	}
+}
+
+func TestValidateFormat(t *testing.T) {
+	for _, format := range []string{"table", "json"} {
+		if err := ValidateFormat(format, inspectFormats...); err != nil {
+			t.Errorf("ValidateFormat(%q) error = %v", format, err)
+		}
+	}
+	for _, format := range []string{"text", "json"} {
+		if err := ValidateFormat(format, reportFormats...); err != nil {
+			t.Errorf("ValidateFormat(%q) of diff and redact error = %v", format, err)
+		}
+	}
+	if err := ValidateFormat("xml", inspectFormats...); ExitCode(err) != ExitValidation {
+		t.Errorf("ValidateFormat(\"xml\") error = %v, want a validation error", err)
+	}
+	if err := ValidateFormat("table", reportFormats...); err == nil {
+		t.Error("ValidateFormat(\"table\") of diff and redact should fail")
+	}
+}
+
+func TestCommandFormat(t *testing.T) {
+	newCmd := func(args ...string) *cobra.Command {
+		cmd := &cobra.Command{}
+		cmd.Flags().String("format", "table", "")
+		if err := cmd.Flags().Parse(args); err != nil {
+			t.Fatal(err)
+		}
+		return cmd
+	}
+	t.Cleanup(func() { viper.Set("output", nil) })
+
+	tests := []struct {
+		name    string
+		output  string
+		args    []string
+		want    string
+		wantErr bool
+	}{
+		{name: "default format", output: outputText, want: "table"},
+		{name: "format flag", output: outputText, args: []string{"--format", "json"}, want: outputJSON},
+		{name: "json output", output: outputJSON, want: outputJSON},
+		{name: "yaml output", output: outputYAML, want: outputYAML},
+		{name: "matching format", output: outputJSON, args: []string{"--format", "json"}, want: outputJSON},
+		{name: "conflicting format", output: outputJSON, args: []string{"--format", "table"}, wantErr: true},
+		{name: "invalid format", output: outputText, args: []string{"--format", "xml"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			viper.Set("output", tt.output)
+			format, err := commandFormat(newCmd(tt.args...), inspectFormats...)
+			if tt.wantErr {
+				if ExitCode(err) != ExitValidation {
+					t.Errorf("commandFormat() error = %v, want a validation error", err)
+				}
+				return
+			}
+			if err != nil || format != tt.want {
+				t.Errorf("commandFormat() = %q, %v, want %q", format, err, tt.want)
+			}
+		})
+	}
+}
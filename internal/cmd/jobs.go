@@ -0,0 +1,211 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+)
+
+var jobsCmd = &cobra.Command{
+	Use:   "jobs",
+	Short: "Manage the local ledger of initiated exports",
+	Long: `Every initiated export is recorded in a local job ledger with its CAID, handler, resource,
+timestamps and final state. The jobs commands list the ledger, resume polling for an export
+after the CLI exited, and prune old entries.`,
+}
+
+var jobsListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List the exports recorded in the job ledger",
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		return loadConfig()
+	},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cmd.SilenceUsage = true
+		state, _ := cmd.Flags().GetString("state")
+		if err := validateJobState(state); err != nil {
+			return err
+		}
+
+		jobs, err := loadJobs()
+		if err != nil {
+			return err
+		}
+		return printJobs(os.Stdout, outputFormat(), filterJobs(jobs, jobState(state)))
+	},
+}
+
+var jobsResumeCmd = &cobra.Command{
+	Use:   "resume <handler>",
+	Short: "Resume polling for an export recorded in the job ledger and download it once ready",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cmd.SilenceUsage = true
+		handler := args[0]
+		if err := ValidateHandler(handler); err != nil {
+			return err
+		}
+
+		job, err := findJob(handler)
+		if err != nil {
+			return err
+		}
+		if job.State == jobStateCompleted {
+			return fmt.Errorf("job %s already completed: %s", handler, job.FilePath)
+		}
+
+		ctx, cancel := context.WithTimeout(cmd.Context(), 10*time.Minute)
+		defer cancel()
+
+		log.Info().Msgf("Resuming export for CAID: %d, Handler ID: %s", job.CAID, handler)
+		start := time.Now()
+		saved, err := checkResourceExportStatusWithContext(ctx, job.CAID, handler, job.Resource)
+		if err != nil {
+			err = fmt.Errorf("error resuming export: %w", err)
+		}
+		return emitResult(newExportResult(job.CAID, job.Resource, handler, saved, time.Since(start), err), err)
+	},
+}
+
+var jobsPruneCmd = &cobra.Command{
+	Use:   "prune",
+	Short: "Remove finished exports from the job ledger",
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		return loadConfig()
+	},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cmd.SilenceUsage = true
+		olderThan, _ := cmd.Flags().GetDuration("older-than")
+		includePending, _ := cmd.Flags().GetBool("include-pending")
+		if olderThan < 0 {
+			return newValidationError(fmt.Errorf("invalid older-than duration: %s", olderThan))
+		}
+
+		var removed int
+		err := updateJobs(func(jobs []jobRecord) []jobRecord {
+			var kept []jobRecord
+			kept, removed = pruneJobs(jobs, time.Now().Add(-olderThan), includePending)
+			return kept
+		})
+		if err != nil {
+			return err
+		}
+
+		log.Info().Msgf("Removed %d jobs from the job ledger", removed)
+		if printsText() {
+			fmt.Printf("Removed %d jobs from the job ledger\n", removed)
+		}
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(jobsCmd)
+	jobsCmd.AddCommand(jobsListCmd, jobsResumeCmd, jobsPruneCmd)
+
+	jobsListCmd.Flags().String("state", "", "Only list jobs in this state (pending, completed, failed)")
+	jobsPruneCmd.Flags().Duration("older-than", 0, "Only remove jobs last updated longer ago than this duration, e.g. 720h")
+	jobsPruneCmd.Flags().Bool("include-pending", false, "Also remove pending jobs")
+}
+
+func validateJobState(state string) error {
+	switch jobState(state) {
+	case "", jobStatePending, jobStateCompleted, jobStateFailed:
+		return nil
+	default:
+		return newValidationError(fmt.Errorf("invalid job state: %q", state))
+	}
+}
+
+// filterJobs returns the jobs in the given state, or all jobs if state is empty
+func filterJobs(jobs []jobRecord, state jobState) []jobRecord {
+	if state == "" {
+		return jobs
+	}
+	var filtered []jobRecord
+	for _, job := range jobs {
+		if job.State == state {
+			filtered = append(filtered, job)
+		}
+	}
+	return filtered
+}
+
+// pruneJobs removes finished jobs last updated before the cutoff and returns the kept jobs and the number removed
+func pruneJobs(jobs []jobRecord, cutoff time.Time, includePending bool) ([]jobRecord, int) {
+	kept := make([]jobRecord, 0, len(jobs))
+	for _, job := range jobs {
+		prunable := job.State != jobStatePending || includePending
+		if prunable && !job.UpdatedAt.After(cutoff) {
+			continue
+		}
+		kept = append(kept, job)
+	}
+	return kept, len(jobs) - len(kept)
+}
+
+// printJobs writes the jobs as a table or as JSON or YAML
+func printJobs(w io.Writer, format string, jobs []jobRecord) error {
+	if format == outputJSON || format == outputYAML {
+		output := jobsOutput{Jobs: make([]jobOutput, len(jobs))}
+		for i, job := range jobs {
+			output.Jobs[i] = newJobOutput(job)
+		}
+		return writeOutput(w, format, output)
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "HANDLER\tCAID\tRESOURCE\tSTATE\tCREATED\tUPDATED\tFILE\tERROR")
+	for _, job := range jobs {
+		fmt.Fprintf(tw, "%s\t%d\t%s\t%s\t%s\t%s\t%s\t%s\n",
+			job.Handler, job.CAID, jobResource(job), job.State,
+			job.CreatedAt.Local().Format(time.RFC3339), job.UpdatedAt.Local().Format(time.RFC3339),
+			orDash(job.FilePath), orDash(job.Error))
+	}
+	return tw.Flush()
+}
+
+// jobsOutput is the structured list of the jobs in the ledger
+type jobsOutput struct {
+	Jobs []jobOutput `json:"jobs" yaml:"jobs"`
+}
+
+// jobOutput is the structured form of a job in the ledger
+type jobOutput struct {
+	Handler   string    `json:"handler" yaml:"handler"`
+	CAID      int64     `json:"caid" yaml:"caid"`
+	Resource  string    `json:"resource" yaml:"resource"`
+	State     jobState  `json:"state" yaml:"state"`
+	File      string    `json:"file,omitempty" yaml:"file,omitempty"`
+	Error     string    `json:"error,omitempty" yaml:"error,omitempty"`
+	CreatedAt time.Time `json:"created_at" yaml:"created_at"`
+	UpdatedAt time.Time `json:"updated_at" yaml:"updated_at"`
+}
+
+// newJobOutput builds the structured form of the job
+func newJobOutput(job jobRecord) jobOutput {
+	return jobOutput{
+		Handler:   job.Handler,
+		CAID:      job.CAID,
+		Resource:  jobResource(job),
+		State:     job.State,
+		File:      job.FilePath,
+		Error:     job.Error,
+		CreatedAt: job.CreatedAt,
+		UpdatedAt: job.UpdatedAt,
+	}
+}
+
+// jobResource returns the exported resource of the job as type/id, or account for an account export
+func jobResource(job jobRecord) string {
+	if job.Resource == nil {
+		return "account"
+	}
+	return fmt.Sprintf("%s/%d", job.Resource.Type, job.Resource.ID)
+}
@@ -0,0 +1,186 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ren3gadem4rm0t/imperva-export-cli/pkg/client"
+	"github.com/spf13/viper"
+)
+
+// useTempLedger points the job ledger at a fresh file for the duration of the test
+func useTempLedger(t *testing.T) string {
+	t.Helper()
+	original := viper.GetString("jobs-file")
+	path := filepath.Join(t.TempDir(), "jobs.json")
+	viper.Set("jobs-file", path)
+	t.Cleanup(func() { viper.Set("jobs-file", original) })
+	return path
+}
+
+func TestJobLedger(t *testing.T) {
+	useTempLedger(t)
+	handler := "28c5f5af-bd9e-423f-99a7-d2a8c440db7e"
+	resource := &client.Resource{Type: client.ResourceSite, ID: 1234}
+
+	jobs, err := loadJobs()
+	if err != nil || len(jobs) != 0 {
+		t.Fatalf("loadJobs() on missing ledger = %v, %v", jobs, err)
+	}
+
+	trackJobStarted(123456, handler, resource)
+	job, err := findJob(handler)
+	if err != nil {
+		t.Fatalf("findJob() error = %v", err)
+	}
+	if job.State != jobStatePending || job.CAID != 123456 || job.Resource == nil || job.Resource.ID != 1234 {
+		t.Errorf("unexpected started job: %+v", job)
+	}
+	createdAt := job.CreatedAt
+
+	trackJobFinished(context.Background(), 123456, handler, nil, "/tmp/export.zip", nil)
+	job, err = findJob(handler)
+	if err != nil {
+		t.Fatalf("findJob() error = %v", err)
+	}
+	if job.State != jobStateCompleted || job.FilePath != "/tmp/export.zip" {
+		t.Errorf("unexpected finished job: %+v", job)
+	}
+	if !job.CreatedAt.Equal(createdAt) || job.Resource == nil {
+		t.Errorf("finishing a job should keep its creation time and resource: %+v", job)
+	}
+
+	if _, err := findJob("12345678-1234-1234-1234-1234567890ab"); err == nil {
+		t.Errorf("findJob() expected error for unknown handler")
+	}
+}
+
+func TestTrackJobFinished_States(t *testing.T) {
+	useTempLedger(t)
+
+	expired, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	tests := []struct {
+		name    string
+		ctx     context.Context
+		err     error
+		want    jobState
+		handler string
+	}{
+		{"completed", context.Background(), nil, jobStateCompleted, "00000000-0000-0000-0000-000000000001"},
+		{"failed", context.Background(), errors.New("API error"), jobStateFailed, "00000000-0000-0000-0000-000000000002"},
+		{"timed out", expired, errors.New("timed out"), jobStatePending, "00000000-0000-0000-0000-000000000003"},
+		{"not ready", context.Background(), client.ErrExportNotReady, jobStatePending, "00000000-0000-0000-0000-000000000004"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			trackJobFinished(tt.ctx, 123456, tt.handler, nil, "", tt.err)
+			job, err := findJob(tt.handler)
+			if err != nil {
+				t.Fatalf("findJob() error = %v", err)
+			}
+			if job.State != tt.want {
+				t.Errorf("job state = %q, want %q", job.State, tt.want)
+			}
+		})
+	}
+}
+
+func TestPruneJobs(t *testing.T) {
+	now := time.Now()
+	jobs := []jobRecord{
+		{Handler: "old-completed", State: jobStateCompleted, UpdatedAt: now.Add(-48 * time.Hour)},
+		{Handler: "old-failed", State: jobStateFailed, UpdatedAt: now.Add(-48 * time.Hour)},
+		{Handler: "old-pending", State: jobStatePending, UpdatedAt: now.Add(-48 * time.Hour)},
+		{Handler: "new-completed", State: jobStateCompleted, UpdatedAt: now},
+	}
+
+	kept, removed := pruneJobs(jobs, now.Add(-24*time.Hour), false)
+	if removed != 2 || len(kept) != 2 || kept[0].Handler != "old-pending" || kept[1].Handler != "new-completed" {
+		t.Errorf("pruneJobs() kept %+v, removed %d", kept, removed)
+	}
+
+	kept, removed = pruneJobs(jobs, now.Add(-24*time.Hour), true)
+	if removed != 3 || len(kept) != 1 {
+		t.Errorf("pruneJobs() with pending kept %+v, removed %d", kept, removed)
+	}
+}
+
+func TestPrintJobs(t *testing.T) {
+	jobs := []jobRecord{
+		{Handler: "28c5f5af-bd9e-423f-99a7-d2a8c440db7e", CAID: 123456, State: jobStatePending},
+		{Handler: "12345678-1234-1234-1234-1234567890ab", CAID: 123456, State: jobStateFailed, Error: "API error",
+			Resource: &client.Resource{Type: client.ResourcePolicy, ID: 42}},
+	}
+
+	var buf bytes.Buffer
+	if err := printJobs(&buf, outputText, filterJobs(jobs, jobStateFailed)); err != nil {
+		t.Fatalf("printJobs() error = %v", err)
+	}
+	out := buf.String()
+	if !strings.Contains(out, "POLICY/42") || !strings.Contains(out, "API error") || strings.Contains(out, "28c5f5af") {
+		t.Errorf("unexpected jobs table:\n%s", out)
+	}
+
+	buf.Reset()
+	if err := printJobs(&buf, outputJSON, filterJobs(jobs, jobStateFailed)); err != nil {
+		t.Fatalf("printJobs() JSON error = %v", err)
+	}
+	var output jobsOutput
+	if err := json.Unmarshal(buf.Bytes(), &output); err != nil {
+		t.Fatalf("printJobs() wrote invalid JSON: %v\n%s", err, buf.String())
+	}
+	if len(output.Jobs) != 1 || output.Jobs[0].Resource != "POLICY/42" || output.Jobs[0].State != jobStateFailed {
+		t.Errorf("unexpected jobs output: %+v", output)
+	}
+}
+
+func TestAutoRecordsJob(t *testing.T) {
+	useTempLedger(t)
+	viper.Set("api-id", "test-api-id")
+	viper.Set("api-key", "test-api-key")
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost {
+			w.WriteHeader(http.StatusAccepted)
+			_, _ = w.Write([]byte(`{"handler": "28c5f5af-bd9e-423f-99a7-d2a8c440db7e", "status": "Export in progress"}`))
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write(testExportContent)
+	}))
+	defer server.Close()
+
+	originalURL := apiBaseURL
+	apiBaseURL = server.URL
+	defer func() { apiBaseURL = originalURL }()
+
+	viper.Set("output-dir", t.TempDir())
+
+	handler, _, err := runAuto(context.Background(), 123456, nil)
+	if err != nil {
+		t.Fatalf("runAuto() error = %v", err)
+	}
+
+	job, err := findJob(handler)
+	if err != nil {
+		t.Fatalf("findJob() error = %v", err)
+	}
+	if job.State != jobStateCompleted {
+		t.Errorf("job state = %q, want %q", job.State, jobStateCompleted)
+	}
+	if _, err := os.Stat(job.FilePath); err != nil {
+		t.Errorf("recorded file %s: %v", job.FilePath, err)
+	}
+}
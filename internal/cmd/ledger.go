@@ -0,0 +1,213 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ren3gadem4rm0t/imperva-export-cli/internal/filelock"
+	"github.com/ren3gadem4rm0t/imperva-export-cli/pkg/client"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/viper"
+)
+
+// jobState is the state of an export job recorded in the ledger
+type jobState string
+
+const (
+	jobStatePending   jobState = "pending"
+	jobStateCompleted jobState = "completed"
+	jobStateFailed    jobState = "failed"
+)
+
+// jobRecord is an export job recorded in the ledger
+type jobRecord struct {
+	Handler   string           `json:"handler"`
+	CAID      int64            `json:"caid"`
+	Resource  *client.Resource `json:"resource,omitempty"`
+	State     jobState         `json:"state"`
+	FilePath  string           `json:"file_path,omitempty"`
+	Error     string           `json:"error,omitempty"`
+	CreatedAt time.Time        `json:"created_at"`
+	UpdatedAt time.Time        `json:"updated_at"`
+}
+
+// ledgerFile is the on-disk format of the ledger
+type ledgerFile struct {
+	Jobs []jobRecord `json:"jobs"`
+}
+
+// ledgerMu serializes ledger updates within the process, e.g. from concurrent batch exports. lockLedger
+// serializes them across processes, e.g. the daemon and a one-off export.
+var ledgerMu sync.Mutex
+
+// ledgerPath returns the path of the job ledger file
+func ledgerPath() (string, error) {
+	if path := viper.GetString("jobs-file"); path != "" {
+		return filepath.Clean(path), nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("could not find home directory: %w", err)
+	}
+	return filepath.Join(home, ".config", "imperva-export-cli-jobs.json"), nil
+}
+
+// loadJobs reads all jobs from the ledger. A missing ledger has no jobs.
+func loadJobs() ([]jobRecord, error) {
+	path, err := ledgerPath()
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(path) // #nosec G304 -- Ledger path comes from the user's own configuration
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read job ledger: %w", err)
+	}
+	var ledger ledgerFile
+	if err := json.Unmarshal(data, &ledger); err != nil {
+		return nil, fmt.Errorf("failed to parse job ledger %s: %w", path, err)
+	}
+	return ledger.Jobs, nil
+}
+
+// saveJobs atomically replaces the ledger with the given jobs
+func saveJobs(jobs []jobRecord) error {
+	path, err := ledgerPath()
+	if err != nil {
+		return err
+	}
+	sort.SliceStable(jobs, func(i, j int) bool {
+		return jobs[i].CreatedAt.Before(jobs[j].CreatedAt)
+	})
+	data, err := json.MarshalIndent(ledgerFile{Jobs: jobs}, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode job ledger: %w", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0750); err != nil {
+		return fmt.Errorf("failed to create job ledger directory: %w", err)
+	}
+	tempPath := path + ".tmp"
+	if err := os.WriteFile(tempPath, data, 0600); err != nil {
+		return fmt.Errorf("failed to write job ledger: %w", err)
+	}
+	if err := os.Rename(tempPath, path); err != nil {
+		_ = os.Remove(tempPath)
+		return fmt.Errorf("failed to replace job ledger: %w", err)
+	}
+	return nil
+}
+
+// lockLedger takes the lock file next to the ledger. The ledger itself is replaced on every save, so
+// it cannot be locked. The returned function releases the lock.
+func lockLedger() (func(), error) {
+	path, err := ledgerPath()
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0750); err != nil {
+		return nil, fmt.Errorf("failed to create job ledger directory: %w", err)
+	}
+	return filelock.LockPath(path + ".lock")
+}
+
+// updateJobs applies fn to the ledger under the process-wide and the file lock and saves the result
+func updateJobs(fn func([]jobRecord) []jobRecord) error {
+	ledgerMu.Lock()
+	defer ledgerMu.Unlock()
+	unlock, err := lockLedger()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	jobs, err := loadJobs()
+	if err != nil {
+		return err
+	}
+	return saveJobs(fn(jobs))
+}
+
+// findJob returns the ledger entry for a handler
+func findJob(handler string) (*jobRecord, error) {
+	ledgerMu.Lock()
+	defer ledgerMu.Unlock()
+
+	jobs, err := loadJobs()
+	if err != nil {
+		return nil, err
+	}
+	for i := range jobs {
+		if jobs[i].Handler == handler {
+			return &jobs[i], nil
+		}
+	}
+	return nil, &NotFoundError{Err: fmt.Errorf("no job with handler %s in the job ledger", handler)}
+}
+
+// upsertJob inserts the job or merges it into the existing entry with the same handler
+func upsertJob(job jobRecord) error {
+	return updateJobs(func(jobs []jobRecord) []jobRecord {
+		for i := range jobs {
+			if jobs[i].Handler == job.Handler {
+				job.CreatedAt = jobs[i].CreatedAt
+				if job.Resource == nil {
+					job.Resource = jobs[i].Resource
+				}
+				jobs[i] = job
+				return jobs
+			}
+		}
+		return append(jobs, job)
+	})
+}
+
+// trackJobStarted records a newly initiated export. Ledger failures are logged and never fail the export.
+func trackJobStarted(caid int64, handler string, resource *client.Resource) {
+	now := time.Now().UTC()
+	job := jobRecord{
+		Handler:   handler,
+		CAID:      caid,
+		Resource:  resource,
+		State:     jobStatePending,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	if err := upsertJob(job); err != nil {
+		log.Warn().Err(err).Msgf("Failed to record job %s in the job ledger", handler)
+	}
+}
+
+// trackJobFinished records the outcome of waiting for or downloading an export.
+// If the context expired or the export was not ready yet it may still complete, so the job stays pending and can be resumed.
+func trackJobFinished(ctx context.Context, caid int64, handler string, resource *client.Resource, filePath string, exportErr error) {
+	now := time.Now().UTC()
+	job := jobRecord{
+		Handler:   handler,
+		CAID:      caid,
+		Resource:  resource,
+		State:     jobStateCompleted,
+		FilePath:  filePath,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	if exportErr != nil {
+		job.Error = exportErr.Error()
+		job.State = jobStateFailed
+		if ctx.Err() != nil || errors.Is(exportErr, client.ErrExportNotReady) {
+			job.State = jobStatePending
+		}
+	}
+	if err := upsertJob(job); err != nil {
+		log.Warn().Err(err).Msgf("Failed to record job %s in the job ledger", handler)
+	}
+}
@@ -0,0 +1,59 @@
+package cmd
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+// TestMain keeps the job ledger of the tests out of the user's home directory
+func TestMain(m *testing.M) {
+	dir, err := os.MkdirTemp("", "imperva-export-cli-test")
+	if err != nil {
+		panic(err)
+	}
+	viper.Set("jobs-file", filepath.Join(dir, "jobs.json"))
+
+	code := m.Run()
+	_ = os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+// testExportContent is a valid export archive served by the test servers
+var testExportContent = newTestExportZip()
+
+// newTestExportZip builds an export archive large enough to be downloaded in several chunks
+func newTestExportZip() []byte {
+	var sites bytes.Buffer
+	for i := 0; i < 1000; i++ {
+		fmt.Fprintf(&sites, "resource \"incapsula_site\" \"site_%d\" {\n  domain = \"www%d.example.com\"\n}\n\n", i, i)
+	}
+
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	files := []struct {
+		name    string
+		content []byte
+	}{
+		{"main.tf", []byte("provider \"incapsula\" {}\n")},
+		{"sites.tf", sites.Bytes()},
+	}
+	for _, file := range files {
+		w, err := zw.CreateHeader(&zip.FileHeader{Name: file.name, Method: zip.Store})
+		if err != nil {
+			panic(err)
+		}
+		if _, err := w.Write(file.content); err != nil {
+			panic(err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		panic(err)
+	}
+	return buf.Bytes()
+}
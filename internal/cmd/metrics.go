@@ -0,0 +1,222 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/ren3gadem4rm0t/imperva-export-cli/internal/metrics"
+	"github.com/ren3gadem4rm0t/imperva-export-cli/pkg/client"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/viper"
+)
+
+// exportMetrics records the API requests, polls, downloads and outcomes of the exports of this process.
+// The daemon serves them with --metrics-addr, and every command writes them to --metrics-file on exit.
+var exportMetrics = newExportMetricSet(metrics.NewRegistry())
+
+// exportMetricSet holds the metrics of exports
+type exportMetricSet struct {
+	registry         *metrics.Registry
+	requests         *metrics.Counter
+	requestDuration  *metrics.Histogram
+	retries          *metrics.Counter
+	polls            *metrics.Counter
+	timeToReady      *metrics.Histogram
+	downloadBytes    *metrics.Counter
+	downloadDuration *metrics.Histogram
+	jobs             *metrics.Counter
+}
+
+// newExportMetricSet adds the metrics of exports to the registry
+func newExportMetricSet(r *metrics.Registry) *exportMetricSet {
+	return &exportMetricSet{
+		registry: r,
+		requests: r.Counter("imperva_export_requests_total",
+			"HTTP requests to the Account-Export API by method and status code, error if no response was received.",
+			"method", "status"),
+		requestDuration: r.Histogram("imperva_export_request_duration_seconds",
+			"Time until the response headers of an API request were received.",
+			[]float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60}, "method"),
+		retries: r.Counter("imperva_export_request_retries_total",
+			"Retries of failed API requests by method.",
+			"method"),
+		polls: r.Counter("imperva_export_polls_total",
+			"Polls of the export status by observed status (in_progress, ready).",
+			"status"),
+		timeToReady: r.Histogram("imperva_export_time_to_ready_seconds",
+			"Time from the start of polling for an export until its archive started to arrive.",
+			[]float64{1, 5, 10, 30, 60, 120, 300, 600, 1200}),
+		downloadBytes: r.Counter("imperva_export_download_bytes_total",
+			"Bytes of export archives received, including those of failed and restarted downloads."),
+		downloadDuration: r.Histogram("imperva_export_download_duration_seconds",
+			"Time to receive the archive of a successful download.",
+			[]float64{0.1, 0.5, 1, 2.5, 5, 10, 30, 60, 120, 300}),
+		jobs: r.Counter("imperva_export_jobs_total",
+			"Finished export jobs by outcome: success, in_progress or the failure class (auth, not_found, busy, timeout, validation, io, interrupted, error).",
+			"outcome"),
+	}
+}
+
+// observeAttempt records an HTTP attempt of the API client
+func (m *exportMetricSet) observeAttempt(a client.Attempt) {
+	status := "error"
+	if a.Status != 0 {
+		status = strconv.Itoa(a.Status)
+	}
+	m.requests.Inc(a.Method, status)
+	m.requestDuration.Observe(a.Duration.Seconds(), a.Method)
+	if a.Retry > 0 {
+		m.retries.Inc(a.Method)
+	}
+}
+
+// observeStatus records a poll of the export status
+func (m *exportMetricSet) observeStatus(status client.Status) {
+	m.polls.Inc(string(status))
+}
+
+// observeDownload records the bytes a download received and, once the archive started to arrive, the time
+// to receive it. The time from start until the archive arrived is the time to ready if the download waited for
+// the export by polling its status; a download of a finished export did not wait for it.
+func (m *exportMetricSet) observeDownload(w *meteredWriter, start time.Time, waited bool, err error) {
+	m.downloadBytes.Add(float64(w.written))
+	if w.first.IsZero() {
+		return
+	}
+	if waited {
+		m.timeToReady.Observe(w.first.Sub(start).Seconds())
+	}
+	if err == nil {
+		m.downloadDuration.Observe(time.Since(w.first).Seconds())
+	}
+}
+
+// observeJob records the outcome of a finished export job
+func (m *exportMetricSet) observeJob(err error) {
+	m.jobs.Inc(jobOutcome(err))
+}
+
+// observeBatch records the outcomes of the exports of a batch
+func (m *exportMetricSet) observeBatch(results []batchResult) {
+	for _, r := range results {
+		m.observeJob(r.Err)
+	}
+}
+
+// jobOutcome returns the outcome label of a job that ended with the error
+func jobOutcome(err error) string {
+	switch {
+	case err == nil:
+		return "success"
+	case errors.Is(err, client.ErrExportNotReady):
+		return "in_progress"
+	case errors.Is(err, context.Canceled):
+		return "interrupted"
+	}
+	switch ExitCode(classifyError(err)) {
+	case ExitValidation:
+		return "validation"
+	case ExitAuth:
+		return "auth"
+	case ExitNotFound:
+		return "not_found"
+	case ExitBusy:
+		return "busy"
+	case ExitTimeout:
+		return "timeout"
+	case ExitIO:
+		return "io"
+	case ExitInterrupt:
+		return "interrupted"
+	default:
+		return "error"
+	}
+}
+
+// observedStatusHook returns a status hook that records every poll before calling hook, if it is not nil
+func observedStatusHook(hook func(client.Status)) func(client.Status) {
+	return func(status client.Status) {
+		exportMetrics.observeStatus(status)
+		if hook != nil {
+			hook(status)
+		}
+	}
+}
+
+// meteredWriter counts the bytes written to a download and records when the first of them arrived
+type meteredWriter struct {
+	client.ResumableWriter
+	written int64
+	first   time.Time
+}
+
+// Write writes p to the underlying writer
+func (w *meteredWriter) Write(p []byte) (int, error) {
+	if w.first.IsZero() && len(p) > 0 {
+		w.first = time.Now()
+	}
+	n, err := w.ResumableWriter.Write(p)
+	w.written += int64(n)
+	return n, err
+}
+
+// writeMetricsFile writes the metrics to the file given with --metrics-file, if any
+func writeMetricsFile() error {
+	path := viper.GetString("metrics-file")
+	if path == "" {
+		return nil
+	}
+	if err := exportMetrics.registry.WriteFile(path); err != nil {
+		return newIOError(err)
+	}
+	log.Debug().Msgf("Metrics written to %s", path)
+	return nil
+}
+
+// metricsServer serves the metrics on /metrics
+type metricsServer struct {
+	listener net.Listener
+	server   *http.Server
+}
+
+// startMetricsServer starts serving the metrics on the address
+func startMetricsServer(addr string) (*metricsServer, error) {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, newValidationError(fmt.Errorf("failed to listen for metrics on %s: %w", addr, err))
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", exportMetrics.registry.Handler())
+	s := &metricsServer{
+		listener: listener,
+		server:   &http.Server{Handler: mux, ReadHeaderTimeout: 10 * time.Second},
+	}
+	go func() {
+		if err := s.server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Error().Err(err).Msg("Metrics server failed")
+		}
+	}()
+	log.Info().Msgf("Serving metrics on http://%s/metrics", listener.Addr())
+	return s, nil
+}
+
+// Addr returns the address the server listens on
+func (s *metricsServer) Addr() string {
+	return s.listener.Addr().String()
+}
+
+// Close stops the server, waiting briefly for running scrapes
+func (s *metricsServer) Close() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := s.server.Shutdown(ctx); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return fmt.Errorf("failed to shut down metrics server: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,166 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ren3gadem4rm0t/imperva-export-cli/pkg/client"
+	"github.com/ren3gadem4rm0t/imperva-export-cli/pkg/mockserver"
+	"github.com/spf13/viper"
+)
+
+// useMetrics starts the test with no recorded metrics
+func useMetrics(t *testing.T) {
+	t.Helper()
+	exportMetrics.registry.Reset()
+	t.Cleanup(exportMetrics.registry.Reset)
+}
+
+// metricsText returns the recorded metrics in the text exposition format
+func metricsText(t *testing.T) string {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := exportMetrics.registry.WriteText(&buf); err != nil {
+		t.Fatal(err)
+	}
+	return buf.String()
+}
+
+func TestAutoExport_Metrics(t *testing.T) {
+	useMockServer(t, mockserver.WithPolls(0), mockserver.WithFixture(newTestExportZip()),
+		mockserver.WithFault(mockserver.Fault{Status: 500, Endpoint: mockserver.EndpointDownload, Count: 1}))
+	useMetrics(t)
+	viper.Set("retry-base-delay", time.Millisecond)
+	t.Cleanup(func() { viper.Set("retry-base-delay", nil) })
+
+	captureResults(t, outputJSON)
+	if err := autoExport(context.Background(), 1234, nil, saveOptions{}); err != nil {
+		t.Fatalf("autoExport() error = %v", err)
+	}
+
+	text := metricsText(t)
+	for _, want := range []string{
+		`imperva_export_requests_total{method="POST",status="202"} 1`,
+		`imperva_export_requests_total{method="GET",status="500"} 1`,
+		`imperva_export_requests_total{method="GET",status="200"} 1`,
+		`imperva_export_request_retries_total{method="GET"} 1`,
+		`imperva_export_request_duration_seconds_count{method="GET"} 2`,
+		`imperva_export_polls_total{status="ready"} 1`,
+		`imperva_export_time_to_ready_seconds_count 1`,
+		fmt.Sprintf("imperva_export_download_bytes_total %d", len(newTestExportZip())),
+		`imperva_export_download_duration_seconds_count 1`,
+		`imperva_export_jobs_total{outcome="success"} 1`,
+	} {
+		if !strings.Contains(text, want+"\n") {
+			t.Errorf("metrics do not contain %q:\n%s", want, text)
+		}
+	}
+
+	// A rejected export is counted by its failure class
+	useMockServer(t, mockserver.WithFault(mockserver.Fault{Status: 401}))
+	if err := autoExport(context.Background(), 1234, nil, saveOptions{}); err == nil {
+		t.Fatal("autoExport() expected an authentication error")
+	}
+	if text := metricsText(t); !strings.Contains(text, `imperva_export_jobs_total{outcome="auth"} 1`) {
+		t.Errorf("metrics do not count the failure:\n%s", text)
+	}
+}
+
+func TestDownload_MetricsWithoutTimeToReady(t *testing.T) {
+	useMockServer(t, mockserver.WithPolls(0), mockserver.WithFixture(newTestExportZip()))
+	useMetrics(t)
+
+	handler, err := initiateExport(context.Background(), 1234)
+	if err != nil {
+		t.Fatalf("initiateExport() error = %v", err)
+	}
+	if _, err := downloadResourceExportFile(context.Background(), 1234, handler, nil); err != nil {
+		t.Fatalf("downloadResourceExportFile() error = %v", err)
+	}
+
+	// A download of a finished export did not poll for it, so it has no time to ready
+	text := metricsText(t)
+	if !strings.Contains(text, "imperva_export_download_duration_seconds_count 1\n") {
+		t.Errorf("metrics do not record the download:\n%s", text)
+	}
+	if strings.Contains(text, "imperva_export_time_to_ready_seconds_count 1") {
+		t.Errorf("a download without polling recorded the time to ready:\n%s", text)
+	}
+}
+
+func TestJobOutcome(t *testing.T) {
+	tests := []struct {
+		err  error
+		want string
+	}{
+		{nil, "success"},
+		{client.ErrExportNotReady, "in_progress"},
+		{fmt.Errorf("stopped: %w", context.Canceled), "interrupted"},
+		{fmt.Errorf("wait: %w", client.ErrWaitTimeout), "timeout"},
+		{newIOError(errors.New("disk full")), "io"},
+		{newValidationError(errors.New("bad flag")), "validation"},
+		{errors.New("boom"), "error"},
+	}
+	for _, tt := range tests {
+		if got := jobOutcome(tt.err); got != tt.want {
+			t.Errorf("jobOutcome(%v) = %q, want %q", tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestMetricsServer(t *testing.T) {
+	useMetrics(t)
+	exportMetrics.observeJob(nil)
+	server, err := startMetricsServer("127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("startMetricsServer() error = %v", err)
+	}
+	defer server.Close()
+
+	resp, err := http.Get("http://" + server.Addr() + "/metrics")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || !strings.Contains(string(body), `imperva_export_jobs_total{outcome="success"} 1`) {
+		t.Errorf("GET /metrics = %d:\n%s", resp.StatusCode, body)
+	}
+
+	if _, err := startMetricsServer(server.Addr()); ExitCode(err) != ExitValidation {
+		t.Errorf("startMetricsServer() on a used address error = %v, want a validation error", err)
+	}
+}
+
+func TestWriteMetricsFile(t *testing.T) {
+	useMetrics(t)
+	if err := writeMetricsFile(); err != nil {
+		t.Errorf("writeMetricsFile() without --metrics-file error = %v", err)
+	}
+
+	path := filepath.Join(t.TempDir(), "imperva_export.prom")
+	viper.Set("metrics-file", path)
+	t.Cleanup(func() { viper.Set("metrics-file", nil) })
+	exportMetrics.observeJob(errors.New("boom"))
+	if err := writeMetricsFile(); err != nil {
+		t.Fatalf("writeMetricsFile() error = %v", err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil || !strings.Contains(string(data), `imperva_export_jobs_total{outcome="error"} 1`) {
+		t.Errorf("metrics file = %q, %v", data, err)
+	}
+
+	viper.Set("metrics-file", filepath.Join(t.TempDir(), "missing", "imperva_export.prom"))
+	if err := writeMetricsFile(); ExitCode(err) != ExitIO {
+		t.Errorf("writeMetricsFile() to a missing directory error = %v, want an I/O error", err)
+	}
+}
@@ -0,0 +1,120 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/ren3gadem4rm0t/imperva-export-cli/pkg/mockserver"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var mockServerCmd = &cobra.Command{
+	Use:   "mock-server",
+	Short: "Run a local mock of the Account-Export API for offline testing",
+	Long: `Serve the Account-Export API contract locally without real credentials.
+
+Exports return a new handler, and the download endpoint answers 202 for --polls requests before it serves
+the fixture archive. Point the CLI at the mock with --base-url. If an API ID and key are configured, requests
+must use them; otherwise any credentials are accepted.
+
+Faults are injected with --fault STATUS[:ENDPOINT[:COUNT]], e.g. --fault 500:download:2 fails the first two
+downloads with 500. STATUS is 401, 403, 404 or 500, ENDPOINT is export, download or any, and a COUNT of 0
+fails every request.`,
+	Args: cobra.NoArgs,
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		return loadConfig()
+	},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cmd.SilenceUsage = true
+		server, err := newMockServer(cmd)
+		if err != nil {
+			return err
+		}
+
+		listen, _ := cmd.Flags().GetString("listen")
+		return runMockServer(cmd.Context(), listen, server, nil)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(mockServerCmd)
+	mockServerCmd.Flags().String("listen", "127.0.0.1:8080", "Address to listen on")
+	mockServerCmd.Flags().Int("polls", 1, "Number of download requests answered with 202 before the archive is served")
+	mockServerCmd.Flags().Duration("latency", 0, "Delay of every response")
+	mockServerCmd.Flags().String("fixture", "", "Export archive to serve (default is a small built-in archive)")
+	mockServerCmd.Flags().StringArray("fault", nil, "Inject a fault, STATUS[:ENDPOINT[:COUNT]] (repeatable)")
+}
+
+// newMockServer creates the mock server configured by the flags
+func newMockServer(cmd *cobra.Command) (*mockserver.Server, error) {
+	polls, _ := cmd.Flags().GetInt("polls")
+	latency, _ := cmd.Flags().GetDuration("latency")
+	fixturePath, _ := cmd.Flags().GetString("fixture")
+	faults, _ := cmd.Flags().GetStringArray("fault")
+
+	opts := []mockserver.Option{
+		mockserver.WithCredentials(viper.GetString("api-id"), viper.GetString("api-key")),
+		mockserver.WithPolls(polls),
+		mockserver.WithLatency(latency),
+	}
+	if fixturePath != "" {
+		fixture, err := os.ReadFile(fixturePath) // #nosec G304 -- The fixture path is provided by the user
+		if err != nil {
+			return nil, fmt.Errorf("failed to read fixture: %w", err)
+		}
+		opts = append(opts, mockserver.WithFixture(fixture))
+	}
+	for _, spec := range faults {
+		fault, err := mockserver.ParseFault(spec)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, mockserver.WithFault(fault))
+	}
+	return mockserver.New(opts...)
+}
+
+// runMockServer serves the mock API until the context is cancelled. The base URL of the listener is sent
+// to ready if it is not nil.
+func runMockServer(ctx context.Context, addr string, handler http.Handler, ready chan<- string) error {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s: %w", addr, err)
+	}
+
+	baseURL := "http://" + listener.Addr().String()
+	if printsText() {
+		fmt.Printf("Mock Account-Export API listening on %s\nUse --base-url %s to send requests to it.\n", baseURL, baseURL)
+	} else {
+		log.Info().Msgf("Mock Account-Export API listening on %s", baseURL)
+	}
+	if ready != nil {
+		ready <- baseURL
+	}
+
+	server := &http.Server{Handler: handler, ReadHeaderTimeout: 10 * time.Second}
+	errs := make(chan error, 1)
+	go func() {
+		errs <- server.Serve(listener)
+	}()
+
+	select {
+	case err := <-errs:
+		return fmt.Errorf("mock server failed: %w", err)
+	case <-ctx.Done():
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return fmt.Errorf("failed to shut down mock server: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,79 @@
+package cmd
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ren3gadem4rm0t/imperva-export-cli/internal/archive"
+	"github.com/ren3gadem4rm0t/imperva-export-cli/pkg/mockserver"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+func TestRunMockServer(t *testing.T) {
+	viper.Set("api-id", "test-api-id")
+	viper.Set("api-key", "test-api-key")
+
+	server, err := mockserver.New(
+		mockserver.WithCredentials("test-api-id", "test-api-key"),
+		mockserver.WithPolls(0),
+		mockserver.WithFault(mockserver.Fault{Status: 500, Endpoint: mockserver.EndpointDownload, Count: 1}),
+	)
+	if err != nil {
+		t.Fatalf("mockserver.New() error = %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	ready := make(chan string, 1)
+	done := make(chan error, 1)
+	go func() {
+		done <- runMockServer(ctx, "127.0.0.1:0", server, ready)
+	}()
+
+	select {
+	case baseURL := <-ready:
+		viper.Set("base-url", baseURL)
+		defer viper.Set("base-url", nil)
+	case err := <-done:
+		t.Fatalf("runMockServer() error = %v", err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("mock server did not start")
+	}
+
+	dir := t.TempDir()
+	viper.Set("output-dir", dir)
+	defer viper.Set("output-dir", "")
+
+	handler, _, err := runAuto(context.Background(), 1234, nil)
+	if err != nil {
+		t.Fatalf("runAuto() against the mock server error = %v", err)
+	}
+	if _, err := archive.Verify(filepath.Join(dir, exportFileName(1234, handler, nil))); err != nil {
+		t.Errorf("downloaded fixture is not a valid export: %v", err)
+	}
+
+	cancel()
+	if err := <-done; err != nil {
+		t.Errorf("runMockServer() error = %v", err)
+	}
+}
+
+func TestNewMockServer_InvalidFlags(t *testing.T) {
+	for _, args := range [][]string{{"--fault", "418"}, {"--polls", "-1"}, {"--fixture", filepath.Join(os.TempDir(), "missing-fixture.zip")}} {
+		cmd := &cobra.Command{}
+		cmd.Flags().Int("polls", 1, "")
+		cmd.Flags().Duration("latency", 0, "")
+		cmd.Flags().String("fixture", "", "")
+		cmd.Flags().StringArray("fault", nil, "")
+		if err := cmd.ParseFlags(args); err != nil {
+			t.Fatalf("ParseFlags(%v) error = %v", args, err)
+		}
+		if _, err := newMockServer(cmd); err == nil {
+			t.Errorf("newMockServer(%v) should fail", args)
+		}
+	}
+}
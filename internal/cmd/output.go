@@ -0,0 +1,178 @@
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/ren3gadem4rm0t/imperva-export-cli/pkg/client"
+	"github.com/rs/zerolog"
+	"github.com/spf13/viper"
+	"gopkg.in/yaml.v3"
+)
+
+// Output formats of the --output flag
+const (
+	outputText string = "text"
+	outputJSON string = "json"
+	outputYAML string = "yaml"
+)
+
+// States of an export in a structured result
+const (
+	resultInitiated  string = "initiated"
+	resultInProgress string = "in_progress"
+	resultDownloaded string = "downloaded"
+	resultFailed     string = "failed"
+)
+
+// resultOutput receives the structured results; tests replace it to capture them
+var resultOutput io.Writer = os.Stdout
+
+// exportResult is the structured result of export, status, download and auto
+type exportResult struct {
+	CAID       int64        `json:"caid" yaml:"caid"`
+	Resource   string       `json:"resource,omitempty" yaml:"resource,omitempty"`
+	Handler    string       `json:"handler,omitempty" yaml:"handler,omitempty"`
+	State      string       `json:"state" yaml:"state"`
+	File       string       `json:"file,omitempty" yaml:"file,omitempty"`
+	Bytes      int64        `json:"bytes,omitempty" yaml:"bytes,omitempty"`
+	SHA256     string       `json:"sha256,omitempty" yaml:"sha256,omitempty"`
+	Extracted  string       `json:"extracted,omitempty" yaml:"extracted,omitempty"`
+	Commit     string       `json:"commit,omitempty" yaml:"commit,omitempty"`
+	Redaction  string       `json:"redaction_report,omitempty" yaml:"redaction_report,omitempty"`
+	Uploaded   string       `json:"uploaded,omitempty" yaml:"uploaded,omitempty"`
+	DurationMS int64        `json:"duration_ms" yaml:"duration_ms"`
+	Error      *resultError `json:"error,omitempty" yaml:"error,omitempty"`
+}
+
+// resultError describes the error of a failed command, with the fields of the API error if the API returned one
+type resultError struct {
+	Message string `json:"message" yaml:"message"`
+	Status  int    `json:"status,omitempty" yaml:"status,omitempty"`
+	ID      string `json:"id,omitempty" yaml:"id,omitempty"`
+	Code    string `json:"code,omitempty" yaml:"code,omitempty"`
+	Title   string `json:"title,omitempty" yaml:"title,omitempty"`
+	Detail  string `json:"detail,omitempty" yaml:"detail,omitempty"`
+	Pointer string `json:"pointer,omitempty" yaml:"pointer,omitempty"`
+}
+
+// batchOutput is the structured result of a batch of exports
+type batchOutput struct {
+	Results []exportResult `json:"results" yaml:"results"`
+	Failed  int            `json:"failed" yaml:"failed"`
+}
+
+// ValidateOutput checks that the output format is supported
+func ValidateOutput(format string) error {
+	switch format {
+	case outputText, outputJSON, outputYAML:
+		return nil
+	default:
+		return newValidationError(fmt.Errorf("invalid output format: %q (must be text, json or yaml)", format))
+	}
+}
+
+// outputFormat returns the configured output format
+func outputFormat() string {
+	if format := viper.GetString("output"); format != "" {
+		return format
+	}
+	return outputText
+}
+
+// logsEnabled reports whether progress is logged rather than printed
+func logsEnabled() bool {
+	return zerolog.GlobalLevel() != zerolog.Disabled
+}
+
+// printsText reports whether progress messages are printed to stdout. They are only printed when logging
+// is disabled and no structured output was requested, so stdout holds nothing but the result.
+func printsText() bool {
+	return !logsEnabled() && outputFormat() == outputText
+}
+
+// newExportResult builds the structured result of an export. The state is derived from the error and
+// whether the export was saved.
+func newExportResult(caid int64, resource *client.Resource, handler string, saved savedExport, duration time.Duration, err error) exportResult {
+	result := exportResult{
+		CAID:       caid,
+		Handler:    handler,
+		File:       saved.Path,
+		Bytes:      saved.Size,
+		SHA256:     saved.SHA256,
+		Extracted:  saved.Extracted,
+		Commit:     saved.Commit,
+		Redaction:  saved.RedactionReport,
+		Uploaded:   saved.Uploaded,
+		DurationMS: duration.Milliseconds(),
+	}
+	if resource != nil {
+		result.Resource = fmt.Sprintf("%s/%d", resource.Type, resource.ID)
+	}
+
+	switch {
+	case errors.Is(err, client.ErrExportNotReady):
+		result.State = resultInProgress
+	case err != nil:
+		result.State = resultFailed
+	case saved.Path != "":
+		result.State = resultDownloaded
+	default:
+		result.State = resultInitiated
+	}
+	if err != nil {
+		result.Error = newResultError(err)
+	}
+	return result
+}
+
+// newResultError describes an error, extracting the fields of the first API error in its chain
+func newResultError(err error) *resultError {
+	resultErr := &resultError{Message: err.Error()}
+	var apiErr client.APIError
+	if errors.As(err, &apiErr) {
+		resultErr.Status = apiErr.Status
+		resultErr.ID = apiErr.ID
+		resultErr.Code = apiErr.Code
+		resultErr.Title = apiErr.Title
+		resultErr.Detail = apiErr.Detail
+		resultErr.Pointer = apiErr.Source.Pointer
+	}
+	return resultErr
+}
+
+// writeOutput encodes a result in the structured output format
+func writeOutput(w io.Writer, format string, v interface{}) error {
+	switch format {
+	case outputJSON:
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(v)
+	case outputYAML:
+		enc := yaml.NewEncoder(w)
+		enc.SetIndent(2)
+		if err := enc.Encode(v); err != nil {
+			return err
+		}
+		return enc.Close()
+	default:
+		return fmt.Errorf("invalid output format: %q", format)
+	}
+}
+
+// emitResult records the outcome of the job in the metrics and the audit log, writes the result to stdout if structured output was requested
+// and returns err unchanged, so commands report the result whether or not they failed
+func emitResult(result exportResult, err error) error {
+	exportMetrics.observeJob(err)
+	auditTrail.recordExport(result, err)
+	if format := outputFormat(); format != outputText {
+		if writeErr := writeOutput(resultOutput, format, result); writeErr != nil {
+			return errors.Join(err, fmt.Errorf("failed to write output: %w", writeErr))
+		}
+	}
+	return err
+}
@@ -0,0 +1,155 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ren3gadem4rm0t/imperva-export-cli/pkg/client"
+	"github.com/ren3gadem4rm0t/imperva-export-cli/pkg/mockserver"
+	"github.com/spf13/viper"
+	"gopkg.in/yaml.v3"
+)
+
+// useMockServer points the API client at a mock server for the duration of the test
+func useMockServer(t *testing.T, opts ...mockserver.Option) {
+	t.Helper()
+	server, err := mockserver.New(opts...)
+	if err != nil {
+		t.Fatalf("mockserver.New() error = %v", err)
+	}
+	httpServer := httptest.NewServer(server)
+	t.Cleanup(httpServer.Close)
+
+	viper.Set("api-id", "test-api-id")
+	viper.Set("api-key", "test-api-key")
+	viper.Set("base-url", httpServer.URL)
+	viper.Set("output-dir", t.TempDir())
+	t.Cleanup(func() {
+		viper.Set("base-url", nil)
+		viper.Set("output-dir", "")
+	})
+}
+
+// captureResults sets the output format and returns the buffer the structured results are written to
+func captureResults(t *testing.T, format string) *bytes.Buffer {
+	t.Helper()
+	var buf bytes.Buffer
+	original := resultOutput
+	resultOutput = &buf
+	viper.Set("output", format)
+	t.Cleanup(func() {
+		resultOutput = original
+		viper.Set("output", nil)
+	})
+	return &buf
+}
+
+func TestNewExportResult(t *testing.T) {
+	resource := &client.Resource{Type: client.ResourceSite, ID: 7}
+	saved := savedExport{Path: "/tmp/export.zip", Size: 42, SHA256: "abc"}
+	apiErr := fmt.Errorf("failed: %w", &client.ErrorResponse{Errors: []client.APIError{{Status: 401, Title: "Authentication Error", Detail: "Authentication missing or invalid"}}})
+
+	tests := []struct {
+		name      string
+		handler   string
+		saved     savedExport
+		err       error
+		wantState string
+	}{
+		{"initiated", "h", savedExport{}, nil, resultInitiated},
+		{"downloaded", "h", saved, nil, resultDownloaded},
+		{"in progress", "h", savedExport{}, fmt.Errorf("wrapped: %w", client.ErrExportNotReady), resultInProgress},
+		{"failed", "", savedExport{}, apiErr, resultFailed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := newExportResult(1, resource, tt.handler, tt.saved, 1500*time.Millisecond, tt.err)
+			if result.State != tt.wantState || result.Resource != "SITE/7" || result.DurationMS != 1500 {
+				t.Errorf("newExportResult() = %+v", result)
+			}
+			if (result.Error != nil) != (tt.err != nil) {
+				t.Errorf("newExportResult() error = %+v, want error %v", result.Error, tt.err)
+			}
+		})
+	}
+
+	result := newExportResult(1, nil, "", savedExport{}, 0, apiErr)
+	if result.Error.Status != 401 || result.Error.Title != "Authentication Error" || !strings.Contains(result.Error.Message, "failed: API errors") {
+		t.Errorf("newExportResult() error = %+v, want the API error fields", result.Error)
+	}
+}
+
+func TestAutoExport_JSONOutput(t *testing.T) {
+	useMockServer(t, mockserver.WithPolls(1))
+	out := captureResults(t, outputJSON)
+
+	if err := autoExport(context.Background(), 1234, nil, saveOptions{}); err != nil {
+		t.Fatalf("autoExport() error = %v", err)
+	}
+
+	var result exportResult
+	if err := json.Unmarshal(out.Bytes(), &result); err != nil {
+		t.Fatalf("output is not a single JSON object: %v\n%s", err, out.String())
+	}
+	if result.CAID != 1234 || result.State != resultDownloaded || result.Handler == "" || result.File == "" ||
+		result.Bytes != int64(len(mockserver.DefaultFixture())) || len(result.SHA256) != 64 || result.Error != nil {
+		t.Errorf("unexpected result: %+v", result)
+	}
+}
+
+func TestAutoExport_YAMLOutputError(t *testing.T) {
+	useMockServer(t, mockserver.WithFault(mockserver.Fault{Status: 401}))
+	out := captureResults(t, outputYAML)
+
+	err := autoExport(context.Background(), 1234, &client.Resource{Type: client.ResourcePolicy, ID: 9}, saveOptions{})
+	if err == nil {
+		t.Fatal("autoExport() expected an authentication error")
+	}
+
+	var result exportResult
+	if err := yaml.Unmarshal(out.Bytes(), &result); err != nil {
+		t.Fatalf("output is not YAML: %v\n%s", err, out.String())
+	}
+	if result.State != resultFailed || result.Resource != "POLICY/9" || result.Error == nil || result.Error.Status != 401 || result.Error.Pointer == "" {
+		t.Errorf("unexpected result: %+v", result)
+	}
+}
+
+func TestWriteBatchOutput(t *testing.T) {
+	results := []batchResult{
+		{CAID: 1, Handler: "h1", FilePath: "/tmp/a.zip", Size: 10, SHA256: "abc", Duration: time.Second},
+		{CAID: 2, Err: errors.New("boom")},
+	}
+	var buf bytes.Buffer
+	if err := writeBatchOutput(&buf, outputJSON, results); err != nil {
+		t.Fatalf("writeBatchOutput() error = %v", err)
+	}
+	var output batchOutput
+	if err := json.Unmarshal(buf.Bytes(), &output); err != nil {
+		t.Fatalf("invalid JSON: %v", err)
+	}
+	if output.Failed != 1 || len(output.Results) != 2 || output.Results[0].State != resultDownloaded || output.Results[1].Error.Message != "boom" {
+		t.Errorf("unexpected batch output: %+v", output)
+	}
+}
+
+func TestValidateOutput(t *testing.T) {
+	for _, format := range []string{"text", "json", "yaml"} {
+		if err := ValidateOutput(format); err != nil {
+			t.Errorf("ValidateOutput(%q) error = %v", format, err)
+		}
+	}
+	if err := ValidateOutput("xml"); err == nil {
+		t.Error("ValidateOutput(\"xml\") should fail")
+	}
+	if err := writeOutput(&bytes.Buffer{}, "xml", nil); err == nil {
+		t.Error("writeOutput() with an invalid format should fail")
+	}
+}
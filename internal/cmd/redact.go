@@ -0,0 +1,214 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/ren3gadem4rm0t/imperva-export-cli/internal/archive"
+	"github.com/ren3gadem4rm0t/imperva-export-cli/internal/redact"
+	"github.com/ren3gadem4rm0t/imperva-export-cli/pkg/client"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var redactCmd = &cobra.Command{
+	Use:   "redact <export.zip>",
+	Short: "Mask secrets and other sensitive values in the Terraform of an export archive",
+	Long: `Parses the Terraform files of an export archive and replaces sensitive values with references to new
+sensitive variables, or with the placeholder "REDACTED" in placeholder mode. Values are sensitive if the name
+of their attribute matches an attribute rule, e.g. password, private_key or certificate, or the value matches a
+pattern, e.g. a PEM block. References to variables and other objects are never redacted.
+
+The redacted archive is written to --out with a redacted_variables.tf declaring the new variables, and a
+report of every masked attribute, without its value, is written next to it.
+
+Rules are added with --redact-attribute and --redact-pattern or the redact.attributes and redact.patterns
+lists of the config file.`,
+	Args: cobra.ExactArgs(1),
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		return loadConfig()
+	},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cmd.SilenceUsage = true
+		format, err := commandFormat(cmd, reportFormats...)
+		if err != nil {
+			return err
+		}
+		opts, err := redactOptionsFromFlags(cmd)
+		if err != nil {
+			return err
+		}
+
+		out, _ := cmd.Flags().GetString("out")
+		if out == "" {
+			out = strings.TrimSuffix(args[0], ".zip") + ".redacted.zip"
+		}
+		if out == args[0] {
+			return newValidationError(fmt.Errorf("--out must not be the export archive"))
+		}
+		reportPath, _ := cmd.Flags().GetString("report")
+		if reportPath == "" {
+			reportPath = out + redact.ReportSuffix
+		}
+
+		report, err := redactExport(args[0], out, reportPath, opts.Options)
+		if err != nil {
+			return err
+		}
+		return printRedaction(os.Stdout, format, report, out, reportPath)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(redactCmd)
+	redactCmd.Flags().String("out", "", "Path of the redacted archive (default <export>.redacted.zip)")
+	redactCmd.Flags().String("report", "", "Path of the redaction report (default <out>"+redact.ReportSuffix+")")
+	redactCmd.Flags().String("format", "text", "Output format (text, json)")
+	addRedactFlags(redactCmd, false)
+}
+
+// redactOptions controls the redaction of a saved export
+type redactOptions struct {
+	Enabled bool
+	Options redact.Options
+}
+
+// addRedactFlags adds the flags controlling the redaction of an export. The --redact flag is only added
+// to commands that do not always redact.
+func addRedactFlags(cmd *cobra.Command, toggle bool) {
+	if toggle {
+		cmd.Flags().Bool("redact", false, "Mask sensitive values in the Terraform of the export after it was saved, replacing the archive")
+	}
+	cmd.Flags().String("redact-mode", "", "Replace sensitive values with a variable reference or a placeholder (variable, placeholder) (default variable)")
+	cmd.Flags().StringSlice("redact-attribute", nil, "Regular expression of attribute names to redact, in addition to the defaults")
+	cmd.Flags().StringSlice("redact-pattern", nil, "Regular expression of values to redact, in addition to the defaults")
+}
+
+// redactOptionsFromFlags returns the redaction options of the flags added by addRedactFlags and the config file
+func redactOptionsFromFlags(cmd *cobra.Command) (redactOptions, error) {
+	var opts redactOptions
+	opts.Enabled, _ = cmd.Flags().GetBool("redact")
+
+	opts.Options.Mode, _ = cmd.Flags().GetString("redact-mode")
+	if opts.Options.Mode == "" {
+		opts.Options.Mode = viper.GetString("redact.mode")
+	}
+	if opts.Options.Mode == "" {
+		opts.Options.Mode = redact.ModeVariable
+	}
+	if opts.Options.Mode != redact.ModeVariable && opts.Options.Mode != redact.ModePlaceholder {
+		return redactOptions{}, newValidationError(fmt.Errorf("invalid redaction mode: %q (must be %s or %s)",
+			opts.Options.Mode, redact.ModeVariable, redact.ModePlaceholder))
+	}
+
+	opts.Options.Rules = redact.DefaultRules()
+	attributes, _ := cmd.Flags().GetStringSlice("redact-attribute")
+	for _, expr := range append(viper.GetStringSlice("redact.attributes"), attributes...) {
+		rule, err := redact.AttributeRule(expr)
+		if err != nil {
+			return redactOptions{}, newValidationError(err)
+		}
+		opts.Options.Rules = append(opts.Options.Rules, rule)
+	}
+	patterns, _ := cmd.Flags().GetStringSlice("redact-pattern")
+	for _, expr := range append(viper.GetStringSlice("redact.patterns"), patterns...) {
+		rule, err := redact.ValueRule(expr)
+		if err != nil {
+			return redactOptions{}, newValidationError(err)
+		}
+		opts.Options.Rules = append(opts.Options.Rules, rule)
+	}
+	return opts, nil
+}
+
+// redactExport writes a redacted copy of the export archive at src to dst, which may be src itself, and the
+// redaction report to reportPath. The archive is written to a temp file that is renamed into place.
+func redactExport(src, dst, reportPath string, opts redact.Options) (*redact.Report, error) {
+	if err := ValidateOutputDir(dst); err != nil {
+		return nil, err
+	}
+	if err := ValidateOutputDir(reportPath); err != nil {
+		return nil, err
+	}
+
+	tempPath := dst + ".redact.tmp"
+	out, err := os.OpenFile(tempPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600) // #nosec G304 -- Path validated above
+	if err != nil {
+		return nil, newIOError(fmt.Errorf("failed to create redacted archive: %w", err))
+	}
+	report, err := redact.Archive(src, out, opts)
+	if closeErr := out.Close(); err == nil && closeErr != nil {
+		err = newIOError(fmt.Errorf("failed to write redacted archive: %w", closeErr))
+	}
+	if err != nil {
+		_ = os.Remove(tempPath)
+		return nil, fmt.Errorf("error redacting export: %w", err)
+	}
+	if err := os.Rename(tempPath, dst); err != nil {
+		_ = os.Remove(tempPath)
+		return nil, newIOError(fmt.Errorf("failed to rename redacted archive: %w", err))
+	}
+	if err := redact.WriteReport(reportPath, report); err != nil {
+		return nil, newIOError(err)
+	}
+
+	log.Info().Msgf("Redacted %d values in %d Terraform files of %s, report written to %s",
+		len(report.Findings), report.Files, dst, reportPath)
+	return report, nil
+}
+
+// redactSaved redacts a saved export in place if redaction is enabled, rewrites its manifest and records
+// the new size, checksum and report
+func redactSaved(saved *savedExport, caid int64, handler string, resource *client.Resource, opts redactOptions) error {
+	if !opts.Enabled || saved.Path == "" {
+		return nil
+	}
+	reportPath := saved.Path + redact.ReportSuffix
+	report, err := redactExport(saved.Path, saved.Path, reportPath, opts.Options)
+	if err != nil {
+		return err
+	}
+	saved.RedactionReport = reportPath
+
+	manifest, err := archive.Verify(saved.Path)
+	if err != nil {
+		return fmt.Errorf("redacted export failed verification: %w", err)
+	}
+	if err := writeExportManifest(saved.Path, manifest, caid, handler, resource); err != nil {
+		return newIOError(err)
+	}
+	saved.Size = manifest.Size
+	saved.SHA256 = manifest.SHA256
+
+	if printsText() {
+		fmt.Printf("Redacted %d values in %d Terraform files, report written to %s\n",
+			len(report.Findings), report.Files, reportPath)
+	}
+	return nil
+}
+
+// printRedaction writes the masked attributes of the report as a table or the report as JSON or YAML
+func printRedaction(w io.Writer, format string, report *redact.Report, out, reportPath string) error {
+	if format == outputJSON || format == outputYAML {
+		return writeOutput(w, format, report)
+	}
+
+	if len(report.Findings) > 0 {
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "FILE\tLINE\tADDRESS\tATTRIBUTE\tRULE\tREPLACEMENT")
+		for _, f := range report.Findings {
+			fmt.Fprintf(tw, "%s\t%d\t%s\t%s\t%s\t%s\n", f.File, f.Line, f.Address, f.Attribute, f.Rule, f.Replacement)
+		}
+		if err := tw.Flush(); err != nil {
+			return err
+		}
+		fmt.Fprintln(w)
+	}
+	fmt.Fprintf(w, "Redacted %d values in %d Terraform files to %s\n", len(report.Findings), report.Files, out)
+	fmt.Fprintf(w, "Report written to %s\n", reportPath)
+	return nil
+}
@@ -1,11 +1,14 @@
 package cmd
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"path/filepath"
 	"time"
 
+	"github.com/ren3gadem4rm0t/imperva-export-cli/internal/s3"
+	"github.com/ren3gadem4rm0t/imperva-export-cli/pkg/client"
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
 	"github.com/spf13/cobra"
@@ -26,9 +29,43 @@ https://docs.imperva.com/bundle/cloud-application-security/page/account-export.h
 	},
 }
 
+// Execute runs the root command with a context that is cancelled on SIGINT or SIGTERM, traced if the
+// OTEL_* environment variables enable tracing, records it in --audit-log and writes the metrics to
+// --metrics-file, if given. The returned error is wrapped in the typed error of its failure class, see
+// ExitCode.
 func Execute() error {
 	rootCmd.Version = version
-	return rootCmd.Execute()
+	ctx, cancel := newSignalContext()
+	defer cancel()
+
+	shutdownTracing, err := setupTracing(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		// Spans of an interrupted run are still exported, so the shutdown does not use ctx
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := shutdownTracing(shutdownCtx); err != nil {
+			log.Error().Err(err).Msg("Failed to export spans")
+		}
+	}()
+
+	auditTrail.begin(invokedCommand(os.Args[1:]))
+	err = rootCmd.ExecuteContext(parentTraceContext(ctx))
+	if err != nil && ctx.Err() != nil {
+		err = &InterruptedError{Err: err}
+	}
+	if auditErr := auditTrail.end(err); auditErr != nil && err == nil {
+		err = auditErr
+	}
+	if metricsErr := writeMetricsFile(); metricsErr != nil {
+		log.Error().Err(metricsErr).Msg("Failed to write metrics file")
+		if err == nil {
+			err = metricsErr
+		}
+	}
+	return classifyError(err)
 }
 
 func init() {
@@ -37,6 +74,45 @@ func init() {
 	rootCmd.PersistentFlags().String("api-key", "", "API Key - prefer to use environment variable API_KEY")
 	rootCmd.PersistentFlags().String("log-level", "none", "Set the logging level (none, debug, info, warn, error)")
 	rootCmd.PersistentFlags().String("output-dir", ".", "Directory to save exported files")
+	rootCmd.PersistentFlags().String("profile", "", "Named profile of the config file to use")
+	rootCmd.PersistentFlags().StringP("output", "o", outputText, "Output format of export, status, download, auto and jobs resume (text, json, yaml)")
+	rootCmd.PersistentFlags().String("jobs-file", "", "Job ledger file (default is $HOME/.config/imperva-export-cli-jobs.json)")
+	rootCmd.PersistentFlags().Bool("encrypt", false, "Encrypt saved exports with age to --encrypt-recipient or the passphrase")
+	rootCmd.PersistentFlags().StringSlice("encrypt-recipient", nil, "age X25519 recipient (age1...) saved exports are encrypted to, implies --encrypt")
+	rootCmd.PersistentFlags().StringSlice("identity", nil, "age identity file (AGE-SECRET-KEY-1...) decrypting encrypted exports")
+	rootCmd.PersistentFlags().String("passphrase-file", "", "File containing the passphrase that encrypts and decrypts exports - prefer to use environment variable EXPORT_PASSPHRASE")
+	rootCmd.PersistentFlags().String("audit-log", "", "Append-only audit log every command invocation is recorded in, verified with audit verify")
+	rootCmd.PersistentFlags().String("metrics-file", "", "File the Prometheus metrics of the run are written to on exit, e.g. for the textfile collector of the node exporter")
+	rootCmd.PersistentFlags().String("dest", "", "Destination of saved exports: a directory, file://, sftp://user@host[:port]/path, webdav://user@host[:port]/path or webdavs:// URL (default is --output-dir)")
+	rootCmd.PersistentFlags().String("sftp-identity", "", "Unencrypted SSH private key file authenticating to sftp:// destinations")
+	rootCmd.PersistentFlags().String("sftp-known-hosts", "", "Known hosts file verifying the host key of sftp:// destinations (default is ~/.ssh/known_hosts)")
+	rootCmd.PersistentFlags().String("s3-bucket", "", "Bucket of S3-compatible object storage saved exports are uploaded to")
+	rootCmd.PersistentFlags().String("s3-endpoint", "", "Endpoint URL of S3-compatible object storage like MinIO (default is Amazon S3)")
+	rootCmd.PersistentFlags().String("s3-region", "", "Region of the bucket (default is AWS_REGION or "+s3.DefaultRegion+")")
+	rootCmd.PersistentFlags().String("s3-prefix", "", "Prefix of the keys of uploaded exports")
+	rootCmd.PersistentFlags().String("s3-key-template", defaultS3KeyTemplate, "Key of uploaded exports with placeholders {profile}, {caid}, {date}, {time}, {handler}, {resource} and {file}")
+	rootCmd.PersistentFlags().String("s3-sse", "", "Server-side encryption of uploaded exports (AES256, aws:kms)")
+	rootCmd.PersistentFlags().String("s3-sse-kms-key-id", "", "KMS key of server-side encryption with aws:kms")
+
+	retry := client.DefaultRetryPolicy()
+	rootCmd.PersistentFlags().Int("max-retries", retry.MaxRetries, "Number of retries of a failed API request")
+	rootCmd.PersistentFlags().Duration("retry-base-delay", retry.BaseDelay, "Delay before the first retry, doubled on every further retry")
+	rootCmd.PersistentFlags().Duration("retry-max-delay", retry.MaxDelay, "Maximum delay between retries")
+	rootCmd.PersistentFlags().Float64("retry-jitter", retry.Jitter, "Fraction (0-1) by which retry delays are randomly shortened")
+	rootCmd.PersistentFlags().IntSlice("retry-statuses", client.DefaultRetryableStatuses, "HTTP status codes that are retried")
+	rootCmd.PersistentFlags().Bool("retry-busy", retry.RetryBusy, "Retry 403 responses for resources that are currently at work")
+	rootCmd.PersistentFlags().Duration("retry-busy-delay", retry.BusyDelay, "Delay before the first retry of a busy resource")
+
+	transport := client.DefaultTransportConfig()
+	rootCmd.PersistentFlags().String("base-url", "", "Base URL of the Account-Export API (default is "+client.DefaultBaseURL+")")
+	rootCmd.PersistentFlags().String("proxy", "", "URL of an HTTP, HTTPS or SOCKS5 proxy (default is the HTTPS_PROXY environment variable)")
+	rootCmd.PersistentFlags().String("ca-bundle", "", "PEM file of root CAs trusted in addition to the system roots")
+	rootCmd.PersistentFlags().String("tls-min-version", "1.2", "Minimum TLS version (1.2, 1.3)")
+	rootCmd.PersistentFlags().String("client-cert", "", "PEM client certificate for mutual TLS")
+	rootCmd.PersistentFlags().String("client-key", "", "PEM private key of the client certificate")
+	rootCmd.PersistentFlags().Duration("connect-timeout", transport.ConnectTimeout, "Timeout for connecting to the API including the TLS handshake")
+	rootCmd.PersistentFlags().Duration("read-timeout", transport.ReadTimeout, "Timeout for waiting on the response headers of a request")
+	rootCmd.PersistentFlags().Duration("http-timeout", transport.Timeout, "Overall timeout of a request including downloading the export (0 means no limit)")
 
 	if err := viper.BindPFlag("api-id", rootCmd.PersistentFlags().Lookup("api-id")); err != nil {
 		log.Error().Err(err).Msg("Failed to bind flag api-id")
@@ -51,6 +127,57 @@ func init() {
 		log.Error().Err(err).Msg("Failed to bind flag output-dir")
 	}
 
+	if err := viper.BindPFlag("profile", rootCmd.PersistentFlags().Lookup("profile")); err != nil {
+		log.Error().Err(err).Msg("Failed to bind flag profile")
+	}
+	if err := viper.BindPFlag("jobs-file", rootCmd.PersistentFlags().Lookup("jobs-file")); err != nil {
+		log.Error().Err(err).Msg("Failed to bind flag jobs-file")
+	}
+	if err := viper.BindPFlag("output", rootCmd.PersistentFlags().Lookup("output")); err != nil {
+		log.Error().Err(err).Msg("Failed to bind flag output")
+	}
+
+	for _, name := range []string{"encrypt", "encrypt-recipient", "identity", "passphrase-file"} {
+		if err := viper.BindPFlag(name, rootCmd.PersistentFlags().Lookup(name)); err != nil {
+			log.Error().Err(err).Msgf("Failed to bind flag %s", name)
+		}
+	}
+
+	if err := viper.BindPFlag("metrics-file", rootCmd.PersistentFlags().Lookup("metrics-file")); err != nil {
+		log.Error().Err(err).Msg("Failed to bind flag metrics-file")
+	}
+
+	if err := viper.BindPFlag("audit-log", rootCmd.PersistentFlags().Lookup("audit-log")); err != nil {
+		log.Error().Err(err).Msg("Failed to bind flag audit-log")
+	}
+
+	if err := viper.BindPFlag("dest", rootCmd.PersistentFlags().Lookup("dest")); err != nil {
+		log.Error().Err(err).Msg("Failed to bind flag dest")
+	}
+	for _, name := range []string{"identity", "known-hosts"} {
+		if err := viper.BindPFlag("sftp."+name, rootCmd.PersistentFlags().Lookup("sftp-"+name)); err != nil {
+			log.Error().Err(err).Msgf("Failed to bind flag sftp-%s", name)
+		}
+	}
+
+	for _, name := range []string{"bucket", "endpoint", "region", "prefix", "key-template", "sse", "sse-kms-key-id"} {
+		if err := viper.BindPFlag("s3."+name, rootCmd.PersistentFlags().Lookup("s3-"+name)); err != nil {
+			log.Error().Err(err).Msgf("Failed to bind flag s3-%s", name)
+		}
+	}
+
+	for _, name := range []string{"max-retries", "retry-base-delay", "retry-max-delay", "retry-jitter", "retry-statuses", "retry-busy", "retry-busy-delay"} {
+		if err := viper.BindPFlag(name, rootCmd.PersistentFlags().Lookup(name)); err != nil {
+			log.Error().Err(err).Msgf("Failed to bind flag %s", name)
+		}
+	}
+
+	for _, name := range []string{"base-url", "proxy", "ca-bundle", "tls-min-version", "client-cert", "client-key", "connect-timeout", "read-timeout", "http-timeout"} {
+		if err := viper.BindPFlag(name, rootCmd.PersistentFlags().Lookup(name)); err != nil {
+			log.Error().Err(err).Msgf("Failed to bind flag %s", name)
+		}
+	}
+
 	if err := viper.BindEnv("api-id", "API_ID"); err != nil {
 		log.Error().Err(err).Msg("Failed to bind environment variable API_ID")
 	}
@@ -60,11 +187,56 @@ func init() {
 	if err := viper.BindEnv("output-dir", "OUTPUT_DIR"); err != nil {
 		log.Error().Err(err).Msg("Failed to bind environment variable OUTPUT_DIR")
 	}
+	if err := viper.BindEnv("jobs-file", "JOBS_FILE"); err != nil {
+		log.Error().Err(err).Msg("Failed to bind environment variable JOBS_FILE")
+	}
+	if err := viper.BindEnv("profile", "IMPERVA_PROFILE"); err != nil {
+		log.Error().Err(err).Msg("Failed to bind environment variable IMPERVA_PROFILE")
+	}
+	if err := viper.BindEnv("passphrase", "EXPORT_PASSPHRASE"); err != nil {
+		log.Error().Err(err).Msg("Failed to bind environment variable EXPORT_PASSPHRASE")
+	}
+	for key, env := range map[string]string{
+		"dest":                 "EXPORT_DEST",
+		"audit-log":            "AUDIT_LOG",
+		"sftp.password":        "SFTP_PASSWORD",
+		"webdav.password":      "WEBDAV_PASSWORD",
+		"s3.access-key-id":     "AWS_ACCESS_KEY_ID",
+		"s3.secret-access-key": "AWS_SECRET_ACCESS_KEY",
+		"s3.session-token":     "AWS_SESSION_TOKEN",
+		"s3.region":            "AWS_REGION",
+	} {
+		if err := viper.BindEnv(key, env); err != nil {
+			log.Error().Err(err).Msgf("Failed to bind environment variable %s", env)
+		}
+	}
+
+	rootCmd.SetFlagErrorFunc(func(cmd *cobra.Command, err error) error {
+		return newValidationError(err)
+	})
 
 	rootCmd.SetVersionTemplate(fmt.Sprintf("imperva-export-cli version %s\n", version))
 }
 
 func initConfig() error {
+	if err := loadConfig(); err != nil {
+		return err
+	}
+
+	if viper.GetString("api-id") == "" || viper.GetString("api-key") == "" {
+		return &AuthError{Err: fmt.Errorf("API ID and API Key must be provided via flags, config file, or environment variables")}
+	}
+
+	if err := validateConfig(); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// loadConfig reads the config file and sets up logging without requiring API credentials,
+// for commands that never call the API
+func loadConfig() error {
 	if cfgFile != "" {
 		viper.SetConfigFile(cfgFile)
 	} else {
@@ -81,21 +253,22 @@ func initConfig() error {
 
 	if err := viper.ReadInConfig(); err != nil {
 		if _, ok := err.(viper.ConfigFileNotFoundError); !ok {
-			return fmt.Errorf("error reading config file: %w", err)
+			return newValidationError(fmt.Errorf("error reading config file: %w", err))
 		}
 	}
 
-	logLevel := viper.GetString("log-level")
-	setLogLevel(logLevel)
-
-	if viper.GetString("api-id") == "" || viper.GetString("api-key") == "" {
-		return fmt.Errorf("API ID and API Key must be provided via flags, config file, or environment variables")
+	if err := applyProfile(); err != nil {
+		return err
 	}
 
-	if err := validateConfig(); err != nil {
+	if err := ValidateOutput(outputFormat()); err != nil {
 		return err
 	}
 
+	logLevel := viper.GetString("log-level")
+	setLogLevel(logLevel)
+
+	auditTrail.start()
 	return nil
 }
 
@@ -128,10 +301,10 @@ func setLogLevel(level string) {
 
 func validateConfig() error {
 	if viper.GetString("api-id") == "" {
-		return fmt.Errorf("API ID must be provided via flag, config file, or environment variable")
+		return &AuthError{Err: fmt.Errorf("API ID must be provided via flag, config file, or environment variable")}
 	}
 	if viper.GetString("api-key") == "" {
-		return fmt.Errorf("API Key must be provided via flag, config file, or environment variable")
+		return &AuthError{Err: fmt.Errorf("API Key must be provided via flag, config file, or environment variable")}
 	}
 	return nil
 }
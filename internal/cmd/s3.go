@@ -0,0 +1,148 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ren3gadem4rm0t/imperva-export-cli/internal/archive"
+	"github.com/ren3gadem4rm0t/imperva-export-cli/internal/s3"
+	"github.com/ren3gadem4rm0t/imperva-export-cli/pkg/client"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/viper"
+)
+
+// defaultS3KeyTemplate names the objects of uploaded exports unless s3.key-template is configured
+const defaultS3KeyTemplate string = "{caid}/{date}/{file}"
+
+// s3Enabled reports whether saved exports are uploaded to a bucket
+func s3Enabled() bool {
+	return viper.GetString("s3.bucket") != ""
+}
+
+// newS3Client returns a client of the configured bucket, or nil if exports are not uploaded
+func newS3Client() (*s3.Client, error) {
+	if !s3Enabled() {
+		return nil, nil
+	}
+	httpClient, err := sharedHTTPClient()
+	if err != nil {
+		return nil, err
+	}
+	c, err := s3.New(s3.Config{
+		Endpoint: viper.GetString("s3.endpoint"),
+		Region:   viper.GetString("s3.region"),
+		Bucket:   viper.GetString("s3.bucket"),
+		Credentials: s3.Credentials{
+			AccessKeyID:     viper.GetString("s3.access-key-id"),
+			SecretAccessKey: viper.GetString("s3.secret-access-key"),
+			SessionToken:    viper.GetString("s3.session-token"),
+		},
+		SSE:         viper.GetString("s3.sse"),
+		SSEKMSKeyID: viper.GetString("s3.sse-kms-key-id"),
+		HTTPClient:  httpClient,
+	})
+	if err != nil {
+		return nil, newValidationError(fmt.Errorf("invalid S3 configuration: %w", err))
+	}
+	return c, nil
+}
+
+// s3Key returns the key an export is uploaded to: the configured prefix followed by the key template with
+// its placeholders {profile}, {caid}, {date}, {time}, {handler}, {resource} and {file} expanded
+func s3Key(caid int64, handler string, resource *client.Resource, now time.Time) (string, error) {
+	template := viper.GetString("s3.key-template")
+	if template == "" {
+		template = defaultS3KeyTemplate
+	}
+	profile := strings.ToLower(viper.GetString("profile"))
+	if profile == "" {
+		profile = "default"
+	}
+	resourceName := "account"
+	if resource != nil {
+		resourceName = fmt.Sprintf("%s_%d", strings.ToLower(string(resource.Type)), resource.ID)
+	}
+	now = now.UTC()
+
+	key, err := s3.ExpandKey(template, map[string]string{
+		"profile":  profile,
+		"caid":     strconv.FormatInt(caid, 10),
+		"date":     now.Format("2006-01-02"),
+		"time":     now.Format(extractTimeFormat),
+		"handler":  handler,
+		"resource": resourceName,
+		"file":     exportFileName(caid, handler, resource),
+	})
+	if err != nil {
+		return "", newValidationError(err)
+	}
+	if prefix := strings.Trim(viper.GetString("s3.prefix"), "/"); prefix != "" {
+		key = prefix + "/" + key
+	}
+	return key, nil
+}
+
+// newExportUpload starts the upload of an export to the configured bucket, or returns nil if exports are
+// not uploaded. Nothing is visible in the bucket before the upload is committed.
+func newExportUpload(ctx context.Context, caid int64, handler string, resource *client.Resource) (*exportUpload, error) {
+	c, err := newS3Client()
+	if err != nil || c == nil {
+		return nil, err
+	}
+	key, err := s3Key(caid, handler, resource, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	return &exportUpload{ctx: ctx, client: c, key: key, Upload: c.NewUpload(ctx, key, "application/zip")}, nil
+}
+
+// exportUpload streams an export to the bucket while it is written to the temp file
+type exportUpload struct {
+	*s3.Upload
+	ctx    context.Context
+	client *s3.Client
+	key    string
+}
+
+// restart aborts the upload and starts a new one, for a download that starts over
+func (u *exportUpload) restart() error {
+	if err := u.Abort(); err != nil {
+		return err
+	}
+	u.Upload = u.client.NewUpload(u.ctx, u.key, "application/zip")
+	return nil
+}
+
+// resume uploads the bytes of a partial download that is resumed, so the object is complete
+func (u *exportUpload) resume(path string) error {
+	file, err := os.Open(path) // #nosec G304 -- Callers pass the validated temp file path
+	if err != nil {
+		return newIOError(fmt.Errorf("failed to read partial download: %w", err))
+	}
+	defer file.Close()
+	if _, err := io.Copy(u.Upload, file); err != nil {
+		return fmt.Errorf("failed to upload partial download: %w", err)
+	}
+	return nil
+}
+
+// commit completes the upload of the export and uploads its manifest next to it
+func (u *exportUpload) commit(manifest []byte) (string, error) {
+	if err := u.Commit(); err != nil {
+		return "", fmt.Errorf("failed to upload export: %w", err)
+	}
+	if err := u.client.PutObject(u.ctx, u.key+archive.ManifestSuffix, "application/json", manifest); err != nil {
+		return "", fmt.Errorf("failed to upload manifest: %w", err)
+	}
+	url := u.client.URL(u.key)
+	log.Info().Msgf("Uploaded export to %s", url)
+	if printsText() {
+		fmt.Printf("Uploaded export to %s\n", url)
+	}
+	return url, nil
+}
@@ -0,0 +1,136 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/ren3gadem4rm0t/imperva-export-cli/internal/archive"
+	"github.com/ren3gadem4rm0t/imperva-export-cli/internal/s3/s3test"
+	"github.com/ren3gadem4rm0t/imperva-export-cli/pkg/client"
+	"github.com/ren3gadem4rm0t/imperva-export-cli/pkg/mockserver"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// useS3 uploads saved exports to the bucket "exports" of a new stand-in server
+func useS3(t *testing.T) *s3test.Server {
+	t.Helper()
+	server := s3test.New("minio")
+	httpServer := httptest.NewServer(server)
+	t.Cleanup(httpServer.Close)
+
+	settings := map[string]string{
+		"s3.endpoint":          httpServer.URL,
+		"s3.bucket":            "exports",
+		"s3.access-key-id":     "minio",
+		"s3.secret-access-key": "minio-secret",
+	}
+	for key, value := range settings {
+		viper.Set(key, value)
+	}
+	t.Cleanup(func() {
+		for key := range settings {
+			viper.Set(key, nil)
+		}
+		viper.Set("s3.prefix", nil)
+		viper.Set("s3.key-template", nil)
+		viper.Set("s3.sse", nil)
+	})
+	return server
+}
+
+func TestAutoExport_S3(t *testing.T) {
+	useMockServer(t, mockserver.WithPolls(0), mockserver.WithFixture(newTestExportZip()))
+	server := useS3(t)
+	viper.Set("s3.prefix", "/backups/")
+	viper.Set("s3.key-template", "{profile}/{caid}/{handler}.zip")
+	viper.Set("s3.sse", "AES256")
+	out := captureResults(t, outputJSON)
+
+	if err := autoExport(context.Background(), 1234, nil, saveOptions{}); err != nil {
+		t.Fatalf("autoExport() error = %v", err)
+	}
+	var result exportResult
+	if err := json.Unmarshal(out.Bytes(), &result); err != nil {
+		t.Fatalf("output is not JSON: %v", err)
+	}
+	key := "backups/default/1234/" + result.Handler + ".zip"
+	if result.Uploaded != "s3://exports/"+key {
+		t.Errorf("uploaded = %q, want s3://exports/%s", result.Uploaded, key)
+	}
+
+	object, ok := server.Object("exports", key)
+	if !ok {
+		t.Fatalf("export not uploaded, keys = %v", server.Keys("exports"))
+	}
+	saved, err := os.ReadFile(result.File)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(object.Data, saved) || object.ContentType != "application/zip" || object.SSE != "AES256" {
+		t.Errorf("uploaded object differs from the saved export: %d bytes, %q, sse %q", len(object.Data), object.ContentType, object.SSE)
+	}
+	manifest, ok := server.Object("exports", key+archive.ManifestSuffix)
+	if !ok {
+		t.Fatalf("manifest not uploaded, keys = %v", server.Keys("exports"))
+	}
+	if local, err := os.ReadFile(result.File + archive.ManifestSuffix); err != nil || !bytes.Equal(manifest.Data, local) {
+		t.Errorf("uploaded manifest differs from the saved manifest: %v", err)
+	}
+}
+
+func TestAutoExport_S3Failure(t *testing.T) {
+	useMockServer(t, mockserver.WithPolls(0), mockserver.WithFixture(newTestExportZip()))
+	server := useS3(t)
+	server.FailRequests(1)
+	captureResults(t, outputJSON)
+
+	if err := autoExport(context.Background(), 1234, nil, saveOptions{}); err == nil {
+		t.Fatal("autoExport() succeeded although the upload failed")
+	}
+	if keys := server.Keys("exports"); len(keys) != 0 || server.PendingUploads() != 0 {
+		t.Errorf("failed upload left objects %v and %d pending uploads", keys, server.PendingUploads())
+	}
+}
+
+func TestS3Key(t *testing.T) {
+	now := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	resource := &client.Resource{Type: client.ResourceSite, ID: 7}
+	t.Cleanup(func() {
+		viper.Set("s3.key-template", nil)
+		viper.Set("profile", nil)
+	})
+
+	key, err := s3Key(1234, "abc", nil, now)
+	if err != nil || key != "1234/2026-01-02/"+exportFileName(1234, "abc", nil) {
+		t.Errorf("s3Key() with the default template = %q, %v", key, err)
+	}
+
+	viper.Set("profile", "Prod")
+	viper.Set("s3.key-template", "{profile}/{caid}/{date}/{resource}/{handler}.zip")
+	if key, err := s3Key(1234, "abc", resource, now); err != nil || key != "prod/1234/2026-01-02/site_7/abc.zip" {
+		t.Errorf("s3Key() = %q, %v", key, err)
+	}
+
+	viper.Set("s3.key-template", "{caid}/{account}.zip")
+	if _, err := s3Key(1234, "abc", nil, now); ExitCode(err) != ExitValidation {
+		t.Errorf("s3Key() with an unknown placeholder error = %v", err)
+	}
+}
+
+func TestSaveOptionsFromFlags_S3(t *testing.T) {
+	useS3(t)
+	cmd := &cobra.Command{}
+	addSaveFlags(cmd)
+	if err := cmd.ParseFlags([]string{"--redact"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := saveOptionsFromFlags(cmd); ExitCode(err) != ExitValidation {
+		t.Errorf("saveOptionsFromFlags() accepted --redact with an S3 bucket: %v", err)
+	}
+}
@@ -0,0 +1,59 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/rs/zerolog/log"
+)
+
+// newSignalContext returns a context that is cancelled on the first SIGINT or SIGTERM. The signals are
+// released after the first one, so a second signal terminates the process immediately.
+func newSignalContext() (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(context.Background())
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		defer signal.Stop(signals)
+		select {
+		case sig := <-signals:
+			log.Warn().Msgf("Received %s, stopping. Send it again to exit immediately", sig)
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	return ctx, cancel
+}
+
+// interrupted reports whether the context was cancelled rather than running into its deadline
+func interrupted(ctx context.Context) bool {
+	return errors.Is(ctx.Err(), context.Canceled)
+}
+
+// reportInterrupted tells the user that an export was left in progress by an interrupt, whether a partial
+// download was kept and how to resume it. It is written to stderr so structured output on stdout stays valid.
+func reportInterrupted(caid int64, handler string) {
+	partial, kept := keptPartials.lookup(handler)
+
+	if logsEnabled() {
+		event := log.Warn().Int64("caid", caid).Str("handler", handler)
+		if kept {
+			event = event.Str("partial", partial.path).Int64("bytes", partial.size)
+		}
+		event.Msgf("Interrupted, resume with: imperva-export-cli jobs resume %s", handler)
+		return
+	}
+
+	if printsText() {
+		fmt.Println()
+	}
+	fmt.Fprintf(os.Stderr, "Interrupted: export %s of CAID %d was not downloaded.\n", handler, caid)
+	if kept {
+		fmt.Fprintf(os.Stderr, "Partial download kept for resume: %s (%d bytes)\n", partial.path, partial.size)
+	}
+	fmt.Fprintf(os.Stderr, "Resume it with: imperva-export-cli jobs resume %s\n", handler)
+}
@@ -0,0 +1,95 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/ren3gadem4rm0t/imperva-export-cli/internal/sink"
+	"github.com/ren3gadem4rm0t/imperva-export-cli/pkg/mockserver"
+)
+
+func TestNewSignalContext(t *testing.T) {
+	ctx, cancel := newSignalContext()
+	defer cancel()
+
+	if err := syscall.Kill(syscall.Getpid(), syscall.SIGTERM); err != nil {
+		t.Fatalf("Failed to send SIGTERM: %v", err)
+	}
+	select {
+	case <-ctx.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("context was not cancelled by SIGTERM")
+	}
+	if !interrupted(ctx) {
+		t.Errorf("interrupted() = false after SIGTERM")
+	}
+}
+
+func TestAutoExport_Interrupted(t *testing.T) {
+	useMockServer(t, mockserver.WithPolls(1000))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(200*time.Millisecond, cancel)
+
+	handler, _, err := runAuto(ctx, 1234, nil)
+	if err == nil {
+		t.Fatal("runAuto() expected an error after the interrupt")
+	}
+	if errors.Is(err, context.DeadlineExceeded) || !strings.Contains(err.Error(), "stopped waiting") {
+		t.Errorf("runAuto() error = %v, want the wait to be stopped", err)
+	}
+	if ExitCode(classifyError(&InterruptedError{Err: err})) != ExitInterrupt {
+		t.Errorf("interrupted export does not exit with %d", ExitInterrupt)
+	}
+
+	job, err := findJob(handler)
+	if err != nil {
+		t.Fatalf("findJob() error = %v", err)
+	}
+	if job.State != jobStatePending {
+		t.Errorf("interrupted job state = %s, want %s so it can be resumed", job.State, jobStatePending)
+	}
+}
+
+func TestSaveExportFile_KeptPartial(t *testing.T) {
+	handler := "00000000-0000-0000-0000-000000000042"
+	interruptedDownload := func(w io.Writer) (int64, error) {
+		n, err := w.Write(testExportContent[:len(testExportContent)/2])
+		if err != nil {
+			return int64(n), err
+		}
+		return int64(n), context.Canceled
+	}
+	dir := t.TempDir()
+	useDest(t, dir)
+	t.Cleanup(func() { keptPartials.forget(handler) })
+
+	// The partial download is reported where the sink in use kept it
+	if _, err := saveExportFile(context.Background(), 1234, handler, nil, false, interruptedDownload); !errors.Is(err, context.Canceled) {
+		t.Fatalf("saveExportFile() error = %v, want the interrupt", err)
+	}
+	partial, kept := keptPartials.lookup(handler)
+	want := filepath.Join(dir, exportFileName(1234, handler, nil)) + sink.TempSuffix
+	if !kept || partial.path != want || partial.size != int64(len(testExportContent)/2) {
+		t.Errorf("kept partial = %+v, %v, want %s with %d bytes", partial, kept, want, len(testExportContent)/2)
+	}
+
+	// An encrypted download cannot be resumed, so its partial file is discarded
+	useEncryption(t)
+	if _, err := saveExportFile(context.Background(), 1234, handler, nil, false, interruptedDownload); !errors.Is(err, context.Canceled) {
+		t.Fatalf("encrypted saveExportFile() error = %v, want the interrupt", err)
+	}
+	if partial, kept := keptPartials.lookup(handler); kept {
+		t.Errorf("encrypted download kept partial %+v", partial)
+	}
+	if _, err := os.Stat(filepath.Join(dir, exportFileName(1234, handler, nil)) + sink.TempSuffix); !os.IsNotExist(err) {
+		t.Errorf("encrypted partial file was left behind: %v", err)
+	}
+}
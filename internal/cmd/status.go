@@ -4,10 +4,9 @@ import (
 	"context"
 	"fmt"
 	"io"
-	"net/http"
 	"time"
 
-	"github.com/rs/zerolog"
+	"github.com/ren3gadem4rm0t/imperva-export-cli/pkg/client"
 	"github.com/rs/zerolog/log"
 	"github.com/spf13/cobra"
 )
@@ -24,112 +23,74 @@ This command polls the API to determine if the export has completed and download
 			return err
 		}
 
-		caid, _ := cmd.Flags().GetInt64("caid")
-		if err := ValidateCAID(caid); err != nil {
+		caid, err := caidFromFlags(cmd)
+		if err != nil {
 			return err
 		}
 
-		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+		resource, err := resourceFromFlags(cmd)
+		if err != nil {
+			return err
+		}
+
+		ctx, cancel := context.WithTimeout(cmd.Context(), 10*time.Minute)
 		defer cancel()
 
-		if err := checkExportStatusWithContext(ctx, caid, handler); err != nil {
-			return fmt.Errorf("error checking export status: %w", err)
+		start := time.Now()
+		saved, err := checkResourceExportStatusWithContext(ctx, caid, handler, resource)
+		if err != nil {
+			err = fmt.Errorf("error checking export status: %w", err)
 		}
-		return nil
+		return emitResult(newExportResult(caid, resource, handler, saved, time.Since(start), err), err)
 	},
 }
 
 func init() {
 	rootCmd.AddCommand(statusCmd)
 	statusCmd.Flags().String("handler", "", "The handler received in the export response")
-	statusCmd.Flags().Int64("caid", 0, "The account ID to work on")
+	statusCmd.Flags().Int64("caid", 0, "The account ID to work on (default is the caid of the profile)")
+	addResourceFlags(statusCmd)
 	if err := statusCmd.MarkFlagRequired("handler"); err != nil {
 		log.Error().Err(err).Msg("Failed to mark flag as required")
 	}
-	if err := statusCmd.MarkFlagRequired("caid"); err != nil {
-		log.Error().Err(err).Msg("Failed to mark flag as required")
-	}
 }
 
-func checkExportStatusWithContext(ctx context.Context, caid int64, handler string) error {
-	url := fmt.Sprintf("%s/v3/export/download/%s?caid=%d", apiBaseURL, handler, caid)
-
-	initialDelay := 1 * time.Second
-	maxDelay := 30 * time.Second
-	currentDelay := initialDelay
-	attempts := 0
-	maxAttempts := 60
+// checkResourceExportStatusWithContext polls the export status and saves the file once ready.
+// A non-nil resource marks a single-resource export and is reflected in the saved file name.
+func checkResourceExportStatusWithContext(ctx context.Context, caid int64, handler string, resource *client.Resource) (savedExport, error) {
+	ctx, span := startJobSpan(ctx, "wait for export", caid, resource)
+	c, err := newClient()
+	if err != nil {
+		endJobSpan(span, handler, err)
+		return savedExport{}, err
+	}
+	saved, err := waitForExport(ctx, c, caid, handler, resource)
+	endJobSpan(span, handler, err)
+	return saved, err
+}
 
-	log.Info().Msg("Waiting for export to complete...")
-	if zerolog.GlobalLevel() == zerolog.Disabled {
+// waitForExport polls the export status with the given client and saves the file once ready
+func waitForExport(ctx context.Context, c *client.Client, caid int64, handler string, resource *client.Resource) (savedExport, error) {
+	if printsText() {
 		fmt.Print("Waiting for export to complete")
 	}
 
-	for {
-		select {
-		case <-ctx.Done():
-			return fmt.Errorf("timed out while waiting for export to complete")
-		default:
-			log.Debug().Msgf("Checking export status at URL: %s", url)
-			resp, err := makeAPIRequest(ctx, http.MethodGet, url, nil)
-			if err != nil {
-				return err
-			}
-
-			switch resp.StatusCode {
-			case http.StatusOK:
-				if zerolog.GlobalLevel() == zerolog.Disabled {
-					fmt.Println("\nExport completed. Saving file...")
-				}
-				err := SaveExportFile(caid, handler, resp)
-				closeErr := resp.Body.Close()
-				if err != nil {
-					return fmt.Errorf("failed to save export file: %w", err)
-				}
-				if closeErr != nil {
-					return fmt.Errorf("failed to close response body: %w", closeErr)
-				}
-				return nil
-			case http.StatusAccepted:
-				if zerolog.GlobalLevel() == zerolog.Disabled {
-					fmt.Print(".")
-				}
-				log.Info().Msg("Export still in progress...")
-				closeErr := resp.Body.Close()
-				if closeErr != nil {
-					return fmt.Errorf("failed to close response body: %w", closeErr)
-				}
-			default:
-				body, readErr := io.ReadAll(resp.Body)
-				closeErr := resp.Body.Close()
-				if readErr != nil {
-					return fmt.Errorf("failed to read response body: %w", readErr)
-				}
-				if closeErr != nil {
-					return fmt.Errorf("failed to close response body: %w", closeErr)
-				}
-				apiErr := HandleHTTPError(resp)
-				if apiErr != nil {
-					return fmt.Errorf("API error: %w", apiErr)
-				}
-				return fmt.Errorf("unexpected status code %d: %s", resp.StatusCode, string(body))
-			}
-
-			select {
-			case <-ctx.Done():
-				return fmt.Errorf("timed out while waiting for export to complete")
-			case <-time.After(currentDelay):
-				if currentDelay < maxDelay {
-					currentDelay *= 2
-					if currentDelay > maxDelay {
-						currentDelay = maxDelay
-					}
-				}
-				attempts++
-				if attempts >= maxAttempts {
-					return fmt.Errorf("maximum number of attempts (%d) reached while waiting for export to complete", maxAttempts)
-				}
-			}
+	saved, err := waitAndSave(ctx, c, caid, handler, resource)
+	if err != nil {
+		if interrupted(ctx) {
+			reportInterrupted(caid, handler)
 		}
+		return savedExport{}, err
 	}
+	reportSavedFile(saved)
+	return saved, nil
+}
+
+// waitAndSave waits for the export to complete and saves it
+func waitAndSave(ctx context.Context, c *client.Client, caid int64, handler string, resource *client.Resource) (savedExport, error) {
+	saved, err := saveExportFile(ctx, caid, handler, resource, true, func(w io.Writer) (int64, error) {
+		return c.Wait(ctx, caid, handler, w)
+	})
+	trackJobFinished(ctx, caid, handler, resource, saved.Path, err)
+	return saved, err
 }
@@ -1,6 +1,7 @@
 package cmd
 
 import (
+	"bytes"
 	"context"
 	"fmt"
 	"net/http"
@@ -23,7 +24,7 @@ func TestCheckExportStatus(t *testing.T) {
 		} else {
 			if r.URL.Path == "/v3/export/download/28c5f5af-bd9e-423f-99a7-d2a8c440db7e" {
 				w.WriteHeader(http.StatusOK)
-				if _, err := w.Write([]byte(`export file content`)); err != nil {
+				if _, err := w.Write(testExportContent); err != nil {
 					t.Fatalf("unexpected error: %v", err)
 				}
 			} else {
@@ -47,7 +48,7 @@ func TestCheckExportStatus(t *testing.T) {
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
 
-	err := checkExportStatusWithContext(ctx, 123456, "28c5f5af-bd9e-423f-99a7-d2a8c440db7e")
+	_, err := checkResourceExportStatusWithContext(ctx, 123456, "28c5f5af-bd9e-423f-99a7-d2a8c440db7e", nil)
 	if err != nil {
 		t.Fatalf("expected no error, got %v", err)
 	}
@@ -61,9 +62,8 @@ func TestCheckExportStatus(t *testing.T) {
 	if err != nil {
 		t.Fatalf("failed to read file: %v", err)
 	}
-	expectedContent := "export file content"
-	if string(data) != expectedContent {
-		t.Errorf("file content mismatch: expected '%s', got '%s'", expectedContent, string(data))
+	if !bytes.Equal(data, testExportContent) {
+		t.Errorf("file content mismatch: expected %d bytes, got %d", len(testExportContent), len(data))
 	}
 }
 
@@ -88,7 +88,7 @@ func TestCheckExportStatusTimeout(t *testing.T) {
 	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
 	defer cancel()
 
-	err := checkExportStatusWithContext(ctx, 123456, "28c5f5af-bd9e-423f-99a7-d2a8c440db7e")
+	_, err := checkResourceExportStatusWithContext(ctx, 123456, "28c5f5af-bd9e-423f-99a7-d2a8c440db7e", nil)
 	if err == nil {
 		t.Fatalf("expected timeout error, got none")
 	}
@@ -121,7 +121,7 @@ func TestCheckExportStatusWithContext(t *testing.T) {
 				},
 				func(w http.ResponseWriter, r *http.Request) {
 					w.WriteHeader(http.StatusOK)
-					_, _ = w.Write([]byte("export file content"))
+					_, _ = w.Write(testExportContent)
 				},
 			},
 			wantErr: false,
@@ -152,9 +152,9 @@ func TestCheckExportStatusWithContext(t *testing.T) {
 			ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 			defer cancel()
 
-			err := checkExportStatusWithContext(ctx, tt.caid, tt.handler)
+			_, err := checkResourceExportStatusWithContext(ctx, tt.caid, tt.handler, nil)
 			if (err != nil) != tt.wantErr {
-				t.Errorf("checkExportStatusWithContext() error = %v, wantErr %v", err, tt.wantErr)
+				t.Errorf("checkResourceExportStatusWithContext() error = %v, wantErr %v", err, tt.wantErr)
 			}
 
 			if !tt.wantErr {
@@ -164,8 +164,8 @@ func TestCheckExportStatusWithContext(t *testing.T) {
 				if err != nil {
 					t.Errorf("Failed to read exported file: %v", err)
 				}
-				if string(data) != "export file content" {
-					t.Errorf("Exported file content mismatch. Got: %s", string(data))
+				if !bytes.Equal(data, testExportContent) {
+					t.Errorf("Exported file content mismatch. Got %d bytes", len(data))
 				}
 			}
 		})
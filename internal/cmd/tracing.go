@@ -0,0 +1,130 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/ren3gadem4rm0t/imperva-export-cli/pkg/client"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracerName is the instrumentation scope of the spans of export jobs
+const tracerName string = "github.com/ren3gadem4rm0t/imperva-export-cli"
+
+// Attributes of the spans of export jobs
+const (
+	attrCAID         attribute.Key = "imperva.caid"
+	attrHandler      attribute.Key = "imperva.export.handler"
+	attrResourceType attribute.Key = "imperva.resource.type"
+	attrResourceID   attribute.Key = "imperva.resource.id"
+	attrOutcome      attribute.Key = "imperva.export.outcome"
+	attrFile         attribute.Key = "imperva.export.file"
+	attrBytes        attribute.Key = "imperva.export.bytes"
+	attrEncrypted    attribute.Key = "imperva.export.encrypted"
+)
+
+// tracingEnabled reports whether spans are exported according to the OTEL_* environment variables. Tracing
+// is enabled by OTEL_TRACES_EXPORTER=otlp or an OTLP endpoint, and disabled by OTEL_SDK_DISABLED=true or
+// OTEL_TRACES_EXPORTER=none.
+func tracingEnabled() (bool, error) {
+	if strings.EqualFold(os.Getenv("OTEL_SDK_DISABLED"), "true") {
+		return false, nil
+	}
+	switch exporter := strings.TrimSpace(os.Getenv("OTEL_TRACES_EXPORTER")); exporter {
+	case "none":
+		return false, nil
+	case "otlp":
+	case "":
+		if os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT") == "" && os.Getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT") == "" {
+			return false, nil
+		}
+	default:
+		return false, newValidationError(fmt.Errorf("unsupported OTEL_TRACES_EXPORTER %q (must be otlp or none)", exporter))
+	}
+
+	protocol := os.Getenv("OTEL_EXPORTER_OTLP_TRACES_PROTOCOL")
+	if protocol == "" {
+		protocol = os.Getenv("OTEL_EXPORTER_OTLP_PROTOCOL")
+	}
+	if protocol != "" && protocol != "http/protobuf" {
+		return false, newValidationError(fmt.Errorf("unsupported OTLP protocol %q (must be http/protobuf)", protocol))
+	}
+	return true, nil
+}
+
+// setupTracing installs a tracer provider exporting spans over OTLP/HTTP if tracing is enabled, see
+// tracingEnabled. The exporter, resource and sampler read the other OTEL_* environment variables, e.g.
+// OTEL_EXPORTER_OTLP_HEADERS, OTEL_SERVICE_NAME and OTEL_TRACES_SAMPLER. The returned function flushes
+// and stops the provider.
+func setupTracing(ctx context.Context) (func(context.Context) error, error) {
+	enabled, err := tracingEnabled()
+	if err != nil || !enabled {
+		return func(context.Context) error { return nil }, err
+	}
+
+	exporter, err := otlptracehttp.New(ctx)
+	if err != nil {
+		return nil, newValidationError(fmt.Errorf("invalid OTLP exporter configuration: %w", err))
+	}
+	// The environment overrides the default service name
+	res, err := resource.New(ctx,
+		resource.WithAttributes(semconv.ServiceName("imperva-export-cli"), semconv.ServiceVersion(version)),
+		resource.WithTelemetrySDK(),
+		resource.WithFromEnv(),
+	)
+	if err != nil {
+		return nil, newValidationError(fmt.Errorf("invalid OTEL_RESOURCE_ATTRIBUTES: %w", err))
+	}
+
+	provider := sdktrace.NewTracerProvider(sdktrace.WithBatcher(exporter), sdktrace.WithResource(res))
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+	return provider.Shutdown, nil
+}
+
+// parentTraceContext returns the context with the trace context of the TRACEPARENT and TRACESTATE
+// environment variables, so the spans of a run join the trace of the pipeline that started it
+func parentTraceContext(ctx context.Context) context.Context {
+	carrier := propagation.MapCarrier{
+		"traceparent": os.Getenv("TRACEPARENT"),
+		"tracestate":  os.Getenv("TRACESTATE"),
+	}
+	return otel.GetTextMapPropagator().Extract(ctx, carrier)
+}
+
+// startJobSpan starts the root span of an export job
+func startJobSpan(ctx context.Context, name string, caid int64, resource *client.Resource) (context.Context, trace.Span) {
+	attrs := []attribute.KeyValue{attrCAID.Int64(caid)}
+	if resource != nil {
+		attrs = append(attrs, attrResourceType.String(string(resource.Type)), attrResourceID.Int64(resource.ID))
+	}
+	return otel.Tracer(tracerName).Start(ctx, name, trace.WithAttributes(attrs...))
+}
+
+// endJobSpan ends the root span of an export job with its handler, if it was initiated, and its outcome
+func endJobSpan(span trace.Span, handler string, err error) {
+	if handler != "" {
+		span.SetAttributes(attrHandler.String(handler))
+	}
+	span.SetAttributes(attrOutcome.String(jobOutcome(err)))
+	endSpan(span, err)
+}
+
+// endSpan ends a span, recording the error if there is one
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
@@ -0,0 +1,145 @@
+package cmd
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/ren3gadem4rm0t/imperva-export-cli/pkg/mockserver"
+	"github.com/spf13/viper"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// useTracing installs a tracer provider recording the spans of the test
+func useTracing(t *testing.T) *tracetest.InMemoryExporter {
+	t.Helper()
+	exporter := tracetest.NewInMemoryExporter()
+	provider, propagator := otel.GetTracerProvider(), otel.GetTextMapPropagator()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter)))
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	t.Cleanup(func() {
+		otel.SetTracerProvider(provider)
+		otel.SetTextMapPropagator(propagator)
+	})
+	return exporter
+}
+
+// spanAttr returns the value of an attribute of a recorded span
+func spanAttr(span tracetest.SpanStub, key attribute.Key) attribute.Value {
+	for _, kv := range span.Attributes {
+		if kv.Key == key {
+			return kv.Value
+		}
+	}
+	return attribute.Value{}
+}
+
+func TestAutoExport_Tracing(t *testing.T) {
+	useMockServer(t, mockserver.WithPolls(0), mockserver.WithFixture(newTestExportZip()),
+		mockserver.WithFault(mockserver.Fault{Status: 500, Endpoint: mockserver.EndpointDownload, Count: 1}))
+	exporter := useTracing(t)
+	viper.Set("retry-base-delay", time.Millisecond)
+	t.Cleanup(func() { viper.Set("retry-base-delay", nil) })
+
+	captureResults(t, outputJSON)
+	if err := autoExport(context.Background(), 1234, nil, saveOptions{}); err != nil {
+		t.Fatalf("autoExport() error = %v", err)
+	}
+
+	byName := map[string][]tracetest.SpanStub{}
+	for _, span := range exporter.GetSpans() {
+		byName[span.Name] = append(byName[span.Name], span)
+	}
+	roots := byName["auto export"]
+	if len(roots) != 1 {
+		t.Fatalf("got %d job spans, want 1: %v", len(roots), byName)
+	}
+	root := roots[0]
+	if root.Parent.IsValid() {
+		t.Error("the job span has a parent")
+	}
+	if spanAttr(root, attrCAID).AsInt64() != 1234 || spanAttr(root, attrHandler).AsString() == "" ||
+		spanAttr(root, attrOutcome).AsString() != "success" {
+		t.Errorf("job span attributes = %v", root.Attributes)
+	}
+
+	// The phases, polls, attempts and downloads of the job are part of its trace
+	for _, name := range []string{"export.poll", "export.download", "export.save", "HTTP POST", "HTTP GET"} {
+		spans := byName[name]
+		if len(spans) == 0 {
+			t.Errorf("no %s span: %v", name, byName)
+		}
+		for _, span := range spans {
+			if span.SpanContext.TraceID() != root.SpanContext.TraceID() {
+				t.Errorf("span %s is not part of the trace of the job", name)
+			}
+		}
+	}
+	var retried bool
+	for _, span := range byName["HTTP GET"] {
+		if spanAttr(span, "http.request.resend_count").AsInt64() == 1 && spanAttr(span, "http.response.status_code").AsInt64() == 200 {
+			retried = true
+		}
+	}
+	if !retried {
+		t.Errorf("no span of the retried download: %v", byName["HTTP GET"])
+	}
+	if save := byName["export.save"]; len(save) == 1 && spanAttr(save[0], attrBytes).AsInt64() != int64(len(newTestExportZip())) {
+		t.Errorf("save span attributes = %v", save[0].Attributes)
+	}
+}
+
+func TestTracingEnabled(t *testing.T) {
+	tests := []struct {
+		name    string
+		env     map[string]string
+		want    bool
+		wantErr bool
+	}{
+		{"unset", nil, false, false},
+		{"endpoint", map[string]string{"OTEL_EXPORTER_OTLP_ENDPOINT": "http://localhost:4318"}, true, false},
+		{"traces endpoint", map[string]string{"OTEL_EXPORTER_OTLP_TRACES_ENDPOINT": "http://localhost:4318/v1/traces"}, true, false},
+		{"otlp exporter", map[string]string{"OTEL_TRACES_EXPORTER": "otlp"}, true, false},
+		{"none exporter", map[string]string{"OTEL_TRACES_EXPORTER": "none", "OTEL_EXPORTER_OTLP_ENDPOINT": "http://localhost:4318"}, false, false},
+		{"sdk disabled", map[string]string{"OTEL_SDK_DISABLED": "true", "OTEL_TRACES_EXPORTER": "otlp"}, false, false},
+		{"unsupported exporter", map[string]string{"OTEL_TRACES_EXPORTER": "zipkin"}, false, true},
+		{"grpc protocol", map[string]string{"OTEL_TRACES_EXPORTER": "otlp", "OTEL_EXPORTER_OTLP_PROTOCOL": "grpc"}, false, true},
+		{"http protocol", map[string]string{"OTEL_TRACES_EXPORTER": "otlp", "OTEL_EXPORTER_OTLP_TRACES_PROTOCOL": "http/protobuf"}, true, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, key := range []string{"OTEL_SDK_DISABLED", "OTEL_TRACES_EXPORTER", "OTEL_EXPORTER_OTLP_ENDPOINT",
+				"OTEL_EXPORTER_OTLP_TRACES_ENDPOINT", "OTEL_EXPORTER_OTLP_PROTOCOL", "OTEL_EXPORTER_OTLP_TRACES_PROTOCOL"} {
+				t.Setenv(key, tt.env[key])
+			}
+			got, err := tracingEnabled()
+			if (err != nil) != tt.wantErr || got != tt.want {
+				t.Fatalf("tracingEnabled() = %v, %v, want %v (error %v)", got, err, tt.want, tt.wantErr)
+			}
+			if err != nil && ExitCode(err) != ExitValidation {
+				t.Errorf("tracingEnabled() error = %v, want a validation error", err)
+			}
+		})
+	}
+}
+
+func TestParentTraceContext(t *testing.T) {
+	useTracing(t)
+	t.Setenv("TRACEPARENT", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	t.Setenv("TRACESTATE", "")
+
+	parent := trace.SpanContextFromContext(parentTraceContext(context.Background()))
+	if parent.TraceID().String() != "4bf92f3577b34da6a3ce929d0e0e4736" || parent.SpanID().String() != "00f067aa0ba902b7" || !parent.IsRemote() {
+		t.Errorf("parent span context = %v", parent)
+	}
+
+	t.Setenv("TRACEPARENT", "")
+	if parent := trace.SpanContextFromContext(parentTraceContext(context.Background())); parent.IsValid() {
+		t.Errorf("parent span context without TRACEPARENT = %v", parent)
+	}
+}
@@ -0,0 +1,49 @@
+package cmd
+
+import (
+	"net/http"
+	"sync"
+
+	"github.com/ren3gadem4rm0t/imperva-export-cli/pkg/client"
+	"github.com/spf13/viper"
+)
+
+// sharedHTTP holds the HTTP client shared by every API client of the process, so that all requests
+// use one transport and its connection pool
+var sharedHTTP struct {
+	sync.Mutex
+	config client.TransportConfig
+	client *http.Client
+}
+
+// transportConfig returns the transport settings configured by flags, config file or environment
+func transportConfig() client.TransportConfig {
+	return client.TransportConfig{
+		ProxyURL:       viper.GetString("proxy"),
+		CABundle:       viper.GetString("ca-bundle"),
+		MinTLSVersion:  viper.GetString("tls-min-version"),
+		ClientCert:     viper.GetString("client-cert"),
+		ClientKey:      viper.GetString("client-key"),
+		ConnectTimeout: viper.GetDuration("connect-timeout"),
+		ReadTimeout:    viper.GetDuration("read-timeout"),
+		Timeout:        viper.GetDuration("http-timeout"),
+	}
+}
+
+// sharedHTTPClient returns the shared HTTP client, building it again only if the transport settings changed
+func sharedHTTPClient() (*http.Client, error) {
+	cfg := transportConfig()
+
+	sharedHTTP.Lock()
+	defer sharedHTTP.Unlock()
+	if sharedHTTP.client != nil && sharedHTTP.config == cfg {
+		return sharedHTTP.client, nil
+	}
+	httpClient, err := client.NewHTTPClient(cfg)
+	if err != nil {
+		return nil, err
+	}
+	sharedHTTP.config = cfg
+	sharedHTTP.client = httpClient
+	return httpClient, nil
+}
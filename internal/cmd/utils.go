@@ -1,189 +1,151 @@
 package cmd
 
 import (
-	"context"
-	"encoding/json"
 	"fmt"
-	"io"
-	"net/http"
-	"net/url"
 	"os"
 	"path/filepath"
-	"regexp"
 	"strings"
-	"time"
 
+	"github.com/ren3gadem4rm0t/imperva-export-cli/internal/encryption"
+	"github.com/ren3gadem4rm0t/imperva-export-cli/pkg/client"
 	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 )
 
-// AsyncResponse represents the asynchronous response from the export API
-type AsyncResponse struct {
-	Handler string `json:"handler"`
-	Status  string `json:"status"`
-}
-
-// APIError represents an error returned by the API
-type APIError struct {
-	Status int    `json:"status"`
-	ID     string `json:"id"`
-	Code   string `json:"code"`
-	Source struct {
-		Pointer string `json:"pointer"`
-	} `json:"source"`
-	Title  string `json:"title"`
-	Detail string `json:"detail"`
-}
-
-// ErrorResponse represents the error response structure
-type ErrorResponse struct {
-	Errors []APIError `json:"errors"`
-}
-
-// Error implements the error interface for APIError
-func (e APIError) Error() string {
-	return fmt.Sprintf("API error: %s - %s (Status Code: %d)", e.Title, e.Detail, e.Status)
-}
-
-// makeAPIRequest makes an HTTP request with retry logic
-func makeAPIRequest(ctx context.Context, method, rawURL string, body io.Reader) (*http.Response, error) {
-	parsedURL, err := url.Parse(rawURL)
-	if err != nil {
-		return nil, fmt.Errorf("invalid URL '%s': %w", rawURL, err)
-	}
-
-	sanitizedURL := parsedURL.String()
-
-	apiID := viper.GetString("api-id")
-	apiKey := viper.GetString("api-key")
-
-	req, err := http.NewRequestWithContext(ctx, method, sanitizedURL, body)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create request: %w", err)
+// newClient creates an API client from the current configuration. Extra options override the defaults.
+func newClient(opts ...client.Option) (*client.Client, error) {
+	baseURL := apiBaseURL
+	if configured := viper.GetString("base-url"); configured != "" {
+		baseURL = configured
 	}
-	req.Header.Set(apiIDHeaderName, apiID)
-	req.Header.Set(apiKeyHeaderName, apiKey)
-	req.Header.Set("User-Agent", userAgentValue)
-
-	resp, err := RetryableRequest(ctx, req, 3)
+	httpClient, err := sharedHTTPClient()
 	if err != nil {
-		return nil, fmt.Errorf("failed to send request: %w", err)
-	}
-
-	return resp, nil
+		return nil, err
+	}
+	defaults := []client.Option{
+		client.WithBaseURL(baseURL),
+		client.WithCredentials(viper.GetString("api-id"), viper.GetString("api-key")),
+		client.WithHTTPClient(httpClient),
+		client.WithUserAgent(userAgentValue),
+		client.WithLogger(log.Logger),
+		client.WithStatusHook(observedStatusHook(printStatus)),
+		client.WithRequestHook(exportMetrics.observeAttempt),
+		client.WithRetryPolicy(retryPolicy()),
+	}
+	return client.New(append(defaults, opts...)...)
 }
 
-// RetryableRequest performs the HTTP request with retries on transient errors
-func RetryableRequest(ctx context.Context, req *http.Request, maxRetries int) (*http.Response, error) {
-	client := &http.Client{}
-	var resp *http.Response
-	var err error
-
-	for attempt := 0; attempt <= maxRetries; attempt++ {
-		clonedReq := req.Clone(ctx)
-
-		resp, err = client.Do(clonedReq)
-		if err == nil && resp.StatusCode < 500 && resp.StatusCode != 401 {
-			return resp, nil
-		}
-
-		if resp != nil {
-			_, copyErr := io.Copy(io.Discard, resp.Body)
-			closeErr := resp.Body.Close()
-			if copyErr != nil {
-				log.Warn().Err(copyErr).Msg("Error discarding response body")
-			}
-			if closeErr != nil {
-				log.Warn().Err(closeErr).Msg("Error closing response body")
-			}
-		}
-
-		// If the last attempt, return the error
-		if attempt == maxRetries {
-			if err == nil {
-				return nil, fmt.Errorf("request failed after %d retries with status code: %d", maxRetries, resp.StatusCode)
-			}
-			return nil, fmt.Errorf("request failed after %d retries: %w", maxRetries, err)
-		}
-
-		if ctx.Err() != nil {
-			return nil, fmt.Errorf("request context canceled: %w", ctx.Err())
-		}
-
-		backoff := time.Duration(1<<attempt) * time.Second
-		if backoff > 30*time.Second {
-			backoff = 30 * time.Second
-		}
-		select {
-		case <-ctx.Done():
-			return nil, fmt.Errorf("request context canceled: %w", ctx.Err())
-		case <-time.After(backoff):
-		}
+// retryPolicy returns the retry policy configured by flags, config file or environment
+func retryPolicy() client.RetryPolicy {
+	return client.RetryPolicy{
+		MaxRetries:        viper.GetInt("max-retries"),
+		BaseDelay:         viper.GetDuration("retry-base-delay"),
+		MaxDelay:          viper.GetDuration("retry-max-delay"),
+		Jitter:            viper.GetFloat64("retry-jitter"),
+		RetryableStatuses: viper.GetIntSlice("retry-statuses"),
+		RetryBusy:         viper.GetBool("retry-busy"),
+		BusyDelay:         viper.GetDuration("retry-busy-delay"),
 	}
-
-	return nil, fmt.Errorf("request failed after %d retries: %w", maxRetries, err)
 }
 
-// ParseAPIError parses the API error response
-func ParseAPIError(resp *http.Response) error {
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return fmt.Errorf("failed to read error response body: %w", err)
+// printStatus reports polling progress on stdout when logging is disabled and the output is text
+func printStatus(status client.Status) {
+	if !printsText() {
+		return
 	}
-
-	var errorResponse ErrorResponse
-	if err := json.Unmarshal(body, &errorResponse); err != nil {
-		return fmt.Errorf("failed to parse error response: %w", err)
+	switch status {
+	case client.StatusInProgress:
+		fmt.Print(".")
+	case client.StatusReady:
+		fmt.Println("\nExport completed. Saving file...")
 	}
+}
 
-	if len(errorResponse.Errors) == 0 {
-		return fmt.Errorf("API error: unknown error, status code %d, response body: %s", resp.StatusCode, string(body))
+// caidFromFlags returns the account ID of the --caid flag, or the default CAID of the configuration or
+// profile if the flag is not set
+func caidFromFlags(cmd *cobra.Command) (int64, error) {
+	caid, _ := cmd.Flags().GetInt64("caid")
+	if !cmd.Flags().Changed("caid") {
+		caid = viper.GetInt64("caid")
 	}
+	if caid == 0 {
+		return 0, newValidationError(fmt.Errorf("a caid must be provided via --caid or the caid of the profile"))
+	}
+	return caid, ValidateCAID(caid)
+}
 
-	var errorMessages []string
-	for _, apiErr := range errorResponse.Errors {
-		errorMessages = append(errorMessages, apiErr.Error())
+// caidsOrDefault returns the given account IDs, or the default CAID of the configuration or profile if there are none
+func caidsOrDefault(caids []int64) []int64 {
+	if len(caids) == 0 {
+		if caid := viper.GetInt64("caid"); caid != 0 {
+			return []int64{caid}
+		}
 	}
-	return fmt.Errorf("API errors: %s", strings.Join(errorMessages, "; "))
+	return caids
 }
 
 // ValidateCAID validates the CAID
 func ValidateCAID(caid int64) error {
-	if caid <= 0 {
-		return fmt.Errorf("invalid caid: %d", caid)
-	}
-	return nil
+	return newValidationError(client.ValidateCAID(caid))
+}
+
+// ValidateResourceType validates the resource type for a single-resource export
+func ValidateResourceType(resourceType string) error {
+	return newValidationError(client.ValidateResourceType(client.ResourceType(resourceType)))
+}
+
+// ValidateResourceID validates the Imperva ID of a site or policy
+func ValidateResourceID(id int64) error {
+	return newValidationError(client.ValidateResourceID(id))
 }
 
 // ValidateHandler validates the handler string as a UUID
 func ValidateHandler(handler string) error {
-	trimmedHandler := strings.TrimSpace(handler)
-	if trimmedHandler == "" {
-		return fmt.Errorf("handler is required")
-	}
-
-	// RE2-compatible regex for UUID: (8-4-4-4-12)
-	var uuidRegex = regexp.MustCompile(`^[a-f0-9]{8}-[a-f0-9]{4}-[a-f0-9]{4}-[a-f0-9]{4}-[a-f0-9]{12}$`)
+	return newValidationError(client.ValidateHandler(handler))
+}
 
-	if !uuidRegex.MatchString(trimmedHandler) {
-		return fmt.Errorf("invalid handler format")
+// exportFileName returns the name of the zip file an export is saved to, with the .age suffix if it is encrypted.
+// Single-resource exports include the resource type and ID so they can be told apart from account exports.
+func exportFileName(caid int64, handler string, resource *client.Resource) string {
+	var name string
+	if resource == nil {
+		name = fmt.Sprintf("export_%d_%s.zip", caid, handler)
+	} else {
+		name = fmt.Sprintf("export_%d_%s_%d_%s.zip", caid, strings.ToLower(string(resource.Type)), resource.ID, handler)
 	}
+	if encryptionEnabled() {
+		name += encryption.Suffix
+	}
+	return name
+}
 
-	return nil
+// addResourceFlags adds the optional flags identifying a single-resource export
+func addResourceFlags(cmd *cobra.Command) {
+	cmd.Flags().String("resource-type", "", "The resource type of a single-resource export (site or policy)")
+	cmd.Flags().Int64("id", 0, "The Imperva ID of the exported site or policy")
+	cmd.MarkFlagsRequiredTogether("resource-type", "id")
 }
 
-// HandleHTTPError handles HTTP errors by parsing API error responses
-func HandleHTTPError(resp *http.Response) error {
-	log.Debug().Msgf("Received status code %d", resp.StatusCode)
-	if resp.StatusCode >= 400 {
-		return ParseAPIError(resp)
+// resourceFromFlags returns the single-resource export described by the flags, or nil for an account export
+func resourceFromFlags(cmd *cobra.Command) (*client.Resource, error) {
+	resourceType, _ := cmd.Flags().GetString("resource-type")
+	id, _ := cmd.Flags().GetInt64("id")
+	if resourceType == "" && id == 0 {
+		return nil, nil
 	}
-	return nil
+	if err := ValidateResourceType(resourceType); err != nil {
+		return nil, err
+	}
+	if err := ValidateResourceID(id); err != nil {
+		return nil, err
+	}
+	return &client.Resource{Type: client.ResourceType(strings.ToUpper(resourceType)), ID: id}, nil
 }
 
 func ValidateOutputDir(outputDir string) error {
 	if strings.Contains(outputDir, "..") {
-		return fmt.Errorf("invalid output directory: %s", outputDir)
+		return &ValidationError{Err: fmt.Errorf("invalid output directory: %s", outputDir)}
 	}
 	return nil
 }
@@ -193,19 +155,19 @@ func ValidateOutputDir(outputDir string) error {
 func ValidateFilePath(path string) error {
 	// Ensure the path does not contain any relative components that would lead to directory traversal
 	if strings.Contains(path, "..") {
-		return fmt.Errorf("invalid file path: %s", path)
+		return &ValidationError{Err: fmt.Errorf("invalid file path: %s", path)}
 	}
 
 	// Allow absolute paths if they are in the system's temp directory
 	tempDir := os.TempDir()
 	if filepath.IsAbs(path) && !strings.HasPrefix(path, tempDir) {
-		return fmt.Errorf("absolute paths are only allowed in the system temp directory: %s", path)
+		return &ValidationError{Err: fmt.Errorf("absolute paths are only allowed in the system temp directory: %s", path)}
 	}
 
 	// Validate that the path points to a file within the expected directory
 	dir := filepath.Dir(path)
 	if err := ValidateOutputDir(dir); err != nil {
-		return fmt.Errorf("invalid directory in file path: %s", dir)
+		return &ValidationError{Err: fmt.Errorf("invalid directory in file path: %s", dir)}
 	}
 
 	return nil
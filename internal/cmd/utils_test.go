@@ -3,17 +3,14 @@
 package cmd
 
 import (
-	"context"
 	"fmt"
-	"io"
-	"net/http"
-	"net/http/httptest"
 	"os"
 	"path/filepath"
 	"strings"
 	"testing"
 	"time"
 
+	"github.com/ren3gadem4rm0t/imperva-export-cli/pkg/client"
 	"github.com/spf13/viper"
 )
 
@@ -85,274 +82,93 @@ func TestValidateCAID(t *testing.T) {
 	}
 }
 
-func TestValidateHandler(t *testing.T) {
+func TestValidateResourceType(t *testing.T) {
 	tests := []struct {
-		handler string
-		wantErr bool
+		resourceType string
+		wantErr      bool
 	}{
-		{"28c5f5af-bd9e-423f-99a7-d2a8c440db7e", false},
-		{"invalid-handler", true},
+		{"SITE", false},
+		{"POLICY", false},
+		{"site", false},
+		{" policy ", false},
+		{"ACCOUNT", true},
 		{"", true},
-		{" 28c5f5af-bd9e-423f-99a7-d2a8c440db7e ", false},
-		{"12345678-1234-1234-1234-1234567890ab", false},
-		{"1234567-1234-1234-1234-1234567890ab", true}, // 7 digits in first group
 	}
 
 	for _, tt := range tests {
-		t.Run(tt.handler, func(t *testing.T) {
-			err := ValidateHandler(tt.handler)
+		t.Run(tt.resourceType, func(t *testing.T) {
+			err := ValidateResourceType(tt.resourceType)
 			if (err != nil) != tt.wantErr {
-				t.Errorf("ValidateHandler(%q) error = %v, wantErr %v", tt.handler, err, tt.wantErr)
+				t.Errorf("ValidateResourceType(%q) error = %v, wantErr %v", tt.resourceType, err, tt.wantErr)
 			}
 		})
 	}
 }
 
-func TestHandleHTTPError(t *testing.T) {
+func TestValidateResourceID(t *testing.T) {
 	tests := []struct {
-		statusCode int
-		body       string
-		wantErr    bool
+		id      int64
+		wantErr bool
 	}{
-		{200, ``, false},
-		{400, `{"errors":[{"status":400,"id":"error1","code":"BadRequest","source":{"pointer":"/export"},"title":"Bad Request","detail":"Invalid input"}]}`, true},
-		{401, `{"errors":[{"status":401,"id":"error2","code":"Unauthorized","source":{"pointer":"/export"},"title":"Authentication Error","detail":"Authentication missing or invalid"}]}`, true},
-		{500, `{"errors":[{"status":500,"id":"error3","code":"InternalError","source":{"pointer":"/export"},"title":"Internal Server Error","detail":"Something went wrong"}]}`, true},
+		{1234, false},
+		{0, true},
+		{-1, true},
 	}
 
 	for _, tt := range tests {
-		t.Run(fmt.Sprintf("StatusCode_%d", tt.statusCode), func(t *testing.T) {
-			resp := &http.Response{
-				StatusCode: tt.statusCode,
-				Body:       io.NopCloser(strings.NewReader(tt.body)),
-			}
-			err := HandleHTTPError(resp)
+		t.Run(fmt.Sprintf("ID_%d", tt.id), func(t *testing.T) {
+			err := ValidateResourceID(tt.id)
 			if (err != nil) != tt.wantErr {
-				t.Errorf("HandleHTTPError() error = %v, wantErr %v", err, tt.wantErr)
+				t.Errorf("ValidateResourceID(%d) error = %v, wantErr %v", tt.id, err, tt.wantErr)
 			}
 		})
 	}
 }
 
-func TestMakeAPIRequest(t *testing.T) {
+func TestExportFileName(t *testing.T) {
+	handler := "28c5f5af-bd9e-423f-99a7-d2a8c440db7e"
 	tests := []struct {
-		name           string
-		method         string
-		url            string
-		body           io.Reader
-		apiID          string
-		apiKey         string
-		serverHandlers []func(w http.ResponseWriter, r *http.Request)
-		wantErr        bool
-		errorSubstring string
+		name     string
+		resource *client.Resource
+		want     string
 	}{
-		{
-			name:   "permanent server error",
-			method: http.MethodGet,
-			url:    "/test-fail",
-			body:   nil,
-			apiID:  "test-api-id",
-			apiKey: "test-api-key",
-			serverHandlers: []func(w http.ResponseWriter, r *http.Request){
-				func(w http.ResponseWriter, r *http.Request) {
-					w.WriteHeader(http.StatusInternalServerError)
-				},
-				func(w http.ResponseWriter, r *http.Request) {
-					w.WriteHeader(http.StatusInternalServerError)
-				},
-				func(w http.ResponseWriter, r *http.Request) {
-					w.WriteHeader(http.StatusInternalServerError)
-				},
-			},
-			wantErr:        true,
-			errorSubstring: "request failed after 3 retries",
-		},
-		{
-			name:   "unauthorized request",
-			method: http.MethodGet,
-			url:    "/test-unauth",
-			body:   nil,
-			apiID:  "wrong-api-id",
-			apiKey: "wrong-api-key",
-			serverHandlers: []func(w http.ResponseWriter, r *http.Request){
-				func(w http.ResponseWriter, r *http.Request) {
-					w.WriteHeader(http.StatusUnauthorized)
-				},
-			},
-			wantErr:        true,
-			errorSubstring: "request failed after 3 retries",
-		},
+		{"account", nil, "export_123456_28c5f5af-bd9e-423f-99a7-d2a8c440db7e.zip"},
+		{"site", &client.Resource{Type: client.ResourceSite, ID: 1234}, "export_123456_site_1234_28c5f5af-bd9e-423f-99a7-d2a8c440db7e.zip"},
+		{"policy", &client.Resource{Type: client.ResourcePolicy, ID: 5678}, "export_123456_policy_5678_28c5f5af-bd9e-423f-99a7-d2a8c440db7e.zip"},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			// Mock server setup
-			attempt := 0
-			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-				if attempt < len(tt.serverHandlers) {
-					tt.serverHandlers[attempt](w, r)
-					attempt++
-				} else {
-					tt.serverHandlers[len(tt.serverHandlers)-1](w, r)
-				}
-			}))
-			defer server.Close()
-
-			// Set test-specific base URL
-			originalURL := apiBaseURL
-			apiBaseURL = server.URL
-			defer func() { apiBaseURL = originalURL }()
-
-			// Set Viper config
-			viper.Set("api-id", tt.apiID)
-			viper.Set("api-key", tt.apiKey)
-
-			// Create context
-			ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
-			defer cancel()
-
-			// Execute the request
-			fullURL := server.URL + tt.url
-			resp, err := makeAPIRequest(ctx, tt.method, fullURL, tt.body)
-			if (err != nil) != tt.wantErr {
-				t.Errorf("makeAPIRequest() error = %v, wantErr %v", err, tt.wantErr)
-			}
-
-			// Validate error substring
-			if tt.wantErr && err != nil && !strings.Contains(err.Error(), tt.errorSubstring) {
-				t.Errorf("makeAPIRequest() error message = %v, want substring %v", err.Error(), tt.errorSubstring)
-			}
-
-			// Validate no response on error
-			if tt.wantErr && resp != nil {
-				t.Errorf("Expected no response, got %v", resp)
+			if got := exportFileName(123456, handler, tt.resource); got != tt.want {
+				t.Errorf("exportFileName() = %q, want %q", got, tt.want)
 			}
 		})
 	}
 }
 
-func TestRetryableRequest(t *testing.T) {
+func TestValidateHandler(t *testing.T) {
 	tests := []struct {
-		name           string
-		serverHandlers []func(w http.ResponseWriter, r *http.Request)
-		maxRetries     int
-		wantErr        bool
-		statusCode     int
+		handler string
+		wantErr bool
 	}{
-		{
-			name: "fails_all_attempts",
-			serverHandlers: []func(w http.ResponseWriter, r *http.Request){
-				func(w http.ResponseWriter, r *http.Request) {
-					w.WriteHeader(http.StatusInternalServerError)
-				},
-				func(w http.ResponseWriter, r *http.Request) {
-					w.WriteHeader(http.StatusInternalServerError)
-				},
-				func(w http.ResponseWriter, r *http.Request) {
-					w.WriteHeader(http.StatusInternalServerError)
-				},
-			},
-			maxRetries: 3,
-			wantErr:    true,
-			statusCode: http.StatusInternalServerError,
-		},
-		{
-			name: "unauthorized_request_does_not_retry",
-			serverHandlers: []func(w http.ResponseWriter, r *http.Request){
-				func(w http.ResponseWriter, r *http.Request) {
-					w.WriteHeader(http.StatusUnauthorized)
-				},
-			},
-			maxRetries: 3,
-			wantErr:    true,
-			statusCode: http.StatusUnauthorized,
-		},
+		{"28c5f5af-bd9e-423f-99a7-d2a8c440db7e", false},
+		{"invalid-handler", true},
+		{"", true},
+		{" 28c5f5af-bd9e-423f-99a7-d2a8c440db7e ", false},
+		{"12345678-1234-1234-1234-1234567890ab", false},
+		{"1234567-1234-1234-1234-1234567890ab", true}, // 7 digits in first group
 	}
 
 	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			// Setup mock server with multiple handlers
-			attempt := 0
-			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-				if attempt < len(tt.serverHandlers) {
-					tt.serverHandlers[attempt](w, r)
-					attempt++
-				} else {
-					tt.serverHandlers[len(tt.serverHandlers)-1](w, r)
-				}
-			}))
-			defer server.Close()
-
-			// Create a request
-			req, err := http.NewRequest(http.MethodGet, server.URL, nil)
-			if err != nil {
-				t.Fatalf("Failed to create request: %v", err)
-			}
-
-			// Call RetryableRequest
-			resp, err := RetryableRequest(context.Background(), req, tt.maxRetries)
+		t.Run(tt.handler, func(t *testing.T) {
+			err := ValidateHandler(tt.handler)
 			if (err != nil) != tt.wantErr {
-				t.Errorf("RetryableRequest() error = %v, wantErr %v", err, tt.wantErr)
-			}
-
-			if resp != nil && resp.StatusCode != tt.statusCode {
-				t.Errorf("RetryableRequest() status code = %d, want %d", resp.StatusCode, tt.statusCode)
-			}
-		})
-	}
-}
-
-func TestParseAPIError_Errors(t *testing.T) {
-	tests := []struct {
-		name       string
-		statusCode int
-		body       string
-		errorMsg   string
-	}{
-		{
-			name:       "Bad JSON",
-			statusCode: 400,
-			body:       `invalid json`,
-			errorMsg:   "failed to parse error response: invalid character 'i' looking for beginning of value",
-		},
-		{
-			name:       "No Errors",
-			statusCode: 404,
-			body:       `{"errors":[]}`,
-			errorMsg:   "unknown error, status code 404, response body: {\"errors\":[]}",
-		},
-	}
-
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			resp := &http.Response{
-				StatusCode: tt.statusCode,
-				Body:       io.NopCloser(strings.NewReader(tt.body)),
-			}
-			err := ParseAPIError(resp)
-			if err == nil {
-				t.Errorf("ParseAPIError() expected error, got none")
-			}
-			if !strings.Contains(err.Error(), tt.errorMsg) {
-				t.Errorf("ParseAPIError() error message = %v, want substring %v", err.Error(), tt.errorMsg)
+				t.Errorf("ValidateHandler(%q) error = %v, wantErr %v", tt.handler, err, tt.wantErr)
 			}
 		})
 	}
 }
 
-func TestParseAPIError_Success(t *testing.T) {
-	resp := &http.Response{
-		StatusCode: 200,
-		Body:       io.NopCloser(strings.NewReader(``)),
-	}
-	// Do not call ParseAPIError for successful responses
-	// Instead, HandleHTTPError should handle it and not return an error
-	err := HandleHTTPError(resp)
-	if err != nil {
-		t.Errorf("HandleHTTPError() expected no error for status code 200, got %v", err)
-	}
-}
-
 func TestInitConfig(t *testing.T) {
 	viper.Set("api-id", "test-api-id")
 	viper.Set("api-key", "test-api-key")
@@ -383,3 +199,54 @@ func TestValidateConfig(t *testing.T) {
 		t.Fatalf("validateConfig() error = %v", err)
 	}
 }
+
+func TestRetryPolicy(t *testing.T) {
+	if got := retryPolicy(); got.MaxRetries != 3 || got.Jitter != 0.2 || len(got.RetryableStatuses) != len(client.DefaultRetryableStatuses) {
+		t.Errorf("retryPolicy() defaults = %+v", got)
+	}
+
+	viper.Set("max-retries", 5)
+	viper.Set("retry-statuses", []int{429, 503})
+	viper.Set("retry-busy", true)
+	defer func() {
+		viper.Set("max-retries", nil)
+		viper.Set("retry-statuses", nil)
+		viper.Set("retry-busy", nil)
+	}()
+
+	got := retryPolicy()
+	if got.MaxRetries != 5 || fmt.Sprint(got.RetryableStatuses) != "[429 503]" || !got.RetryBusy {
+		t.Errorf("retryPolicy() = %+v", got)
+	}
+}
+
+func TestSharedHTTPClient(t *testing.T) {
+	if got := transportConfig(); got.ConnectTimeout != 30*time.Second || got.MinTLSVersion != "1.2" || got.Timeout != 0 {
+		t.Errorf("transportConfig() defaults = %+v", got)
+	}
+
+	first, err := sharedHTTPClient()
+	if err != nil {
+		t.Fatalf("sharedHTTPClient() error = %v", err)
+	}
+	second, err := sharedHTTPClient()
+	if err != nil || second != first {
+		t.Errorf("sharedHTTPClient() did not reuse the client for unchanged settings")
+	}
+
+	viper.Set("http-timeout", time.Hour)
+	defer viper.Set("http-timeout", nil)
+	changed, err := sharedHTTPClient()
+	if err != nil {
+		t.Fatalf("sharedHTTPClient() error = %v", err)
+	}
+	if changed == first || changed.Timeout != time.Hour {
+		t.Errorf("sharedHTTPClient() did not apply the changed timeout")
+	}
+
+	viper.Set("tls-min-version", "1.1")
+	defer viper.Set("tls-min-version", nil)
+	if _, err := newClient(); err == nil || !strings.Contains(err.Error(), "invalid minimum TLS version") {
+		t.Errorf("newClient() error = %v, want invalid minimum TLS version", err)
+	}
+}
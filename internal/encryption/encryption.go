@@ -0,0 +1,235 @@
+// Package encryption encrypts export archives at rest in the age format (https://age-encryption.org), either
+// to X25519 recipients or with a passphrase. Encrypted archives can be decrypted with this package or the
+// age command line tool.
+package encryption
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"strings"
+
+	"filippo.io/age"
+)
+
+// Suffix is appended to the file name of an encrypted archive
+const Suffix string = ".age"
+
+// header starts every file in the age format
+const header string = "age-encryption.org/v1\n"
+
+// Recipients returns the recipients an archive is encrypted to: the X25519 recipients (age1...) or, if
+// none are given, the passphrase. Exactly one of them must be provided.
+func Recipients(recipients []string, passphrase string) ([]age.Recipient, error) {
+	switch {
+	case len(recipients) > 0 && passphrase != "":
+		return nil, errors.New("an archive is encrypted either to recipients or with a passphrase, not both")
+	case len(recipients) > 0:
+		parsed := make([]age.Recipient, 0, len(recipients))
+		for _, recipient := range recipients {
+			r, err := age.ParseX25519Recipient(strings.TrimSpace(recipient))
+			if err != nil {
+				return nil, fmt.Errorf("invalid recipient %q: %w", recipient, err)
+			}
+			parsed = append(parsed, r)
+		}
+		return parsed, nil
+	case passphrase != "":
+		r, err := age.NewScryptRecipient(passphrase)
+		if err != nil {
+			return nil, fmt.Errorf("invalid passphrase: %w", err)
+		}
+		return []age.Recipient{r}, nil
+	default:
+		return nil, errors.New("encryption requires a recipient or a passphrase")
+	}
+}
+
+// Identities returns the identities that decrypt an archive: the X25519 identities (AGE-SECRET-KEY-1...)
+// in the identity files and the passphrase, if any
+func Identities(identityFiles []string, passphrase string) ([]age.Identity, error) {
+	var identities []age.Identity
+	for _, path := range identityFiles {
+		file, err := os.Open(path) // #nosec G304 -- Identity files are chosen by the user
+		if err != nil {
+			return nil, fmt.Errorf("failed to open identity file: %w", err)
+		}
+		parsed, err := age.ParseIdentities(bufio.NewReader(file))
+		_ = file.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse identity file %s: %w", path, err)
+		}
+		identities = append(identities, parsed...)
+	}
+	if passphrase != "" {
+		identity, err := age.NewScryptIdentity(passphrase)
+		if err != nil {
+			return nil, fmt.Errorf("invalid passphrase: %w", err)
+		}
+		identities = append(identities, identity)
+	}
+	if len(identities) == 0 {
+		return nil, errors.New("decryption requires an identity file or a passphrase")
+	}
+	return identities, nil
+}
+
+// IsEncrypted reports whether the file at path is in the age format
+func IsEncrypted(path string) (bool, error) {
+	file, err := os.Open(path) // #nosec G304 -- Callers pass paths they created or validated
+	if err != nil {
+		return false, err
+	}
+	defer file.Close()
+
+	buf := make([]byte, len(header))
+	if _, err := io.ReadFull(file, buf); err != nil {
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			return false, nil
+		}
+		return false, err
+	}
+	return string(buf) == header, nil
+}
+
+// MaxPlaintextSize is the largest archive that is held in memory while it is encrypted or read without
+// decrypting it to disk. An encrypted archive is verified in memory, so the plaintext never touches disk.
+const MaxPlaintextSize int64 = 256 << 20
+
+// ErrTooLarge is returned for an archive larger than MaxPlaintextSize
+var ErrTooLarge = fmt.Errorf("archive is larger than the limit of %d MiB for encrypted archives", MaxPlaintextSize>>20)
+
+// maxPlaintextSize is MaxPlaintextSize, lowered by tests
+var maxPlaintextSize = MaxPlaintextSize
+
+// Open opens the encrypted file at path and returns a reader of the plaintext, which is decrypted as it is read
+func Open(path string, identities []age.Identity) (io.ReadCloser, error) {
+	file, err := os.Open(path) // #nosec G304 -- Callers pass paths they created or validated
+	if err != nil {
+		return nil, fmt.Errorf("failed to open encrypted archive: %w", err)
+	}
+	r, err := age.Decrypt(bufio.NewReader(file), identities...)
+	if err != nil {
+		_ = file.Close()
+		return nil, fmt.Errorf("failed to decrypt %s: %w", path, err)
+	}
+	return &decryptedFile{Reader: r, file: file}, nil
+}
+
+// decryptedFile reads the plaintext of an encrypted file and closes the file
+type decryptedFile struct {
+	io.Reader
+	file *os.File
+}
+
+// Close closes the encrypted file
+func (f *decryptedFile) Close() error {
+	return f.file.Close()
+}
+
+// ReadFile decrypts the file at path into memory, so the plaintext never touches disk. Archives larger
+// than MaxPlaintextSize are refused with ErrTooLarge.
+func ReadFile(path string, identities []age.Identity) ([]byte, error) {
+	r, err := Open(path, identities)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	var buf bytes.Buffer
+	n, err := io.Copy(&buf, io.LimitReader(r, maxPlaintextSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt %s: %w", path, err)
+	}
+	if n > maxPlaintextSize {
+		return nil, fmt.Errorf("failed to decrypt %s: %w", path, ErrTooLarge)
+	}
+	return buf.Bytes(), nil
+}
+
+// Writer encrypts everything written to it into a file. The plaintext is hashed and counted as it is
+// written and kept in memory up to MaxPlaintextSize, so the archive can be verified without writing the
+// plaintext to disk; a larger archive is refused with ErrTooLarge. It implements client.ResumableWriter:
+// Size reports the plaintext bytes written, so an interrupted download is resumed within the same run, and
+// Reset starts a new encrypted file. An encrypted file cannot be resumed across runs.
+type Writer struct {
+	file       File
+	recipients []age.Recipient
+	enc        io.WriteCloser
+	size       int64
+	hash       hash.Hash
+	plaintext  bytes.Buffer
+}
+
+// File is the file an encrypted archive is written to
+type File interface {
+	io.Writer
+	// Reset discards everything written to the file
+	Reset() error
+}
+
+// NewWriter returns a writer encrypting to the recipients into file, which is reset
+func NewWriter(file File, recipients []age.Recipient) (*Writer, error) {
+	w := &Writer{file: file, recipients: recipients, hash: sha256.New()}
+	if err := w.Reset(); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+// Write encrypts p into the file. Nothing is written once the plaintext would exceed MaxPlaintextSize.
+func (w *Writer) Write(p []byte) (int, error) {
+	if w.size+int64(len(p)) > maxPlaintextSize {
+		return 0, ErrTooLarge
+	}
+	n, err := w.enc.Write(p)
+	w.hash.Write(p[:n])
+	w.plaintext.Write(p[:n])
+	w.size += int64(n)
+	return n, err
+}
+
+// Size returns the number of plaintext bytes written
+func (w *Writer) Size() (int64, error) {
+	return w.size, nil
+}
+
+// Reset discards everything written and starts a new encrypted file
+func (w *Writer) Reset() error {
+	if err := w.file.Reset(); err != nil {
+		return fmt.Errorf("failed to truncate encrypted file: %w", err)
+	}
+	enc, err := age.Encrypt(w.file, w.recipients...)
+	if err != nil {
+		return fmt.Errorf("failed to start encryption: %w", err)
+	}
+	w.enc = enc
+	w.size = 0
+	w.hash.Reset()
+	w.plaintext.Reset()
+	return nil
+}
+
+// SHA256 returns the hex-encoded SHA-256 of the plaintext written so far
+func (w *Writer) SHA256() string {
+	return hex.EncodeToString(w.hash.Sum(nil))
+}
+
+// Plaintext returns a reader of the plaintext written so far
+func (w *Writer) Plaintext() *bytes.Reader {
+	return bytes.NewReader(w.plaintext.Bytes())
+}
+
+// Close writes the final encrypted chunk. It does not close the file.
+func (w *Writer) Close() error {
+	if err := w.enc.Close(); err != nil {
+		return fmt.Errorf("failed to finish encryption: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,235 @@
+package encryption
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"filippo.io/age"
+)
+
+// testFile is a file that is truncated on Reset
+type testFile struct {
+	*os.File
+}
+
+func (f testFile) Reset() error {
+	if err := f.Truncate(0); err != nil {
+		return err
+	}
+	_, err := f.Seek(0, io.SeekStart)
+	return err
+}
+
+func TestWriter(t *testing.T) {
+	identity, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	recipients, err := Recipients([]string{identity.Recipient().String()}, "")
+	if err != nil {
+		t.Fatalf("Recipients() error = %v", err)
+	}
+
+	path := filepath.Join(t.TempDir(), "export.zip.age")
+	file, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	w, err := NewWriter(testFile{file}, recipients)
+	if err != nil {
+		t.Fatalf("NewWriter() error = %v", err)
+	}
+
+	// A reset discards the bytes of an interrupted attempt
+	if _, err := w.Write([]byte("interrupted")); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Reset(); err != nil {
+		t.Fatalf("Reset() error = %v", err)
+	}
+	if _, err := w.Write([]byte("plaintext archive")); err != nil {
+		t.Fatal(err)
+	}
+	if size, err := w.Size(); err != nil || size != 17 {
+		t.Errorf("Size() = %d, %v, want 17", size, err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+	if plaintext, err := io.ReadAll(w.Plaintext()); err != nil || string(plaintext) != "plaintext archive" {
+		t.Errorf("Plaintext() = %q, %v", plaintext, err)
+	}
+	if sum := sha256.Sum256([]byte("plaintext archive")); w.SHA256() != hex.EncodeToString(sum[:]) {
+		t.Errorf("SHA256() = %s, want the hash of the plaintext", w.SHA256())
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(data, []byte("plaintext")) || bytes.Contains(data, []byte("interrupted")) {
+		t.Error("encrypted file contains the plaintext")
+	}
+	if encrypted, err := IsEncrypted(path); err != nil || !encrypted {
+		t.Errorf("IsEncrypted() = %v, %v, want true", encrypted, err)
+	}
+
+	decrypted, err := ReadFile(path, []age.Identity{identity})
+	if err != nil || string(decrypted) != "plaintext archive" {
+		t.Errorf("ReadFile() = %q, %v", decrypted, err)
+	}
+
+	other, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ReadFile(path, []age.Identity{other}); err == nil {
+		t.Error("ReadFile() decrypted with the wrong identity")
+	}
+}
+
+func TestMaxPlaintextSize(t *testing.T) {
+	original := maxPlaintextSize
+	maxPlaintextSize = 16
+	t.Cleanup(func() { maxPlaintextSize = original })
+
+	identity, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "export.zip.age")
+	file, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	w, err := NewWriter(testFile{file}, []age.Recipient{identity.Recipient()})
+	if err != nil {
+		t.Fatalf("NewWriter() error = %v", err)
+	}
+
+	// The plaintext is never held in memory beyond the limit
+	if _, err := w.Write([]byte("0123456789")); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := w.Write([]byte("0123456789")); n != 0 || !errors.Is(err, ErrTooLarge) {
+		t.Errorf("Write() past the limit = %d, %v, want ErrTooLarge", n, err)
+	}
+	if size, _ := w.Size(); size != 10 || w.Plaintext().Len() != 10 {
+		t.Errorf("Size() = %d after a refused write, want 10", size)
+	}
+
+	// A reset starts over, so an archive within the limit is written and decrypted
+	if err := w.Reset(); err != nil {
+		t.Fatalf("Reset() error = %v", err)
+	}
+	if _, err := w.Write([]byte("0123456789abcdef")); err != nil {
+		t.Fatalf("Write() up to the limit error = %v", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if data, err := ReadFile(path, []age.Identity{identity}); err != nil || string(data) != "0123456789abcdef" {
+		t.Errorf("ReadFile() = %q, %v", data, err)
+	}
+
+	maxPlaintextSize = 8
+	if _, err := ReadFile(path, []age.Identity{identity}); !errors.Is(err, ErrTooLarge) {
+		t.Errorf("ReadFile() past the limit error = %v, want ErrTooLarge", err)
+	}
+}
+
+func TestPassphrase(t *testing.T) {
+	recipients, err := Recipients(nil, "correct horse battery staple")
+	if err != nil {
+		t.Fatalf("Recipients() error = %v", err)
+	}
+	path := filepath.Join(t.TempDir(), "export.zip.age")
+	file, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w, err := NewWriter(testFile{file}, recipients)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Write([]byte("archive")); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := file.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	identities, err := Identities(nil, "correct horse battery staple")
+	if err != nil {
+		t.Fatalf("Identities() error = %v", err)
+	}
+	if data, err := ReadFile(path, identities); err != nil || string(data) != "archive" {
+		t.Errorf("ReadFile() = %q, %v", data, err)
+	}
+}
+
+func TestIdentities(t *testing.T) {
+	identity, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "key.txt")
+	content := "# created: 2026-01-01T00:00:00Z\n" + identity.String() + "\n"
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	identities, err := Identities([]string{path}, "")
+	if err != nil || len(identities) != 1 {
+		t.Errorf("Identities() = %v, %v, want one identity", identities, err)
+	}
+
+	if _, err := Identities(nil, ""); err == nil {
+		t.Error("Identities() accepted neither identity files nor a passphrase")
+	}
+	if _, err := Identities([]string{filepath.Join(t.TempDir(), "missing.txt")}, ""); err == nil {
+		t.Error("Identities() accepted a missing identity file")
+	}
+}
+
+func TestRecipients_Invalid(t *testing.T) {
+	for name, tc := range map[string]struct {
+		recipients []string
+		passphrase string
+		want       string
+	}{
+		"none":    {want: "requires a recipient or a passphrase"},
+		"both":    {recipients: []string{"age1x"}, passphrase: "secret", want: "not both"},
+		"invalid": {recipients: []string{"ssh-ed25519 AAAA"}, want: "invalid recipient"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			if _, err := Recipients(tc.recipients, tc.passphrase); err == nil || !strings.Contains(err.Error(), tc.want) {
+				t.Errorf("Recipients() error = %v, want %q", err, tc.want)
+			}
+		})
+	}
+}
+
+func TestIsEncrypted(t *testing.T) {
+	dir := t.TempDir()
+	for name, content := range map[string]string{"plain.zip": "PK\x03\x04", "empty.zip": ""} {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+		if encrypted, err := IsEncrypted(path); err != nil || encrypted {
+			t.Errorf("IsEncrypted(%s) = %v, %v, want false", name, encrypted, err)
+		}
+	}
+}
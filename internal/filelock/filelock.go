@@ -0,0 +1,25 @@
+// Package filelock takes exclusive advisory locks of files, serializing updates of a file shared by several
+// processes, e.g. the daemon and a one-off export.
+package filelock
+
+import (
+	"fmt"
+	"os"
+)
+
+// LockPath takes an exclusive lock of the lock file at path, creating it if needed, for files that are
+// replaced by a rename and so cannot be locked themselves. The returned function releases the lock.
+func LockPath(path string) (func(), error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0600) // #nosec G304 -- Path comes from the user's own configuration
+	if err != nil {
+		return nil, fmt.Errorf("failed to open lock file: %w", err)
+	}
+	if err := Lock(f); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("failed to lock %s: %w", path, err)
+	}
+	return func() {
+		_ = Unlock(f)
+		f.Close()
+	}, nil
+}
@@ -0,0 +1,42 @@
+package filelock
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestLockPath(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ledger.json.lock")
+	unlock, err := LockPath(path)
+	if err != nil {
+		t.Fatalf("LockPath() error = %v", err)
+	}
+
+	// Every LockPath opens the file anew, so a second lock waits like one of another process
+	locked := make(chan struct{})
+	go func() {
+		unlock, err := LockPath(path)
+		if err != nil {
+			t.Error(err)
+		} else {
+			unlock()
+		}
+		close(locked)
+	}()
+	select {
+	case <-locked:
+		t.Fatal("LockPath() took a lock that is held")
+	case <-time.After(50 * time.Millisecond):
+	}
+	unlock()
+	select {
+	case <-locked:
+	case <-time.After(5 * time.Second):
+		t.Fatal("LockPath() did not get the released lock")
+	}
+
+	if _, err := LockPath(filepath.Join(t.TempDir(), "missing", "ledger.json.lock")); err == nil {
+		t.Error("LockPath() in a missing directory expected an error")
+	}
+}
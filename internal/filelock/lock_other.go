@@ -0,0 +1,11 @@
+//go:build !unix && !windows
+
+package filelock
+
+import "os"
+
+// Lock does nothing on platforms without file locks, where only updates within the process are serialized
+func Lock(*os.File) error { return nil }
+
+// Unlock does nothing on platforms without file locks
+func Unlock(*os.File) error { return nil }
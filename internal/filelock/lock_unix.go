@@ -0,0 +1,18 @@
+//go:build unix
+
+package filelock
+
+import (
+	"os"
+	"syscall"
+)
+
+// Lock takes an exclusive lock of the file, waiting until other processes released it
+func Lock(f *os.File) error {
+	return syscall.Flock(int(f.Fd()), syscall.LOCK_EX) // #nosec G115 -- File descriptors fit into an int
+}
+
+// Unlock releases the lock of the file
+func Unlock(f *os.File) error {
+	return syscall.Flock(int(f.Fd()), syscall.LOCK_UN) // #nosec G115 -- File descriptors fit into an int
+}
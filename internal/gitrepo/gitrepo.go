@@ -0,0 +1,410 @@
+// Package gitrepo keeps the history of exports in a local git repository. Every export is extracted into a
+// directory of the working tree and committed with a message summarizing what changed, so the history of
+// an account can be browsed, diffed and pushed with any git tooling. No git binary is required.
+package gitrepo
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/ren3gadem4rm0t/imperva-export-cli/internal/archive"
+	"github.com/ren3gadem4rm0t/imperva-export-cli/internal/terraform"
+)
+
+// Default author of the commits
+const (
+	DefaultAuthorName  string = "imperva-export-cli"
+	DefaultAuthorEmail string = "imperva-export-cli@localhost"
+)
+
+// TimeFormat is the format of the export timestamp in tag names
+const TimeFormat string = "20060102T150405Z"
+
+// maxListedChanges is the maximum number of changed resources listed in a commit message
+const maxListedChanges int = 50
+
+// Export describes the export committed to the repository
+type Export struct {
+	// Archive is the path of the saved export archive
+	Archive string
+	// Dir is the slash-separated directory of the working tree the export is kept in, e.g. 123456
+	Dir      string
+	CAID     int64
+	Handler  string
+	Resource string
+	Time     time.Time
+}
+
+// Options controls how exports are committed
+type Options struct {
+	AuthorName  string
+	AuthorEmail string
+	// Tag creates an annotated tag pointing at the commit
+	Tag bool
+	// Limits bound the extraction of the archive
+	Limits archive.ExtractLimits
+}
+
+// FileChanges counts the files of the working tree changed by an export
+type FileChanges struct {
+	Added    int
+	Modified int
+	Deleted  int
+}
+
+// Total returns the number of changed files
+func (f FileChanges) Total() int {
+	return f.Added + f.Modified + f.Deleted
+}
+
+// Result describes the commit of an export
+type Result struct {
+	// Commit is the hash of the new commit, or empty if the export did not change anything
+	Commit string
+	// Tag is the name of the created tag, if any
+	Tag       string
+	Files     FileChanges
+	Resources *terraform.Diff
+}
+
+// Commit extracts the export into its directory of the working tree at repoDir, stages the files that
+// were added, modified or deleted and commits them. The repository is created if it does not exist yet.
+// Nothing is committed if the export matches the files tracked in that directory.
+func Commit(repoDir string, export Export, opts Options) (Result, error) {
+	dir := filepath.FromSlash(export.Dir)
+	if export.Dir == "" || !filepath.IsLocal(dir) {
+		return Result{}, fmt.Errorf("invalid directory in git repository: %q", export.Dir)
+	}
+
+	repo, err := open(repoDir)
+	if err != nil {
+		return Result{}, err
+	}
+	worktree, err := repo.Worktree()
+	if err != nil {
+		return Result{}, fmt.Errorf("failed to open working tree of %s: %w", repoDir, err)
+	}
+
+	staging, err := os.MkdirTemp("", "imperva-export-git-")
+	if err != nil {
+		return Result{}, fmt.Errorf("failed to create staging directory: %w", err)
+	}
+	defer os.RemoveAll(staging)
+	extracted := filepath.Join(staging, "export")
+	if _, err := archive.Extract(export.Archive, extracted, opts.Limits); err != nil {
+		return Result{}, fmt.Errorf("error extracting export: %w", err)
+	}
+
+	target := filepath.Join(repoDir, dir)
+	oldConfig, err := terraform.LoadDir(target)
+	if err != nil {
+		return Result{}, fmt.Errorf("error reading previous export: %w", err)
+	}
+	newConfig, err := terraform.LoadDir(extracted)
+	if err != nil {
+		return Result{}, fmt.Errorf("error reading export: %w", err)
+	}
+
+	tracked, err := trackedFiles(repo, dir)
+	if err != nil {
+		return Result{}, err
+	}
+	changes, err := syncDir(extracted, target, tracked)
+	if err != nil {
+		return Result{}, err
+	}
+	result := Result{Resources: terraform.Compare(oldConfig, newConfig)}
+	for _, change := range changes {
+		switch change.kind {
+		case changeAdded:
+			result.Files.Added++
+		case changeModified:
+			result.Files.Modified++
+		case changeDeleted:
+			result.Files.Deleted++
+		}
+	}
+	if len(changes) == 0 {
+		return result, nil
+	}
+
+	for _, change := range changes {
+		name := filepath.Join(dir, filepath.FromSlash(change.name))
+		if change.kind == changeDeleted {
+			// The file is already gone, so only its index entry is removed
+			if _, err := worktree.Remove(name); err != nil {
+				return Result{}, fmt.Errorf("failed to stage deletion of %s: %w", name, err)
+			}
+			continue
+		}
+		if _, err := worktree.Add(name); err != nil {
+			return Result{}, fmt.Errorf("failed to stage %s: %w", name, err)
+		}
+	}
+
+	when := export.Time
+	if when.IsZero() {
+		when = time.Now()
+	}
+	signature := &object.Signature{Name: opts.AuthorName, Email: opts.AuthorEmail, When: when}
+	if signature.Name == "" {
+		signature.Name = DefaultAuthorName
+	}
+	if signature.Email == "" {
+		signature.Email = DefaultAuthorEmail
+	}
+
+	message := CommitMessage(export, result)
+	hash, err := worktree.Commit(message, &git.CommitOptions{Author: signature})
+	if err != nil {
+		return Result{}, fmt.Errorf("failed to commit export: %w", err)
+	}
+	result.Commit = hash.String()
+
+	if opts.Tag {
+		result.Tag = TagName(export)
+		subject, _, _ := strings.Cut(message, "\n")
+		if _, err := repo.CreateTag(result.Tag, hash, &git.CreateTagOptions{Tagger: signature, Message: subject}); err != nil {
+			return result, fmt.Errorf("failed to tag commit %s: %w", result.Commit, err)
+		}
+	}
+	return result, nil
+}
+
+// open opens the repository at dir, initializing it if it does not exist
+func open(dir string) (*git.Repository, error) {
+	repo, err := git.PlainOpen(dir)
+	if err == nil {
+		return repo, nil
+	}
+	if !errors.Is(err, git.ErrRepositoryNotExists) {
+		return nil, fmt.Errorf("failed to open git repository %s: %w", dir, err)
+	}
+	if err := os.MkdirAll(dir, archive.ExtractDirMode); err != nil {
+		return nil, fmt.Errorf("failed to create git repository %s: %w", dir, err)
+	}
+	repo, err = git.PlainInit(dir, false)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create git repository %s: %w", dir, err)
+	}
+	return repo, nil
+}
+
+// TagName returns the name of the tag of an export, e.g. export-123456-20240102T150405Z
+func TagName(export Export) string {
+	return fmt.Sprintf("export-%s-%s", strings.ReplaceAll(export.Dir, "/", "-"), export.Time.UTC().Format(TimeFormat))
+}
+
+// CommitMessage returns the message of the commit of an export. The subject summarizes the resource
+// changes, the body lists the export and the changed resources.
+func CommitMessage(export Export, result Result) string {
+	diff := result.Resources
+	if diff == nil {
+		diff = &terraform.Diff{}
+	}
+	counts := fmt.Sprintf("%d added, %d changed, %d removed", diff.Added, diff.Changed, diff.Removed)
+
+	var b strings.Builder
+	subject := fmt.Sprintf("Export of CAID %d", export.CAID)
+	if export.Resource != "" {
+		subject = fmt.Sprintf("Export of %s in CAID %d", export.Resource, export.CAID)
+	}
+	fmt.Fprintf(&b, "%s: %s\n\n", subject, counts)
+	fmt.Fprintf(&b, "CAID: %d\n", export.CAID)
+	if export.Resource != "" {
+		fmt.Fprintf(&b, "Resource: %s\n", export.Resource)
+	}
+	if export.Handler != "" {
+		fmt.Fprintf(&b, "Handler: %s\n", export.Handler)
+	}
+	fmt.Fprintf(&b, "Timestamp: %s\n", export.Time.UTC().Format(time.RFC3339))
+	fmt.Fprintf(&b, "Resources: %s\n", counts)
+	fmt.Fprintf(&b, "Files: %d added, %d modified, %d deleted\n",
+		result.Files.Added, result.Files.Modified, result.Files.Deleted)
+
+	if len(diff.Resources) > 0 {
+		b.WriteString("\n")
+		for i, change := range diff.Resources {
+			if i == maxListedChanges {
+				fmt.Fprintf(&b, "... and %d more\n", len(diff.Resources)-maxListedChanges)
+				break
+			}
+			fmt.Fprintf(&b, "%s %s\n", changeMarker(change.Change), change.Address)
+		}
+	}
+	return b.String()
+}
+
+// changeMarker returns the marker of a resource change in the commit message
+func changeMarker(change string) string {
+	switch change {
+	case terraform.ChangeAdded:
+		return "+"
+	case terraform.ChangeRemoved:
+		return "-"
+	default:
+		return "~"
+	}
+}
+
+// Kinds of a file change in the working tree
+const (
+	changeAdded    string = "added"
+	changeModified string = "modified"
+	changeDeleted  string = "deleted"
+)
+
+// fileChange is a file of the working tree changed by syncDir, named by its slash-separated path
+type fileChange struct {
+	name string
+	kind string
+}
+
+// syncDir makes the files below target match the files below source and returns the files that differ
+// from the tracked files in name order. tracked maps the slash-separated paths of the files below target
+// in the index to their blob hashes. Comparing with the index rather than the working tree also picks up
+// files written by an earlier run that failed before its commit.
+func syncDir(source, target string, tracked map[string]plumbing.Hash) ([]fileChange, error) {
+	newFiles, err := listFiles(source)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list extracted files: %w", err)
+	}
+	oldFiles, err := listFiles(target)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list files of %s: %w", target, err)
+	}
+	for name := range newFiles {
+		if isGitPath(name) {
+			return nil, fmt.Errorf("illegal path in export: %q", name)
+		}
+	}
+
+	var changes []fileChange
+	for name := range newFiles {
+		data, err := os.ReadFile(filepath.Join(source, filepath.FromSlash(name))) // #nosec G304 -- Path found by walking source
+		if err != nil {
+			return nil, fmt.Errorf("failed to read extracted file %s: %w", name, err)
+		}
+		dst := filepath.Join(target, filepath.FromSlash(name))
+		if err := writeFile(dst, data, oldFiles[name]); err != nil {
+			return nil, err
+		}
+
+		hash, ok := tracked[name]
+		switch {
+		case !ok:
+			changes = append(changes, fileChange{name: name, kind: changeAdded})
+		case hash != plumbing.ComputeHash(plumbing.BlobObject, data):
+			changes = append(changes, fileChange{name: name, kind: changeModified})
+		}
+	}
+
+	for name := range oldFiles {
+		if newFiles[name] {
+			continue
+		}
+		dst := filepath.Join(target, filepath.FromSlash(name))
+		if err := os.Remove(dst); err != nil {
+			return nil, fmt.Errorf("failed to delete %s: %w", dst, err)
+		}
+		removeEmptyDirs(target, filepath.Dir(dst))
+	}
+	for name := range tracked {
+		if !newFiles[name] {
+			changes = append(changes, fileChange{name: name, kind: changeDeleted})
+		}
+	}
+
+	sort.Slice(changes, func(i, j int) bool { return changes[i].name < changes[j].name })
+	return changes, nil
+}
+
+// writeFile writes data to path unless the existing file already has that content
+func writeFile(path string, data []byte, exists bool) error {
+	if exists {
+		old, err := os.ReadFile(path) // #nosec G304 -- Path found by walking the working tree
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %w", path, err)
+		}
+		if bytes.Equal(old, data) {
+			return nil
+		}
+	}
+	if err := os.MkdirAll(filepath.Dir(path), archive.ExtractDirMode); err != nil {
+		return fmt.Errorf("failed to create directory for %s: %w", path, err)
+	}
+	if err := os.WriteFile(path, data, archive.ExtractFileMode); err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	return nil
+}
+
+// trackedFiles returns the blob hashes of the files in the index below dir, keyed by their slash-separated
+// path relative to dir
+func trackedFiles(repo *git.Repository, dir string) (map[string]plumbing.Hash, error) {
+	idx, err := repo.Storer.Index()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read git index: %w", err)
+	}
+	prefix := filepath.ToSlash(dir) + "/"
+	tracked := map[string]plumbing.Hash{}
+	for _, entry := range idx.Entries {
+		if name, ok := strings.CutPrefix(entry.Name, prefix); ok {
+			tracked[name] = entry.Hash
+		}
+	}
+	return tracked, nil
+}
+
+// listFiles returns the slash-separated paths of the regular files below dir. A missing directory has no files.
+func listFiles(dir string) (map[string]bool, error) {
+	files := map[string]bool{}
+	err := filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) && p == dir {
+				return filepath.SkipDir
+			}
+			return err
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+		files[filepath.ToSlash(rel)] = true
+		return nil
+	})
+	return files, err
+}
+
+// isGitPath reports whether a path has a .git component, which must never be written by an export
+func isGitPath(name string) bool {
+	for _, part := range strings.Split(name, "/") {
+		if strings.EqualFold(part, git.GitDirName) {
+			return true
+		}
+	}
+	return false
+}
+
+// removeEmptyDirs removes dir and its parents up to, but not including, root as long as they are empty
+func removeEmptyDirs(root, dir string) {
+	for dir != root && strings.HasPrefix(dir, root) {
+		if err := os.Remove(dir); err != nil {
+			return
+		}
+		dir = filepath.Dir(dir)
+	}
+}
@@ -0,0 +1,179 @@
+package gitrepo
+
+import (
+	"archive/zip"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/ren3gadem4rm0t/imperva-export-cli/internal/archive"
+)
+
+// writeArchive writes a zip archive with the given files and returns its path
+func writeArchive(t *testing.T, files map[string]string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "export.zip")
+	file, err := os.Create(path)
+	if err != nil {
+		t.Fatalf("failed to create zip: %v", err)
+	}
+	defer file.Close()
+	zw := zip.NewWriter(file)
+	for name, content := range files {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatalf("failed to create zip entry: %v", err)
+		}
+		if _, err := w.Write([]byte(content)); err != nil {
+			t.Fatalf("failed to write zip entry: %v", err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatalf("failed to close zip: %v", err)
+	}
+	return path
+}
+
+func testExport(t *testing.T, files map[string]string, when time.Time) Export {
+	t.Helper()
+	return Export{
+		Archive: writeArchive(t, files),
+		Dir:     "123456",
+		CAID:    123456,
+		Handler: "handler-1",
+		Time:    when,
+	}
+}
+
+func testOptions() Options {
+	return Options{Limits: archive.DefaultExtractLimits()}
+}
+
+func TestCommit(t *testing.T) {
+	repoDir := filepath.Join(t.TempDir(), "history")
+	when := time.Date(2024, 9, 26, 12, 0, 0, 0, time.UTC)
+
+	first := testExport(t, map[string]string{
+		"main.tf":          `resource "incapsula_site" "a" { domain = "a.example.com" }`,
+		"sites/removed.tf": `resource "incapsula_site" "b" { domain = "b.example.com" }`,
+	}, when)
+	result, err := Commit(repoDir, first, testOptions())
+	if err != nil {
+		t.Fatalf("Commit() error = %v", err)
+	}
+	if result.Commit == "" || result.Files != (FileChanges{Added: 2}) || result.Resources.Added != 2 {
+		t.Errorf("Commit() = %+v, want a commit adding 2 files and resources", result)
+	}
+
+	// The same export again does not create an empty commit
+	result, err = Commit(repoDir, testExport(t, map[string]string{
+		"main.tf":          `resource "incapsula_site" "a" { domain = "a.example.com" }`,
+		"sites/removed.tf": `resource "incapsula_site" "b" { domain = "b.example.com" }`,
+	}, when.Add(time.Hour)), testOptions())
+	if err != nil || result.Commit != "" || result.Files.Total() != 0 {
+		t.Errorf("Commit() of an unchanged export = %+v, %v, want no commit", result, err)
+	}
+
+	third := testExport(t, map[string]string{
+		"main.tf":  `resource "incapsula_site" "a" { domain = "c.example.com" }`,
+		"added.tf": `resource "incapsula_policy" "p" { name = "p" }`,
+	}, when.Add(2*time.Hour))
+	third.Handler = "handler-3"
+	opts := testOptions()
+	opts.Tag = true
+	opts.AuthorName = "Exporter"
+	opts.AuthorEmail = "exporter@example.com"
+	result, err = Commit(repoDir, third, opts)
+	if err != nil {
+		t.Fatalf("Commit() error = %v", err)
+	}
+	if result.Files != (FileChanges{Added: 1, Modified: 1, Deleted: 1}) {
+		t.Errorf("file changes = %+v", result.Files)
+	}
+	if result.Resources.Added != 1 || result.Resources.Changed != 1 || result.Resources.Removed != 1 {
+		t.Errorf("resource changes = %+v", result.Resources)
+	}
+	if result.Tag != "export-123456-20240926T140000Z" {
+		t.Errorf("tag = %q", result.Tag)
+	}
+	if _, err := os.Stat(filepath.Join(repoDir, "123456", "sites")); !os.IsNotExist(err) {
+		t.Errorf("directory of the deleted file was kept: %v", err)
+	}
+
+	repo, err := git.PlainOpen(repoDir)
+	if err != nil {
+		t.Fatalf("failed to open repository: %v", err)
+	}
+	commit, err := repo.CommitObject(plumbing.NewHash(result.Commit))
+	if err != nil {
+		t.Fatalf("failed to read commit: %v", err)
+	}
+	if commit.Author.Name != "Exporter" || !commit.Author.When.Equal(third.Time) {
+		t.Errorf("author = %+v", commit.Author)
+	}
+	for _, want := range []string{
+		"Export of CAID 123456: 1 added, 1 changed, 1 removed\n\n",
+		"Handler: handler-3\n",
+		"Timestamp: 2024-09-26T14:00:00Z\n",
+		"Files: 1 added, 1 modified, 1 deleted\n",
+		"+ incapsula_policy.p\n",
+		"~ incapsula_site.a\n",
+		"- incapsula_site.b\n",
+	} {
+		if !strings.Contains(commit.Message, want) {
+			t.Errorf("commit message %q does not contain %q", commit.Message, want)
+		}
+	}
+	if _, err := repo.Tag(result.Tag); err != nil {
+		t.Errorf("tag %s not created: %v", result.Tag, err)
+	}
+
+	worktree, err := repo.Worktree()
+	if err != nil {
+		t.Fatal(err)
+	}
+	status, err := worktree.Status()
+	if err != nil || !status.IsClean() {
+		t.Errorf("working tree not clean after commit: %v, %v", status, err)
+	}
+}
+
+func TestCommit_RecoversUncommittedFiles(t *testing.T) {
+	repoDir := t.TempDir()
+	export := testExport(t, map[string]string{"main.tf": `resource "incapsula_site" "a" {}`}, time.Now())
+
+	// A previous run wrote the file but failed before committing it
+	if err := os.MkdirAll(filepath.Join(repoDir, "123456"), 0750); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(repoDir, "123456", "main.tf"), []byte(`resource "incapsula_site" "a" {}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := Commit(repoDir, export, testOptions())
+	if err != nil || result.Commit == "" || result.Files.Added != 1 {
+		t.Errorf("Commit() = %+v, %v, want the file committed", result, err)
+	}
+}
+
+func TestCommit_Rejects(t *testing.T) {
+	repoDir := t.TempDir()
+
+	export := testExport(t, map[string]string{"main.tf": ""}, time.Now())
+	export.Dir = "../outside"
+	if _, err := Commit(repoDir, export, testOptions()); err == nil || !strings.Contains(err.Error(), "invalid directory") {
+		t.Errorf("Commit() outside the repository error = %v", err)
+	}
+
+	export = testExport(t, map[string]string{"main.tf": "", "sites/.git/config": "[core]"}, time.Now())
+	if _, err := Commit(repoDir, export, testOptions()); err == nil || !strings.Contains(err.Error(), "illegal path") {
+		t.Errorf("Commit() of a .git entry error = %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(repoDir, "123456", "main.tf")); !os.IsNotExist(err) {
+		t.Errorf("files were written for a rejected export: %v", err)
+	}
+}
@@ -0,0 +1,287 @@
+// Package metrics records counters and histograms and writes them in the Prometheus text exposition format,
+// served over HTTP or written to a file for the textfile collector of the node exporter.
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ContentType is the content type of the text exposition format
+const ContentType string = "text/plain; version=0.0.4; charset=utf-8"
+
+// Registry holds the metrics of a process. It is safe for concurrent use.
+type Registry struct {
+	mu       sync.Mutex
+	families []*family
+}
+
+// family is a metric with its series, one per combination of label values
+type family struct {
+	name    string
+	help    string
+	kind    string
+	labels  []string
+	buckets []float64
+	series  map[string]*series
+}
+
+// series is the value of a metric for one combination of label values. Counters only use sum.
+type series struct {
+	labelValues []string
+	counts      []uint64
+	count       uint64
+	sum         float64
+}
+
+// Counter is a metric that only goes up
+type Counter struct {
+	registry *Registry
+	family   *family
+}
+
+// Histogram is a metric that counts observations in buckets
+type Histogram struct {
+	registry *Registry
+	family   *family
+}
+
+// NewRegistry returns an empty registry
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+// metricName and labelName match the valid names of metrics and labels
+var (
+	metricName = regexp.MustCompile(`^[a-zA-Z_:][a-zA-Z0-9_:]*$`)
+	labelName  = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+)
+
+// Counter adds a counter with the label names to the registry. Like the other methods adding metrics, it
+// panics if a name is invalid or the metric is already registered, as metrics are defined by the program.
+func (r *Registry) Counter(name, help string, labels ...string) *Counter {
+	return &Counter{registry: r, family: r.add(name, help, "counter", labels, nil)}
+}
+
+// Histogram adds a histogram with the upper bounds of its buckets and the label names to the registry
+func (r *Registry) Histogram(name, help string, buckets []float64, labels ...string) *Histogram {
+	buckets = append([]float64(nil), buckets...)
+	sort.Float64s(buckets)
+	return &Histogram{registry: r, family: r.add(name, help, "histogram", labels, buckets)}
+}
+
+func (r *Registry) add(name, help, kind string, labels []string, buckets []float64) *family {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err := r.validate(name, kind, labels); err != nil {
+		panic(err)
+	}
+	f := &family{name: name, help: help, kind: kind, labels: labels, buckets: buckets, series: map[string]*series{}}
+	r.families = append(r.families, f)
+	return f
+}
+
+// validate checks the names of a new metric and its labels against the text exposition format. The le label
+// is reserved for the buckets of histograms and labels starting with __ for Prometheus itself.
+func (r *Registry) validate(name, kind string, labels []string) error {
+	if !metricName.MatchString(name) {
+		return fmt.Errorf("invalid metric name %q", name)
+	}
+	for _, f := range r.families {
+		if f.name == name {
+			return fmt.Errorf("metric %s is already registered", name)
+		}
+	}
+	seen := map[string]bool{}
+	for _, label := range labels {
+		switch {
+		case !labelName.MatchString(label) || strings.HasPrefix(label, "__"):
+			return fmt.Errorf("invalid label name %q of metric %s", label, name)
+		case label == "le" && kind == "histogram":
+			return fmt.Errorf("label le of histogram %s is reserved for its buckets", name)
+		case seen[label]:
+			return fmt.Errorf("duplicate label %s of metric %s", label, name)
+		}
+		seen[label] = true
+	}
+	return nil
+}
+
+// Inc adds one to the counter of the label values
+func (c *Counter) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+// Add adds a non-negative value to the counter of the label values
+func (c *Counter) Add(v float64, labelValues ...string) {
+	if v < 0 {
+		return
+	}
+	c.registry.mu.Lock()
+	defer c.registry.mu.Unlock()
+	c.family.get(labelValues).sum += v
+}
+
+// Observe adds an observation to the histogram of the label values
+func (h *Histogram) Observe(v float64, labelValues ...string) {
+	h.registry.mu.Lock()
+	defer h.registry.mu.Unlock()
+	s := h.family.get(labelValues)
+	for i, bound := range h.family.buckets {
+		if v <= bound {
+			s.counts[i]++
+		}
+	}
+	s.count++
+	s.sum += v
+}
+
+// get returns the series of the label values, creating it on first use. Missing label values are empty.
+func (f *family) get(labelValues []string) *series {
+	values := make([]string, len(f.labels))
+	copy(values, labelValues)
+	key := strings.Join(values, "\xff")
+	s, ok := f.series[key]
+	if !ok {
+		s = &series{labelValues: values, counts: make([]uint64, len(f.buckets))}
+		f.series[key] = s
+	}
+	return s
+}
+
+// Reset removes all recorded values, keeping the metrics
+func (r *Registry) Reset() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, f := range r.families {
+		f.series = map[string]*series{}
+	}
+}
+
+// WriteText writes all metrics in the text exposition format. Series are sorted by their label values.
+func (r *Registry) WriteText(w io.Writer) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	bw := bufio.NewWriter(w)
+	for _, f := range r.families {
+		fmt.Fprintf(bw, "# HELP %s %s\n", f.name, escapeHelp(f.help))
+		fmt.Fprintf(bw, "# TYPE %s %s\n", f.name, f.kind)
+
+		keys := make([]string, 0, len(f.series))
+		for key := range f.series {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			s := f.series[key]
+			if f.kind == "counter" {
+				fmt.Fprintf(bw, "%s%s %s\n", f.name, labelPairs(f.labels, s.labelValues, ""), formatFloat(s.sum))
+				continue
+			}
+			for i, bound := range f.buckets {
+				fmt.Fprintf(bw, "%s_bucket%s %d\n", f.name, labelPairs(f.labels, s.labelValues, formatFloat(bound)), s.counts[i])
+			}
+			fmt.Fprintf(bw, "%s_bucket%s %d\n", f.name, labelPairs(f.labels, s.labelValues, "+Inf"), s.count)
+			fmt.Fprintf(bw, "%s_sum%s %s\n", f.name, labelPairs(f.labels, s.labelValues, ""), formatFloat(s.sum))
+			fmt.Fprintf(bw, "%s_count%s %d\n", f.name, labelPairs(f.labels, s.labelValues, ""), s.count)
+		}
+	}
+	return bw.Flush()
+}
+
+// Handler returns an HTTP handler serving the metrics
+func (r *Registry) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodGet && req.Method != http.MethodHead {
+			w.Header().Set("Allow", "GET, HEAD")
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+			return
+		}
+		w.Header().Set("Content-Type", ContentType)
+		_ = r.WriteText(w)
+	})
+}
+
+// WriteFile atomically replaces the file with the metrics, so the textfile collector never reads a
+// partial file. The temp file is written to the same directory and ignored by the collector, which only
+// reads *.prom files.
+func (r *Registry) WriteFile(path string) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to create metrics file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if err := r.WriteText(tmp); err != nil {
+		_ = tmp.Close()
+		return fmt.Errorf("failed to write metrics file: %w", err)
+	}
+	if err := tmp.Chmod(0644); err != nil {
+		_ = tmp.Close()
+		return fmt.Errorf("failed to write metrics file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write metrics file: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("failed to write metrics file: %w", err)
+	}
+	return nil
+}
+
+// labelPairs formats the labels of a series, adding the le label of a bucket if given
+func labelPairs(names, values []string, le string) string {
+	if len(names) == 0 && le == "" {
+		return ""
+	}
+	var b strings.Builder
+	b.WriteByte('{')
+	for i, name := range names {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		fmt.Fprintf(&b, "%s=\"%s\"", name, escapeLabel(values[i]))
+	}
+	if le != "" {
+		if len(names) > 0 {
+			b.WriteByte(',')
+		}
+		fmt.Fprintf(&b, "le=\"%s\"", le)
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+var (
+	helpEscaper  = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+	labelEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+)
+
+func escapeHelp(s string) string {
+	return helpEscaper.Replace(s)
+}
+
+func escapeLabel(s string) string {
+	return labelEscaper.Replace(s)
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
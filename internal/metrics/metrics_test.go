@@ -0,0 +1,137 @@
+package metrics
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWriteText(t *testing.T) {
+	r := NewRegistry()
+	requests := r.Counter("requests_total", "Requests by status.", "method", "status")
+	duration := r.Histogram("duration_seconds", "Duration\nof requests.", []float64{1, 0.5}, "method")
+	bytesTotal := r.Counter("bytes_total", "Bytes.")
+
+	requests.Inc("GET", "200")
+	requests.Inc("GET", "200")
+	requests.Inc("POST", `a"b\c`)
+	requests.Add(-1, "GET", "200")
+	duration.Observe(0.2, "GET")
+	duration.Observe(0.7, "GET")
+	duration.Observe(3, "GET")
+	bytesTotal.Add(1.5e9)
+
+	want := `# HELP requests_total Requests by status.
+# TYPE requests_total counter
+requests_total{method="GET",status="200"} 2
+requests_total{method="POST",status="a\"b\\c"} 1
+# HELP duration_seconds Duration\nof requests.
+# TYPE duration_seconds histogram
+duration_seconds_bucket{method="GET",le="0.5"} 1
+duration_seconds_bucket{method="GET",le="1"} 2
+duration_seconds_bucket{method="GET",le="+Inf"} 3
+duration_seconds_sum{method="GET"} 3.9
+duration_seconds_count{method="GET"} 3
+# HELP bytes_total Bytes.
+# TYPE bytes_total counter
+bytes_total 1.5e+09
+`
+	var buf bytes.Buffer
+	if err := r.WriteText(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != want {
+		t.Errorf("WriteText() =\n%s\nwant\n%s", buf.String(), want)
+	}
+
+	r.Reset()
+	buf.Reset()
+	if err := r.WriteText(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if want := "# HELP requests_total Requests by status.\n# TYPE requests_total counter\n"; !bytes.HasPrefix(buf.Bytes(), []byte(want)) || bytes.Contains(buf.Bytes(), []byte("} ")) {
+		t.Errorf("WriteText() after Reset() =\n%s", buf.String())
+	}
+}
+
+func TestHandler(t *testing.T) {
+	r := NewRegistry()
+	r.Counter("jobs_total", "Jobs.").Inc()
+	server := httptest.NewServer(r.Handler())
+	defer server.Close()
+
+	resp, err := http.Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != ContentType || !bytes.Contains(body, []byte("jobs_total 1\n")) {
+		t.Errorf("GET = %d %s:\n%s", resp.StatusCode, resp.Header.Get("Content-Type"), body)
+	}
+
+	resp, err = http.Post(server.URL, "text/plain", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusMethodNotAllowed {
+		t.Errorf("POST = %d, want %d", resp.StatusCode, http.StatusMethodNotAllowed)
+	}
+}
+
+func TestWriteFile(t *testing.T) {
+	r := NewRegistry()
+	r.Counter("jobs_total", "Jobs.").Inc()
+	dir := t.TempDir()
+	path := filepath.Join(dir, "export.prom")
+	if err := os.WriteFile(path, []byte("stale"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := r.WriteFile(path); err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil || !bytes.Contains(data, []byte("jobs_total 1\n")) {
+		t.Errorf("file = %q, %v", data, err)
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 1 {
+		t.Errorf("temp files left behind: %v", entries)
+	}
+	if err := r.WriteFile(filepath.Join(dir, "missing", "export.prom")); err == nil {
+		t.Error("WriteFile() to a missing directory succeeded")
+	}
+}
+
+func TestRegistry_InvalidNames(t *testing.T) {
+	tests := map[string]func(r *Registry){
+		"metric name":        func(r *Registry) { r.Counter("requests-total", "") },
+		"label name":         func(r *Registry) { r.Counter("requests_total", "", "http.method") },
+		"reserved label":     func(r *Registry) { r.Counter("requests_total", "", "__name") },
+		"histogram le label": func(r *Registry) { r.Histogram("duration_seconds", "", []float64{1}, "le") },
+		"duplicate label":    func(r *Registry) { r.Counter("requests_total", "", "method", "method") },
+		"duplicate metric": func(r *Registry) {
+			r.Counter("requests_total", "")
+			r.Histogram("requests_total", "", []float64{1})
+		},
+	}
+	for name, register := range tests {
+		t.Run(name, func(t *testing.T) {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("registering an invalid %s did not panic", name)
+				}
+			}()
+			register(NewRegistry())
+		})
+	}
+
+	// Counters may have an le label, and colons are valid in metric names
+	r := NewRegistry()
+	r.Counter("job:requests_total", "", "le")
+}
@@ -0,0 +1,473 @@
+// Package redact masks secrets and other sensitive values in the Terraform files of an export, so the
+// export can be kept in shared repositories and build artifacts. Sensitive attributes are found by name
+// rules and value patterns and replaced with references to new sensitive variables or placeholders,
+// keeping the formatting of the files.
+package redact
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/hashicorp/hcl/v2/hclwrite"
+	"github.com/ren3gadem4rm0t/imperva-export-cli/internal/archive"
+	"github.com/ren3gadem4rm0t/imperva-export-cli/internal/terraform"
+	"github.com/zclconf/go-cty/cty"
+)
+
+// Modes of replacing a sensitive value
+const (
+	// ModeVariable replaces the value with a reference to a new sensitive variable
+	ModeVariable string = "variable"
+	// ModePlaceholder replaces the value with the Placeholder string
+	ModePlaceholder string = "placeholder"
+)
+
+// Placeholder replaces sensitive values in placeholder mode and where variables cannot be referenced
+const Placeholder string = "REDACTED"
+
+// VariablesFile declares the variables that replace sensitive values. It is added to every directory
+// of the archive with a redacted file.
+const VariablesFile string = "redacted_variables.tf"
+
+// ReportSuffix is appended to the archive path to name its sidecar redaction report
+const ReportSuffix string = ".redaction.json"
+
+// variablePrefix starts the names of the variables declared in VariablesFile, so they do not clash with
+// variables of the export
+const variablePrefix string = "redacted_"
+
+// Rule identifies sensitive values by the name of their attribute or by their value
+type Rule struct {
+	Name string
+	// Attribute matches the names of sensitive attributes
+	Attribute *regexp.Regexp
+	// Value matches the source of sensitive values, whatever their attribute is called
+	Value *regexp.Regexp
+}
+
+// matches reports whether the attribute with the given name and value source is sensitive
+func (r Rule) matches(name string, value []byte) bool {
+	return (r.Attribute != nil && r.Attribute.MatchString(name)) || (r.Value != nil && r.Value.Match(value))
+}
+
+// DefaultRules returns the rules used when none are configured: passwords, secrets and keys, tokens and
+// certificates by attribute name, and PEM blocks and JSON web tokens by value
+func DefaultRules() []Rule {
+	return []Rule{
+		{Name: "password", Attribute: regexp.MustCompile(`(?i)^(.*_)?(password|passwd|passphrase)$`)},
+		{Name: "secret", Attribute: regexp.MustCompile(`(?i)^(.*_)?(secret|secret_key|access_key|private_key|api_key)$`)},
+		{Name: "token", Attribute: regexp.MustCompile(`(?i)^(.*_)?token$`)},
+		{Name: "certificate", Attribute: regexp.MustCompile(`(?i)^(.*_)?(certificate|cert)$`)},
+		{Name: "pem", Value: regexp.MustCompile(`-----BEGIN [A-Z0-9 ]+-----`)},
+		{Name: "jwt", Value: regexp.MustCompile(`eyJ[A-Za-z0-9_-]+\.eyJ[A-Za-z0-9_-]+\.[A-Za-z0-9_-]+`)},
+	}
+}
+
+// AttributeRule returns a rule matching attribute names with the regular expression
+func AttributeRule(expr string) (Rule, error) {
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return Rule{}, fmt.Errorf("invalid attribute rule %q: %w", expr, err)
+	}
+	return Rule{Name: "attribute:" + expr, Attribute: re}, nil
+}
+
+// ValueRule returns a rule matching values with the regular expression
+func ValueRule(expr string) (Rule, error) {
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return Rule{}, fmt.Errorf("invalid value pattern %q: %w", expr, err)
+	}
+	return Rule{Name: "pattern:" + expr, Value: re}, nil
+}
+
+// Options controls the redaction
+type Options struct {
+	// Mode is ModeVariable or ModePlaceholder
+	Mode  string
+	Rules []Rule
+}
+
+// Finding is a sensitive value that was replaced. The value itself is never reported.
+type Finding struct {
+	File        string `json:"file" yaml:"file"`
+	Line        int    `json:"line" yaml:"line"`
+	Address     string `json:"address" yaml:"address"`
+	Attribute   string `json:"attribute" yaml:"attribute"`
+	Rule        string `json:"rule" yaml:"rule"`
+	Replacement string `json:"replacement" yaml:"replacement"`
+}
+
+// Report lists the values masked by a redaction
+type Report struct {
+	Mode string `json:"mode" yaml:"mode"`
+	// Files is the number of Terraform files scanned
+	Files    int       `json:"files" yaml:"files"`
+	Findings []Finding `json:"findings" yaml:"findings"`
+	// Variables are the files declaring the variables that replace sensitive values
+	Variables []string `json:"variables,omitempty" yaml:"variables,omitempty"`
+}
+
+// variable is a variable declared in place of a sensitive value
+type variable struct {
+	name   string
+	source string
+}
+
+// Redactor masks the sensitive values of the Terraform files of a single export
+type Redactor struct {
+	opts   Options
+	report Report
+	// variables are the declared variables by the directory of the files that reference them
+	variables map[string][]variable
+	names     map[string]bool
+}
+
+// New returns a redactor for the options
+func New(opts Options) (*Redactor, error) {
+	if opts.Mode == "" {
+		opts.Mode = ModeVariable
+	}
+	if opts.Mode != ModeVariable && opts.Mode != ModePlaceholder {
+		return nil, fmt.Errorf("invalid redaction mode: %q (must be %s or %s)", opts.Mode, ModeVariable, ModePlaceholder)
+	}
+	return &Redactor{
+		opts:      opts,
+		report:    Report{Mode: opts.Mode, Findings: []Finding{}},
+		variables: map[string][]variable{},
+		names:     map[string]bool{},
+	}, nil
+}
+
+// Report returns the report of the files redacted so far
+func (r *Redactor) Report() *Report {
+	report := r.report
+	for dir := range r.variables {
+		report.Variables = append(report.Variables, path.Join(dir, VariablesFile))
+	}
+	sort.Strings(report.Variables)
+	return &report
+}
+
+// File redacts a Terraform file. Data is returned unchanged if nothing in it is sensitive.
+func (r *Redactor) File(name string, data []byte) ([]byte, error) {
+	syntaxFile, diags := hclsyntax.ParseConfig(data, name, hcl.InitialPos)
+	if diags.HasErrors() {
+		return nil, fmt.Errorf("failed to parse %s: %s", name, diags.Error())
+	}
+	syntaxBody, ok := syntaxFile.Body.(*hclsyntax.Body)
+	if !ok {
+		return nil, fmt.Errorf("failed to parse %s: unexpected body type", name)
+	}
+	writeFile, diags := hclwrite.ParseConfig(data, name, hcl.InitialPos)
+	if diags.HasErrors() {
+		return nil, fmt.Errorf("failed to parse %s: %s", name, diags.Error())
+	}
+
+	r.report.Files++
+	found := len(r.report.Findings)
+	blocks := writeFile.Body().Blocks()
+	if len(blocks) != len(syntaxBody.Blocks) {
+		return nil, fmt.Errorf("failed to parse %s: inconsistent blocks", name)
+	}
+	for i, block := range syntaxBody.Blocks {
+		b := &terraform.Block{Kind: block.Type, Labels: block.Labels}
+		// Variables cannot be referenced in variable declarations and the terraform block
+		placeholder := block.Type == terraform.KindVariable || block.Type == terraform.KindTerraform
+		err := r.body(name, b.Address(), "", block.Body, blocks[i].Body(), data, placeholder)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if len(r.report.Findings) == found {
+		return data, nil
+	}
+	return writeFile.Bytes(), nil
+}
+
+// body redacts the attributes of a block body and its nested blocks. Nested blocks are addressed by
+// type and index, e.g. rule[0].password, and the items of objects by key, e.g. credentials.password.
+func (r *Redactor) body(file, address, prefix string, body *hclsyntax.Body, writeBody *hclwrite.Body, src []byte, placeholder bool) error {
+	names := make([]string, 0, len(body.Attributes))
+	for name := range body.Attributes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		attr := body.Attributes[name]
+		found := r.sensitive(name, prefix+name, attr.Expr, src)
+		if len(found) == 0 {
+			continue
+		}
+
+		replacements := make([]string, len(found))
+		for i, f := range found {
+			finding := Finding{
+				File:      file,
+				Line:      f.rng.Start.Line,
+				Address:   address,
+				Attribute: f.attribute,
+				Rule:      f.rule.Name,
+			}
+			if len(found) == 1 && f.rng == attr.Expr.Range() {
+				finding.Line = attr.SrcRange.Start.Line
+			}
+			if placeholder || r.opts.Mode == ModePlaceholder {
+				finding.Replacement = strconv.Quote(Placeholder)
+			} else {
+				finding.Replacement = "var." + r.declare(path.Dir(file), address+"."+f.attribute)
+			}
+			replacements[i] = finding.Replacement
+			r.report.Findings = append(r.report.Findings, finding)
+		}
+
+		// Sensitive values nested in the expression are replaced in its source, keeping the rest of it
+		expr := attr.Expr.Range()
+		value := expr.SliceBytes(src)
+		for i := len(found) - 1; i >= 0; i-- {
+			start, end := found[i].rng.Start.Byte-expr.Start.Byte, found[i].rng.End.Byte-expr.Start.Byte
+			value = append(append(append([]byte{}, value[:start]...), replacements[i]...), value[end:]...)
+		}
+		tokens, err := expressionTokens(value)
+		if err != nil {
+			return fmt.Errorf("failed to redact %s.%s in %s: %w", address, prefix+name, file, err)
+		}
+		writeBody.SetAttributeRaw(name, tokens)
+	}
+
+	writeBlocks := writeBody.Blocks()
+	if len(writeBlocks) != len(body.Blocks) {
+		return fmt.Errorf("failed to parse %s: inconsistent blocks in %s", file, address)
+	}
+	counts := map[string]int{}
+	for i, block := range body.Blocks {
+		nested := fmt.Sprintf("%s%s[%d].", prefix, block.Type, counts[block.Type])
+		counts[block.Type]++
+		if err := r.body(file, address, nested, block.Body, writeBlocks[i].Body(), src, placeholder); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// sensitiveValue is a sensitive value in the expression of an attribute
+type sensitiveValue struct {
+	rng hcl.Range
+	// attribute is the path of the value, e.g. credentials.password
+	attribute string
+	rule      Rule
+}
+
+// sensitive returns the sensitive values of an expression, in source order. A literal value matching a
+// rule is sensitive as a whole. References to variables and other objects are not literal values, but the
+// literal parts of a template that interpolates them are matched with the value rules, and the items of
+// objects, maps and tuples are searched in turn.
+func (r *Redactor) sensitive(name, attribute string, expr hclsyntax.Expression, src []byte) []sensitiveValue {
+	whole := func(rule Rule) []sensitiveValue {
+		return []sensitiveValue{{rng: expr.Range(), attribute: attribute, rule: rule}}
+	}
+	if len(expr.Variables()) == 0 {
+		if rule, ok := r.match(name, expr.Range().SliceBytes(src)); ok {
+			return whole(rule)
+		}
+	}
+
+	var found []sensitiveValue
+	switch e := expr.(type) {
+	case *hclsyntax.TemplateExpr:
+		for _, part := range e.Parts {
+			if _, literal := part.(*hclsyntax.LiteralValueExpr); !literal {
+				continue
+			}
+			if rule, ok := r.matchValue(part.Range().SliceBytes(src)); ok {
+				return whole(rule)
+			}
+		}
+	case *hclsyntax.ObjectConsExpr:
+		for _, item := range e.Items {
+			key, diags := item.KeyExpr.Value(nil)
+			if diags.HasErrors() || !key.IsKnown() || key.IsNull() || key.Type() != cty.String {
+				continue
+			}
+			found = append(found, r.sensitive(key.AsString(), attribute+"."+key.AsString(), item.ValueExpr, src)...)
+		}
+	case *hclsyntax.TupleConsExpr:
+		for i, item := range e.Exprs {
+			found = append(found, r.sensitive(name, fmt.Sprintf("%s[%d]", attribute, i), item, src)...)
+		}
+	}
+	return found
+}
+
+// match returns the first rule matching the attribute
+func (r *Redactor) match(name string, value []byte) (Rule, bool) {
+	for _, rule := range r.opts.Rules {
+		if rule.matches(name, value) {
+			return rule, true
+		}
+	}
+	return Rule{}, false
+}
+
+// matchValue returns the first value rule matching the value
+func (r *Redactor) matchValue(value []byte) (Rule, bool) {
+	for _, rule := range r.opts.Rules {
+		if rule.Value != nil && rule.Value.Match(value) {
+			return rule, true
+		}
+	}
+	return Rule{}, false
+}
+
+// expressionTokens returns the tokens of the expression source
+func expressionTokens(expr []byte) (hclwrite.Tokens, error) {
+	file, diags := hclwrite.ParseConfig(append([]byte("value = "), expr...), "", hcl.InitialPos)
+	if diags.HasErrors() {
+		return nil, errors.New(diags.Error())
+	}
+	attr := file.Body().GetAttribute("value")
+	if attr == nil {
+		return nil, errors.New("not a single expression")
+	}
+	return attr.Expr().BuildTokens(nil), nil
+}
+
+// nonIdentifier matches the characters that are not allowed in variable names
+var nonIdentifier = regexp.MustCompile(`[^a-z0-9_]+`)
+
+// declare declares a variable for the sensitive value at source, referenced from the files in dir, and
+// returns its name
+func (r *Redactor) declare(dir, source string) string {
+	base := variablePrefix + strings.Trim(nonIdentifier.ReplaceAllString(strings.ToLower(source), "_"), "_")
+	name := base
+	for i := 2; r.names[name]; i++ {
+		name = fmt.Sprintf("%s_%d", base, i)
+	}
+	r.names[name] = true
+	r.variables[dir] = append(r.variables[dir], variable{name: name, source: source})
+	return name
+}
+
+// VariablesFiles returns the content of the VariablesFile of every directory with a redacted file,
+// keyed by its path. It is empty in placeholder mode.
+func (r *Redactor) VariablesFiles() map[string][]byte {
+	files := map[string][]byte{}
+	for dir, variables := range r.variables {
+		file := hclwrite.NewEmptyFile()
+		body := file.Body()
+		for i, v := range variables {
+			if i > 0 {
+				body.AppendNewline()
+			}
+			block := body.AppendNewBlock(terraform.KindVariable, []string{v.name})
+			block.Body().SetAttributeValue("description", cty.StringVal("Redacted value of "+v.source))
+			block.Body().SetAttributeValue("sensitive", cty.True)
+		}
+		files[path.Join(dir, VariablesFile)] = file.Bytes()
+	}
+	return files
+}
+
+// Archive writes a copy of the export archive at src to w with every Terraform file redacted and the
+// variables files added. Other files are copied unchanged.
+func Archive(src string, w io.Writer, opts Options) (*Report, error) {
+	redactor, err := New(opts)
+	if err != nil {
+		return nil, err
+	}
+	reader, err := zip.OpenReader(src)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open archive %s: %w", src, err)
+	}
+	defer reader.Close()
+
+	zw := zip.NewWriter(w)
+	names := map[string]bool{}
+	for _, f := range reader.File {
+		names[f.Name] = true
+		if f.FileInfo().IsDir() || !terraform.IsTerraformFile(f.Name) {
+			if err := zw.Copy(f); err != nil {
+				return nil, fmt.Errorf("failed to copy archive entry %s: %w", f.Name, err)
+			}
+			continue
+		}
+
+		data, err := archive.ReadEntry(f)
+		if err != nil {
+			return nil, err
+		}
+		redacted, err := redactor.File(f.Name, data)
+		if err != nil {
+			return nil, err
+		}
+		header := &zip.FileHeader{Name: f.Name, Method: f.Method, Modified: f.Modified}
+		header.SetMode(f.Mode())
+		if err := writeEntry(zw, header, redacted); err != nil {
+			return nil, err
+		}
+	}
+
+	variables := redactor.VariablesFiles()
+	files := make([]string, 0, len(variables))
+	for name := range variables {
+		files = append(files, name)
+	}
+	sort.Strings(files)
+	for _, name := range files {
+		if names[name] {
+			return nil, fmt.Errorf("archive already contains %s", name)
+		}
+		header := &zip.FileHeader{Name: name, Method: zip.Deflate, Modified: time.Now()}
+		if err := writeEntry(zw, header, variables[name]); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := zw.Close(); err != nil {
+		return nil, fmt.Errorf("failed to write archive: %w", err)
+	}
+	return redactor.Report(), nil
+}
+
+// writeEntry adds a file to the archive
+func writeEntry(zw *zip.Writer, header *zip.FileHeader, data []byte) error {
+	w, err := zw.CreateHeader(header)
+	if err != nil {
+		return fmt.Errorf("failed to create archive entry %s: %w", header.Name, err)
+	}
+	if _, err := w.Write(data); err != nil {
+		return fmt.Errorf("failed to write archive entry %s: %w", header.Name, err)
+	}
+	return nil
+}
+
+// WriteReport writes the report as JSON to path
+func WriteReport(path string, report *Report) error {
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode redaction report: %w", err)
+	}
+	tempPath := path + ".tmp"
+	if err := os.WriteFile(tempPath, append(data, '\n'), 0600); err != nil {
+		return fmt.Errorf("failed to write redaction report: %w", err)
+	}
+	if err := os.Rename(tempPath, path); err != nil {
+		_ = os.Remove(tempPath)
+		return fmt.Errorf("failed to rename redaction report: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,87 @@
+// Package retention decides which of a series of export files to keep.
+package retention
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// Policy keeps the newest KeepLast files and the newest file of each of the last KeepDaily days,
+// KeepWeekly ISO weeks and KeepMonthly months that have files. A file kept by any rule is kept.
+// The zero Policy keeps everything.
+type Policy struct {
+	KeepLast    int
+	KeepDaily   int
+	KeepWeekly  int
+	KeepMonthly int
+}
+
+// IsZero reports whether the policy keeps every file
+func (p Policy) IsZero() bool {
+	return p == Policy{}
+}
+
+// Validate checks that no rule is negative
+func (p Policy) Validate() error {
+	if p.KeepLast < 0 || p.KeepDaily < 0 || p.KeepWeekly < 0 || p.KeepMonthly < 0 {
+		return fmt.Errorf("invalid retention policy: keep counts must not be negative")
+	}
+	return nil
+}
+
+// Item is a file subject to the policy
+type Item struct {
+	Path string
+	Time time.Time
+}
+
+// rule keeps the newest item of each of the first count distinct buckets
+type rule struct {
+	count  int
+	bucket func(i int, t time.Time) string
+}
+
+// Apply splits the items into the ones to keep and the ones to remove, both newest first
+func Apply(items []Item, p Policy) (keep, remove []Item) {
+	sorted := make([]Item, len(items))
+	copy(sorted, items)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].Time.After(sorted[j].Time) })
+	if p.IsZero() {
+		return sorted, nil
+	}
+
+	rules := []*rule{
+		// every item is its own bucket, even two with the same timestamp
+		{count: p.KeepLast, bucket: func(i int, _ time.Time) string { return fmt.Sprint(i) }},
+		{count: p.KeepDaily, bucket: func(_ int, t time.Time) string { return t.Format("2006-01-02") }},
+		{count: p.KeepWeekly, bucket: func(_ int, t time.Time) string {
+			year, week := t.ISOWeek()
+			return fmt.Sprintf("%d-W%02d", year, week)
+		}},
+		{count: p.KeepMonthly, bucket: func(_ int, t time.Time) string { return t.Format("2006-01") }},
+	}
+	last := make([]string, len(rules))
+
+	for i, item := range sorted {
+		kept := false
+		for r, rl := range rules {
+			if rl.count == 0 {
+				continue
+			}
+			key := rl.bucket(i, item.Time)
+			if key == last[r] {
+				continue
+			}
+			last[r] = key
+			rl.count--
+			kept = true
+		}
+		if kept {
+			keep = append(keep, item)
+		} else {
+			remove = append(remove, item)
+		}
+	}
+	return keep, remove
+}
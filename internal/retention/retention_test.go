@@ -0,0 +1,100 @@
+package retention
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func paths(items []Item) []string {
+	var out []string
+	for _, item := range items {
+		out = append(out, item.Path)
+	}
+	return out
+}
+
+// dailyItems returns one item per day at noon, the newest first, named by date
+func dailyItems(start time.Time, days int) []Item {
+	items := make([]Item, 0, days)
+	for i := 0; i < days; i++ {
+		t := start.AddDate(0, 0, -i)
+		items = append(items, Item{Path: t.Format("2006-01-02"), Time: t})
+	}
+	return items
+}
+
+func TestApply(t *testing.T) {
+	// Wednesday 2024-07-31
+	start := time.Date(2024, 7, 31, 12, 0, 0, 0, time.UTC)
+	items := dailyItems(start, 70)
+
+	tests := []struct {
+		name   string
+		policy Policy
+		want   []string
+	}{
+		{
+			name:   "keep last",
+			policy: Policy{KeepLast: 2},
+			want:   []string{"2024-07-31", "2024-07-30"},
+		},
+		{
+			name:   "keep weekly",
+			policy: Policy{KeepWeekly: 3},
+			want:   []string{"2024-07-31", "2024-07-28", "2024-07-21"},
+		},
+		{
+			name:   "keep monthly",
+			policy: Policy{KeepMonthly: 3},
+			want:   []string{"2024-07-31", "2024-06-30", "2024-05-31"},
+		},
+		{
+			name:   "combined",
+			policy: Policy{KeepDaily: 2, KeepWeekly: 2, KeepMonthly: 2},
+			want:   []string{"2024-07-31", "2024-07-30", "2024-07-28", "2024-06-30"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			keep, remove := Apply(items, tt.policy)
+			if got := paths(keep); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Apply() keep = %v, want %v", got, tt.want)
+			}
+			if len(keep)+len(remove) != len(items) {
+				t.Errorf("Apply() kept %d and removed %d of %d items", len(keep), len(remove), len(items))
+			}
+		})
+	}
+}
+
+func TestApply_SameDay(t *testing.T) {
+	day := time.Date(2024, 7, 31, 0, 0, 0, 0, time.UTC)
+	items := []Item{
+		{Path: "morning", Time: day.Add(6 * time.Hour)},
+		{Path: "evening", Time: day.Add(18 * time.Hour)},
+		{Path: "noon", Time: day.Add(12 * time.Hour)},
+	}
+
+	keep, remove := Apply(items, Policy{KeepDaily: 7})
+	if !reflect.DeepEqual(paths(keep), []string{"evening"}) || !reflect.DeepEqual(paths(remove), []string{"noon", "morning"}) {
+		t.Errorf("Apply() keep = %v, remove = %v", paths(keep), paths(remove))
+	}
+}
+
+func TestApply_ZeroPolicy(t *testing.T) {
+	items := dailyItems(time.Now(), 5)
+	keep, remove := Apply(items, Policy{})
+	if len(keep) != 5 || len(remove) != 0 {
+		t.Errorf("Apply() with zero policy kept %d and removed %d", len(keep), len(remove))
+	}
+}
+
+func TestPolicy_Validate(t *testing.T) {
+	if err := (Policy{KeepLast: 1}).Validate(); err != nil {
+		t.Errorf("Validate() error = %v", err)
+	}
+	if err := (Policy{KeepWeekly: -1}).Validate(); err == nil {
+		t.Error("Validate() should reject negative counts")
+	}
+}
@@ -0,0 +1,220 @@
+// Package s3 uploads exports to Amazon S3 and S3-compatible object storage such as MinIO, Ceph or
+// Cloudflare R2. Requests are signed with AWS Signature Version 4, and large objects are streamed in
+// multipart uploads so no more than one part is held in memory.
+package s3
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Server-side encryption modes
+const (
+	SSENone   string = ""
+	SSES3     string = "AES256"
+	SSEKMS    string = "aws:kms"
+	sseHeader string = "X-Amz-Server-Side-Encryption"
+	kmsHeader string = "X-Amz-Server-Side-Encryption-Aws-Kms-Key-Id"
+)
+
+// Part sizes of multipart uploads. Every part but the last must be at least MinPartSize bytes.
+const (
+	MinPartSize     int64 = 5 << 20
+	DefaultPartSize int64 = 8 << 20
+	maxParts        int   = 10000
+)
+
+// DefaultRegion is the region used when none is configured
+const DefaultRegion string = "us-east-1"
+
+// Config configures the connection to a bucket
+type Config struct {
+	// Endpoint is the URL of an S3-compatible service. Buckets are addressed in the path of the URL
+	// (https://endpoint/bucket/key). Without an endpoint, the AWS endpoint of the region is used with
+	// virtual-hosted addressing (https://bucket.s3.region.amazonaws.com/key).
+	Endpoint string
+	Region   string
+	Bucket   string
+	Credentials
+	// SSE is the server-side encryption of uploaded objects: SSENone, SSES3 or SSEKMS
+	SSE string
+	// SSEKMSKeyID is the KMS key of SSEKMS; the default is the AWS managed key of the bucket
+	SSEKMSKeyID string
+	// PartSize is the size of the parts of a multipart upload (default DefaultPartSize)
+	PartSize int64
+	// HTTPClient sends the requests (default http.DefaultClient)
+	HTTPClient *http.Client
+}
+
+// Client uploads objects to a bucket
+type Client struct {
+	cfg  Config
+	base *url.URL
+	now  func() time.Time
+}
+
+// Error is an error response of the object storage
+type Error struct {
+	StatusCode int    `xml:"-"`
+	Code       string `xml:"Code"`
+	Message    string `xml:"Message"`
+	RequestID  string `xml:"RequestId"`
+}
+
+func (e *Error) Error() string {
+	if e.Code == "" {
+		return fmt.Sprintf("object storage returned status %d", e.StatusCode)
+	}
+	return fmt.Sprintf("object storage returned status %d: %s: %s", e.StatusCode, e.Code, e.Message)
+}
+
+// New returns a client of the bucket of the configuration
+func New(cfg Config) (*Client, error) {
+	if cfg.Bucket == "" {
+		return nil, errors.New("bucket must be set")
+	}
+	if cfg.Region == "" {
+		cfg.Region = DefaultRegion
+	}
+	if cfg.PartSize == 0 {
+		cfg.PartSize = DefaultPartSize
+	}
+	if cfg.PartSize < MinPartSize {
+		return nil, fmt.Errorf("part size must be at least %d bytes", MinPartSize)
+	}
+	switch cfg.SSE {
+	case SSENone, SSES3:
+		if cfg.SSEKMSKeyID != "" {
+			return nil, fmt.Errorf("a KMS key requires server-side encryption %s", SSEKMS)
+		}
+	case SSEKMS:
+	default:
+		return nil, fmt.Errorf("invalid server-side encryption %q (must be %s or %s)", cfg.SSE, SSES3, SSEKMS)
+	}
+	if cfg.AccessKeyID == "" || cfg.SecretAccessKey == "" {
+		return nil, errors.New("access key ID and secret access key must be set")
+	}
+	if cfg.HTTPClient == nil {
+		cfg.HTTPClient = http.DefaultClient
+	}
+
+	var base *url.URL
+	if cfg.Endpoint == "" {
+		base = &url.URL{Scheme: "https", Host: cfg.Bucket + ".s3." + cfg.Region + ".amazonaws.com", Path: "/"}
+	} else {
+		endpoint, err := url.Parse(cfg.Endpoint)
+		if err != nil || (endpoint.Scheme != "http" && endpoint.Scheme != "https") || endpoint.Host == "" {
+			return nil, fmt.Errorf("invalid endpoint %q: must be an http or https URL", cfg.Endpoint)
+		}
+		base = &url.URL{Scheme: endpoint.Scheme, Host: endpoint.Host,
+			Path: strings.TrimSuffix(endpoint.Path, "/") + "/" + cfg.Bucket + "/"}
+	}
+	return &Client{cfg: cfg, base: base, now: time.Now}, nil
+}
+
+// URL returns the s3:// URL of the object with the key
+func (c *Client) URL(key string) string {
+	return "s3://" + c.cfg.Bucket + "/" + key
+}
+
+// PutObject uploads data as the object with the key in a single request
+func (c *Client) PutObject(ctx context.Context, key, contentType string, data []byte) error {
+	header := c.sseHeader()
+	header.Set("Content-Type", contentType)
+	resp, err := c.do(ctx, http.MethodPut, key, nil, header, data)
+	if err != nil {
+		return fmt.Errorf("failed to upload %s: %w", c.URL(key), err)
+	}
+	return resp.Body.Close()
+}
+
+// sseHeader returns the headers requesting the server-side encryption of a new object
+func (c *Client) sseHeader() http.Header {
+	header := http.Header{}
+	if c.cfg.SSE != SSENone {
+		header.Set(sseHeader, c.cfg.SSE)
+	}
+	if c.cfg.SSEKMSKeyID != "" {
+		header.Set(kmsHeader, c.cfg.SSEKMSKeyID)
+	}
+	return header
+}
+
+// do sends a signed request for the object with the key and returns the response if it succeeded. The
+// caller closes the body of the response.
+func (c *Client) do(ctx context.Context, method, key string, query url.Values, header http.Header, body []byte) (*http.Response, error) {
+	u := *c.base
+	u.Path += key
+	u.RawPath = encodePath(u.Path)
+	u.RawQuery = query.Encode()
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	payloadHash := emptyPayloadHash
+	if len(body) > 0 {
+		payloadHash = hashHex(body)
+	}
+	sign(req, c.cfg.Credentials, c.cfg.Region, payloadHash, c.now())
+
+	resp, err := c.cfg.HTTPClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= 300 {
+		defer resp.Body.Close()
+		return nil, parseError(resp)
+	}
+	return resp, nil
+}
+
+// parseError returns the error of an error response
+func parseError(resp *http.Response) error {
+	apiErr := &Error{StatusCode: resp.StatusCode}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	if err == nil && len(data) > 0 {
+		_ = xml.Unmarshal(data, apiErr)
+	}
+	return apiErr
+}
+
+// ExpandKey replaces the {name} placeholders of the key template with their values, e.g.
+// "{caid}/{date}/{file}". A placeholder without a value is an error.
+func ExpandKey(template string, values map[string]string) (string, error) {
+	var b strings.Builder
+	rest := template
+	for {
+		start := strings.IndexByte(rest, '{')
+		if start < 0 {
+			b.WriteString(rest)
+			break
+		}
+		end := strings.IndexByte(rest[start:], '}')
+		if end < 0 {
+			return "", fmt.Errorf("invalid key template %q: unclosed placeholder", template)
+		}
+		name := rest[start+1 : start+end]
+		value, ok := values[name]
+		if !ok {
+			return "", fmt.Errorf("invalid key template %q: unknown placeholder {%s}", template, name)
+		}
+		b.WriteString(rest[:start] + value)
+		rest = rest[start+end+1:]
+	}
+	key := b.String()
+	if key == "" || strings.HasPrefix(key, "/") {
+		return "", fmt.Errorf("invalid key template %q: key %q must not be empty or start with /", template, key)
+	}
+	return key, nil
+}
@@ -0,0 +1,242 @@
+// Package s3test implements an in-memory stand-in for S3-compatible object storage, like a local MinIO,
+// for tests of uploads. Buckets are addressed in the path and created on first use. The server checks the
+// access key and the payload hash of signed requests and enforces the minimum part size of multipart uploads.
+package s3test
+
+import (
+	"crypto/md5" // #nosec G501 -- ETags of S3 are MD5 checksums
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// minPartSize is the minimum size of every part of a multipart upload but the last
+const minPartSize int64 = 5 << 20
+
+// Object is an object stored by the server
+type Object struct {
+	Data        []byte
+	ContentType string
+	// SSE and SSEKMSKeyID are the server-side encryption requested for the object
+	SSE         string
+	SSEKMSKeyID string
+	// Parts is the number of parts of a multipart upload, or 0 for a single request
+	Parts int
+}
+
+// multipartUpload is a multipart upload in progress
+type multipartUpload struct {
+	object *Object
+	key    string
+	parts  map[int][]byte
+}
+
+// Server is an in-memory object storage. It implements http.Handler.
+type Server struct {
+	accessKeyID string
+
+	mu       sync.Mutex
+	objects  map[string]*Object
+	uploads  map[string]*multipartUpload
+	uploadID int
+	failures int
+}
+
+// New returns a server accepting requests signed with the access key ID
+func New(accessKeyID string) *Server {
+	return &Server{
+		accessKeyID: accessKeyID,
+		objects:     map[string]*Object{},
+		uploads:     map[string]*multipartUpload{},
+	}
+}
+
+// Object returns the object with the key in the bucket
+func (s *Server) Object(bucket, key string) (*Object, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	object, ok := s.objects[bucket+"/"+key]
+	return object, ok
+}
+
+// Keys returns the sorted keys of the objects in the bucket
+func (s *Server) Keys(bucket string) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var keys []string
+	for name := range s.objects {
+		if key, ok := strings.CutPrefix(name, bucket+"/"); ok {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// PendingUploads returns the number of multipart uploads that were neither completed nor aborted
+func (s *Server) PendingUploads() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.uploads)
+}
+
+// FailRequests makes the next n requests that upload data fail with status 500
+func (s *Server) FailRequests(n int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failures = n
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "IncompleteBody", err.Error())
+		return
+	}
+	if !strings.Contains(r.Header.Get("Authorization"), "Credential="+s.accessKeyID+"/") {
+		writeError(w, http.StatusForbidden, "InvalidAccessKeyId", "The access key ID does not exist")
+		return
+	}
+	if sum := sha256.Sum256(body); r.Header.Get("X-Amz-Content-Sha256") != hex.EncodeToString(sum[:]) {
+		writeError(w, http.StatusBadRequest, "XAmzContentSHA256Mismatch", "The payload hash does not match")
+		return
+	}
+	bucket, key, ok := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	if !ok || bucket == "" || key == "" {
+		writeError(w, http.StatusBadRequest, "InvalidRequest", "Requests must address an object in a bucket")
+		return
+	}
+	name := bucket + "/" + key
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.failures > 0 && r.Method != http.MethodDelete && r.Method != http.MethodGet {
+		s.failures--
+		writeError(w, http.StatusInternalServerError, "InternalError", "Injected failure")
+		return
+	}
+
+	query := r.URL.Query()
+	uploadID := query.Get("uploadId")
+	switch {
+	case r.Method == http.MethodGet:
+		object, ok := s.objects[name]
+		if !ok {
+			writeError(w, http.StatusNotFound, "NoSuchKey", "The specified key does not exist")
+			return
+		}
+		w.Header().Set("Content-Type", object.ContentType)
+		_, _ = w.Write(object.Data)
+	case r.Method == http.MethodPut && uploadID == "":
+		s.objects[name] = newObject(r, body)
+		w.Header().Set("ETag", etag(body))
+	case r.Method == http.MethodPost && query.Has("uploads"):
+		s.uploadID++
+		id := strconv.Itoa(s.uploadID)
+		s.uploads[id] = &multipartUpload{object: newObject(r, nil), key: name, parts: map[int][]byte{}}
+		writeXML(w, struct {
+			XMLName  xml.Name `xml:"InitiateMultipartUploadResult"`
+			Bucket   string   `xml:"Bucket"`
+			Key      string   `xml:"Key"`
+			UploadID string   `xml:"UploadId"`
+		}{Bucket: bucket, Key: key, UploadID: id})
+	case r.Method == http.MethodPut:
+		upload, ok := s.uploads[uploadID]
+		number, err := strconv.Atoi(query.Get("partNumber"))
+		if !ok || upload.key != name || err != nil || number < 1 {
+			writeError(w, http.StatusNotFound, "NoSuchUpload", "The specified upload does not exist")
+			return
+		}
+		upload.parts[number] = body
+		w.Header().Set("ETag", etag(body))
+	case r.Method == http.MethodPost:
+		s.complete(w, name, uploadID, body)
+	case r.Method == http.MethodDelete:
+		if upload, ok := s.uploads[uploadID]; !ok || upload.key != name {
+			writeError(w, http.StatusNotFound, "NoSuchUpload", "The specified upload does not exist")
+			return
+		}
+		delete(s.uploads, uploadID)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "MethodNotAllowed", "The method is not allowed")
+	}
+}
+
+// complete assembles the parts of a multipart upload into the object
+func (s *Server) complete(w http.ResponseWriter, name, uploadID string, body []byte) {
+	upload, ok := s.uploads[uploadID]
+	if !ok || upload.key != name {
+		writeError(w, http.StatusNotFound, "NoSuchUpload", "The specified upload does not exist")
+		return
+	}
+	var request struct {
+		Parts []struct {
+			PartNumber int    `xml:"PartNumber"`
+			ETag       string `xml:"ETag"`
+		} `xml:"Part"`
+	}
+	if err := xml.Unmarshal(body, &request); err != nil || len(request.Parts) == 0 {
+		writeError(w, http.StatusBadRequest, "MalformedXML", "The XML is not well-formed")
+		return
+	}
+	var data []byte
+	for i, part := range request.Parts {
+		content, ok := upload.parts[part.PartNumber]
+		if !ok || part.PartNumber != i+1 || etag(content) != part.ETag {
+			writeError(w, http.StatusBadRequest, "InvalidPart", fmt.Sprintf("Part %d is invalid", part.PartNumber))
+			return
+		}
+		if i < len(request.Parts)-1 && int64(len(content)) < minPartSize {
+			writeError(w, http.StatusBadRequest, "EntityTooSmall", "A part is smaller than the minimum part size")
+			return
+		}
+		data = append(data, content...)
+	}
+
+	upload.object.Data = data
+	upload.object.Parts = len(request.Parts)
+	s.objects[name] = upload.object
+	delete(s.uploads, uploadID)
+	writeXML(w, struct {
+		XMLName xml.Name `xml:"CompleteMultipartUploadResult"`
+		Key     string   `xml:"Key"`
+		ETag    string   `xml:"ETag"`
+	}{Key: name, ETag: etag(data)})
+}
+
+func newObject(r *http.Request, data []byte) *Object {
+	return &Object{
+		Data:        data,
+		ContentType: r.Header.Get("Content-Type"),
+		SSE:         r.Header.Get("X-Amz-Server-Side-Encryption"),
+		SSEKMSKeyID: r.Header.Get("X-Amz-Server-Side-Encryption-Aws-Kms-Key-Id"),
+	}
+}
+
+func etag(data []byte) string {
+	sum := md5.Sum(data) // #nosec G401 -- ETags of S3 are MD5 checksums
+	return `"` + hex.EncodeToString(sum[:]) + `"`
+}
+
+func writeXML(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/xml")
+	_ = xml.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, code, message string) {
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(status)
+	_ = xml.NewEncoder(w).Encode(struct {
+		XMLName xml.Name `xml:"Error"`
+		Code    string   `xml:"Code"`
+		Message string   `xml:"Message"`
+	}{Code: code, Message: message})
+}
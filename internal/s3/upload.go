@@ -0,0 +1,173 @@
+package s3
+
+import (
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+// Upload streams an object to the bucket. Written bytes are buffered until a part is full and then sent
+// in a multipart upload, so at most one part is held in memory. The object only appears in the bucket
+// once the upload is committed; an aborted upload leaves nothing behind. An object smaller than one part
+// is sent in a single request on commit.
+type Upload struct {
+	client      *Client
+	ctx         context.Context
+	key         string
+	contentType string
+	buf         []byte
+	uploadID    string
+	parts       []completedPart
+	err         error
+	done        bool
+}
+
+// completedPart identifies an uploaded part when the multipart upload is completed
+type completedPart struct {
+	PartNumber int    `xml:"PartNumber"`
+	ETag       string `xml:"ETag"`
+}
+
+// NewUpload starts the upload of an object with the key. Nothing is sent before the first part is full.
+func (c *Client) NewUpload(ctx context.Context, key, contentType string) *Upload {
+	return &Upload{client: c, ctx: ctx, key: key, contentType: contentType}
+}
+
+// Key returns the key of the uploaded object
+func (u *Upload) Key() string {
+	return u.key
+}
+
+// Write buffers p and uploads every full part. After an error, every further write fails.
+func (u *Upload) Write(p []byte) (int, error) {
+	if u.err != nil {
+		return 0, u.err
+	}
+	if u.done {
+		return 0, errors.New("upload already finished")
+	}
+	u.buf = append(u.buf, p...)
+	partSize := int(u.client.cfg.PartSize)
+	for len(u.buf) >= partSize {
+		if err := u.uploadPart(u.buf[:partSize]); err != nil {
+			u.err = err
+			return 0, err
+		}
+		u.buf = append(u.buf[:0], u.buf[partSize:]...)
+	}
+	return len(p), nil
+}
+
+// Commit uploads the buffered bytes and completes the upload, so the object appears in the bucket
+func (u *Upload) Commit() error {
+	if u.err != nil {
+		return u.err
+	}
+	if u.done {
+		return errors.New("upload already finished")
+	}
+	u.done = true
+	if u.uploadID == "" {
+		return u.client.PutObject(u.ctx, u.key, u.contentType, u.buf)
+	}
+	if len(u.buf) > 0 {
+		if err := u.uploadPart(u.buf); err != nil {
+			return err
+		}
+	}
+
+	body, err := xml.Marshal(struct {
+		XMLName xml.Name        `xml:"CompleteMultipartUpload"`
+		Parts   []completedPart `xml:"Part"`
+	}{Parts: u.parts})
+	if err != nil {
+		return u.abortAfter(err)
+	}
+	resp, err := u.client.do(u.ctx, http.MethodPost, u.key, url.Values{"uploadId": {u.uploadID}}, http.Header{}, body)
+	if err != nil {
+		return u.abortAfter(fmt.Errorf("failed to complete upload of %s: %w", u.client.URL(u.key), err))
+	}
+	defer resp.Body.Close()
+
+	// The completion can fail after the status 200 was sent, with an error in the body
+	var result struct {
+		XMLName xml.Name
+		Code    string `xml:"Code"`
+		Message string `xml:"Message"`
+	}
+	if err := xml.NewDecoder(resp.Body).Decode(&result); err == nil && result.XMLName.Local == "Error" {
+		err := &Error{StatusCode: resp.StatusCode, Code: result.Code, Message: result.Message}
+		return u.abortAfter(fmt.Errorf("failed to complete upload of %s: %w", u.client.URL(u.key), err))
+	}
+	return nil
+}
+
+// Abort discards the upload and the parts uploaded so far
+func (u *Upload) Abort() error {
+	u.done = true
+	if u.uploadID == "" {
+		return nil
+	}
+	// The upload is aborted even if the context of the upload was cancelled
+	ctx := context.WithoutCancel(u.ctx)
+	resp, err := u.client.do(ctx, http.MethodDelete, u.key, url.Values{"uploadId": {u.uploadID}}, nil, nil)
+	u.uploadID = ""
+	if err != nil {
+		return fmt.Errorf("failed to abort upload of %s: %w", u.client.URL(u.key), err)
+	}
+	return resp.Body.Close()
+}
+
+// abortAfter aborts the upload after the error and returns the error
+func (u *Upload) abortAfter(err error) error {
+	u.err = err
+	if abortErr := u.Abort(); abortErr != nil {
+		return errors.Join(err, abortErr)
+	}
+	return err
+}
+
+// uploadPart sends the next part, creating the multipart upload first if needed
+func (u *Upload) uploadPart(data []byte) error {
+	if u.uploadID == "" {
+		if err := u.create(); err != nil {
+			return err
+		}
+	}
+	number := len(u.parts) + 1
+	if number > maxParts {
+		return u.abortAfter(fmt.Errorf("upload of %s exceeds %d parts", u.client.URL(u.key), maxParts))
+	}
+	query := url.Values{"partNumber": {strconv.Itoa(number)}, "uploadId": {u.uploadID}}
+	resp, err := u.client.do(u.ctx, http.MethodPut, u.key, query, nil, data)
+	if err != nil {
+		return u.abortAfter(fmt.Errorf("failed to upload part %d of %s: %w", number, u.client.URL(u.key), err))
+	}
+	_ = resp.Body.Close()
+	u.parts = append(u.parts, completedPart{PartNumber: number, ETag: resp.Header.Get("ETag")})
+	return nil
+}
+
+// create starts a multipart upload with the server-side encryption of the client
+func (u *Upload) create() error {
+	header := u.client.sseHeader()
+	header.Set("Content-Type", u.contentType)
+	resp, err := u.client.do(u.ctx, http.MethodPost, u.key, url.Values{"uploads": {""}}, header, nil)
+	if err != nil {
+		return fmt.Errorf("failed to start upload of %s: %w", u.client.URL(u.key), err)
+	}
+	defer resp.Body.Close()
+
+	var result struct {
+		UploadID string `xml:"UploadId"`
+	}
+	if err := xml.NewDecoder(resp.Body).Decode(&result); err != nil || result.UploadID == "" {
+		return fmt.Errorf("failed to start upload of %s: invalid response", u.client.URL(u.key))
+	}
+	u.uploadID = result.UploadID
+	return nil
+}
@@ -0,0 +1,113 @@
+package sink
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// Local writes files to a directory of the local filesystem. A file is written to its name with TempSuffix
+// and renamed into place on commit.
+type Local struct {
+	dir    string
+	resume bool
+	file   *os.File
+	path   string
+}
+
+// NewLocal returns a sink writing to the directory, which is created on Open if needed. With resume, the
+// partial file of an aborted write is kept and appended to by the next Open of the same name.
+func NewLocal(dir string, resume bool) *Local {
+	return &Local{dir: dir, resume: resume}
+}
+
+// Open creates the temp file of the name, or opens the partial file of an earlier write for appending
+func (s *Local) Open(_ context.Context, name string) error {
+	if s.file != nil {
+		return errors.New("a file is already open")
+	}
+	if err := os.MkdirAll(s.dir, 0750); err != nil {
+		return fmt.Errorf("failed to create output directory: %w", err)
+	}
+	s.path = filepath.Join(s.dir, name)
+	flags := os.O_WRONLY | os.O_CREATE | os.O_APPEND
+	if !s.resume {
+		flags |= os.O_TRUNC
+	}
+	file, err := os.OpenFile(s.TempPath(), flags, 0600) // #nosec G304 -- Callers validate the output directory and name
+	if err != nil {
+		return fmt.Errorf("failed to create temp file: %w", err)
+	}
+	s.file = file
+	return nil
+}
+
+// TempPath returns the path of the open file while it is written
+func (s *Local) TempPath() string {
+	return s.path + TempSuffix
+}
+
+// Write appends p to the temp file
+func (s *Local) Write(p []byte) (int, error) {
+	if s.file == nil {
+		return 0, os.ErrClosed
+	}
+	return s.file.Write(p)
+}
+
+// Size returns the number of bytes in the temp file
+func (s *Local) Size() (int64, error) {
+	if s.file == nil {
+		return 0, os.ErrClosed
+	}
+	info, err := s.file.Stat()
+	if err != nil {
+		return 0, err
+	}
+	return info.Size(), nil
+}
+
+// Reset truncates the temp file
+func (s *Local) Reset() error {
+	if s.file == nil {
+		return os.ErrClosed
+	}
+	return s.file.Truncate(0)
+}
+
+// Commit closes the temp file and renames it to the name, replacing an existing file. It returns the path.
+func (s *Local) Commit() (string, error) {
+	if s.file == nil {
+		return "", os.ErrClosed
+	}
+	err := s.file.Close()
+	s.file = nil
+	if err != nil {
+		return "", fmt.Errorf("failed to close temp file: %w", err)
+	}
+	if err := os.Rename(s.TempPath(), s.path); err != nil {
+		return "", fmt.Errorf("failed to rename temp file to final file: %w", err)
+	}
+	return s.path, nil
+}
+
+// Abort closes the temp file and removes it, unless it is a non-empty partial file kept for resuming
+func (s *Local) Abort() error {
+	if s.file == nil {
+		return nil
+	}
+	err := s.file.Close()
+	s.file = nil
+	if err != nil {
+		err = fmt.Errorf("failed to close temp file: %w", err)
+	}
+	if info, statErr := os.Stat(s.TempPath()); statErr == nil && info.Size() > 0 && s.resume {
+		return err
+	}
+	if removeErr := os.Remove(s.TempPath()); removeErr != nil && !os.IsNotExist(removeErr) {
+		return errors.Join(err, fmt.Errorf("failed to remove temp file: %w", removeErr))
+	}
+	return err
+}
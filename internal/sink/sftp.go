@@ -0,0 +1,247 @@
+package sink
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"time"
+
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// DefaultSFTPPort is the port of SFTP destinations without one
+const DefaultSFTPPort string = "22"
+
+// sftpDialTimeout limits connecting to the SSH server including the handshake
+const sftpDialTimeout = 30 * time.Second
+
+// SFTPAuth authenticates to SFTP destinations. The host key of the server is always verified.
+type SFTPAuth struct {
+	// IdentityFile is an unencrypted private key file of the user
+	IdentityFile string
+	// Password is the password of the user, tried after the identity file
+	Password string
+	// KnownHostsFile lists the host keys of the servers (default is ~/.ssh/known_hosts)
+	KnownHostsFile string
+}
+
+// SFTP writes files to a directory of an SSH server. Every Open connects to the server; Commit and Abort
+// disconnect. Partial files are never resumed.
+type SFTP struct {
+	dest   *url.URL
+	addr   string
+	dir    string
+	config *ssh.ClientConfig
+
+	conn   *ssh.Client
+	client *sftp.Client
+	file   *sftp.File
+	path   string
+	size   int64
+}
+
+// NewSFTP returns a sink writing to the directory of an sftp:// URL. The user of the URL defaults to the
+// current user.
+func NewSFTP(dest *url.URL, auth SFTPAuth) (*SFTP, error) {
+	user := dest.User.Username()
+	if user == "" {
+		user = os.Getenv("USER")
+	}
+	if user == "" {
+		return nil, errors.New("missing user of the SFTP destination")
+	}
+
+	var methods []ssh.AuthMethod
+	if auth.IdentityFile != "" {
+		key, err := os.ReadFile(auth.IdentityFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read SSH identity file: %w", err)
+		}
+		signer, err := ssh.ParsePrivateKey(key)
+		if err != nil {
+			return nil, fmt.Errorf("invalid SSH identity file %s: %w", auth.IdentityFile, err)
+		}
+		methods = append(methods, ssh.PublicKeys(signer))
+	}
+	if auth.Password != "" {
+		methods = append(methods, ssh.Password(auth.Password))
+	}
+	if len(methods) == 0 {
+		return nil, errors.New("missing SSH identity file or password of the SFTP destination")
+	}
+
+	knownHostsFile := auth.KnownHostsFile
+	if knownHostsFile == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return nil, fmt.Errorf("failed to find the known hosts file: %w", err)
+		}
+		knownHostsFile = filepath.Join(home, ".ssh", "known_hosts")
+	}
+	hostKeyCallback, err := knownhosts.New(knownHostsFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read known hosts: %w", err)
+	}
+
+	port := dest.Port()
+	if port == "" {
+		port = DefaultSFTPPort
+	}
+	dir := dest.Path
+	if dir == "" {
+		dir = "."
+	}
+	return &SFTP{
+		dest: dest,
+		addr: net.JoinHostPort(dest.Hostname(), port),
+		dir:  dir,
+		config: &ssh.ClientConfig{
+			User:            user,
+			Auth:            methods,
+			HostKeyCallback: hostKeyCallback,
+			Timeout:         sftpDialTimeout,
+		},
+	}, nil
+}
+
+// Open connects to the server, creates the directory if needed and creates the temp file of the name
+func (s *SFTP) Open(ctx context.Context, name string) error {
+	if s.file != nil {
+		return errors.New("a file is already open")
+	}
+	if err := s.connect(ctx); err != nil {
+		return err
+	}
+	if err := s.client.MkdirAll(s.dir); err != nil {
+		s.disconnect()
+		return fmt.Errorf("failed to create directory %s: %w", s.dir, err)
+	}
+	s.path = path.Join(s.dir, name)
+	file, err := s.client.OpenFile(s.path+TempSuffix, os.O_WRONLY|os.O_CREATE|os.O_TRUNC)
+	if err != nil {
+		s.disconnect()
+		return fmt.Errorf("failed to create temp file %s: %w", s.path+TempSuffix, err)
+	}
+	s.file = file
+	s.size = 0
+	return nil
+}
+
+// connect opens the SSH connection and the SFTP session, cancelling the handshake with the context
+func (s *SFTP) connect(ctx context.Context) error {
+	dialer := net.Dialer{Timeout: sftpDialTimeout}
+	netConn, err := dialer.DialContext(ctx, "tcp", s.addr)
+	if err != nil {
+		return fmt.Errorf("failed to connect to %s: %w", s.addr, err)
+	}
+	stop := context.AfterFunc(ctx, func() { _ = netConn.Close() })
+	defer stop()
+
+	conn, chans, reqs, err := ssh.NewClientConn(netConn, s.addr, s.config)
+	if err != nil {
+		_ = netConn.Close()
+		return fmt.Errorf("failed to connect to %s: %w", s.addr, err)
+	}
+	s.conn = ssh.NewClient(conn, chans, reqs)
+	if s.client, err = sftp.NewClient(s.conn); err != nil {
+		_ = s.conn.Close()
+		return fmt.Errorf("failed to start SFTP session with %s: %w", s.addr, err)
+	}
+	return nil
+}
+
+// disconnect closes the SFTP session and the SSH connection
+func (s *SFTP) disconnect() {
+	if s.client != nil {
+		_ = s.client.Close()
+	}
+	if s.conn != nil {
+		_ = s.conn.Close()
+	}
+	s.client, s.conn = nil, nil
+}
+
+// Write appends p to the temp file
+func (s *SFTP) Write(p []byte) (int, error) {
+	if s.file == nil {
+		return 0, os.ErrClosed
+	}
+	n, err := s.file.Write(p)
+	s.size += int64(n)
+	return n, err
+}
+
+// Size returns the number of bytes written to the temp file
+func (s *SFTP) Size() (int64, error) {
+	if s.file == nil {
+		return 0, os.ErrClosed
+	}
+	return s.size, nil
+}
+
+// Reset truncates the temp file
+func (s *SFTP) Reset() error {
+	if s.file == nil {
+		return os.ErrClosed
+	}
+	if err := s.file.Truncate(0); err != nil {
+		return fmt.Errorf("failed to truncate temp file: %w", err)
+	}
+	if _, err := s.file.Seek(0, io.SeekStart); err != nil {
+		return fmt.Errorf("failed to truncate temp file: %w", err)
+	}
+	s.size = 0
+	return nil
+}
+
+// Commit closes the temp file, renames it to the name, replacing an existing file, and disconnects. It
+// returns the sftp:// URL of the file.
+func (s *SFTP) Commit() (string, error) {
+	if s.file == nil {
+		return "", os.ErrClosed
+	}
+	defer s.disconnect()
+	err := s.file.Close()
+	s.file = nil
+	if err != nil {
+		return "", fmt.Errorf("failed to close temp file: %w", err)
+	}
+
+	// Without the rename extension of OpenSSH, an existing file is removed first, as plain SFTP renames fail
+	if _, ok := s.client.HasExtension("posix-rename@openssh.com"); ok {
+		err = s.client.PosixRename(s.path+TempSuffix, s.path)
+	} else {
+		if err := s.client.Remove(s.path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return "", fmt.Errorf("failed to replace %s: %w", s.path, err)
+		}
+		err = s.client.Rename(s.path+TempSuffix, s.path)
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to rename temp file to final file: %w", err)
+	}
+	location := *s.dest
+	location.Path = s.path
+	return location.String(), nil
+}
+
+// Abort closes and removes the temp file and disconnects
+func (s *SFTP) Abort() error {
+	if s.file == nil {
+		return nil
+	}
+	defer s.disconnect()
+	_ = s.file.Close()
+	s.file = nil
+	if err := s.client.Remove(s.path + TempSuffix); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to remove temp file: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,130 @@
+// Package sink writes saved exports to their destination: a local directory, or a directory of a backup host
+// reached over SFTP or WebDAV.
+package sink
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"strings"
+)
+
+// TempSuffix is appended to the name of a file while it is written
+const TempSuffix string = ".tmp"
+
+// Schemes of destination URLs
+const (
+	SchemeFile    string = "file"
+	SchemeSFTP    string = "sftp"
+	SchemeWebDAV  string = "webdav"
+	SchemeWebDAVS string = "webdavs"
+)
+
+// ExportSink writes files to a destination. A file is written between Open and Commit or Abort under a
+// temporary name and only appears under its own name once committed, so readers of the destination never
+// see a partial file. A sink writes one file at a time and can be opened again after Commit or Abort.
+type ExportSink interface {
+	// Open starts writing the file with the name
+	Open(ctx context.Context, name string) error
+	// Write appends p to the open file
+	Write(p []byte) (int, error)
+	// Size returns the number of bytes in the open file, including those of a resumed partial file
+	Size() (int64, error)
+	// Reset discards the bytes of the open file
+	Reset() error
+	// Commit moves the open file into place under its name and returns its location
+	Commit() (string, error)
+	// Abort discards the open file. A sink that resumes partial files keeps a non-empty one for the next Open.
+	Abort() error
+}
+
+// Options configures the sinks of destinations
+type Options struct {
+	// Resume keeps the partial file of an aborted write to a local directory, so the next Open resumes it
+	Resume bool
+	// SFTP authenticates to SFTP destinations
+	SFTP SFTPAuth
+	// WebDAVPassword is the password of the user of WebDAV destinations
+	WebDAVPassword string
+	// HTTPClient sends the requests to WebDAV destinations (default http.DefaultClient)
+	HTTPClient *http.Client
+}
+
+// ParseDest parses a destination: a directory path or a file://, sftp://[user@]host[:port]/path,
+// webdav://[user@]host[:port]/path or webdavs:// URL. WebDAV destinations use HTTP, webdavs ones HTTPS.
+func ParseDest(dest string) (*url.URL, error) {
+	if !strings.Contains(dest, "://") {
+		if dest == "" {
+			return nil, errors.New("empty destination")
+		}
+		return &url.URL{Scheme: SchemeFile, Path: filepath.ToSlash(dest)}, nil
+	}
+	u, err := url.Parse(dest)
+	if err != nil {
+		return nil, fmt.Errorf("invalid destination: %w", err)
+	}
+	if _, ok := u.User.Password(); ok {
+		return nil, fmt.Errorf("invalid destination %s: passwords are not accepted in the URL", u.Redacted())
+	}
+	for _, segment := range strings.Split(u.Path, "/") {
+		if segment == ".." {
+			return nil, fmt.Errorf("invalid destination %s: the path must not contain ..", u.Redacted())
+		}
+	}
+	switch u.Scheme {
+	case SchemeFile:
+		if u.Host != "" && u.Host != "localhost" {
+			return nil, fmt.Errorf("invalid destination %s: file URLs must not name a host", dest)
+		}
+	case SchemeSFTP, SchemeWebDAV, SchemeWebDAVS:
+		if u.Hostname() == "" {
+			return nil, fmt.Errorf("invalid destination %s: missing host", u.Redacted())
+		}
+	default:
+		return nil, fmt.Errorf("invalid destination %s: unsupported scheme %q (must be file, sftp, webdav or webdavs)", u.Redacted(), u.Scheme)
+	}
+	if u.RawQuery != "" || u.Fragment != "" {
+		return nil, fmt.Errorf("invalid destination %s: query and fragment are not supported", u.Redacted())
+	}
+	return u, nil
+}
+
+// IsLocal reports whether the destination is a local directory
+func IsLocal(dest *url.URL) bool {
+	return dest.Scheme == SchemeFile
+}
+
+// New returns a sink writing to the destination parsed by ParseDest
+func New(dest *url.URL, opts Options) (ExportSink, error) {
+	switch dest.Scheme {
+	case SchemeFile:
+		return NewLocal(filepath.FromSlash(dest.Path), opts.Resume), nil
+	case SchemeSFTP:
+		return NewSFTP(dest, opts.SFTP)
+	case SchemeWebDAV, SchemeWebDAVS:
+		return NewWebDAV(dest, opts.WebDAVPassword, opts.HTTPClient), nil
+	default:
+		return nil, fmt.Errorf("unsupported destination scheme %q", dest.Scheme)
+	}
+}
+
+// WriteFile writes a small file like a manifest to the sink in one step and returns its location
+func WriteFile(ctx context.Context, s ExportSink, name string, data []byte) (string, error) {
+	if err := s.Open(ctx, name); err != nil {
+		return "", err
+	}
+	// A partial file left by an earlier attempt is replaced
+	err := s.Reset()
+	if err == nil {
+		_, err = s.Write(data)
+	}
+	if err != nil {
+		// Reset first, so a sink that resumes partial files does not keep this one
+		_ = s.Reset()
+		return "", errors.Join(err, s.Abort())
+	}
+	return s.Commit()
+}
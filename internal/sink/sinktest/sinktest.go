@@ -0,0 +1,138 @@
+// Package sinktest implements stand-ins for the backup hosts of remote export sinks: an SSH server with
+// the SFTP subsystem and a WebDAV server, both serving a local directory and accepting a single user.
+package sinktest
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/subtle"
+	"errors"
+	"net"
+	"net/http"
+	"sync"
+
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+	"golang.org/x/net/webdav"
+)
+
+// SFTPServer is an SSH server on a loopback port serving SFTP with password authentication. Paths are
+// those of the local filesystem.
+type SFTPServer struct {
+	listener net.Listener
+	hostKey  ssh.PublicKey
+	config   *ssh.ServerConfig
+	wg       sync.WaitGroup
+}
+
+// NewSFTPServer starts a server accepting the user with the password and a new ed25519 host key
+func NewSFTPServer(user, password string) (*SFTPServer, error) {
+	_, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	signer, err := ssh.NewSignerFromKey(private)
+	if err != nil {
+		return nil, err
+	}
+	config := &ssh.ServerConfig{
+		PasswordCallback: func(conn ssh.ConnMetadata, given []byte) (*ssh.Permissions, error) {
+			if conn.User() == user && subtle.ConstantTimeCompare(given, []byte(password)) == 1 {
+				return nil, nil
+			}
+			return nil, errors.New("invalid credentials")
+		},
+	}
+	config.AddHostKey(signer)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+	s := &SFTPServer{listener: listener, hostKey: signer.PublicKey(), config: config}
+	s.wg.Add(1)
+	go s.serve()
+	return s, nil
+}
+
+// Addr returns the host and port of the server
+func (s *SFTPServer) Addr() string {
+	return s.listener.Addr().String()
+}
+
+// KnownHosts returns a known_hosts line with the host key of the server
+func (s *SFTPServer) KnownHosts() string {
+	return knownhosts.Line([]string{knownhosts.Normalize(s.Addr())}, s.hostKey) + "\n"
+}
+
+// Close stops accepting connections and waits for the open ones to end
+func (s *SFTPServer) Close() error {
+	err := s.listener.Close()
+	s.wg.Wait()
+	return err
+}
+
+func (s *SFTPServer) serve() {
+	defer s.wg.Done()
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			s.handle(conn)
+		}()
+	}
+}
+
+// handle serves the SFTP subsystem on the session channels of a connection
+func (s *SFTPServer) handle(netConn net.Conn) {
+	conn, chans, reqs, err := ssh.NewServerConn(netConn, s.config)
+	if err != nil {
+		_ = netConn.Close()
+		return
+	}
+	defer conn.Close()
+	go ssh.DiscardRequests(reqs)
+
+	for newChannel := range chans {
+		if newChannel.ChannelType() != "session" {
+			_ = newChannel.Reject(ssh.UnknownChannelType, "unknown channel type")
+			continue
+		}
+		channel, requests, err := newChannel.Accept()
+		if err != nil {
+			return
+		}
+		go func() {
+			for req := range requests {
+				ok := req.Type == "subsystem" && len(req.Payload) > 4 && string(req.Payload[4:]) == "sftp"
+				_ = req.Reply(ok, nil)
+			}
+		}()
+		server, err := sftp.NewServer(channel)
+		if err != nil {
+			_ = channel.Close()
+			continue
+		}
+		_ = server.Serve()
+		_ = server.Close()
+	}
+}
+
+// NewWebDAVServer returns a WebDAV handler of the directory requiring basic authentication as the user
+func NewWebDAVServer(dir, user, password string) http.Handler {
+	handler := &webdav.Handler{FileSystem: webdav.Dir(dir), LockSystem: webdav.NewMemLS()}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		givenUser, givenPassword, ok := r.BasicAuth()
+		if !ok || givenUser != user || subtle.ConstantTimeCompare([]byte(givenPassword), []byte(password)) != 1 {
+			w.Header().Set("WWW-Authenticate", `Basic realm="exports"`)
+			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+			return
+		}
+		handler.ServeHTTP(w, r)
+	})
+}
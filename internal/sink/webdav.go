@@ -0,0 +1,233 @@
+package sink
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// errDiscarded ends the upload of a temp file that is discarded
+var errDiscarded = errors.New("upload discarded")
+
+// A server may still hold the lock of a discarded upload for a moment after the request failed, so a locked
+// temp file is deleted again after lockedRetryDelay, up to lockedRetries times
+const (
+	lockedRetries    = 20
+	lockedRetryDelay = 50 * time.Millisecond
+)
+
+// WebDAV writes files to a collection of a WebDAV server. The temp file is streamed to the server in a
+// single PUT request and moved into place with MOVE on commit. Partial files are never resumed.
+type WebDAV struct {
+	dest     *url.URL
+	base     *url.URL
+	password string
+	client   *http.Client
+
+	ctx    context.Context
+	name   string
+	body   *io.PipeWriter
+	result chan error
+	size   int64
+}
+
+// NewWebDAV returns a sink writing to the collection of a webdav:// or webdavs:// URL, authenticating as
+// the user of the URL with the password if the URL has one. A nil client uses http.DefaultClient.
+func NewWebDAV(dest *url.URL, password string, client *http.Client) *WebDAV {
+	base := &url.URL{Scheme: "http", Host: dest.Host, Path: strings.TrimSuffix(dest.Path, "/") + "/"}
+	if dest.Scheme == SchemeWebDAVS {
+		base.Scheme = "https"
+	}
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return &WebDAV{dest: dest, base: base, password: password, client: client}
+}
+
+// Open creates the collection if needed and starts uploading the temp file of the name
+func (s *WebDAV) Open(ctx context.Context, name string) error {
+	if s.body != nil {
+		return errors.New("a file is already open")
+	}
+	s.ctx = ctx
+	s.name = name
+	if err := s.makeCollections(); err != nil {
+		return err
+	}
+	s.startUpload()
+	return nil
+}
+
+// makeCollections creates the collection and its parents that do not exist yet
+func (s *WebDAV) makeCollections() error {
+	collection := &url.URL{Scheme: s.base.Scheme, Host: s.base.Host, Path: "/"}
+	for _, segment := range strings.Split(strings.Trim(s.base.Path, "/"), "/") {
+		if segment == "" {
+			continue
+		}
+		collection = collection.JoinPath(segment)
+		collection.Path += "/"
+		resp, err := s.request(s.ctx, "MKCOL", collection, nil)
+		if err != nil {
+			return err
+		}
+		// An existing collection is reported with 405 Method Not Allowed
+		if !success(resp) && resp.StatusCode != http.StatusMethodNotAllowed {
+			return statusError("MKCOL", collection, resp)
+		}
+	}
+	return nil
+}
+
+// startUpload starts the PUT request of the temp file, whose body receives the written bytes
+func (s *WebDAV) startUpload() {
+	reader, writer := io.Pipe()
+	s.body = writer
+	s.size = 0
+	s.result = make(chan error, 1)
+	go func() {
+		resp, err := s.request(s.ctx, http.MethodPut, s.tempURL(), reader)
+		if err == nil && !success(resp) {
+			err = statusError(http.MethodPut, s.tempURL(), resp)
+		}
+		// A failed upload fails the next write
+		if err != nil {
+			_ = reader.CloseWithError(err)
+		} else {
+			_ = reader.Close()
+		}
+		s.result <- err
+	}()
+}
+
+// finishUpload ends the body of the PUT request with the error, or successfully if it is nil, and returns
+// the result of the request
+func (s *WebDAV) finishUpload(err error) error {
+	_ = s.body.CloseWithError(err)
+	s.body = nil
+	return <-s.result
+}
+
+func (s *WebDAV) tempURL() *url.URL {
+	return s.base.JoinPath(s.name + TempSuffix)
+}
+
+// Write streams p to the server
+func (s *WebDAV) Write(p []byte) (int, error) {
+	if s.body == nil {
+		return 0, os.ErrClosed
+	}
+	n, err := s.body.Write(p)
+	s.size += int64(n)
+	if err != nil {
+		return n, fmt.Errorf("failed to upload %s: %w", s.name, err)
+	}
+	return n, nil
+}
+
+// Size returns the number of bytes written to the temp file
+func (s *WebDAV) Size() (int64, error) {
+	if s.body == nil {
+		return 0, os.ErrClosed
+	}
+	return s.size, nil
+}
+
+// Reset discards the upload of the temp file and starts a new one
+func (s *WebDAV) Reset() error {
+	if s.body == nil {
+		return os.ErrClosed
+	}
+	_ = s.finishUpload(errDiscarded)
+	s.removeTemp()
+	s.startUpload()
+	return nil
+}
+
+// Commit finishes the upload of the temp file and moves it to the name, replacing an existing file. It
+// returns the URL of the file.
+func (s *WebDAV) Commit() (string, error) {
+	if s.body == nil {
+		return "", os.ErrClosed
+	}
+	if err := s.finishUpload(nil); err != nil {
+		s.removeTemp()
+		return "", fmt.Errorf("failed to upload %s: %w", s.name, err)
+	}
+
+	target := s.base.JoinPath(s.name)
+	header := http.Header{"Destination": {target.String()}, "Overwrite": {"T"}}
+	resp, err := s.requestWithHeader(s.ctx, "MOVE", s.tempURL(), nil, header)
+	if err == nil && !success(resp) {
+		err = statusError("MOVE", s.tempURL(), resp)
+	}
+	if err != nil {
+		s.removeTemp()
+		return "", fmt.Errorf("failed to rename temp file to final file: %w", err)
+	}
+	location := *s.dest
+	location.Path = target.Path
+	return location.String(), nil
+}
+
+// Abort discards the upload of the temp file and removes what the server kept of it
+func (s *WebDAV) Abort() error {
+	if s.body == nil {
+		return nil
+	}
+	_ = s.finishUpload(errDiscarded)
+	s.removeTemp()
+	return nil
+}
+
+// removeTemp deletes the temp file, even if the context of the sink was cancelled. Once the delete is not
+// refused as locked, the server is done with the previous upload of the temp file.
+func (s *WebDAV) removeTemp() {
+	for attempt := 0; attempt < lockedRetries; attempt++ {
+		resp, err := s.request(context.WithoutCancel(s.ctx), http.MethodDelete, s.tempURL(), nil)
+		if err != nil || resp.StatusCode != http.StatusLocked {
+			return
+		}
+		time.Sleep(lockedRetryDelay)
+	}
+}
+
+func (s *WebDAV) request(ctx context.Context, method string, u *url.URL, body io.Reader) (*http.Response, error) {
+	return s.requestWithHeader(ctx, method, u, body, nil)
+}
+
+// requestWithHeader sends a request with basic authentication and returns the response with its body
+// drained and closed
+func (s *WebDAV) requestWithHeader(ctx context.Context, method string, u *url.URL, body io.Reader, header http.Header) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), body)
+	if err != nil {
+		return nil, err
+	}
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	if user := s.dest.User.Username(); user != "" {
+		req.SetBasicAuth(user, s.password)
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("%s %s failed: %w", method, u.Redacted(), err)
+	}
+	_, _ = io.Copy(io.Discard, resp.Body)
+	_ = resp.Body.Close()
+	return resp, nil
+}
+
+func success(resp *http.Response) bool {
+	return resp.StatusCode >= 200 && resp.StatusCode < 300
+}
+
+func statusError(method string, u *url.URL, resp *http.Response) error {
+	return fmt.Errorf("%s %s returned status %s", method, u.Redacted(), resp.Status)
+}
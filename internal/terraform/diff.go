@@ -0,0 +1,287 @@
+package terraform
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/hashicorp/hcl/v2/hclwrite"
+	ctyjson "github.com/zclconf/go-cty/cty/json"
+)
+
+// Change kinds of a resource or attribute
+const (
+	ChangeAdded   string = "added"
+	ChangeRemoved string = "removed"
+	ChangeChanged string = "changed"
+)
+
+// AttributeChange is a change of a single attribute of a resource. Attributes of nested blocks
+// are addressed by path, e.g. rule[0].action
+type AttributeChange struct {
+	Path   string `json:"path" yaml:"path"`
+	Change string `json:"change" yaml:"change"`
+	Old    string `json:"old,omitempty" yaml:"old,omitempty"`
+	New    string `json:"new,omitempty" yaml:"new,omitempty"`
+}
+
+// ResourceChange is a resource or data source that was added, removed or changed
+type ResourceChange struct {
+	Address    string            `json:"address" yaml:"address"`
+	Change     string            `json:"change" yaml:"change"`
+	Attributes []AttributeChange `json:"attributes,omitempty" yaml:"attributes,omitempty"`
+}
+
+// Diff is the semantic difference between two configurations
+type Diff struct {
+	Added     int              `json:"added" yaml:"added"`
+	Removed   int              `json:"removed" yaml:"removed"`
+	Changed   int              `json:"changed" yaml:"changed"`
+	Resources []ResourceChange `json:"resources" yaml:"resources"`
+}
+
+// HasChanges reports whether any resource was added, removed or changed
+func (d *Diff) HasChanges() bool {
+	return len(d.Resources) > 0
+}
+
+// Compare matches the resources and data sources of both configurations by address and reports
+// the attribute-level changes between them. The order of blocks and attributes and the formatting
+// of the files are ignored.
+func Compare(oldConfig, newConfig *Config) *Diff {
+	oldBlocks := addressable(oldConfig)
+	newBlocks := addressable(newConfig)
+
+	addresses := make([]string, 0, len(oldBlocks)+len(newBlocks))
+	for address := range oldBlocks {
+		addresses = append(addresses, address)
+	}
+	for address := range newBlocks {
+		if _, ok := oldBlocks[address]; !ok {
+			addresses = append(addresses, address)
+		}
+	}
+	sort.Strings(addresses)
+
+	diff := &Diff{Resources: []ResourceChange{}}
+	for _, address := range addresses {
+		oldBlock, inOld := oldBlocks[address]
+		newBlock, inNew := newBlocks[address]
+		switch {
+		case !inOld:
+			diff.Added++
+			diff.Resources = append(diff.Resources, ResourceChange{
+				Address:    address,
+				Change:     ChangeAdded,
+				Attributes: compareAttributes(nil, newBlock.Attributes()),
+			})
+		case !inNew:
+			diff.Removed++
+			diff.Resources = append(diff.Resources, ResourceChange{
+				Address:    address,
+				Change:     ChangeRemoved,
+				Attributes: compareAttributes(oldBlock.Attributes(), nil),
+			})
+		default:
+			changes := compareAttributes(oldBlock.Attributes(), newBlock.Attributes())
+			if len(changes) == 0 {
+				continue
+			}
+			diff.Changed++
+			diff.Resources = append(diff.Resources, ResourceChange{
+				Address:    address,
+				Change:     ChangeChanged,
+				Attributes: changes,
+			})
+		}
+	}
+	return diff
+}
+
+// addressable returns the resources and data sources of the configuration by address
+func addressable(config *Config) map[string]*Block {
+	blocks := map[string]*Block{}
+	for _, b := range config.Blocks {
+		if b.Kind == KindResource || b.Kind == KindData {
+			blocks[b.Address()] = b
+		}
+	}
+	return blocks
+}
+
+// compareAttributes returns the changes between two flattened attribute sets sorted by path
+func compareAttributes(oldAttrs, newAttrs map[string]string) []AttributeChange {
+	var changes []AttributeChange
+	for path, oldValue := range oldAttrs {
+		newValue, ok := newAttrs[path]
+		switch {
+		case !ok:
+			changes = append(changes, AttributeChange{Path: path, Change: ChangeRemoved, Old: oldValue})
+		case newValue != oldValue:
+			changes = append(changes, AttributeChange{Path: path, Change: ChangeChanged, Old: oldValue, New: newValue})
+		}
+	}
+	for path, newValue := range newAttrs {
+		if _, ok := oldAttrs[path]; !ok {
+			changes = append(changes, AttributeChange{Path: path, Change: ChangeAdded, New: newValue})
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Path < changes[j].Path })
+	return changes
+}
+
+// Attributes flattens the body of the block into a map of attribute paths to normalized values.
+// Nested blocks are indexed by type and labels; repeated blocks are ordered by their content so
+// that reordering them is not reported as a change.
+func (b *Block) Attributes() map[string]string {
+	attrs := map[string]string{}
+	flattenBody("", b.Body, b.Source, attrs)
+	return attrs
+}
+
+func flattenBody(prefix string, body *hclsyntax.Body, src []byte, attrs map[string]string) {
+	for name, attr := range body.Attributes {
+		attrs[prefix+name] = exprString(attr.Expr, src)
+	}
+
+	groups := map[string][]map[string]string{}
+	for _, block := range body.Blocks {
+		nested := map[string]string{}
+		flattenBody("", block.Body, src, nested)
+		key := strings.Join(append([]string{block.Type}, block.Labels...), ".")
+		groups[key] = append(groups[key], nested)
+	}
+	for key, blocks := range groups {
+		sort.Slice(blocks, func(i, j int) bool { return canonical(blocks[i]) < canonical(blocks[j]) })
+		for i, nested := range blocks {
+			blockPrefix := fmt.Sprintf("%s%s[%d]", prefix, key, i)
+			if len(nested) == 0 {
+				attrs[blockPrefix] = "{}"
+				continue
+			}
+			for path, value := range nested {
+				attrs[blockPrefix+"."+path] = value
+			}
+		}
+	}
+}
+
+// canonical renders flattened attributes as a single string in path order
+func canonical(attrs map[string]string) string {
+	paths := make([]string, 0, len(attrs))
+	for path := range attrs {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	var sb strings.Builder
+	for _, path := range paths {
+		fmt.Fprintf(&sb, "%s=%s\n", path, attrs[path])
+	}
+	return sb.String()
+}
+
+// exprString renders an expression in a normalized form. Literal values are rendered as JSON with
+// sorted object keys, objects and lists containing references item by item with sorted keys, and
+// any other expression from its source formatted like terraform fmt and joined onto a single line.
+func exprString(expr hclsyntax.Expression, src []byte) string {
+	if val, diags := expr.Value(nil); !diags.HasErrors() && val.IsWhollyKnown() {
+		if val.IsNull() {
+			return "null"
+		}
+		if !val.Type().HasDynamicTypes() {
+			if data, err := ctyjson.Marshal(val, val.Type()); err == nil {
+				return string(data)
+			}
+		}
+	}
+
+	switch e := expr.(type) {
+	case *hclsyntax.ObjectConsExpr:
+		items := make([]string, len(e.Items))
+		for i, item := range e.Items {
+			items[i] = exprString(item.KeyExpr, src) + " = " + exprString(item.ValueExpr, src)
+		}
+		sort.Strings(items)
+		return "{" + strings.Join(items, ", ") + "}"
+	case *hclsyntax.TupleConsExpr:
+		items := make([]string, len(e.Exprs))
+		for i, item := range e.Exprs {
+			items[i] = exprString(item, src)
+		}
+		return "[" + strings.Join(items, ", ") + "]"
+	}
+
+	formatted := hclwrite.Format(expr.Range().SliceBytes(src))
+	tokens, _ := hclsyntax.LexExpression(formatted, "", hcl.InitialPos)
+	return joinTokens(tokens)
+}
+
+// joinTokens writes formatted tokens on a single line. Newlines separating the items of a
+// multi-line object or list become commas and trailing commas are dropped, so a collection
+// reads the same whether it was written on one line or several.
+func joinTokens(tokens hclsyntax.Tokens) string {
+	var sb strings.Builder
+	var prev hclsyntax.TokenType
+	end, depth := -1, 0
+	for i, token := range tokens {
+		switch token.Type {
+		case hclsyntax.TokenEOF:
+			continue
+		case hclsyntax.TokenComment, hclsyntax.TokenNewline:
+			// line comments include the newline that ends them
+			if token.Type == hclsyntax.TokenComment && !bytes.HasSuffix(token.Bytes, []byte("\n")) {
+				continue
+			}
+			if depth > 0 && endsValue(prev) && !isCloser(nextToken(tokens, i)) {
+				sb.WriteByte(',')
+				prev = hclsyntax.TokenComma
+			}
+			continue
+		case hclsyntax.TokenComma:
+			if prev == hclsyntax.TokenComma || isCloser(nextToken(tokens, i)) {
+				continue
+			}
+		case hclsyntax.TokenOBrace, hclsyntax.TokenOBrack:
+			depth++
+		case hclsyntax.TokenCBrace, hclsyntax.TokenCBrack:
+			depth--
+		}
+
+		gap := end >= 0 && token.Range.Start.Byte > end
+		if prev == hclsyntax.TokenComma || (gap && prev != hclsyntax.TokenOBrack && prev != hclsyntax.TokenOParen &&
+			token.Type != hclsyntax.TokenCBrack && token.Type != hclsyntax.TokenCParen) {
+			sb.WriteByte(' ')
+		}
+		sb.Write(token.Bytes)
+		prev = token.Type
+		end = token.Range.End.Byte
+	}
+	return sb.String()
+}
+
+// nextToken returns the type of the next token after i that is not a newline or comment
+func nextToken(tokens hclsyntax.Tokens, i int) hclsyntax.TokenType {
+	for _, token := range tokens[i+1:] {
+		if token.Type != hclsyntax.TokenNewline && token.Type != hclsyntax.TokenComment {
+			return token.Type
+		}
+	}
+	return hclsyntax.TokenEOF
+}
+
+func endsValue(t hclsyntax.TokenType) bool {
+	switch t {
+	case hclsyntax.TokenIdent, hclsyntax.TokenNumberLit, hclsyntax.TokenCQuote, hclsyntax.TokenCHeredoc,
+		hclsyntax.TokenCBrace, hclsyntax.TokenCBrack, hclsyntax.TokenCParen:
+		return true
+	}
+	return false
+}
+
+func isCloser(t hclsyntax.TokenType) bool {
+	return t == hclsyntax.TokenCBrace || t == hclsyntax.TokenCBrack || t == hclsyntax.TokenCParen
+}
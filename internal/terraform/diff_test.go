@@ -0,0 +1,158 @@
+package terraform
+
+import (
+	"reflect"
+	"testing"
+)
+
+func parseConfig(t *testing.T, files map[string]string) *Config {
+	t.Helper()
+	config := &Config{}
+	for name, content := range files {
+		if err := config.AddFile(name, []byte(content)); err != nil {
+			t.Fatalf("AddFile() error = %v", err)
+		}
+	}
+	return config
+}
+
+const diffOld = `
+resource "incapsula_site" "example" {
+  domain = "www.example.com"
+  tags   = { env = "prod", team = "web" }
+  ports  = [80, 443]
+
+  rule {
+    name   = "block"
+    action = "RULE_ACTION_BLOCK"
+  }
+  rule {
+    name   = "alert"
+    action = "RULE_ACTION_ALERT"
+  }
+}
+
+resource "incapsula_policy" "acl" {
+  name    = "ACL"
+  site_id = incapsula_site.example.id
+}
+
+resource "incapsula_site" "removed" {
+  domain = "www.removed.com"
+}
+`
+
+// diffReformatted is diffOld with reordered blocks and attributes and different formatting
+const diffReformatted = `
+resource "incapsula_site" "removed" { domain = "www.removed.com" }
+
+resource "incapsula_policy" "acl" {
+  site_id = incapsula_site.example.id # the site
+  name = "ACL"
+}
+
+resource "incapsula_site" "example" {
+  rule {
+    action = "RULE_ACTION_ALERT"
+    name   = "alert"
+  }
+  rule {
+    action = "RULE_ACTION_BLOCK"
+    name   = "block"
+  }
+  ports  = [
+    80,
+    443,
+  ]
+  tags   = {
+    team = "web"
+    env  = "prod"
+  }
+  domain = "www.example.com"
+}
+`
+
+const diffNew = `
+resource "incapsula_site" "example" {
+  domain = "www.example.org"
+  tags   = { env = "prod", team = "web" }
+  ports  = [80, 443]
+
+  rule {
+    name   = "block"
+    action = "RULE_ACTION_BLOCK"
+  }
+  rule {
+    name   = "alert"
+    action = "RULE_ACTION_BLOCK"
+  }
+}
+
+resource "incapsula_policy" "acl" {
+  name    = "ACL"
+  site_id = incapsula_site.other.id
+  enabled = true
+}
+
+resource "incapsula_site" "added" {
+  domain = "www.added.com"
+}
+`
+
+func TestCompare_IgnoresOrderAndFormatting(t *testing.T) {
+	diff := Compare(parseConfig(t, map[string]string{"main.tf": diffOld}), parseConfig(t, map[string]string{"main.tf": diffReformatted}))
+	if diff.HasChanges() {
+		t.Errorf("Compare() reported changes for a reformatted configuration: %+v", diff.Resources)
+	}
+}
+
+func TestCompare(t *testing.T) {
+	diff := Compare(
+		parseConfig(t, map[string]string{"main.tf": diffOld}),
+		parseConfig(t, map[string]string{"sites.tf": diffNew}),
+	)
+
+	want := &Diff{
+		Added:   1,
+		Removed: 1,
+		Changed: 2,
+		Resources: []ResourceChange{
+			{Address: "incapsula_policy.acl", Change: ChangeChanged, Attributes: []AttributeChange{
+				{Path: "enabled", Change: ChangeAdded, New: "true"},
+				{Path: "site_id", Change: ChangeChanged, Old: "incapsula_site.example.id", New: "incapsula_site.other.id"},
+			}},
+			{Address: "incapsula_site.added", Change: ChangeAdded, Attributes: []AttributeChange{
+				{Path: "domain", Change: ChangeAdded, New: `"www.added.com"`},
+			}},
+			{Address: "incapsula_site.example", Change: ChangeChanged, Attributes: []AttributeChange{
+				{Path: "domain", Change: ChangeChanged, Old: `"www.example.com"`, New: `"www.example.org"`},
+				{Path: "rule[0].action", Change: ChangeChanged, Old: `"RULE_ACTION_ALERT"`, New: `"RULE_ACTION_BLOCK"`},
+			}},
+			{Address: "incapsula_site.removed", Change: ChangeRemoved, Attributes: []AttributeChange{
+				{Path: "domain", Change: ChangeRemoved, Old: `"www.removed.com"`},
+			}},
+		},
+	}
+	if !reflect.DeepEqual(diff, want) {
+		t.Errorf("Compare() = %+v, want %+v", diff, want)
+	}
+}
+
+func TestExprString(t *testing.T) {
+	tests := []struct {
+		a, b string
+	}{
+		{`{ a = 1, b = var.x }`, "{\n  b = var.x\n  a = 1\n}"},
+		{`[var.a, var.b]`, "[\n  var.a,\n  var.b,\n]"},
+		{`"${var.x}-y"`, `"${var.x}-y"`},
+		{`lookup(var.m,"k")`, `lookup( var.m, "k" )`},
+		{`null`, `null`},
+	}
+	for _, tt := range tests {
+		a := parseConfig(t, map[string]string{"a.tf": "resource \"t\" \"n\" {\n  v = " + tt.a + "\n}\n"})
+		b := parseConfig(t, map[string]string{"b.tf": "resource \"t\" \"n\" {\n  v = " + tt.b + "\n}\n"})
+		if got, want := a.Blocks[0].Attributes()["v"], b.Blocks[0].Attributes()["v"]; got != want {
+			t.Errorf("normalized %q = %q, %q = %q", tt.a, got, tt.b, want)
+		}
+	}
+}
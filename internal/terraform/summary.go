@@ -0,0 +1,41 @@
+package terraform
+
+// Summary counts what an export contains
+type Summary struct {
+	Files       int            `json:"files" yaml:"files"`
+	Resources   int            `json:"resources" yaml:"resources"`
+	ByType      map[string]int `json:"resources_by_type" yaml:"resources_by_type"`
+	DataSources int            `json:"data_sources" yaml:"data_sources"`
+	DataByType  map[string]int `json:"data_sources_by_type" yaml:"data_sources_by_type"`
+	Variables   int            `json:"variables" yaml:"variables"`
+	Outputs     int            `json:"outputs" yaml:"outputs"`
+	Modules     int            `json:"modules" yaml:"modules"`
+	Providers   []string       `json:"providers" yaml:"providers"`
+}
+
+// Summarize counts the resources, data sources, variables and providers of the configuration
+func Summarize(config *Config) Summary {
+	summary := Summary{
+		Files:      len(config.Files),
+		ByType:     map[string]int{},
+		DataByType: map[string]int{},
+		Providers:  config.Providers(),
+	}
+	for _, b := range config.Blocks {
+		switch b.Kind {
+		case KindResource:
+			summary.Resources++
+			summary.ByType[b.Type()]++
+		case KindData:
+			summary.DataSources++
+			summary.DataByType[b.Type()]++
+		case KindVariable:
+			summary.Variables++
+		case KindOutput:
+			summary.Outputs++
+		case KindModule:
+			summary.Modules++
+		}
+	}
+	return summary
+}
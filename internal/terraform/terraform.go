@@ -0,0 +1,192 @@
+// Package terraform parses the Terraform configuration contained in an export archive.
+package terraform
+
+import (
+	"archive/zip"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/ren3gadem4rm0t/imperva-export-cli/internal/archive"
+)
+
+// Block kinds of the top-level Terraform blocks
+const (
+	KindResource  string = "resource"
+	KindData      string = "data"
+	KindVariable  string = "variable"
+	KindProvider  string = "provider"
+	KindOutput    string = "output"
+	KindModule    string = "module"
+	KindLocals    string = "locals"
+	KindTerraform string = "terraform"
+)
+
+// Block is a top-level block of a Terraform file
+type Block struct {
+	Kind   string
+	Labels []string
+	File   string
+	Body   *hclsyntax.Body
+	// Source is the content of the file the block was parsed from
+	Source []byte
+}
+
+// Type returns the first label, e.g. the resource type of a resource block
+func (b *Block) Type() string {
+	if len(b.Labels) == 0 {
+		return ""
+	}
+	return b.Labels[0]
+}
+
+// Name returns the last label, e.g. the resource name of a resource block
+func (b *Block) Name() string {
+	if len(b.Labels) == 0 {
+		return ""
+	}
+	return b.Labels[len(b.Labels)-1]
+}
+
+// Address returns the Terraform address of the block, e.g. incapsula_site.example or data.incapsula_policy.default
+func (b *Block) Address() string {
+	if b.Kind == KindResource {
+		return strings.Join(b.Labels, ".")
+	}
+	return strings.Join(append([]string{b.Kind}, b.Labels...), ".")
+}
+
+// Config is the Terraform configuration of an export
+type Config struct {
+	Files  []string
+	Blocks []*Block
+}
+
+// Filter returns the blocks of the given kind in file order
+func (c *Config) Filter(kind string) []*Block {
+	var blocks []*Block
+	for _, b := range c.Blocks {
+		if b.Kind == kind {
+			blocks = append(blocks, b)
+		}
+	}
+	return blocks
+}
+
+// IsTerraformFile reports whether an archive entry is a Terraform configuration file
+func IsTerraformFile(name string) bool {
+	return strings.EqualFold(path.Ext(name), ".tf")
+}
+
+// LoadArchive parses every .tf file in the export archive at path without extracting it
+func LoadArchive(archivePath string) (*Config, error) {
+	config := &Config{}
+	err := archive.ReadFiles(archivePath, IsTerraformFile, func(name string, data []byte) error {
+		return config.AddFile(name, data)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+// LoadZip is LoadArchive for an opened archive, e.g. an archive decrypted into memory
+func LoadZip(reader *zip.Reader) (*Config, error) {
+	config := &Config{}
+	err := archive.ReadZipFiles(reader, IsTerraformFile, func(name string, data []byte) error {
+		return config.AddFile(name, data)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+// LoadDir parses every .tf file below dir. Files are named by their slash-separated path relative to dir,
+// like the entries of an archive, so configurations loaded from a directory and an archive can be compared.
+// A missing directory is an empty configuration.
+func LoadDir(dir string) (*Config, error) {
+	config := &Config{}
+	err := filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) && p == dir {
+				return filepath.SkipDir
+			}
+			return err
+		}
+		if !d.Type().IsRegular() || !IsTerraformFile(d.Name()) {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+		data, err := os.ReadFile(p) // #nosec G304 -- Path found by walking dir
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %w", p, err)
+		}
+		return config.AddFile(filepath.ToSlash(rel), data)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+// AddFile parses a Terraform file and adds its blocks to the configuration
+func (c *Config) AddFile(name string, data []byte) error {
+	file, diags := hclsyntax.ParseConfig(data, name, hcl.InitialPos)
+	if diags.HasErrors() {
+		return fmt.Errorf("failed to parse %s: %s", name, diags.Error())
+	}
+	body, ok := file.Body.(*hclsyntax.Body)
+	if !ok {
+		return fmt.Errorf("failed to parse %s: unexpected body type", name)
+	}
+
+	c.Files = append(c.Files, name)
+	for _, block := range body.Blocks {
+		c.Blocks = append(c.Blocks, &Block{
+			Kind:   block.Type,
+			Labels: block.Labels,
+			File:   name,
+			Body:   block.Body,
+			Source: data,
+		})
+	}
+	return nil
+}
+
+// Providers returns the sorted names of the providers configured or required by the configuration
+func (c *Config) Providers() []string {
+	seen := map[string]bool{}
+	for _, b := range c.Blocks {
+		switch b.Kind {
+		case KindProvider:
+			seen[b.Type()] = true
+		case KindTerraform:
+			for _, nested := range b.Body.Blocks {
+				if nested.Type != "required_providers" {
+					continue
+				}
+				for name := range nested.Body.Attributes {
+					seen[name] = true
+				}
+			}
+		}
+	}
+
+	providers := make([]string, 0, len(seen))
+	for name := range seen {
+		providers = append(providers, name)
+	}
+	sort.Strings(providers)
+	return providers
+}
@@ -0,0 +1,163 @@
+package terraform
+
+import (
+	"archive/zip"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+const testConfig = `
+terraform {
+  required_providers {
+    incapsula = {
+      source = "imperva/incapsula"
+    }
+  }
+}
+
+provider "incapsula" {
+  api_id = var.api_id
+}
+
+variable "api_id" {}
+variable "api_key" {}
+
+data "incapsula_data_center" "default" {
+  site_id = incapsula_site.example.id
+}
+
+resource "incapsula_site" "example" {
+  domain = "www.example.com"
+}
+
+resource "incapsula_site" "other" {
+  domain = "www.other.com"
+}
+
+resource "incapsula_policy" "acl" {
+  name = "ACL"
+}
+
+output "site_id" {
+  value = incapsula_site.example.id
+}
+`
+
+func writeArchive(t *testing.T, files map[string]string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "export.zip")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatalf("failed to create archive: %v", err)
+	}
+	defer f.Close()
+
+	zw := zip.NewWriter(f)
+	for name, content := range files {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatalf("failed to create zip entry: %v", err)
+		}
+		if _, err := w.Write([]byte(content)); err != nil {
+			t.Fatalf("failed to write zip entry: %v", err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatalf("failed to close zip: %v", err)
+	}
+	return path
+}
+
+func TestLoadArchive(t *testing.T) {
+	path := writeArchive(t, map[string]string{
+		"main.tf":   testConfig,
+		"extra.TF":  `provider "aws" {}`,
+		"README.md": "not terraform {",
+	})
+
+	config, err := LoadArchive(path)
+	if err != nil {
+		t.Fatalf("LoadArchive() error = %v", err)
+	}
+	if len(config.Files) != 2 {
+		t.Errorf("parsed files = %v, want main.tf and extra.TF", config.Files)
+	}
+
+	sites := config.Filter(KindResource)
+	if len(sites) != 3 || sites[0].Address() != "incapsula_site.example" || sites[0].File != "main.tf" {
+		t.Errorf("unexpected resources: %+v", sites)
+	}
+	data := config.Filter(KindData)
+	if len(data) != 1 || data[0].Address() != "data.incapsula_data_center.default" {
+		t.Errorf("unexpected data sources: %+v", data)
+	}
+	if got := config.Providers(); !reflect.DeepEqual(got, []string{"aws", "incapsula"}) {
+		t.Errorf("Providers() = %v", got)
+	}
+}
+
+func TestLoadArchive_Invalid(t *testing.T) {
+	path := writeArchive(t, map[string]string{"main.tf": `resource "incapsula_site" {`})
+	if _, err := LoadArchive(path); err == nil || !strings.Contains(err.Error(), "failed to parse main.tf") {
+		t.Errorf("LoadArchive() error = %v, want parse error", err)
+	}
+}
+
+func TestSummarize(t *testing.T) {
+	config := &Config{}
+	if err := config.AddFile("main.tf", []byte(testConfig)); err != nil {
+		t.Fatalf("AddFile() error = %v", err)
+	}
+
+	want := Summary{
+		Files:       1,
+		Resources:   3,
+		ByType:      map[string]int{"incapsula_site": 2, "incapsula_policy": 1},
+		DataSources: 1,
+		DataByType:  map[string]int{"incapsula_data_center": 1},
+		Variables:   2,
+		Outputs:     1,
+		Providers:   []string{"incapsula"},
+	}
+	if got := Summarize(config); !reflect.DeepEqual(got, want) {
+		t.Errorf("Summarize() = %+v, want %+v", got, want)
+	}
+}
+
+func TestLoadDir(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, "sites"), 0750); err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]string{
+		"main.tf":        testConfig,
+		"sites/extra.tf": `provider "aws" {}`,
+		"README.md":      "not terraform {",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	config, err := LoadDir(dir)
+	if err != nil {
+		t.Fatalf("LoadDir() error = %v", err)
+	}
+	sort.Strings(config.Files)
+	if !reflect.DeepEqual(config.Files, []string{"main.tf", "sites/extra.tf"}) {
+		t.Errorf("parsed files = %v", config.Files)
+	}
+	if len(config.Filter(KindResource)) != 3 {
+		t.Errorf("unexpected resources: %+v", config.Filter(KindResource))
+	}
+
+	missing, err := LoadDir(filepath.Join(dir, "missing"))
+	if err != nil || len(missing.Blocks) != 0 {
+		t.Errorf("LoadDir() of a missing directory = %+v, %v, want empty configuration", missing, err)
+	}
+}
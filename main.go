@@ -1,6 +1,7 @@
 package main
 
 import (
+	"errors"
 	"os"
 
 	"github.com/ren3gadem4rm0t/imperva-export-cli/internal/cmd"
@@ -10,11 +11,14 @@ import (
 
 func main() {
 	if err := cmd.Execute(); err != nil {
+		if errors.Is(err, cmd.ErrChanges) {
+			os.Exit(cmd.ExitError)
+		}
 		if zerolog.GlobalLevel() == zerolog.Disabled {
 			_, _ = os.Stderr.WriteString(err.Error() + "\n")
 		} else {
 			log.Error().Err(err).Msg("Error executing command")
 		}
-		os.Exit(1)
+		os.Exit(cmd.ExitCode(err))
 	}
 }
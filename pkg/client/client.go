@@ -0,0 +1,256 @@
+// Package client provides a Go client for the Imperva Account-Export API.
+//
+// A Client is constructed from explicit options and does not read any global
+// configuration, so it can be embedded in other tools:
+//
+//	c, err := client.New(
+//		client.WithCredentials(apiID, apiKey),
+//		client.WithLogger(logger),
+//	)
+//	handler, err := c.Export(ctx, caid)
+//	n, err := c.Wait(ctx, caid, handler, file)
+package client
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/rs/zerolog"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	// DefaultBaseURL is the base URL of the Imperva Account-Export API
+	DefaultBaseURL string = "https://api.imperva.com/account-export-import"
+	// DefaultUserAgent is sent when no user agent is configured
+	DefaultUserAgent string = "imperva-export-cli"
+
+	apiIDHeaderName  string = "x-API-Id"  // #nosec G101 -- False positive. This is the name of the header, not the value.
+	apiKeyHeaderName string = "x-API-Key" // #nosec G101 -- False positive. This is the name of the header, not the value.
+)
+
+// DefaultRetryableStatuses are the HTTP status codes retried when a policy does not list its own
+var DefaultRetryableStatuses = []int{
+	http.StatusTooManyRequests,
+	http.StatusInternalServerError,
+	http.StatusBadGateway,
+	http.StatusServiceUnavailable,
+	http.StatusGatewayTimeout,
+}
+
+// RetryPolicy controls how transient request failures are retried. A Retry-After header on a
+// retried response overrides the computed delay.
+type RetryPolicy struct {
+	// MaxRetries is the number of retries after the first attempt
+	MaxRetries int
+	// BaseDelay is the delay before the first retry, doubled on every further retry
+	BaseDelay time.Duration
+	// MaxDelay caps the delay between retries
+	MaxDelay time.Duration
+	// Jitter randomly shortens every delay by up to this fraction (0 to 1) so that
+	// concurrent clients do not retry in lockstep
+	Jitter float64
+	// RetryableStatuses are the HTTP status codes that are retried; nil uses DefaultRetryableStatuses
+	RetryableStatuses []int
+	// RetryBusy retries 403 responses stating that the resource is currently at work
+	RetryBusy bool
+	// BusyDelay is the delay before the first retry of a busy response, doubled on every further retry
+	// up to MaxDelay or BusyDelay, whichever is larger
+	BusyDelay time.Duration
+}
+
+// DefaultRetryPolicy returns the retry policy used when none is configured
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		MaxRetries: 3,
+		BaseDelay:  1 * time.Second,
+		MaxDelay:   30 * time.Second,
+		Jitter:     0.2,
+		BusyDelay:  10 * time.Second,
+	}
+}
+
+// validate checks that the policy's counts, delays and jitter are in range
+func (p RetryPolicy) validate() error {
+	if p.MaxRetries < 0 {
+		return fmt.Errorf("invalid retry policy: max retries must not be negative")
+	}
+	if p.BaseDelay < 0 || p.MaxDelay < 0 || p.BusyDelay < 0 {
+		return fmt.Errorf("invalid retry policy: delays must not be negative")
+	}
+	if p.Jitter < 0 || p.Jitter > 1 {
+		return fmt.Errorf("invalid retry policy: jitter must be between 0 and 1")
+	}
+	for _, status := range p.RetryableStatuses {
+		if status < 100 || status > 599 {
+			return fmt.Errorf("invalid retry policy: invalid status code %d", status)
+		}
+	}
+	return nil
+}
+
+// PollPolicy controls how often the export status is polled while waiting
+type PollPolicy struct {
+	// InitialDelay is the delay after the first poll, doubled on every further poll
+	InitialDelay time.Duration
+	// MaxDelay caps the delay between polls
+	MaxDelay time.Duration
+	// MaxAttempts is the maximum number of polls before giving up
+	MaxAttempts int
+}
+
+// DefaultPollPolicy returns the poll policy used when none is configured
+func DefaultPollPolicy() PollPolicy {
+	return PollPolicy{
+		InitialDelay: 1 * time.Second,
+		MaxDelay:     30 * time.Second,
+		MaxAttempts:  60,
+	}
+}
+
+// Client is a client for the Imperva Account-Export API
+type Client struct {
+	baseURL     string
+	apiID       string
+	apiKey      string
+	userAgent   string
+	httpClient  *http.Client
+	retry       RetryPolicy
+	poll        PollPolicy
+	logger      zerolog.Logger
+	statusHook  func(Status)
+	requestHook func(Attempt)
+	tracing     trace.TracerProvider
+	tracer      trace.Tracer
+}
+
+// Option configures a Client
+type Option func(*Client)
+
+// WithBaseURL sets the base URL of the API
+func WithBaseURL(baseURL string) Option {
+	return func(c *Client) {
+		c.baseURL = baseURL
+	}
+}
+
+// WithCredentials sets the API ID and API key used to authenticate requests
+func WithCredentials(apiID, apiKey string) Option {
+	return func(c *Client) {
+		c.apiID = apiID
+		c.apiKey = apiKey
+	}
+}
+
+// WithHTTPClient sets the HTTP client used to send requests. Use NewHTTPClient to build one with proxy, TLS
+// and timeout settings; by default a shared client with DefaultTransportConfig is used.
+func WithHTTPClient(httpClient *http.Client) Option {
+	return func(c *Client) {
+		c.httpClient = httpClient
+	}
+}
+
+// WithUserAgent sets the User-Agent header sent with every request
+func WithUserAgent(userAgent string) Option {
+	return func(c *Client) {
+		c.userAgent = userAgent
+	}
+}
+
+// WithRetryPolicy sets the retry policy for transient request failures
+func WithRetryPolicy(policy RetryPolicy) Option {
+	return func(c *Client) {
+		c.retry = policy
+	}
+}
+
+// WithPollPolicy sets the poll policy used while waiting for an export
+func WithPollPolicy(policy PollPolicy) Option {
+	return func(c *Client) {
+		c.poll = policy
+	}
+}
+
+// WithLogger sets the logger. By default the client does not log.
+func WithLogger(logger zerolog.Logger) Option {
+	return func(c *Client) {
+		c.logger = logger
+	}
+}
+
+// WithStatusHook sets a function that is called with the observed status after every poll
+func WithStatusHook(hook func(Status)) Option {
+	return func(c *Client) {
+		c.statusHook = hook
+	}
+}
+
+// Attempt describes a single HTTP attempt of a request, e.g. to record metrics
+type Attempt struct {
+	// Method is the HTTP method of the request
+	Method string
+	// Retry is the number of the attempt: 0 for the first one, 1 for the first retry and so on
+	Retry int
+	// Status is the status code of the response, or 0 if no response was received
+	Status int
+	// Err is the error of an attempt that received no response
+	Err error
+	// Duration is the time until the response headers were received or the attempt failed
+	Duration time.Duration
+}
+
+// WithRequestHook sets a function that is called after every HTTP attempt, including retries
+func WithRequestHook(hook func(Attempt)) Option {
+	return func(c *Client) {
+		c.requestHook = hook
+	}
+}
+
+// WithTracerProvider sets the OpenTelemetry tracer provider of the spans of HTTP attempts, polls and
+// downloads. By default the global tracer provider is used, which does not record spans unless one was
+// installed with otel.SetTracerProvider. The W3C trace context of the spans is sent with every request by the
+// global propagator.
+func WithTracerProvider(provider trace.TracerProvider) Option {
+	return func(c *Client) {
+		c.tracing = provider
+	}
+}
+
+// New creates a Client from the given options
+func New(opts ...Option) (*Client, error) {
+	c := &Client{
+		baseURL:    DefaultBaseURL,
+		userAgent:  DefaultUserAgent,
+		httpClient: defaultHTTPClient(),
+		retry:      DefaultRetryPolicy(),
+		poll:       DefaultPollPolicy(),
+		logger:     zerolog.Nop(),
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	if c.apiID == "" || c.apiKey == "" {
+		return nil, fmt.Errorf("API ID and API Key must be provided")
+	}
+	if err := ValidateBaseURL(c.baseURL); err != nil {
+		return nil, err
+	}
+	if c.httpClient == nil {
+		c.httpClient = defaultHTTPClient()
+	}
+	if err := c.retry.validate(); err != nil {
+		return nil, err
+	}
+	if c.poll.MaxAttempts <= 0 {
+		return nil, fmt.Errorf("invalid poll policy: max attempts must be positive")
+	}
+	if c.tracing == nil {
+		c.tracing = otel.GetTracerProvider()
+	}
+	c.tracer = c.tracing.Tracer(tracerName)
+
+	return c, nil
+}
@@ -0,0 +1,60 @@
+package client
+
+import (
+	"testing"
+)
+
+func TestNew(t *testing.T) {
+	tests := []struct {
+		name    string
+		opts    []Option
+		wantErr bool
+	}{
+		{
+			name: "defaults with credentials",
+			opts: []Option{WithCredentials("test-api-id", "test-api-key")},
+		},
+		{
+			name:    "missing credentials",
+			opts:    nil,
+			wantErr: true,
+		},
+		{
+			name:    "missing api key",
+			opts:    []Option{WithCredentials("test-api-id", "")},
+			wantErr: true,
+		},
+		{
+			name:    "invalid base url",
+			opts:    []Option{WithCredentials("test-api-id", "test-api-key"), WithBaseURL("://bad")},
+			wantErr: true,
+		},
+		{
+			name:    "base url without scheme",
+			opts:    []Option{WithCredentials("test-api-id", "test-api-key"), WithBaseURL("api.imperva.com")},
+			wantErr: true,
+		},
+		{
+			name:    "negative retries",
+			opts:    []Option{WithCredentials("test-api-id", "test-api-key"), WithRetryPolicy(RetryPolicy{MaxRetries: -1})},
+			wantErr: true,
+		},
+		{
+			name:    "no poll attempts",
+			opts:    []Option{WithCredentials("test-api-id", "test-api-key"), WithPollPolicy(PollPolicy{})},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := New(tt.opts...)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("New() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && c.baseURL != DefaultBaseURL {
+				t.Errorf("New() baseURL = %q, want %q", c.baseURL, DefaultBaseURL)
+			}
+		})
+	}
+}
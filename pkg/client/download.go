@@ -0,0 +1,382 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Status is the state of an export process
+type Status string
+
+// Export states reported by the download endpoint
+const (
+	StatusInProgress Status = "in_progress"
+	StatusReady      Status = "ready"
+)
+
+// ResumableWriter is a download destination that may already hold the beginning of the archive,
+// e.g. a partial file kept from an interrupted download. Download and Wait resume such a destination
+// with an HTTP Range request, and restart from the beginning if the server does not support ranges.
+// An interrupted transfer into a ResumableWriter is resumed up to the retry policy's MaxRetries times.
+type ResumableWriter interface {
+	io.Writer
+	// Size returns the number of bytes already written
+	Size() (int64, error)
+	// Reset discards all written bytes
+	Reset() error
+}
+
+// readError is returned when the response body could not be read completely; the transfer can be resumed
+type readError struct {
+	err error
+}
+
+func (e *readError) Error() string {
+	return fmt.Sprintf("error reading response body: %v", e.err)
+}
+
+func (e *readError) Unwrap() error {
+	return e.err
+}
+
+// Status checks whether an export is still in progress or ready for download.
+// The download endpoint doubles as the status endpoint, so a ready export is
+// transferred and discarded; use Download or Wait to keep the archive.
+func (c *Client) Status(ctx context.Context, caid int64, handler string) (Status, error) {
+	resp, err := c.requestDownload(ctx, caid, handler, 0)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK, http.StatusPartialContent:
+		return StatusReady, nil
+	case http.StatusAccepted:
+		return StatusInProgress, nil
+	default:
+		return "", unexpectedStatusError(resp)
+	}
+}
+
+// Download writes the archive of a finished export to w and returns the size of the archive,
+// including any bytes a ResumableWriter already held.
+// It returns ErrExportNotReady if the export is still in progress.
+func (c *Client) Download(ctx context.Context, caid int64, handler string, w io.Writer) (int64, error) {
+	resp, offset, err := c.requestArchive(ctx, caid, handler, w)
+	if err != nil {
+		return 0, err
+	}
+
+	switch resp.StatusCode {
+	case http.StatusOK, http.StatusPartialContent:
+		return c.readArchive(ctx, caid, handler, resp, offset, w)
+	case http.StatusAccepted:
+		_ = resp.Body.Close()
+		return 0, ErrExportNotReady
+	default:
+		err := unexpectedStatusError(resp)
+		_ = resp.Body.Close()
+		return 0, err
+	}
+}
+
+// Wait polls the export status until the export is ready, then writes the archive to w
+// and returns the size of the archive, including any bytes a ResumableWriter already held.
+func (c *Client) Wait(ctx context.Context, caid int64, handler string, w io.Writer) (int64, error) {
+	currentDelay := c.poll.InitialDelay
+	attempts := 0
+
+	c.logger.Info().Msg("Waiting for export to complete...")
+
+	for {
+		select {
+		case <-ctx.Done():
+			return 0, waitError(ctx)
+		default:
+		}
+
+		pollCtx, pollSpan := c.tracer.Start(ctx, "export.poll", trace.WithAttributes(
+			attrCAID.Int64(caid), attrHandler.String(handler), attrPoll.Int(attempts+1)))
+		resp, offset, err := c.requestArchive(pollCtx, caid, handler, w)
+		if err != nil {
+			endSpan(pollSpan, err)
+			return 0, err
+		}
+
+		switch resp.StatusCode {
+		case http.StatusOK, http.StatusPartialContent:
+			pollSpan.SetAttributes(attrStatus.String(string(StatusReady)))
+			pollSpan.End()
+			c.notifyStatus(StatusReady)
+			return c.readArchive(ctx, caid, handler, resp, offset, w)
+		case http.StatusAccepted:
+			pollSpan.SetAttributes(attrStatus.String(string(StatusInProgress)))
+			pollSpan.End()
+			c.notifyStatus(StatusInProgress)
+			c.logger.Info().Msg("Export still in progress...")
+			if err := resp.Body.Close(); err != nil {
+				return 0, fmt.Errorf("failed to close response body: %w", err)
+			}
+		default:
+			err := unexpectedStatusError(resp)
+			_ = resp.Body.Close()
+			endSpan(pollSpan, err)
+			return 0, err
+		}
+
+		_, waitSpan := c.tracer.Start(ctx, "export.poll_wait", trace.WithAttributes(
+			attrPoll.Int(attempts+1), attrDelay.Int64(currentDelay.Milliseconds())))
+		select {
+		case <-ctx.Done():
+			err := waitError(ctx)
+			endSpan(waitSpan, err)
+			return 0, err
+		case <-time.After(currentDelay):
+			waitSpan.End()
+			if currentDelay < c.poll.MaxDelay {
+				currentDelay *= 2
+				if currentDelay > c.poll.MaxDelay {
+					currentDelay = c.poll.MaxDelay
+				}
+			}
+			attempts++
+			if attempts >= c.poll.MaxAttempts {
+				return 0, fmt.Errorf("%w: maximum number of attempts (%d) reached", ErrWaitTimeout, c.poll.MaxAttempts)
+			}
+		}
+	}
+}
+
+// waitError builds the error for a wait that ended with the context. A cancelled context stopped the wait,
+// every other context error is a timeout.
+func waitError(ctx context.Context) error {
+	if errors.Is(ctx.Err(), context.Canceled) {
+		return fmt.Errorf("stopped waiting for export to complete: %w", ctx.Err())
+	}
+	return fmt.Errorf("%w: %w", ErrWaitTimeout, ctx.Err())
+}
+
+// ExportAndWait starts an export, waits for it to finish and writes the archive to w.
+// A nil resource exports the whole account. It returns the handler ID and the size of the archive.
+func (c *Client) ExportAndWait(ctx context.Context, caid int64, resource *Resource, w io.Writer) (string, int64, error) {
+	var handler string
+	var err error
+	if resource == nil {
+		handler, err = c.Export(ctx, caid)
+	} else {
+		handler, err = c.ExportResource(ctx, caid, *resource)
+	}
+	if err != nil {
+		return "", 0, err
+	}
+
+	c.logger.Info().Msgf("Export initiated. Handler ID: %s", handler)
+
+	n, err := c.Wait(ctx, caid, handler, w)
+	return handler, n, err
+}
+
+// requestDownload sends a request to the download endpoint of an export.
+// A positive offset requests the rest of the archive starting at that byte.
+func (c *Client) requestDownload(ctx context.Context, caid int64, handler string, offset int64) (*http.Response, error) {
+	if err := ValidateCAID(caid); err != nil {
+		return nil, err
+	}
+	if err := ValidateHandler(handler); err != nil {
+		return nil, err
+	}
+
+	url := fmt.Sprintf("%s/v3/export/download/%s?caid=%d", c.baseURL, handler, caid)
+	c.logger.Debug().Msgf("Checking export status at URL: %s", url)
+
+	req, err := c.newRequest(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	if offset > 0 {
+		c.logger.Debug().Msgf("Requesting archive from byte %d", offset)
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+	}
+
+	resp, err := c.send(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	c.logger.Debug().Msgf("Received status code %d", resp.StatusCode)
+	return resp, nil
+}
+
+// requestArchive requests the archive, resuming after the bytes a ResumableWriter already holds.
+// It returns the response and the offset it was requested from.
+func (c *Client) requestArchive(ctx context.Context, caid int64, handler string, w io.Writer) (*http.Response, int64, error) {
+	var offset int64
+	rw, resumable := w.(ResumableWriter)
+	if resumable {
+		size, err := rw.Size()
+		if err != nil {
+			return nil, 0, fmt.Errorf("failed to determine size of partial download: %w", err)
+		}
+		offset = size
+	}
+
+	resp, err := c.requestDownload(ctx, caid, handler, offset)
+	if err != nil {
+		return nil, 0, err
+	}
+	if resp.StatusCode != http.StatusRequestedRangeNotSatisfiable || offset == 0 {
+		return resp, offset, nil
+	}
+
+	// The partial download does not match the archive, start over
+	c.logger.Warn().Msgf("Server rejected resuming the download at byte %d, restarting download", offset)
+	_, _ = io.Copy(io.Discard, resp.Body)
+	_ = resp.Body.Close()
+	if err := rw.Reset(); err != nil {
+		return nil, 0, fmt.Errorf("failed to discard partial download: %w", err)
+	}
+	resp, err = c.requestDownload(ctx, caid, handler, 0)
+	if err != nil {
+		return nil, 0, err
+	}
+	return resp, 0, nil
+}
+
+// readArchive writes a ready response to w and closes its body. An interrupted transfer into a
+// ResumableWriter is resumed with a new range request.
+func (c *Client) readArchive(ctx context.Context, caid int64, handler string, resp *http.Response, offset int64, w io.Writer) (int64, error) {
+	ctx, span := c.tracer.Start(ctx, "export.download", trace.WithAttributes(
+		attrCAID.Int64(caid), attrHandler.String(handler), attrOffset.Int64(offset)))
+	total, err := c.transferArchive(ctx, caid, handler, resp, offset, w)
+	span.SetAttributes(attrBytes.Int64(total))
+	endSpan(span, err)
+	return total, err
+}
+
+// transferArchive receives the archive of readArchive, resuming interrupted transfers
+func (c *Client) transferArchive(ctx context.Context, caid int64, handler string, resp *http.Response, offset int64, w io.Writer) (int64, error) {
+	for attempt := 0; ; attempt++ {
+		total, err := c.receive(resp, offset, w)
+		closeErr := resp.Body.Close()
+		if err == nil {
+			if closeErr != nil {
+				return total, fmt.Errorf("failed to close response body: %w", closeErr)
+			}
+			return total, nil
+		}
+
+		var re *readError
+		if _, resumable := w.(ResumableWriter); !resumable || !errors.As(err, &re) || attempt >= c.retry.MaxRetries {
+			return total, err
+		}
+
+		c.logger.Warn().Err(err).Msgf("Download interrupted after %d bytes, resuming", total)
+		trace.SpanFromContext(ctx).AddEvent("resume", trace.WithAttributes(attrOffset.Int64(total), attrResumes.Int(attempt+1)))
+		if err := sleep(ctx, c.retry.backoff(attempt)); err != nil {
+			return total, fmt.Errorf("request context canceled: %w", err)
+		}
+
+		resp, offset, err = c.requestArchive(ctx, caid, handler, w)
+		if err != nil {
+			return total, err
+		}
+		if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusPartialContent {
+			err := unexpectedStatusError(resp)
+			_ = resp.Body.Close()
+			return total, err
+		}
+	}
+}
+
+// receive writes a 200 or 206 response body to w, which already holds offset bytes of the archive.
+// It returns the size of the archive written so far.
+func (c *Client) receive(resp *http.Response, offset int64, w io.Writer) (int64, error) {
+	switch {
+	case resp.StatusCode == http.StatusOK && offset > 0:
+		c.logger.Warn().Msg("Server does not support range requests, restarting download")
+		if err := w.(ResumableWriter).Reset(); err != nil {
+			return 0, fmt.Errorf("failed to discard partial download: %w", err)
+		}
+		offset = 0
+	case resp.StatusCode == http.StatusPartialContent:
+		contentRange := resp.Header.Get("Content-Range")
+		start, err := contentRangeStart(contentRange)
+		if err != nil || start != offset {
+			if rw, ok := w.(ResumableWriter); ok {
+				if err := rw.Reset(); err != nil {
+					return 0, fmt.Errorf("failed to discard partial download: %w", err)
+				}
+			}
+			return 0, fmt.Errorf("unexpected content range %q for download resumed at byte %d", contentRange, offset)
+		}
+		c.logger.Info().Msgf("Resuming download at byte %d", offset)
+	}
+
+	n, err := c.copyBody(w, resp.Body)
+	total := offset + n
+	if err != nil {
+		return total, err
+	}
+	if resp.ContentLength >= 0 && n != resp.ContentLength {
+		return total, &readError{err: fmt.Errorf("incomplete download: received %d of %d bytes", n, resp.ContentLength)}
+	}
+	return total, nil
+}
+
+// contentRangeStart returns the first byte position of a Content-Range header such as "bytes 100-199/200"
+func contentRangeStart(contentRange string) (int64, error) {
+	rangeSpec, ok := strings.CutPrefix(contentRange, "bytes ")
+	if !ok {
+		return 0, fmt.Errorf("invalid content range: %q", contentRange)
+	}
+	start, _, ok := strings.Cut(rangeSpec, "-")
+	if !ok {
+		return 0, fmt.Errorf("invalid content range: %q", contentRange)
+	}
+	return strconv.ParseInt(start, 10, 64)
+}
+
+// copyBody streams the response body to w
+func (c *Client) copyBody(w io.Writer, body io.Reader) (int64, error) {
+	buffer := make([]byte, 32*1024)
+	var totalBytes int64 = 0
+	for {
+		n, readErr := body.Read(buffer)
+		if n > 0 {
+			if _, writeErr := w.Write(buffer[:n]); writeErr != nil {
+				c.logger.Error().Err(writeErr).Msg("Failed to write export file")
+				return totalBytes, fmt.Errorf("failed to write export file: %w", writeErr)
+			}
+			totalBytes += int64(n)
+		}
+		if readErr != nil {
+			if readErr != io.EOF {
+				c.logger.Error().Err(readErr).Msg("Error reading response body")
+				return totalBytes, &readError{err: readErr}
+			}
+			return totalBytes, nil
+		}
+	}
+}
+
+func (c *Client) notifyStatus(status Status) {
+	if c.statusHook != nil {
+		c.statusHook(status)
+	}
+}
+
+// unexpectedStatusError builds the error for a response that is neither ready nor in progress
+func unexpectedStatusError(resp *http.Response) error {
+	if err := HandleHTTPError(resp); err != nil {
+		return fmt.Errorf("API error: %w", err)
+	}
+	return fmt.Errorf("unexpected status code %d", resp.StatusCode)
+}
@@ -0,0 +1,349 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+const testHandler = "28c5f5af-bd9e-423f-99a7-d2a8c440db7e"
+
+// pollingServer answers the download endpoint with 202 for the given number of polls, then serves the content
+func pollingServer(t *testing.T, pending int, content string) *httptest.Server {
+	t.Helper()
+	polls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodPost && r.URL.Path == "/v3/export":
+			w.WriteHeader(http.StatusAccepted)
+			_, _ = w.Write([]byte(`{"handler": "` + testHandler + `", "status": "Export is in progress"}`))
+		case r.Method == http.MethodGet && r.URL.Path == "/v3/export/download/"+testHandler:
+			if polls < pending {
+				polls++
+				w.WriteHeader(http.StatusAccepted)
+				return
+			}
+			w.WriteHeader(http.StatusOK)
+			_, _ = w.Write([]byte(content))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = w.Write([]byte(`{"errors":[{"status":404,"title":"Not Found","detail":"Unknown export"}]}`))
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestClientStatus(t *testing.T) {
+	server := pollingServer(t, 1, "export file content")
+	c := newTestClient(t, server.URL)
+
+	status, err := c.Status(context.Background(), 123456, testHandler)
+	if err != nil {
+		t.Fatalf("Status() error = %v", err)
+	}
+	if status != StatusInProgress {
+		t.Errorf("Status() = %q, want %q", status, StatusInProgress)
+	}
+
+	status, err = c.Status(context.Background(), 123456, testHandler)
+	if err != nil {
+		t.Fatalf("Status() error = %v", err)
+	}
+	if status != StatusReady {
+		t.Errorf("Status() = %q, want %q", status, StatusReady)
+	}
+
+	if _, err := c.Status(context.Background(), 123456, "invalid-handler"); err == nil {
+		t.Errorf("Status() expected error for invalid handler")
+	}
+}
+
+func TestClientDownload(t *testing.T) {
+	server := pollingServer(t, 1, "export file content")
+	c := newTestClient(t, server.URL)
+
+	var buf bytes.Buffer
+	if _, err := c.Download(context.Background(), 123456, testHandler, &buf); !errors.Is(err, ErrExportNotReady) {
+		t.Fatalf("Download() error = %v, want %v", err, ErrExportNotReady)
+	}
+
+	n, err := c.Download(context.Background(), 123456, testHandler, &buf)
+	if err != nil {
+		t.Fatalf("Download() error = %v", err)
+	}
+	if n != int64(len("export file content")) || buf.String() != "export file content" {
+		t.Errorf("Download() wrote %d bytes %q", n, buf.String())
+	}
+}
+
+func TestClientWait(t *testing.T) {
+	server := pollingServer(t, 3, "export file content")
+
+	var statuses []Status
+	c := newTestClient(t, server.URL, WithStatusHook(func(s Status) {
+		statuses = append(statuses, s)
+	}))
+
+	var buf bytes.Buffer
+	n, err := c.Wait(context.Background(), 123456, testHandler, &buf)
+	if err != nil {
+		t.Fatalf("Wait() error = %v", err)
+	}
+	if n != int64(buf.Len()) || buf.String() != "export file content" {
+		t.Errorf("Wait() wrote %d bytes %q", n, buf.String())
+	}
+	want := []Status{StatusInProgress, StatusInProgress, StatusInProgress, StatusReady}
+	if len(statuses) != len(want) {
+		t.Fatalf("status hook called with %v, want %v", statuses, want)
+	}
+	for i := range want {
+		if statuses[i] != want[i] {
+			t.Errorf("status hook call %d = %q, want %q", i, statuses[i], want[i])
+		}
+	}
+}
+
+func TestClientWait_Errors(t *testing.T) {
+	t.Run("max attempts", func(t *testing.T) {
+		server := pollingServer(t, 100, "export file content")
+		c := newTestClient(t, server.URL, WithPollPolicy(PollPolicy{InitialDelay: time.Millisecond, MaxDelay: time.Millisecond, MaxAttempts: 2}))
+
+		if _, err := c.Wait(context.Background(), 123456, testHandler, &bytes.Buffer{}); !errors.Is(err, ErrWaitTimeout) {
+			t.Errorf("Wait() error = %v, want ErrWaitTimeout after max attempts", err)
+		}
+	})
+
+	t.Run("not found", func(t *testing.T) {
+		server := pollingServer(t, 0, "")
+		c := newTestClient(t, server.URL)
+
+		if _, err := c.Wait(context.Background(), 123456, "12345678-1234-1234-1234-1234567890ab", &bytes.Buffer{}); err == nil {
+			t.Errorf("Wait() expected error for unknown export")
+		}
+	})
+
+	t.Run("context canceled", func(t *testing.T) {
+		server := pollingServer(t, 100, "export file content")
+		c := newTestClient(t, server.URL, WithPollPolicy(PollPolicy{InitialDelay: time.Second, MaxDelay: time.Second, MaxAttempts: 10}))
+
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		_, err := c.Wait(ctx, 123456, testHandler, &bytes.Buffer{})
+		if !errors.Is(err, ErrWaitTimeout) || !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("Wait() error = %v, want ErrWaitTimeout wrapping the context error", err)
+		}
+	})
+}
+
+func TestClientExportAndWait(t *testing.T) {
+	server := pollingServer(t, 2, "export file content")
+	c := newTestClient(t, server.URL)
+
+	var buf bytes.Buffer
+	handler, n, err := c.ExportAndWait(context.Background(), 123456, nil, &buf)
+	if err != nil {
+		t.Fatalf("ExportAndWait() error = %v", err)
+	}
+	if handler != testHandler {
+		t.Errorf("ExportAndWait() handler = %q, want %q", handler, testHandler)
+	}
+	if n != int64(len("export file content")) {
+		t.Errorf("ExportAndWait() bytes = %d", n)
+	}
+}
+
+// memoryFile is an in-memory ResumableWriter
+type memoryFile struct {
+	bytes.Buffer
+}
+
+func (f *memoryFile) Size() (int64, error) {
+	return int64(f.Len()), nil
+}
+
+func (f *memoryFile) Reset() error {
+	f.Buffer.Reset()
+	return nil
+}
+
+// testArchive returns deterministic archive content larger than the copy buffer
+func testArchive() []byte {
+	content := make([]byte, 100*1024)
+	for i := range content {
+		content[i] = byte(i % 251)
+	}
+	return content
+}
+
+// cutConnection sends the headers of a full response and part of the body, then drops the connection
+func cutConnection(t *testing.T, w http.ResponseWriter, content []byte, sent int) {
+	t.Helper()
+	w.Header().Set("Content-Length", strconv.Itoa(len(content)))
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(content[:sent])
+	w.(http.Flusher).Flush()
+	conn, _, err := w.(http.Hijacker).Hijack()
+	if err != nil {
+		t.Errorf("failed to hijack connection: %v", err)
+		return
+	}
+	_ = conn.Close()
+}
+
+func TestClientDownload_ResumesInterruptedTransfer(t *testing.T) {
+	content := testArchive()
+	var ranges []string
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		ranges = append(ranges, r.Header.Get("Range"))
+		if requests == 1 {
+			cutConnection(t, w, content, 40*1024)
+			return
+		}
+		http.ServeContent(w, r, "export.zip", time.Time{}, bytes.NewReader(content))
+	}))
+	defer server.Close()
+
+	c := newTestClient(t, server.URL)
+
+	var file memoryFile
+	n, err := c.Download(context.Background(), 123456, testHandler, &file)
+	if err != nil {
+		t.Fatalf("Download() error = %v", err)
+	}
+	if n != int64(len(content)) || !bytes.Equal(file.Bytes(), content) {
+		t.Fatalf("Download() size = %d, content match = %v", n, bytes.Equal(file.Bytes(), content))
+	}
+	if len(ranges) != 2 || ranges[0] != "" || ranges[1] != "bytes=40960-" {
+		t.Errorf("Range headers = %q, want [\"\" \"bytes=40960-\"]", ranges)
+	}
+}
+
+func TestClientDownload_ResumesPartialWriter(t *testing.T) {
+	content := testArchive()
+
+	tests := []struct {
+		name    string
+		partial []byte
+		handler func(w http.ResponseWriter, r *http.Request)
+	}{
+		{
+			name:    "server supports ranges",
+			partial: content[:1000],
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				if r.Header.Get("Range") != "bytes=1000-" {
+					t.Errorf("Range header = %q, want bytes=1000-", r.Header.Get("Range"))
+				}
+				http.ServeContent(w, r, "export.zip", time.Time{}, bytes.NewReader(content))
+			},
+		},
+		{
+			name:    "server ignores ranges",
+			partial: []byte("stale partial download"),
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusOK)
+				_, _ = w.Write(content)
+			},
+		},
+		{
+			name:    "range not satisfiable",
+			partial: make([]byte, len(content)+10),
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				http.ServeContent(w, r, "export.zip", time.Time{}, bytes.NewReader(content))
+			},
+		},
+		{
+			name:    "unexpected content range",
+			partial: content[:1000],
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				if r.Header.Get("Range") != "" {
+					w.Header().Set("Content-Range", fmt.Sprintf("bytes 0-%d/%d", len(content)-1, len(content)))
+					w.WriteHeader(http.StatusPartialContent)
+					_, _ = w.Write(content)
+					return
+				}
+				w.WriteHeader(http.StatusOK)
+				_, _ = w.Write(content)
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(tt.handler))
+			defer server.Close()
+
+			c := newTestClient(t, server.URL)
+
+			var file memoryFile
+			file.Write(tt.partial)
+
+			n, err := c.Download(context.Background(), 123456, testHandler, &file)
+			if err != nil {
+				if tt.name != "unexpected content range" {
+					t.Fatalf("Download() error = %v", err)
+				}
+				// The mismatched partial download is discarded, so the next attempt starts over
+				if file.Len() != 0 {
+					t.Fatalf("partial download was not discarded after content range mismatch")
+				}
+				n, err = c.Download(context.Background(), 123456, testHandler, &file)
+				if err != nil {
+					t.Fatalf("Download() retry error = %v", err)
+				}
+			}
+			if n != int64(len(content)) || !bytes.Equal(file.Bytes(), content) {
+				t.Errorf("Download() size = %d, content match = %v", n, bytes.Equal(file.Bytes(), content))
+			}
+		})
+	}
+}
+
+func TestClientDownload_InterruptedWithoutResume(t *testing.T) {
+	content := testArchive()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cutConnection(t, w, content, 1024)
+	}))
+	defer server.Close()
+
+	c := newTestClient(t, server.URL)
+
+	var buf bytes.Buffer
+	if _, err := c.Download(context.Background(), 123456, testHandler, &buf); err == nil {
+		t.Fatalf("Download() expected error for interrupted transfer")
+	}
+}
+
+func TestContentRangeStart(t *testing.T) {
+	tests := []struct {
+		header  string
+		want    int64
+		wantErr bool
+	}{
+		{"bytes 100-199/200", 100, false},
+		{"bytes 0-0/1", 0, false},
+		{"bytes */200", 0, true},
+		{"items 1-2/3", 0, true},
+		{"", 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.header, func(t *testing.T) {
+			got, err := contentRangeStart(tt.header)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("contentRangeStart(%q) error = %v, wantErr %v", tt.header, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("contentRangeStart(%q) = %d, want %d", tt.header, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,95 @@
+package client
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// ErrExportNotReady is returned by Download when the export is still in progress
+var ErrExportNotReady = errors.New("export is still in progress")
+
+// ErrWaitTimeout is returned by Wait when the context expires or the poll policy's MaxAttempts are used up
+// before the export is ready
+var ErrWaitTimeout = errors.New("timed out while waiting for export to complete")
+
+// ErrResourceBusy is returned when a request for a resource that is currently at work was retried until
+// the retry policy's MaxRetries were used up
+var ErrResourceBusy = errors.New("resource is currently at work")
+
+// APIError represents an error returned by the API
+type APIError struct {
+	Status int    `json:"status"`
+	ID     string `json:"id"`
+	Code   string `json:"code"`
+	Source struct {
+		Pointer string `json:"pointer"`
+	} `json:"source"`
+	Title  string `json:"title"`
+	Detail string `json:"detail"`
+}
+
+// ErrorResponse represents the error response structure. As an error it wraps every APIError,
+// so errors.As can extract the first one.
+type ErrorResponse struct {
+	Errors []APIError `json:"errors"`
+}
+
+// Error implements the error interface for ErrorResponse
+func (e *ErrorResponse) Error() string {
+	var errorMessages []string
+	for _, apiErr := range e.Errors {
+		errorMessages = append(errorMessages, apiErr.Error())
+	}
+	return fmt.Sprintf("API errors: %s", strings.Join(errorMessages, "; "))
+}
+
+// Unwrap returns the API errors of the response
+func (e *ErrorResponse) Unwrap() []error {
+	errs := make([]error, len(e.Errors))
+	for i, apiErr := range e.Errors {
+		errs[i] = apiErr
+	}
+	return errs
+}
+
+// Error implements the error interface for APIError
+func (e APIError) Error() string {
+	return fmt.Sprintf("API error: %s - %s (Status Code: %d)", e.Title, e.Detail, e.Status)
+}
+
+// Busy reports whether the error is the documented 403 response for a resource that is currently at work
+func (e APIError) Busy() bool {
+	return e.Status == http.StatusForbidden &&
+		(strings.Contains(e.Detail, busyMarker) || strings.Contains(e.Title, busyMarker))
+}
+
+// ParseAPIError parses the API error response
+func ParseAPIError(resp *http.Response) error {
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read error response body: %w", err)
+	}
+
+	var errorResponse ErrorResponse
+	if err := json.Unmarshal(body, &errorResponse); err != nil {
+		return fmt.Errorf("failed to parse error response: %w", err)
+	}
+
+	if len(errorResponse.Errors) == 0 {
+		return fmt.Errorf("API error: unknown error, status code %d, response body: %s", resp.StatusCode, string(body))
+	}
+
+	return &errorResponse
+}
+
+// HandleHTTPError handles HTTP errors by parsing API error responses
+func HandleHTTPError(resp *http.Response) error {
+	if resp.StatusCode >= 400 {
+		return ParseAPIError(resp)
+	}
+	return nil
+}
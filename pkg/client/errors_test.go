@@ -0,0 +1,122 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestHandleHTTPError(t *testing.T) {
+	tests := []struct {
+		statusCode int
+		body       string
+		wantErr    bool
+	}{
+		{200, ``, false},
+		{400, `{"errors":[{"status":400,"id":"error1","code":"BadRequest","source":{"pointer":"/export"},"title":"Bad Request","detail":"Invalid input"}]}`, true},
+		{401, `{"errors":[{"status":401,"id":"error2","code":"Unauthorized","source":{"pointer":"/export"},"title":"Authentication Error","detail":"Authentication missing or invalid"}]}`, true},
+		{500, `{"errors":[{"status":500,"id":"error3","code":"InternalError","source":{"pointer":"/export"},"title":"Internal Server Error","detail":"Something went wrong"}]}`, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("StatusCode_%d", tt.statusCode), func(t *testing.T) {
+			resp := &http.Response{
+				StatusCode: tt.statusCode,
+				Body:       io.NopCloser(strings.NewReader(tt.body)),
+			}
+			err := HandleHTTPError(resp)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("HandleHTTPError() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestParseAPIError_Errors(t *testing.T) {
+	tests := []struct {
+		name       string
+		statusCode int
+		body       string
+		errorMsg   string
+	}{
+		{
+			name:       "Bad JSON",
+			statusCode: 400,
+			body:       `invalid json`,
+			errorMsg:   "failed to parse error response: invalid character 'i' looking for beginning of value",
+		},
+		{
+			name:       "No Errors",
+			statusCode: 404,
+			body:       `{"errors":[]}`,
+			errorMsg:   "unknown error, status code 404, response body: {\"errors\":[]}",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := &http.Response{
+				StatusCode: tt.statusCode,
+				Body:       io.NopCloser(strings.NewReader(tt.body)),
+			}
+			err := ParseAPIError(resp)
+			if err == nil {
+				t.Errorf("ParseAPIError() expected error, got none")
+			}
+			if !strings.Contains(err.Error(), tt.errorMsg) {
+				t.Errorf("ParseAPIError() error message = %v, want substring %v", err.Error(), tt.errorMsg)
+			}
+		})
+	}
+}
+
+func TestParseAPIError_Success(t *testing.T) {
+	resp := &http.Response{
+		StatusCode: 200,
+		Body:       io.NopCloser(strings.NewReader(``)),
+	}
+	// Do not call ParseAPIError for successful responses
+	// Instead, HandleHTTPError should handle it and not return an error
+	err := HandleHTTPError(resp)
+	if err != nil {
+		t.Errorf("HandleHTTPError() expected no error for status code 200, got %v", err)
+	}
+}
+
+func TestParseAPIError_As(t *testing.T) {
+	resp := &http.Response{
+		StatusCode: 403,
+		Body:       io.NopCloser(strings.NewReader(`{"errors":[{"status":403,"id":"20014b504cb97819","source":{"pointer":"/export"},"title":"Operation Forbidden","detail":"currently at work"}]}`)),
+	}
+	err := fmt.Errorf("API error: %w", ParseAPIError(resp))
+
+	var apiErr APIError
+	if !errors.As(err, &apiErr) {
+		t.Fatalf("errors.As(%v) found no APIError", err)
+	}
+	if apiErr.Status != 403 || apiErr.Title != "Operation Forbidden" || apiErr.Source.Pointer != "/export" {
+		t.Errorf("APIError = %+v", apiErr)
+	}
+	if want := "API error: API errors: API error: Operation Forbidden - currently at work (Status Code: 403)"; err.Error() != want {
+		t.Errorf("Error() = %q, want %q", err.Error(), want)
+	}
+}
+
+func TestAPIError_Busy(t *testing.T) {
+	tests := []struct {
+		err  APIError
+		want bool
+	}{
+		{APIError{Status: 403, Title: "Operation Forbidden", Detail: "This resource is currently at work. Please try again later"}, true},
+		{APIError{Status: 403, Title: "Operation Forbidden", Detail: "Access denied"}, false},
+		{APIError{Status: 500, Detail: "currently at work"}, false},
+	}
+	for _, tt := range tests {
+		if got := tt.err.Busy(); got != tt.want {
+			t.Errorf("Busy() of %+v = %v, want %v", tt.err, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,92 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// ResourceType is the type of a root resource that can be exported on its own
+type ResourceType string
+
+// Resource types accepted by the single-resource export endpoint
+const (
+	ResourceSite   ResourceType = "SITE"
+	ResourcePolicy ResourceType = "POLICY"
+)
+
+// Resource identifies a single root resource to export instead of the whole account
+type Resource struct {
+	Type ResourceType `json:"type"`
+	ID   int64        `json:"id"`
+}
+
+// AsyncResponse represents the asynchronous response from the export API
+type AsyncResponse struct {
+	Handler string `json:"handler"`
+	Status  string `json:"status"`
+}
+
+// Export starts the export process for an account and returns the handler ID
+func (c *Client) Export(ctx context.Context, caid int64) (string, error) {
+	if err := ValidateCAID(caid); err != nil {
+		return "", err
+	}
+
+	url := fmt.Sprintf("%s/v3/export?caid=%d", c.baseURL, caid)
+
+	c.logger.Debug().Msgf("Initiating export for CAID: %d", caid)
+	c.logger.Debug().Msgf("Export URL: %s", url)
+
+	return c.requestExport(ctx, url)
+}
+
+// ExportResource starts the export process for a single site or policy and returns the handler ID
+func (c *Client) ExportResource(ctx context.Context, caid int64, resource Resource) (string, error) {
+	if err := ValidateCAID(caid); err != nil {
+		return "", err
+	}
+	if err := ValidateResourceType(resource.Type); err != nil {
+		return "", err
+	}
+	if err := ValidateResourceID(resource.ID); err != nil {
+		return "", err
+	}
+
+	resourceType := strings.ToUpper(strings.TrimSpace(string(resource.Type)))
+	url := fmt.Sprintf("%s/v3/export/%s/%d?caid=%d", c.baseURL, resourceType, resource.ID, caid)
+
+	c.logger.Debug().Msgf("Initiating %s export for CAID: %d, ID: %d", resourceType, caid, resource.ID)
+	c.logger.Debug().Msgf("Export URL: %s", url)
+
+	return c.requestExport(ctx, url)
+}
+
+// requestExport sends an export initiation request and decodes the handler from the response
+func (c *Client) requestExport(ctx context.Context, url string) (string, error) {
+	resp, err := c.do(ctx, http.MethodPost, url, nil)
+	if err != nil {
+		c.logger.Error().Err(err).Msg("Failed to initiate export")
+		return "", fmt.Errorf("failed to initiate export: %w", err)
+	}
+	defer resp.Body.Close()
+
+	c.logger.Debug().Msgf("Received status code %d", resp.StatusCode)
+	if err := HandleHTTPError(resp); err != nil {
+		return "", fmt.Errorf("error response from export initiation: %w", err)
+	}
+
+	var asyncResp AsyncResponse
+	decoder := json.NewDecoder(resp.Body)
+	if err := decoder.Decode(&asyncResp); err != nil {
+		return "", fmt.Errorf("failed to decode export initiation response: %w", err)
+	}
+
+	if asyncResp.Handler == "" {
+		return "", fmt.Errorf("received empty handler in response")
+	}
+
+	return asyncResp.Handler, nil
+}
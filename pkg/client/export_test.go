@@ -0,0 +1,119 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestClientExport(t *testing.T) {
+	tests := []struct {
+		name          string
+		caid          int64
+		serverHandler func(w http.ResponseWriter, r *http.Request)
+		wantHandler   string
+		wantErr       bool
+	}{
+		{
+			name: "successful export initiation",
+			caid: 123456,
+			serverHandler: func(w http.ResponseWriter, r *http.Request) {
+				if r.Method != http.MethodPost || r.URL.Path != "/v3/export" || r.URL.Query().Get("caid") != "123456" {
+					w.WriteHeader(http.StatusNotFound)
+					return
+				}
+				if r.Header.Get("x-API-Id") != "test-api-id" || r.Header.Get("x-API-Key") != "test-api-key" {
+					w.WriteHeader(http.StatusUnauthorized)
+					return
+				}
+				w.WriteHeader(http.StatusAccepted)
+				_, _ = w.Write([]byte(`{"handler": "28c5f5af-bd9e-423f-99a7-d2a8c440db7e", "status": "Export is in progress"}`))
+			},
+			wantHandler: "28c5f5af-bd9e-423f-99a7-d2a8c440db7e",
+		},
+		{
+			name: "resource busy",
+			caid: 123456,
+			serverHandler: func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusForbidden)
+				_, _ = w.Write([]byte(`{"errors":[{"status":403,"id":"error-id","source":{"pointer":"/export"},"title":"Operation Forbidden","detail":"This resource, or one of its associated resources, is currently at work. Please try again later"}]}`))
+			},
+			wantErr: true,
+		},
+		{
+			name: "invalid caid",
+			caid: 0,
+			serverHandler: func(w http.ResponseWriter, r *http.Request) {
+				t.Errorf("unexpected request for invalid caid")
+			},
+			wantErr: true,
+		},
+		{
+			name: "empty handler",
+			caid: 123456,
+			serverHandler: func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusAccepted)
+				_, _ = w.Write([]byte(`{"handler": "", "status": "Export is in progress"}`))
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(tt.serverHandler))
+			defer server.Close()
+
+			c := newTestClient(t, server.URL)
+
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+
+			handler, err := c.Export(ctx, tt.caid)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Export() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if handler != tt.wantHandler {
+				t.Errorf("Export() handler = %v, want %v", handler, tt.wantHandler)
+			}
+		})
+	}
+}
+
+func TestClientExportResource(t *testing.T) {
+	tests := []struct {
+		name     string
+		resource Resource
+		wantPath string
+		wantErr  bool
+	}{
+		{"site", Resource{Type: ResourceSite, ID: 1234}, "/v3/export/SITE/1234", false},
+		{"policy lower case", Resource{Type: "policy", ID: 5678}, "/v3/export/POLICY/5678", false},
+		{"invalid type", Resource{Type: "ACCOUNT", ID: 1234}, "", true},
+		{"invalid id", Resource{Type: ResourceSite, ID: -1}, "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var gotPath string
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				gotPath = r.URL.Path
+				w.WriteHeader(http.StatusAccepted)
+				_, _ = w.Write([]byte(`{"handler": "28c5f5af-bd9e-423f-99a7-d2a8c440db7e", "status": "Export is in progress"}`))
+			}))
+			defer server.Close()
+
+			c := newTestClient(t, server.URL)
+
+			_, err := c.ExportResource(context.Background(), 123456, tt.resource)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ExportResource() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if gotPath != tt.wantPath {
+				t.Errorf("ExportResource() path = %q, want %q", gotPath, tt.wantPath)
+			}
+		})
+	}
+}
@@ -0,0 +1,233 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// do makes an authenticated HTTP request with retry logic
+func (c *Client) do(ctx context.Context, method, rawURL string, body io.Reader) (*http.Response, error) {
+	req, err := c.newRequest(ctx, method, rawURL, body)
+	if err != nil {
+		return nil, err
+	}
+	return c.send(ctx, req)
+}
+
+// newRequest creates an authenticated HTTP request
+func (c *Client) newRequest(ctx context.Context, method, rawURL string, body io.Reader) (*http.Request, error) {
+	parsedURL, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid URL '%s': %w", rawURL, err)
+	}
+
+	sanitizedURL := parsedURL.String()
+
+	req, err := http.NewRequestWithContext(ctx, method, sanitizedURL, body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set(apiIDHeaderName, c.apiID)
+	req.Header.Set(apiKeyHeaderName, c.apiKey)
+	req.Header.Set("User-Agent", c.userAgent)
+	return req, nil
+}
+
+// send sends the request with retry logic
+func (c *Client) send(ctx context.Context, req *http.Request) (*http.Response, error) {
+	resp, err := c.retryableRequest(ctx, req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send request: %w", err)
+	}
+
+	return resp, nil
+}
+
+// busyMarker identifies the documented 403 response for a resource that is currently at work
+const busyMarker string = "currently at work"
+
+// maxBusyBodySize limits how much of a 403 response body is read to detect the busy response
+const maxBusyBodySize int64 = 64 << 10
+
+// retryableRequest performs the HTTP request with retries on transient errors.
+// Responses with a status the policy does not retry, e.g. 401, are returned to the caller immediately.
+func (c *Client) retryableRequest(ctx context.Context, req *http.Request) (*http.Response, error) {
+	maxRetries := c.retry.MaxRetries
+	var resp *http.Response
+	var err error
+
+	for attempt := 0; attempt <= maxRetries; attempt++ {
+		attemptCtx, span := c.startAttempt(ctx, req, attempt)
+		clonedReq := req.Clone(attemptCtx)
+		injectTraceContext(attemptCtx, clonedReq)
+
+		start := time.Now()
+		resp, err = c.httpClient.Do(clonedReq)
+		endAttempt(span, resp, err)
+		c.notifyAttempt(req.Method, attempt, resp, err, time.Since(start))
+		busy := false
+		if err == nil {
+			if busy, err = c.isBusy(resp); err != nil {
+				_ = resp.Body.Close()
+				resp = nil
+			} else if !busy && !c.retry.retryable(resp.StatusCode) {
+				return resp, nil
+			}
+		}
+
+		delay := c.retry.backoff(attempt)
+		if busy {
+			delay = c.retry.busyBackoff(attempt)
+		}
+		if resp != nil {
+			if retryAfter, ok := parseRetryAfter(resp.Header.Get("Retry-After"), time.Now()); ok {
+				delay = retryAfter
+			}
+			_, copyErr := io.Copy(io.Discard, resp.Body)
+			closeErr := resp.Body.Close()
+			if copyErr != nil {
+				c.logger.Warn().Err(copyErr).Msg("Error discarding response body")
+			}
+			if closeErr != nil {
+				c.logger.Warn().Err(closeErr).Msg("Error closing response body")
+			}
+		}
+
+		// If the last attempt, return the error
+		if attempt == maxRetries {
+			if busy {
+				return nil, fmt.Errorf("request failed after %d retries: %w", maxRetries, ErrResourceBusy)
+			}
+			if err == nil {
+				return nil, fmt.Errorf("request failed after %d retries with status code: %d", maxRetries, resp.StatusCode)
+			}
+			return nil, fmt.Errorf("request failed after %d retries: %w", maxRetries, err)
+		}
+
+		if ctx.Err() != nil {
+			return nil, fmt.Errorf("request context canceled: %w", ctx.Err())
+		}
+
+		if err != nil {
+			c.logger.Debug().Err(err).Msgf("Request failed, retrying in %s", delay)
+		} else {
+			c.logger.Debug().Msgf("Received status code %d, retrying in %s", resp.StatusCode, delay)
+		}
+		if err := sleep(ctx, delay); err != nil {
+			return nil, fmt.Errorf("request context canceled: %w", err)
+		}
+	}
+
+	return nil, fmt.Errorf("request failed after %d retries: %w", maxRetries, err)
+}
+
+// notifyAttempt calls the request hook with the outcome of an attempt
+func (c *Client) notifyAttempt(method string, retry int, resp *http.Response, err error, duration time.Duration) {
+	if c.requestHook == nil {
+		return
+	}
+	attempt := Attempt{Method: method, Retry: retry, Err: err, Duration: duration}
+	if resp != nil {
+		attempt.Status = resp.StatusCode
+	}
+	c.requestHook(attempt)
+}
+
+// isBusy reports whether the response is a 403 for a resource that is currently at work and the policy
+// retries it. The body of a 403 response is buffered so the caller can still read it.
+func (c *Client) isBusy(resp *http.Response) (bool, error) {
+	if !c.retry.RetryBusy || resp.StatusCode != http.StatusForbidden {
+		return false, nil
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxBusyBodySize))
+	if err != nil {
+		return false, fmt.Errorf("failed to read response body: %w", err)
+	}
+	_ = resp.Body.Close()
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	return bytes.Contains(body, []byte(busyMarker)), nil
+}
+
+// retryable reports whether a response with the given status code is retried
+func (p RetryPolicy) retryable(status int) bool {
+	statuses := p.RetryableStatuses
+	if statuses == nil {
+		statuses = DefaultRetryableStatuses
+	}
+	for _, s := range statuses {
+		if s == status {
+			return true
+		}
+	}
+	return false
+}
+
+// backoff returns the delay before the retry following the given attempt
+func (p RetryPolicy) backoff(attempt int) time.Duration {
+	return p.jitter(exponential(p.BaseDelay, p.MaxDelay, attempt))
+}
+
+// busyBackoff returns the delay before retrying a busy response after the given attempt
+func (p RetryPolicy) busyBackoff(attempt int) time.Duration {
+	maxDelay := p.MaxDelay
+	if p.BusyDelay > maxDelay {
+		maxDelay = p.BusyDelay
+	}
+	return p.jitter(exponential(p.BusyDelay, maxDelay, attempt))
+}
+
+// jitter shortens the delay by a random fraction of up to p.Jitter
+func (p RetryPolicy) jitter(delay time.Duration) time.Duration {
+	if p.Jitter <= 0 || delay <= 0 {
+		return delay
+	}
+	return delay - time.Duration(rand.Float64()*p.Jitter*float64(delay)) // #nosec G404 -- Jitter does not need a secure random source
+}
+
+// exponential returns base doubled attempt times, capped at maxDelay
+func exponential(base, maxDelay time.Duration, attempt int) time.Duration {
+	delay := base << attempt
+	if delay > maxDelay || delay < 0 {
+		delay = maxDelay
+	}
+	return delay
+}
+
+// parseRetryAfter parses a Retry-After header given in seconds or as an HTTP date
+func parseRetryAfter(value string, now time.Time) (time.Duration, bool) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.ParseInt(value, 10, 64); err == nil {
+		if seconds < 0 {
+			return 0, false
+		}
+		return time.Duration(seconds) * time.Second, true
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		if delay := date.Sub(now); delay > 0 {
+			return delay, true
+		}
+		return 0, true
+	}
+	return 0, false
+}
+
+// sleep waits for the given duration or until the context is done
+func sleep(ctx context.Context, d time.Duration) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-time.After(d):
+		return nil
+	}
+}
@@ -0,0 +1,417 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newTestClient creates a client for the given test server with fast retries and polling
+func newTestClient(t *testing.T, baseURL string, opts ...Option) *Client {
+	t.Helper()
+	defaults := []Option{
+		WithBaseURL(baseURL),
+		WithCredentials("test-api-id", "test-api-key"),
+		WithRetryPolicy(RetryPolicy{MaxRetries: 3, BaseDelay: time.Millisecond, MaxDelay: 10 * time.Millisecond}),
+		WithPollPolicy(PollPolicy{InitialDelay: time.Millisecond, MaxDelay: 10 * time.Millisecond, MaxAttempts: 10}),
+	}
+	c, err := New(append(defaults, opts...)...)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	return c
+}
+
+func TestClientDo(t *testing.T) {
+	tests := []struct {
+		name           string
+		method         string
+		url            string
+		body           io.Reader
+		apiID          string
+		apiKey         string
+		serverHandlers []func(w http.ResponseWriter, r *http.Request)
+		wantErr        bool
+		errorSubstring string
+	}{
+		{
+			name:   "permanent server error",
+			method: http.MethodGet,
+			url:    "/test-fail",
+			body:   nil,
+			apiID:  "test-api-id",
+			apiKey: "test-api-key",
+			serverHandlers: []func(w http.ResponseWriter, r *http.Request){
+				func(w http.ResponseWriter, r *http.Request) {
+					w.WriteHeader(http.StatusInternalServerError)
+				},
+				func(w http.ResponseWriter, r *http.Request) {
+					w.WriteHeader(http.StatusInternalServerError)
+				},
+				func(w http.ResponseWriter, r *http.Request) {
+					w.WriteHeader(http.StatusInternalServerError)
+				},
+			},
+			wantErr:        true,
+			errorSubstring: "request failed after 3 retries",
+		},
+		{
+			name:   "unauthorized request",
+			method: http.MethodGet,
+			url:    "/test-unauth",
+			body:   nil,
+			apiID:  "wrong-api-id",
+			apiKey: "wrong-api-key",
+			serverHandlers: []func(w http.ResponseWriter, r *http.Request){
+				func(w http.ResponseWriter, r *http.Request) {
+					w.WriteHeader(http.StatusUnauthorized)
+				},
+			},
+			// Authentication failures are not retried and returned to the caller to report the API error
+			wantErr: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Mock server setup
+			attempt := 0
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if attempt < len(tt.serverHandlers) {
+					tt.serverHandlers[attempt](w, r)
+					attempt++
+				} else {
+					tt.serverHandlers[len(tt.serverHandlers)-1](w, r)
+				}
+			}))
+			defer server.Close()
+
+			c := newTestClient(t, server.URL, WithCredentials(tt.apiID, tt.apiKey))
+
+			// Create context
+			ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+			defer cancel()
+
+			// Execute the request
+			fullURL := server.URL + tt.url
+			resp, err := c.do(ctx, tt.method, fullURL, tt.body)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("do() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			// Validate error substring
+			if tt.wantErr && err != nil && !strings.Contains(err.Error(), tt.errorSubstring) {
+				t.Errorf("do() error message = %v, want substring %v", err.Error(), tt.errorSubstring)
+			}
+
+			// Validate no response on error
+			if tt.wantErr && resp != nil {
+				t.Errorf("Expected no response, got %v", resp)
+			}
+			if resp != nil {
+				resp.Body.Close()
+			}
+		})
+	}
+}
+
+func TestClientRetryableRequest(t *testing.T) {
+	tests := []struct {
+		name           string
+		serverHandlers []func(w http.ResponseWriter, r *http.Request)
+		maxRetries     int
+		wantErr        bool
+		statusCode     int
+		wantAttempts   int
+	}{
+		{
+			name: "fails_all_attempts",
+			serverHandlers: []func(w http.ResponseWriter, r *http.Request){
+				func(w http.ResponseWriter, r *http.Request) {
+					w.WriteHeader(http.StatusInternalServerError)
+				},
+				func(w http.ResponseWriter, r *http.Request) {
+					w.WriteHeader(http.StatusInternalServerError)
+				},
+				func(w http.ResponseWriter, r *http.Request) {
+					w.WriteHeader(http.StatusInternalServerError)
+				},
+			},
+			maxRetries:   3,
+			wantErr:      true,
+			statusCode:   http.StatusInternalServerError,
+			wantAttempts: 4,
+		},
+		{
+			name: "unauthorized_request_does_not_retry",
+			serverHandlers: []func(w http.ResponseWriter, r *http.Request){
+				func(w http.ResponseWriter, r *http.Request) {
+					w.WriteHeader(http.StatusUnauthorized)
+				},
+			},
+			maxRetries:   3,
+			wantErr:      false,
+			statusCode:   http.StatusUnauthorized,
+			wantAttempts: 1,
+		},
+		{
+			name: "rate_limited_request_is_retried",
+			serverHandlers: []func(w http.ResponseWriter, r *http.Request){
+				func(w http.ResponseWriter, r *http.Request) {
+					w.WriteHeader(http.StatusTooManyRequests)
+				},
+				func(w http.ResponseWriter, r *http.Request) {
+					w.WriteHeader(http.StatusOK)
+				},
+			},
+			maxRetries:   3,
+			wantErr:      false,
+			statusCode:   http.StatusOK,
+			wantAttempts: 2,
+		},
+		{
+			name: "not_implemented_is_not_retried",
+			serverHandlers: []func(w http.ResponseWriter, r *http.Request){
+				func(w http.ResponseWriter, r *http.Request) {
+					w.WriteHeader(http.StatusNotImplemented)
+				},
+			},
+			maxRetries:   3,
+			wantErr:      false,
+			statusCode:   http.StatusNotImplemented,
+			wantAttempts: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Setup mock server with multiple handlers, repeating the last one
+			attempt := 0
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				handler := tt.serverHandlers[min(attempt, len(tt.serverHandlers)-1)]
+				attempt++
+				handler(w, r)
+			}))
+			defer server.Close()
+
+			// Create a request
+			req, err := http.NewRequest(http.MethodGet, server.URL, nil)
+			if err != nil {
+				t.Fatalf("Failed to create request: %v", err)
+			}
+
+			c := newTestClient(t, server.URL, WithRetryPolicy(RetryPolicy{MaxRetries: tt.maxRetries, BaseDelay: time.Millisecond, MaxDelay: 10 * time.Millisecond}))
+			resp, err := c.retryableRequest(context.Background(), req)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("retryableRequest() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if resp != nil && resp.StatusCode != tt.statusCode {
+				t.Errorf("retryableRequest() status code = %d, want %d", resp.StatusCode, tt.statusCode)
+			}
+			if resp != nil {
+				resp.Body.Close()
+			}
+			if attempt != tt.wantAttempts {
+				t.Errorf("retryableRequest() made %d attempts, want %d", attempt, tt.wantAttempts)
+			}
+		})
+	}
+}
+
+func TestClientRetryableRequest_RetryAfter(t *testing.T) {
+	attempts := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		if attempts == 1 {
+			w.Header().Set("Retry-After", "1")
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	req, err := http.NewRequest(http.MethodGet, server.URL, nil)
+	if err != nil {
+		t.Fatalf("Failed to create request: %v", err)
+	}
+
+	c := newTestClient(t, server.URL)
+	start := time.Now()
+	resp, err := c.retryableRequest(context.Background(), req)
+	if err != nil {
+		t.Fatalf("retryableRequest() error = %v", err)
+	}
+	resp.Body.Close()
+	if elapsed := time.Since(start); elapsed < time.Second {
+		t.Errorf("retryableRequest() retried after %s, want at least the Retry-After of 1s", elapsed)
+	}
+	if attempts != 2 {
+		t.Errorf("retryableRequest() made %d attempts, want 2", attempts)
+	}
+}
+
+func TestClientRetryableRequest_Busy(t *testing.T) {
+	const busyBody = `{"errors":[{"status":403,"title":"Operation Forbidden","detail":"This resource, or one of its associated resources, is currently at work. Please try again later"}]}`
+
+	for _, retryBusy := range []bool{false, true} {
+		attempts := 0
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			attempts++
+			if attempts == 1 {
+				w.WriteHeader(http.StatusForbidden)
+				_, _ = w.Write([]byte(busyBody))
+				return
+			}
+			w.WriteHeader(http.StatusOK)
+		}))
+
+		req, err := http.NewRequest(http.MethodPost, server.URL, nil)
+		if err != nil {
+			t.Fatalf("Failed to create request: %v", err)
+		}
+
+		c := newTestClient(t, server.URL, WithRetryPolicy(RetryPolicy{
+			MaxRetries: 3,
+			BaseDelay:  time.Millisecond,
+			MaxDelay:   10 * time.Millisecond,
+			RetryBusy:  retryBusy,
+			BusyDelay:  20 * time.Millisecond,
+		}))
+		start := time.Now()
+		resp, err := c.retryableRequest(context.Background(), req)
+		if err != nil {
+			t.Fatalf("retryableRequest() error = %v", err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		server.Close()
+
+		if !retryBusy {
+			// The busy response is returned with its body so the caller can report the API error
+			if resp.StatusCode != http.StatusForbidden || attempts != 1 || string(body) != busyBody {
+				t.Errorf("without RetryBusy got status %d after %d attempts, body %q", resp.StatusCode, attempts, body)
+			}
+			continue
+		}
+		if resp.StatusCode != http.StatusOK || attempts != 2 {
+			t.Errorf("with RetryBusy got status %d after %d attempts", resp.StatusCode, attempts)
+		}
+		if elapsed := time.Since(start); elapsed < 20*time.Millisecond {
+			t.Errorf("busy response retried after %s, want the busy delay of 20ms", elapsed)
+		}
+	}
+}
+
+func TestClientRetryableRequest_BusyExhausted(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+		_, _ = w.Write([]byte(`{"errors":[{"status":403,"title":"Operation Forbidden","detail":"currently at work"}]}`))
+	}))
+	defer server.Close()
+
+	req, err := http.NewRequest(http.MethodPost, server.URL, nil)
+	if err != nil {
+		t.Fatalf("Failed to create request: %v", err)
+	}
+	c := newTestClient(t, server.URL, WithRetryPolicy(RetryPolicy{MaxRetries: 1, RetryBusy: true, BusyDelay: time.Millisecond}))
+	if _, err := c.retryableRequest(context.Background(), req); !errors.Is(err, ErrResourceBusy) {
+		t.Errorf("retryableRequest() error = %v, want ErrResourceBusy", err)
+	}
+}
+
+func TestClientRetryableRequest_RequestHook(t *testing.T) {
+	attempts := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		if attempts < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	req, err := http.NewRequest(http.MethodGet, server.URL, nil)
+	if err != nil {
+		t.Fatalf("Failed to create request: %v", err)
+	}
+	var observed []Attempt
+	c := newTestClient(t, server.URL, WithRequestHook(func(a Attempt) {
+		observed = append(observed, a)
+	}))
+	resp, err := c.retryableRequest(context.Background(), req)
+	if err != nil {
+		t.Fatalf("retryableRequest() error = %v", err)
+	}
+	resp.Body.Close()
+
+	if len(observed) != 3 {
+		t.Fatalf("request hook called %d times, want 3", len(observed))
+	}
+	for i, a := range observed {
+		want := http.StatusServiceUnavailable
+		if i == 2 {
+			want = http.StatusOK
+		}
+		if a.Method != http.MethodGet || a.Retry != i || a.Status != want || a.Err != nil || a.Duration <= 0 {
+			t.Errorf("attempt %d = %+v, want retry %d with status %d", i, a, i, want)
+		}
+	}
+
+	// An attempt without response reports its error and no status
+	server.Close()
+	observed = nil
+	c = newTestClient(t, server.URL, WithRetryPolicy(RetryPolicy{}), WithRequestHook(func(a Attempt) {
+		observed = append(observed, a)
+	}))
+	if _, err := c.retryableRequest(context.Background(), req); err == nil {
+		t.Fatal("retryableRequest() to a closed server succeeded")
+	}
+	if len(observed) != 1 || observed[0].Status != 0 || observed[0].Err == nil {
+		t.Errorf("attempts = %+v, want one failed attempt", observed)
+	}
+}
+
+func TestRetryPolicyBackoff(t *testing.T) {
+	p := RetryPolicy{BaseDelay: 100 * time.Millisecond, MaxDelay: time.Second, Jitter: 0.5, BusyDelay: 2 * time.Second}
+	for attempt, want := range []time.Duration{100 * time.Millisecond, 200 * time.Millisecond, 400 * time.Millisecond, 800 * time.Millisecond, time.Second, time.Second} {
+		for i := 0; i < 20; i++ {
+			if got := p.backoff(attempt); got > want || got < want/2 {
+				t.Fatalf("backoff(%d) = %s, want between %s and %s", attempt, got, want/2, want)
+			}
+		}
+	}
+	if got := p.busyBackoff(3); got > 2*time.Second || got < time.Second {
+		t.Errorf("busyBackoff(3) = %s, want between 1s and 2s", got)
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2024, 9, 26, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		value  string
+		want   time.Duration
+		wantOK bool
+	}{
+		{"120", 2 * time.Minute, true},
+		{"0", 0, true},
+		{now.Add(30 * time.Second).Format(http.TimeFormat), 30 * time.Second, true},
+		{now.Add(-time.Minute).Format(http.TimeFormat), 0, true},
+		{"", 0, false},
+		{"-1", 0, false},
+		{"soon", 0, false},
+	}
+	for _, tt := range tests {
+		got, ok := parseRetryAfter(tt.value, now)
+		if got != tt.want || ok != tt.wantOK {
+			t.Errorf("parseRetryAfter(%q) = %s, %v, want %s, %v", tt.value, got, ok, tt.want, tt.wantOK)
+		}
+	}
+}
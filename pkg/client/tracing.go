@@ -0,0 +1,78 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracerName is the instrumentation scope of the spans of the client
+const tracerName string = "github.com/ren3gadem4rm0t/imperva-export-cli/pkg/client"
+
+// Attributes of the spans of the client
+const (
+	attrCAID    attribute.Key = "imperva.caid"
+	attrHandler attribute.Key = "imperva.export.handler"
+	attrPoll    attribute.Key = "imperva.export.poll"
+	attrStatus  attribute.Key = "imperva.export.status"
+	attrDelay   attribute.Key = "imperva.export.poll_delay_ms"
+	attrOffset  attribute.Key = "imperva.export.resume_offset"
+	attrBytes   attribute.Key = "imperva.export.bytes"
+	attrResumes attribute.Key = "imperva.export.resumes"
+)
+
+// startAttempt starts the span of an HTTP attempt. The retry number is recorded as the resend count.
+func (c *Client) startAttempt(ctx context.Context, req *http.Request, retry int) (context.Context, trace.Span) {
+	ctx, span := c.tracer.Start(ctx, "HTTP "+req.Method,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			semconv.HTTPRequestMethodKey.String(req.Method),
+			semconv.URLFull(redactURL(req.URL)),
+			semconv.ServerAddress(req.URL.Hostname()),
+			semconv.HTTPRequestResendCount(retry),
+		))
+	return ctx, span
+}
+
+// injectTraceContext adds the W3C trace context of the context to the request headers
+func injectTraceContext(ctx context.Context, req *http.Request) {
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(req.Header))
+}
+
+// endAttempt ends the span of an HTTP attempt with its status code or error
+func endAttempt(span trace.Span, resp *http.Response, err error) {
+	switch {
+	case err != nil:
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	case resp != nil:
+		span.SetAttributes(semconv.HTTPResponseStatusCode(resp.StatusCode))
+		if resp.StatusCode >= http.StatusBadRequest {
+			span.SetStatus(codes.Error, http.StatusText(resp.StatusCode))
+		}
+	}
+	span.End()
+}
+
+// endSpan ends a span, recording the error if there is one
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// redactURL returns the URL without user info, which is never sent in spans
+func redactURL(u *url.URL) string {
+	redacted := *u
+	redacted.User = nil
+	return redacted.String()
+}
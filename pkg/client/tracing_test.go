@@ -0,0 +1,119 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+// spanAttr returns the value of an attribute of a recorded span
+func spanAttr(span tracetest.SpanStub, key attribute.Key) attribute.Value {
+	for _, kv := range span.Attributes {
+		if kv.Key == key {
+			return kv.Value
+		}
+	}
+	return attribute.Value{}
+}
+
+func TestClientWait_Tracing(t *testing.T) {
+	original := otel.GetTextMapPropagator()
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	t.Cleanup(func() { otel.SetTextMapPropagator(original) })
+
+	var traceparents []string
+	polls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		traceparents = append(traceparents, r.Header.Get("traceparent"))
+		polls++
+		switch polls {
+		case 1:
+			w.WriteHeader(http.StatusAccepted)
+		case 2:
+			w.WriteHeader(http.StatusServiceUnavailable)
+		default:
+			_, _ = w.Write([]byte("archive"))
+		}
+	}))
+	defer server.Close()
+
+	exporter := tracetest.NewInMemoryExporter()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	c := newTestClient(t, server.URL, WithTracerProvider(provider))
+
+	ctx, root := provider.Tracer("test").Start(context.Background(), "job")
+	var buf bytes.Buffer
+	if _, err := c.Wait(ctx, 1234, testHandler, &buf); err != nil {
+		t.Fatalf("Wait() error = %v", err)
+	}
+	root.End()
+
+	spans := exporter.GetSpans()
+	byName := map[string][]tracetest.SpanStub{}
+	for _, span := range spans {
+		if span.SpanContext.TraceID() != root.SpanContext().TraceID() {
+			t.Errorf("span %s is not part of the trace of the job", span.Name)
+		}
+		byName[span.Name] = append(byName[span.Name], span)
+	}
+	if len(byName["export.poll"]) != 2 || len(byName["export.poll_wait"]) != 1 || len(byName["export.download"]) != 1 {
+		t.Fatalf("spans = %v", byName)
+	}
+	if got := spanAttr(byName["export.poll"][0], attrStatus).AsString(); got != string(StatusInProgress) {
+		t.Errorf("first poll status = %q", got)
+	}
+	if got := spanAttr(byName["export.download"][0], attrBytes).AsInt64(); got != int64(len("archive")) {
+		t.Errorf("download bytes = %d", got)
+	}
+
+	// Every HTTP attempt has its own span, with the retry number and status, and sends its trace context
+	attempts := byName["HTTP GET"]
+	if len(attempts) != 3 || len(traceparents) != 3 {
+		t.Fatalf("got %d attempt spans and %d requests, want 3", len(attempts), len(traceparents))
+	}
+	for i, want := range []struct {
+		retry  int64
+		status int64
+		code   codes.Code
+	}{{0, 202, codes.Unset}, {0, 503, codes.Error}, {1, 200, codes.Unset}} {
+		span := attempts[i]
+		if spanAttr(span, "http.request.resend_count").AsInt64() != want.retry ||
+			spanAttr(span, "http.response.status_code").AsInt64() != want.status || span.Status.Code != want.code {
+			t.Errorf("attempt %d = %v, status %v, want retry %d with status %d", i, span.Attributes, span.Status, want.retry, want.status)
+		}
+		wantHeader := "00-" + span.SpanContext.TraceID().String() + "-" + span.SpanContext.SpanID().String() + "-01"
+		if traceparents[i] != wantHeader {
+			t.Errorf("traceparent of request %d = %q, want %q", i, traceparents[i], wantHeader)
+		}
+	}
+	if attempts[0].Parent.SpanID() != byName["export.poll"][0].SpanContext.SpanID() {
+		t.Error("the attempt span is not a child of its poll span")
+	}
+}
+
+func TestClient_NoTracing(t *testing.T) {
+	var traceparent string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		traceparent = r.Header.Get("traceparent")
+		_, _ = w.Write([]byte("archive"))
+	}))
+	defer server.Close()
+
+	// Without a tracer provider and propagator no trace context is sent
+	c := newTestClient(t, server.URL)
+	if _, err := c.Download(context.Background(), 1234, testHandler, &bytes.Buffer{}); err != nil {
+		t.Fatalf("Download() error = %v", err)
+	}
+	if traceparent != "" {
+		t.Errorf("traceparent = %q, want none", traceparent)
+	}
+}
@@ -0,0 +1,143 @@
+package client
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// TransportConfig configures the HTTP client used to reach the API. The zero value uses the proxy
+// of the HTTPS_PROXY, HTTP_PROXY and NO_PROXY environment variables, the system root CAs and TLS 1.2 or later.
+type TransportConfig struct {
+	// ProxyURL is the URL of an HTTP, HTTPS or SOCKS5 proxy for all requests
+	ProxyURL string
+	// CABundle is the path of a PEM file with root CAs trusted in addition to the system roots
+	CABundle string
+	// MinTLSVersion is the minimum TLS version, "1.2" or "1.3"
+	MinTLSVersion string
+	// ClientCert and ClientKey are the paths of a PEM client certificate and its key for mutual TLS
+	ClientCert string
+	ClientKey  string
+	// ConnectTimeout limits establishing the TCP connection and the TLS handshake
+	ConnectTimeout time.Duration
+	// ReadTimeout limits waiting for the response headers after the request was sent
+	ReadTimeout time.Duration
+	// Timeout limits a whole request including reading the response body; zero means no limit.
+	// It also applies to downloads, so it must leave enough time for the largest export.
+	Timeout time.Duration
+}
+
+// DefaultTransportConfig returns the transport configuration used when no HTTP client is configured
+func DefaultTransportConfig() TransportConfig {
+	return TransportConfig{
+		ConnectTimeout: 30 * time.Second,
+		ReadTimeout:    2 * time.Minute,
+	}
+}
+
+// defaultHTTPClient is shared by all clients created without an HTTP client, so they reuse connections
+var defaultHTTPClient = sync.OnceValue(func() *http.Client {
+	httpClient, err := NewHTTPClient(DefaultTransportConfig())
+	if err != nil {
+		panic(err) // The default configuration has neither files nor URLs that could be invalid
+	}
+	return httpClient
+})
+
+// tlsVersions maps the accepted MinTLSVersion values to their crypto/tls constants
+var tlsVersions = map[string]uint16{
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// NewHTTPClient builds an HTTP client whose transport applies the configuration.
+// The returned client is safe for concurrent use and meant to be shared by all clients of a process.
+func NewHTTPClient(cfg TransportConfig) (*http.Client, error) {
+	tlsConfig, err := cfg.tlsConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+	transport.ResponseHeaderTimeout = cfg.ReadTimeout
+	if cfg.ConnectTimeout > 0 {
+		dialer := &net.Dialer{Timeout: cfg.ConnectTimeout, KeepAlive: 30 * time.Second}
+		transport.DialContext = dialer.DialContext
+		transport.TLSHandshakeTimeout = cfg.ConnectTimeout
+	}
+	if cfg.ProxyURL != "" {
+		proxyURL, err := parseProxyURL(cfg.ProxyURL)
+		if err != nil {
+			return nil, err
+		}
+		transport.Proxy = http.ProxyURL(proxyURL)
+	}
+
+	return &http.Client{Transport: transport, Timeout: cfg.Timeout}, nil
+}
+
+// tlsConfig builds the TLS configuration with the CA bundle, minimum version and client certificate
+func (cfg TransportConfig) tlsConfig() (*tls.Config, error) {
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+
+	if cfg.MinTLSVersion != "" {
+		version, ok := tlsVersions[strings.TrimSpace(cfg.MinTLSVersion)]
+		if !ok {
+			return nil, fmt.Errorf("invalid minimum TLS version: %q (must be 1.2 or 1.3)", cfg.MinTLSVersion)
+		}
+		tlsConfig.MinVersion = version
+	}
+
+	if cfg.CABundle != "" {
+		pem, err := os.ReadFile(cfg.CABundle) // #nosec G304 -- The CA bundle path comes from the user's own configuration
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CA bundle: %w", err)
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in CA bundle %s", cfg.CABundle)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	if cfg.ClientCert != "" || cfg.ClientKey != "" {
+		if cfg.ClientCert == "" || cfg.ClientKey == "" {
+			return nil, fmt.Errorf("client certificate and client key must be provided together")
+		}
+		cert, err := tls.LoadX509KeyPair(cfg.ClientCert, cfg.ClientKey)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	return tlsConfig, nil
+}
+
+// parseProxyURL parses and validates the URL of a proxy
+func parseProxyURL(rawURL string) (*url.URL, error) {
+	proxyURL, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid proxy URL '%s': %w", rawURL, err)
+	}
+	switch proxyURL.Scheme {
+	case "http", "https", "socks5":
+	default:
+		return nil, fmt.Errorf("invalid proxy URL '%s': scheme must be http, https or socks5", rawURL)
+	}
+	if proxyURL.Host == "" {
+		return nil, fmt.Errorf("invalid proxy URL '%s': missing host", rawURL)
+	}
+	return proxyURL, nil
+}
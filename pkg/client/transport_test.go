@@ -0,0 +1,179 @@
+package client
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writePEM writes a PEM block to a file in the test's temp directory and returns its path
+func writePEM(t *testing.T, name, blockType string, der []byte) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der}), 0600); err != nil {
+		t.Fatalf("failed to write %s: %v", name, err)
+	}
+	return path
+}
+
+// writeClientCert writes a self-signed client certificate and its key and returns their paths
+func writeClientCert(t *testing.T) (string, string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "imperva-export-cli"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("failed to create certificate: %v", err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("failed to marshal key: %v", err)
+	}
+	return writePEM(t, "client.crt", "CERTIFICATE", der), writePEM(t, "client.key", "EC PRIVATE KEY", keyDER)
+}
+
+func TestNewHTTPClient_CABundle(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	untrusted, err := NewHTTPClient(TransportConfig{})
+	if err != nil {
+		t.Fatalf("NewHTTPClient() error = %v", err)
+	}
+	if _, err := untrusted.Get(server.URL); err == nil {
+		t.Error("request to a server with a private CA should fail without the CA bundle")
+	}
+
+	bundle := writePEM(t, "ca.pem", "CERTIFICATE", server.Certificate().Raw)
+	trusted, err := NewHTTPClient(TransportConfig{CABundle: bundle})
+	if err != nil {
+		t.Fatalf("NewHTTPClient() error = %v", err)
+	}
+	resp, err := trusted.Get(server.URL)
+	if err != nil {
+		t.Fatalf("request with the CA bundle failed: %v", err)
+	}
+	resp.Body.Close()
+}
+
+func TestNewHTTPClient_ClientCertificate(t *testing.T) {
+	var peerCerts int
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		peerCerts = len(r.TLS.PeerCertificates)
+		w.WriteHeader(http.StatusOK)
+	}))
+	server.TLS = &tls.Config{ClientAuth: tls.RequireAnyClientCert}
+	server.StartTLS()
+	defer server.Close()
+
+	cert, key := writeClientCert(t)
+	httpClient, err := NewHTTPClient(TransportConfig{
+		CABundle:      writePEM(t, "ca.pem", "CERTIFICATE", server.Certificate().Raw),
+		MinTLSVersion: "1.3",
+		ClientCert:    cert,
+		ClientKey:     key,
+	})
+	if err != nil {
+		t.Fatalf("NewHTTPClient() error = %v", err)
+	}
+	resp, err := httpClient.Get(server.URL)
+	if err != nil {
+		t.Fatalf("request with the client certificate failed: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.TLS.Version != tls.VersionTLS13 || peerCerts != 1 {
+		t.Errorf("TLS version = %x, peer certificates = %d, want TLS 1.3 and 1", resp.TLS.Version, peerCerts)
+	}
+}
+
+func TestNewHTTPClient_Proxy(t *testing.T) {
+	var proxied string
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proxied = r.URL.String()
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer proxy.Close()
+
+	httpClient, err := NewHTTPClient(TransportConfig{ProxyURL: proxy.URL})
+	if err != nil {
+		t.Fatalf("NewHTTPClient() error = %v", err)
+	}
+	resp, err := httpClient.Get("http://api.example.invalid/v3/export")
+	if err != nil {
+		t.Fatalf("request through the proxy failed: %v", err)
+	}
+	resp.Body.Close()
+	if proxied != "http://api.example.invalid/v3/export" {
+		t.Errorf("proxy received %q, want the absolute request URL", proxied)
+	}
+}
+
+func TestNewHTTPClient_ReadTimeout(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+	defer close(release)
+
+	httpClient, err := NewHTTPClient(TransportConfig{ReadTimeout: 50 * time.Millisecond})
+	if err != nil {
+		t.Fatalf("NewHTTPClient() error = %v", err)
+	}
+	if _, err := httpClient.Get(server.URL); err == nil || !strings.Contains(err.Error(), "timeout") {
+		t.Errorf("Get() error = %v, want a timeout", err)
+	}
+}
+
+func TestNewHTTPClient_InvalidConfig(t *testing.T) {
+	cert, key := writeClientCert(t)
+	notPEM := filepath.Join(t.TempDir(), "ca.pem")
+	if err := os.WriteFile(notPEM, []byte("not a certificate"), 0600); err != nil {
+		t.Fatalf("failed to write CA bundle: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		cfg     TransportConfig
+		wantErr string
+	}{
+		{"tls 1.0", TransportConfig{MinTLSVersion: "1.0"}, "invalid minimum TLS version"},
+		{"missing ca bundle", TransportConfig{CABundle: filepath.Join(t.TempDir(), "missing.pem")}, "failed to read CA bundle"},
+		{"empty ca bundle", TransportConfig{CABundle: notPEM}, "no certificates found"},
+		{"cert without key", TransportConfig{ClientCert: cert}, "must be provided together"},
+		{"key as cert", TransportConfig{ClientCert: key, ClientKey: key}, "failed to load client certificate"},
+		{"proxy scheme", TransportConfig{ProxyURL: "ftp://proxy:21"}, "scheme must be"},
+		{"proxy without host", TransportConfig{ProxyURL: "http://"}, "missing host"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewHTTPClient(tt.cfg); err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("NewHTTPClient() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,66 @@
+package client
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// RE2-compatible regex for UUID: (8-4-4-4-12)
+var uuidRegex = regexp.MustCompile(`^[a-f0-9]{8}-[a-f0-9]{4}-[a-f0-9]{4}-[a-f0-9]{4}-[a-f0-9]{12}$`)
+
+// ValidateCAID validates the CAID
+func ValidateCAID(caid int64) error {
+	if caid <= 0 {
+		return fmt.Errorf("invalid caid: %d", caid)
+	}
+	return nil
+}
+
+// ValidateHandler validates the handler string as a UUID
+func ValidateHandler(handler string) error {
+	trimmedHandler := strings.TrimSpace(handler)
+	if trimmedHandler == "" {
+		return fmt.Errorf("handler is required")
+	}
+
+	if !uuidRegex.MatchString(trimmedHandler) {
+		return fmt.Errorf("invalid handler format")
+	}
+
+	return nil
+}
+
+// ValidateResourceType validates the resource type for a single-resource export
+func ValidateResourceType(resourceType ResourceType) error {
+	switch ResourceType(strings.ToUpper(strings.TrimSpace(string(resourceType)))) {
+	case ResourceSite, ResourcePolicy:
+		return nil
+	default:
+		return fmt.Errorf("invalid resource type: %q (must be %s or %s)", resourceType, ResourceSite, ResourcePolicy)
+	}
+}
+
+// ValidateResourceID validates the Imperva ID of a site or policy
+func ValidateResourceID(id int64) error {
+	if id <= 0 {
+		return fmt.Errorf("invalid resource id: %d", id)
+	}
+	return nil
+}
+
+// ValidateBaseURL validates the base URL of the API, which must be an absolute http or https URL
+func ValidateBaseURL(baseURL string) error {
+	parsedURL, err := url.Parse(baseURL)
+	if err != nil {
+		return fmt.Errorf("invalid base URL '%s': %w", baseURL, err)
+	}
+	if parsedURL.Scheme != "https" && parsedURL.Scheme != "http" {
+		return fmt.Errorf("invalid base URL '%s': scheme must be http or https", baseURL)
+	}
+	if parsedURL.Host == "" {
+		return fmt.Errorf("invalid base URL '%s': missing host", baseURL)
+	}
+	return nil
+}
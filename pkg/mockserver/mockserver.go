@@ -0,0 +1,359 @@
+// Package mockserver implements the Imperva Account-Export API contract of openapi.yaml in memory,
+// for tests, demos and offline integration testing of export pipelines.
+package mockserver
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ren3gadem4rm0t/imperva-export-cli/pkg/client"
+)
+
+// Endpoint selects the requests a fault applies to
+type Endpoint string
+
+// Endpoints of the API
+const (
+	EndpointAny      Endpoint = ""
+	EndpointExport   Endpoint = "export"
+	EndpointDownload Endpoint = "download"
+)
+
+// Fault makes the server answer requests with an error status instead of the regular response
+type Fault struct {
+	// Status is the error status: 401, 403, 404 or 500
+	Status int
+	// Endpoint restricts the fault to the export or download requests; the zero value applies to both
+	Endpoint Endpoint
+	// Count is the number of responses that fail; zero fails every response
+	Count int
+}
+
+// errorDetails holds the title and detail of the documented error responses
+var errorDetails = map[int][2]string{
+	http.StatusBadRequest:          {"Bad Request", "Invalid request parameters"},
+	http.StatusUnauthorized:        {"Authentication Error", "Authentication missing or invalid"},
+	http.StatusForbidden:           {"Operation Forbidden", "This resource, or one of its associated resources, is currently at work. Please try again later"},
+	http.StatusNotFound:            {"Resource Not Found", "Resource Not Found"},
+	http.StatusInternalServerError: {"Internal Server Error", "Something went wrong. Contact support"},
+}
+
+// ParseFault parses a fault of the form STATUS[:ENDPOINT[:COUNT]], e.g. "500:download:2"
+func ParseFault(s string) (Fault, error) {
+	parts := strings.Split(strings.TrimSpace(s), ":")
+	if len(parts) > 3 {
+		return Fault{}, fmt.Errorf("invalid fault %q: must be STATUS[:ENDPOINT[:COUNT]]", s)
+	}
+
+	var fault Fault
+	status, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return Fault{}, fmt.Errorf("invalid fault %q: invalid status: %w", s, err)
+	}
+	fault.Status = status
+	if len(parts) > 1 {
+		fault.Endpoint = Endpoint(strings.ToLower(parts[1]))
+		if fault.Endpoint == "any" {
+			fault.Endpoint = EndpointAny
+		}
+	}
+	if len(parts) > 2 {
+		if fault.Count, err = strconv.Atoi(parts[2]); err != nil {
+			return Fault{}, fmt.Errorf("invalid fault %q: invalid count: %w", s, err)
+		}
+	}
+	return fault, fault.validate()
+}
+
+// validate checks that the fault is one of the documented error responses
+func (f Fault) validate() error {
+	switch f.Status {
+	case http.StatusUnauthorized, http.StatusForbidden, http.StatusNotFound, http.StatusInternalServerError:
+	default:
+		return fmt.Errorf("invalid fault status: %d (must be 401, 403, 404 or 500)", f.Status)
+	}
+	switch f.Endpoint {
+	case EndpointAny, EndpointExport, EndpointDownload:
+	default:
+		return fmt.Errorf("invalid fault endpoint: %q (must be export, download or any)", f.Endpoint)
+	}
+	if f.Count < 0 {
+		return fmt.Errorf("invalid fault count: %d", f.Count)
+	}
+	return nil
+}
+
+// export is an export process started on the server
+type export struct {
+	caid  int64
+	polls int
+}
+
+// Server is an in-memory Account-Export API. It implements http.Handler and is safe for concurrent use.
+type Server struct {
+	apiID   string
+	apiKey  string
+	polls   int
+	latency time.Duration
+	fixture []byte
+	faults  []Fault
+
+	mu        sync.Mutex
+	exports   map[string]*export
+	remaining []int
+	mux       *http.ServeMux
+}
+
+// Option configures a Server
+type Option func(*Server)
+
+// WithCredentials requires requests to authenticate with the API ID and API key.
+// By default any non-empty credentials are accepted.
+func WithCredentials(apiID, apiKey string) Option {
+	return func(s *Server) {
+		s.apiID = apiID
+		s.apiKey = apiKey
+	}
+}
+
+// WithPolls sets the number of download requests of an export answered with 202 before the archive is served
+func WithPolls(polls int) Option {
+	return func(s *Server) {
+		s.polls = polls
+	}
+}
+
+// WithLatency delays every response
+func WithLatency(latency time.Duration) Option {
+	return func(s *Server) {
+		s.latency = latency
+	}
+}
+
+// WithFixture sets the archive served for every export. By default DefaultFixture is served.
+func WithFixture(fixture []byte) Option {
+	return func(s *Server) {
+		s.fixture = fixture
+	}
+}
+
+// WithFault injects a fault. Faults are checked in the order they were added.
+func WithFault(fault Fault) Option {
+	return func(s *Server) {
+		s.faults = append(s.faults, fault)
+	}
+}
+
+// New creates a Server from the given options
+func New(opts ...Option) (*Server, error) {
+	s := &Server{
+		polls:   1,
+		exports: make(map[string]*export),
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	if s.polls < 0 {
+		return nil, fmt.Errorf("invalid number of polls: %d", s.polls)
+	}
+	if s.latency < 0 {
+		return nil, fmt.Errorf("invalid latency: %s", s.latency)
+	}
+	for _, fault := range s.faults {
+		if err := fault.validate(); err != nil {
+			return nil, err
+		}
+		s.remaining = append(s.remaining, fault.Count)
+	}
+	if s.fixture == nil {
+		s.fixture = DefaultFixture()
+	}
+
+	s.mux = http.NewServeMux()
+	s.mux.HandleFunc("POST /v3/export", s.handleExport)
+	s.mux.HandleFunc("POST /v3/export/{resourceType}/{id}", s.handleExport)
+	s.mux.HandleFunc("GET /v3/export/download/{handler}", s.handleDownload)
+	return s, nil
+}
+
+// ServeHTTP implements http.Handler
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if s.latency > 0 {
+		select {
+		case <-time.After(s.latency):
+		case <-r.Context().Done():
+			return
+		}
+	}
+	s.mux.ServeHTTP(w, r)
+}
+
+// handleExport starts an export of an account or a single site or policy
+func (s *Server) handleExport(w http.ResponseWriter, r *http.Request) {
+	if !s.authorized(r) {
+		writeError(w, r, http.StatusUnauthorized)
+		return
+	}
+	if status := s.fault(EndpointExport); status != 0 {
+		writeError(w, r, status)
+		return
+	}
+
+	caid, err := strconv.ParseInt(r.URL.Query().Get("caid"), 10, 64)
+	if err != nil || caid <= 0 {
+		writeError(w, r, http.StatusBadRequest)
+		return
+	}
+	if resourceType := r.PathValue("resourceType"); resourceType != "" {
+		id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+		if client.ValidateResourceType(client.ResourceType(resourceType)) != nil || err != nil || id <= 0 {
+			writeError(w, r, http.StatusBadRequest)
+			return
+		}
+	}
+
+	handler := newHandler()
+	s.mu.Lock()
+	s.exports[handler] = &export{caid: caid, polls: s.polls}
+	s.mu.Unlock()
+
+	writeJSON(w, http.StatusAccepted, client.AsyncResponse{Handler: handler, Status: "Export is in progress"})
+}
+
+// handleDownload answers 202 while the export is in progress and serves the archive once it is ready.
+// Range requests are supported so that interrupted downloads can be resumed.
+func (s *Server) handleDownload(w http.ResponseWriter, r *http.Request) {
+	if !s.authorized(r) {
+		writeError(w, r, http.StatusUnauthorized)
+		return
+	}
+	if status := s.fault(EndpointDownload); status != 0 {
+		writeError(w, r, status)
+		return
+	}
+
+	handler := r.PathValue("handler")
+	caid, _ := strconv.ParseInt(r.URL.Query().Get("caid"), 10, 64)
+
+	s.mu.Lock()
+	exp, ok := s.exports[handler]
+	inProgress := ok && exp.caid == caid && exp.polls > 0
+	if inProgress {
+		exp.polls--
+	}
+	s.mu.Unlock()
+
+	switch {
+	case !ok || exp.caid != caid:
+		writeError(w, r, http.StatusNotFound)
+	case inProgress:
+		writeJSON(w, http.StatusAccepted, client.AsyncResponse{Handler: handler, Status: "Export is in progress"})
+	default:
+		w.Header().Set("Content-Type", "application/zip")
+		http.ServeContent(w, r, "export_"+handler+".zip", time.Time{}, bytes.NewReader(s.fixture))
+	}
+}
+
+// authorized reports whether the request carries valid credentials
+func (s *Server) authorized(r *http.Request) bool {
+	apiID, apiKey := r.Header.Get("x-API-Id"), r.Header.Get("x-API-Key")
+	if apiID == "" || apiKey == "" {
+		return false
+	}
+	if s.apiID != "" && apiID != s.apiID {
+		return false
+	}
+	return s.apiKey == "" || apiKey == s.apiKey
+}
+
+// fault returns the status of the first active fault for the endpoint, or zero if the request succeeds
+func (s *Server) fault(endpoint Endpoint) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, fault := range s.faults {
+		if fault.Endpoint != EndpointAny && fault.Endpoint != endpoint {
+			continue
+		}
+		if fault.Count == 0 {
+			return fault.Status
+		}
+		if s.remaining[i] > 0 {
+			s.remaining[i]--
+			return fault.Status
+		}
+	}
+	return 0
+}
+
+// writeError writes the documented error response for the status
+func writeError(w http.ResponseWriter, r *http.Request, status int) {
+	details := errorDetails[status]
+	apiErr := client.APIError{Status: status, ID: "20014b504cb97819", Title: details[0], Detail: details[1]}
+	apiErr.Source.Pointer = strings.TrimPrefix(r.URL.Path, "/v3")
+	writeJSON(w, status, client.ErrorResponse{Errors: []client.APIError{apiErr}})
+}
+
+// writeJSON writes a JSON response body with the status
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(body)
+}
+
+// newHandler returns a random UUID identifying an export
+func newHandler() string {
+	var b [16]byte
+	_, _ = rand.Read(b[:])
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
+}
+
+// DefaultFixture returns an export archive with a provider, two sites and a policy
+func DefaultFixture() []byte {
+	files := []struct {
+		name    string
+		content string
+	}{
+		{"main.tf", "provider \"incapsula\" {}\n"},
+		{"sites.tf", `resource "incapsula_site" "site_1001" {
+  domain = "www.example.com"
+}
+
+resource "incapsula_site" "site_1002" {
+  domain = "shop.example.com"
+}
+`},
+		{"policies.tf", `resource "incapsula_policy" "policy_2001" {
+  name        = "Block countries"
+  policy_type = "ACL"
+  enabled     = true
+}
+`},
+	}
+
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, file := range files {
+		fw, err := zw.Create(file.name)
+		if err != nil {
+			panic(err)
+		}
+		if _, err := fw.Write([]byte(file.content)); err != nil {
+			panic(err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		panic(err)
+	}
+	return buf.Bytes()
+}
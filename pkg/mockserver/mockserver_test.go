@@ -0,0 +1,161 @@
+package mockserver
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ren3gadem4rm0t/imperva-export-cli/pkg/client"
+)
+
+// newTestClient starts the mock server and returns a client for it
+func newTestClient(t *testing.T, opts ...Option) *client.Client {
+	t.Helper()
+	server, err := New(opts...)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	httpServer := httptest.NewServer(server)
+	t.Cleanup(httpServer.Close)
+
+	c, err := client.New(
+		client.WithBaseURL(httpServer.URL),
+		client.WithCredentials("test-api-id", "test-api-key"),
+		client.WithRetryPolicy(client.RetryPolicy{MaxRetries: 2, BaseDelay: time.Millisecond, MaxDelay: time.Millisecond}),
+		client.WithPollPolicy(client.PollPolicy{InitialDelay: time.Millisecond, MaxDelay: time.Millisecond, MaxAttempts: 10}),
+	)
+	if err != nil {
+		t.Fatalf("client.New() error = %v", err)
+	}
+	return c
+}
+
+func TestServer_ExportAndWait(t *testing.T) {
+	fixture := []byte("PK fixture")
+	c := newTestClient(t, WithPolls(3), WithFixture(fixture))
+	ctx := context.Background()
+
+	for _, resource := range []*client.Resource{nil, {Type: client.ResourcePolicy, ID: 2001}} {
+		handler, err := c.Export(ctx, 1234)
+		if resource != nil {
+			handler, err = c.ExportResource(ctx, 1234, *resource)
+		}
+		if err != nil {
+			t.Fatalf("export error = %v", err)
+		}
+
+		for i := 0; i < 3; i++ {
+			if _, err := c.Download(ctx, 1234, handler, &bytes.Buffer{}); !errors.Is(err, client.ErrExportNotReady) {
+				t.Fatalf("poll %d: Download() error = %v, want ErrExportNotReady", i, err)
+			}
+		}
+		var buf bytes.Buffer
+		if _, err := c.Download(ctx, 1234, handler, &buf); err != nil {
+			t.Fatalf("Download() error = %v", err)
+		}
+		if !bytes.Equal(buf.Bytes(), fixture) {
+			t.Errorf("Download() = %q, want the fixture", buf.String())
+		}
+	}
+}
+
+func TestServer_DefaultFixture(t *testing.T) {
+	c := newTestClient(t)
+	var buf bytes.Buffer
+	if _, _, err := c.ExportAndWait(context.Background(), 1234, nil, &buf); err != nil {
+		t.Fatalf("ExportAndWait() error = %v", err)
+	}
+	if !bytes.Equal(buf.Bytes(), DefaultFixture()) {
+		t.Error("ExportAndWait() did not download the default fixture")
+	}
+}
+
+func TestServer_Errors(t *testing.T) {
+	ctx := context.Background()
+
+	wrongKey := newTestClient(t, WithCredentials("test-api-id", "other-key"))
+	if _, err := wrongKey.Export(ctx, 1234); err == nil || !strings.Contains(err.Error(), "Authentication Error") {
+		t.Errorf("Export() with wrong credentials error = %v, want authentication error", err)
+	}
+
+	c := newTestClient(t)
+	if _, err := c.Download(ctx, 1234, "00000000-0000-0000-0000-000000000000", &bytes.Buffer{}); err == nil || !strings.Contains(err.Error(), "404") {
+		t.Errorf("Download() of an unknown handler error = %v, want 404", err)
+	}
+	handler, err := c.Export(ctx, 1234)
+	if err != nil {
+		t.Fatalf("Export() error = %v", err)
+	}
+	if _, err := c.Download(ctx, 5678, handler, &bytes.Buffer{}); err == nil || !strings.Contains(err.Error(), "404") {
+		t.Errorf("Download() for another account error = %v, want 404", err)
+	}
+}
+
+func TestServer_Faults(t *testing.T) {
+	ctx := context.Background()
+
+	// Two 500 responses are retried and the third attempt succeeds
+	c := newTestClient(t, WithFault(Fault{Status: http.StatusInternalServerError, Endpoint: EndpointExport, Count: 2}))
+	if _, err := c.Export(ctx, 1234); err != nil {
+		t.Errorf("Export() error = %v, want the retries to succeed", err)
+	}
+
+	busy := newTestClient(t, WithFault(Fault{Status: http.StatusForbidden}))
+	if _, err := busy.Export(ctx, 1234); err == nil || !strings.Contains(err.Error(), "currently at work") {
+		t.Errorf("Export() error = %v, want the busy response", err)
+	}
+
+	download := newTestClient(t, WithFault(Fault{Status: http.StatusNotFound, Endpoint: EndpointDownload}))
+	handler, err := download.Export(ctx, 1234)
+	if err != nil {
+		t.Fatalf("Export() error = %v", err)
+	}
+	if _, err := download.Download(ctx, 1234, handler, &bytes.Buffer{}); err == nil || !strings.Contains(err.Error(), "Resource Not Found") {
+		t.Errorf("Download() error = %v, want the injected 404", err)
+	}
+}
+
+func TestServer_Latency(t *testing.T) {
+	c := newTestClient(t, WithLatency(100*time.Millisecond))
+	start := time.Now()
+	if _, err := c.Export(context.Background(), 1234); err != nil {
+		t.Fatalf("Export() error = %v", err)
+	}
+	if elapsed := time.Since(start); elapsed < 100*time.Millisecond {
+		t.Errorf("Export() took %s, want at least the latency", elapsed)
+	}
+}
+
+func TestParseFault(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    Fault
+		wantErr bool
+	}{
+		{input: "500", want: Fault{Status: 500}},
+		{input: "403:export", want: Fault{Status: 403, Endpoint: EndpointExport}},
+		{input: "404:Download:2", want: Fault{Status: 404, Endpoint: EndpointDownload, Count: 2}},
+		{input: "401:any:1", want: Fault{Status: 401, Count: 1}},
+		{input: "418", wantErr: true},
+		{input: "500:status", wantErr: true},
+		{input: "500:export:-1", wantErr: true},
+		{input: "500:export:x", wantErr: true},
+		{input: "500:export:1:2", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got, err := ParseFault(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseFault() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && got != tt.want {
+				t.Errorf("ParseFault() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}